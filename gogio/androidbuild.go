@@ -5,9 +5,17 @@ package main
 import (
 	"archive/zip"
 	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"encoding/pem"
+	"encoding/xml"
 	"errors"
 	"fmt"
+	"image"
+	"image/color"
+	"image/png"
 	"io"
+	"io/fs"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -16,7 +24,9 @@ import (
 	"strings"
 	"text/template"
 
-	"golang.org/x/sync/errgroup"
+	"gioui.org/cmd/svg2gio/svg"
+	"gioui.org/f32"
+	"golang.org/x/image/vector"
 	"golang.org/x/tools/go/packages"
 )
 
@@ -45,29 +55,80 @@ type manifestData struct {
 	MinSDK      int
 	TargetSDK   int
 	Permissions []string
-	Features    []string
+	Features    []androidFeature
 	IconSnip    string
-	AppName     string
+	Application string
+	Activity    string
+	Wear        bool
+	NetConfig   bool
+	Cleartext   bool
+	// Queries are the package names of the apps the app queries.
+	Queries []string
+	// QuerySchemes are the URI schemes of the intents the app queries.
+	QuerySchemes []string
+	// ConfigChanges are the configuration changes handled by the activity
+	// instead of restarting it.
+	ConfigChanges string
+	Debuggable    bool
+	TestOnly      bool
 }
 
-const (
-	themes = `<?xml version="1.0" encoding="utf-8"?>
-<resources>
-	<style name="Theme.GioApp" parent="android:style/Theme.NoTitleBar">
-		<item name="android:windowBackground">@android:color/white</item>
-	</style>
-</resources>`
-	themesV21 = `<?xml version="1.0" encoding="utf-8"?>
+// defaultConfigChanges are the configuration changes Gio handles by itself.
+const defaultConfigChanges = "screenSize|screenLayout|smallestScreenSize|orientation|keyboard|keyboardHidden"
+
+// configChanges are the known android:configChanges values.
+var configChanges = map[string]bool{
+	"colorMode":            true,
+	"density":              true,
+	"fontScale":            true,
+	"fontWeightAdjustment": true,
+	"grammaticalGender":    true,
+	"keyboard":             true,
+	"keyboardHidden":       true,
+	"layoutDirection":      true,
+	"locale":               true,
+	"mcc":                  true,
+	"mnc":                  true,
+	"navigation":           true,
+	"orientation":          true,
+	"screenLayout":         true,
+	"screenSize":           true,
+	"smallestScreenSize":   true,
+	"touchscreen":          true,
+	"uiMode":               true,
+}
+
+// validateConfigChanges checks a '|' separated list of configuration
+// changes.
+func validateConfigChanges(changes string) error {
+	for _, c := range strings.Split(changes, "|") {
+		if !configChanges[c] {
+			return fmt.Errorf("unknown configuration change %q", c)
+		}
+	}
+	return nil
+}
+
+// themesTmpl is the Theme.GioApp style for the API level of a values
+// directory.
+var themesTmpl = template.Must(template.New("themes").Parse(`<?xml version="1.0" encoding="utf-8"?>
 <resources>
 	<style name="Theme.GioApp" parent="android:style/Theme.NoTitleBar">
 		<item name="android:windowBackground">@android:color/white</item>
+{{- if ge .API 21}}
 
 		<item name="android:windowDrawsSystemBarBackgrounds">true</item>
 		<item name="android:navigationBarColor">#40000000</item>
-		<item name="android:statusBarColor">#40000000</item>
+		<item name="android:statusBarColor">{{.StatusBarColor}}</item>
+{{- end}}
+{{- if ge .API 31}}
+		<item name="android:windowSplashScreenBackground">{{.SplashColor}}</item>
+{{- if .SplashIcon}}
+		<item name="android:windowSplashScreenAnimatedIcon">@drawable/splash_icon</item>
+{{- end}}
+{{- end}}
 	</style>
-</resources>`
-)
+</resources>`))
 
 func init() {
 	if runtime.GOOS == "windows" {
@@ -113,7 +174,7 @@ func buildAndroid(tmpDir string, bi *buildInfo) error {
 	if err != nil {
 		return err
 	}
-	var extraJars []string
+	var extraJars, aars []string
 	visitedPkgs := make(map[string]bool)
 	var visitPkg func(*packages.Package) error
 	visitPkg = func(p *packages.Package) error {
@@ -126,6 +187,11 @@ func buildAndroid(tmpDir string, bi *buildInfo) error {
 			return err
 		}
 		extraJars = append(extraJars, jars...)
+		pkgAARs, err := filepath.Glob(filepath.Join(dir, "*.aar"))
+		if err != nil {
+			return err
+		}
+		aars = append(aars, pkgAARs...)
 		switch {
 		case p.PkgPath == "net":
 			perms = append(perms, "network")
@@ -150,11 +216,15 @@ func buildAndroid(tmpDir string, bi *buildInfo) error {
 	}
 	switch *buildMode {
 	case "archive":
-		return archiveAndroid(tmpDir, bi, perms)
+		if err := archiveAndroid(tmpDir, bi, perms); err != nil {
+			return err
+		}
+		addArtifact(outputPath(bi), strings.Join(bi.archs, ","))
+		return nil
 	case "exe":
 		file := *destPath
 		if file == "" {
-			file = fmt.Sprintf("%s.apk", bi.name)
+			file = fmt.Sprintf("%s.apk", androidName(bi.name))
 		}
 
 		isBundle := false
@@ -166,18 +236,71 @@ func buildAndroid(tmpDir string, bi *buildInfo) error {
 			return fmt.Errorf("the specified output %q does not end in '.apk' or '.aab'", file)
 		}
 
-		if err := exeAndroid(tmpDir, tools, bi, extraJars, perms, isBundle); err != nil {
+		deps, err := extractAARs(filepath.Join(tmpDir, "aars"), aars)
+		if err != nil {
+			return err
+		}
+		extraJars = append(extraJars, deps.jars...)
+		if err := exeAndroid(tmpDir, tools, bi, extraJars, perms, deps, isBundle); err != nil {
 			return err
 		}
+		sign := signAPK
 		if isBundle {
-			return signAAB(tmpDir, file, tools, bi)
+			sign = signAAB
+		}
+		if err := sign(tmpDir, file, tools, bi); err != nil {
+			return err
+		}
+		archs := strings.Join(bi.archs, ",")
+		addArtifact(file, archs)
+		if bi.v4Signing && !isBundle {
+			addArtifact(file+".idsig", archs)
+		}
+		if bi.universalAPK && isBundle {
+			apk, err := buildUniversalAPK(tmpDir, file, tools, bi)
+			if err != nil {
+				return err
+			}
+			addArtifact(apk, archs)
+		}
+		if !bi.assetLinks {
+			return nil
 		}
-		return signAPK(tmpDir, file, tools, bi)
+		links := filepath.Join(filepath.Dir(file), "assetlinks.json")
+		if err := writeAssetLinks(bi, links); err != nil {
+			return err
+		}
+		addArtifact(links, "")
+		return nil
 	default:
 		panic("unreachable")
 	}
 }
 
+// androidCompileCmd returns the command that builds the program into the
+// libFile shared library for the goarch architecture, using the clang
+// compiler of the NDK.
+func androidCompileCmd(bi *buildInfo, goarch, clang, libFile string) *exec.Cmd {
+	cmd := exec.Command(
+		"go",
+		"build",
+		"-ldflags="+bi.ldflags,
+		"-buildmode=c-shared",
+		"-tags", bi.tags,
+		"-o", libFile,
+		bi.pkgPath,
+	)
+	cmd.Env = append(
+		os.Environ(),
+		"GOOS=android",
+		"GOARCH="+goarch,
+		"GOARM=7", // Avoid softfloat.
+		"CGO_ENABLED=1",
+	)
+	cmd.Env = append(cmd.Env, cgoEnv(bi, clang, nil, nil)...)
+	return cmd
+}
+
 func compileAndroid(tmpDir string, tools *androidTools, bi *buildInfo) (err error) {
 	androidHome := os.Getenv("ANDROID_SDK_ROOT")
 	if androidHome == "" {
@@ -187,16 +310,19 @@ func compileAndroid(tmpDir string, tools *androidTools, bi *buildInfo) (err erro
 	if err != nil {
 		return fmt.Errorf("could not find javac: %v", err)
 	}
-	ndkRoot, err := findNDK(androidHome)
+	ndkRoot, err := findNDK(androidHome, bi.ndk)
 	if err != nil {
 		return err
 	}
+	if err := checkAndroidSDK(bi, filepath.Dir(tools.androidjar), ndkRoot); err != nil {
+		return err
+	}
 	minSDK := 17
 	if bi.minsdk > minSDK {
 		minSDK = bi.minsdk
 	}
 	tcRoot := filepath.Join(ndkRoot, "toolchains", "llvm", "prebuilt", archNDK())
-	var builds errgroup.Group
+	builds := newBuildGroup(bi.jobs)
 	for _, a := range bi.archs {
 		arch := allArchs[a]
 		clang, err := latestCompiler(tcRoot, a, minSDK)
@@ -217,29 +343,15 @@ func compileAndroid(tmpDir string, tools *androidTools, bi *buildInfo) (err erro
 			return fmt.Errorf("failed to create %q: %v", archDir, err)
 		}
 		libFile := filepath.Join(archDir, "libgio.so")
-		cmd := exec.Command(
-			"go",
-			"build",
-			"-ldflags=-w -s "+bi.ldflags,
-			"-buildmode=c-shared",
-			"-tags", bi.tags,
-			"-o", libFile,
-			bi.pkgPath,
-		)
-		cmd.Env = append(
-			os.Environ(),
-			"GOOS=android",
-			"GOARCH="+a,
-			"GOARM=7", // Avoid softfloat.
-			"CGO_ENABLED=1",
-			"CC="+clang,
-		)
+		cmd := androidCompileCmd(bi, a, clang, libFile)
+		goarch := a
 		builds.Go(func() error {
-			_, err := runCmd(cmd)
+			err := runGoBuild(bi, cmd, libFile)
+			emitBuild(goarch, err)
 			return err
 		})
 	}
-	appDir, err := runCmd(exec.Command("go", "list", "-tags", bi.tags, "-f", "{{.Dir}}", "gioui.org/app/"))
+	appDir, err := runQuery(exec.Command("go", "list", "-tags", bi.tags, "-f", "{{.Dir}}", "gioui.org/app/"))
 	if err != nil {
 		return err
 	}
@@ -275,11 +387,14 @@ func compileAndroid(tmpDir string, tools *androidTools, bi *buildInfo) (err erro
 func archiveAndroid(tmpDir string, bi *buildInfo, perms []string) (err error) {
 	aarFile := *destPath
 	if aarFile == "" {
-		aarFile = fmt.Sprintf("%s.aar", bi.name)
+		aarFile = fmt.Sprintf("%s.aar", androidName(bi.name))
 	}
 	if filepath.Ext(aarFile) != ".aar" {
 		return fmt.Errorf("the specified output %q does not end in '.aar'", aarFile)
 	}
+	if dryRunSkip("writing " + aarFile) {
+		return nil
+	}
 	aar, err := os.Create(aarFile)
 	if err != nil {
 		return err
@@ -292,10 +407,24 @@ func archiveAndroid(tmpDir string, bi *buildInfo, perms []string) (err error) {
 	aarw := newZipWriter(aar)
 	defer aarw.Close()
 	aarw.Create("R.txt")
-	themesXML := aarw.Create("res/values/themes.xml")
-	themesXML.Write([]byte(themes))
-	themesXML21 := aarw.Create("res/values-v21/themes.xml")
-	themesXML21.Write([]byte(themesV21))
+	resDir := filepath.Join(tmpDir, "res")
+	if err := writeAndroidThemes(resDir, bi); err != nil {
+		return err
+	}
+	err = filepath.Walk(resDir, func(path string, f os.FileInfo, err error) error {
+		if err != nil || f.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(resDir, path)
+		if err != nil {
+			return err
+		}
+		aarw.Add(filepath.ToSlash(filepath.Join("res", rel)), path)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
 	permissions, features := getPermissions(perms)
 	// Disable input emulation on ChromeOS.
 	manifest := aarw.Create("AndroidManifest.xml")
@@ -303,13 +432,13 @@ func archiveAndroid(tmpDir string, bi *buildInfo, perms []string) (err error) {
 		AppID:       bi.appID,
 		MinSDK:      bi.minsdk,
 		Permissions: permissions,
-		Features:    features,
+		Features:    mergeFeatures(features, bi.features),
 	}
 	tmpl, err := template.New("manifest").Parse(
 		`<manifest xmlns:android="http://schemas.android.com/apk/res/android" package="{{.AppID}}">
         <uses-sdk android:minSdkVersion="{{.MinSDK}}"/>
 {{range .Permissions}}	<uses-permission android:name="{{.}}"/>
-{{end}}{{range .Features}}	<uses-feature android:{{.}} android:required="false"/>
+{{end}}{{range .Features}}	<uses-feature android:{{.Attr}} android:required="{{.Required}}"/>
 {{end}}</manifest>
 `)
 	if err != nil {
@@ -324,6 +453,26 @@ func archiveAndroid(tmpDir string, bi *buildInfo, perms []string) (err error) {
 		libFile := filepath.Join("jni", arch.jniArch, "libgio.so")
 		aarw.Add(filepath.ToSlash(libFile), filepath.Join(tmpDir, libFile))
 	}
+	for _, d := range [][2]string{{"assets", bi.assetsDir}, {"res", bi.res}} {
+		dir, src := d[0], d[1]
+		if src == "" {
+			continue
+		}
+		err := filepath.Walk(src, func(path string, f os.FileInfo, err error) error {
+			if err != nil || f.IsDir() {
+				return err
+			}
+			rel, err := filepath.Rel(src, path)
+			if err != nil {
+				return err
+			}
+			aarw.Add(filepath.ToSlash(filepath.Join(dir, rel)), path)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
 	classes := filepath.Join(tmpDir, "classes")
 	if _, err := os.Stat(classes); err == nil {
 		jarFile := filepath.Join(tmpDir, "classes.jar")
@@ -335,7 +484,7 @@ func archiveAndroid(tmpDir string, bi *buildInfo, perms []string) (err error) {
 	return aarw.Close()
 }
 
-func exeAndroid(tmpDir string, tools *androidTools, bi *buildInfo, extraJars, perms []string, isBundle bool) (err error) {
+func exeAndroid(tmpDir string, tools *androidTools, bi *buildInfo, extraJars, perms []string, deps *aarDeps, isBundle bool) (err error) {
 	classes := filepath.Join(tmpDir, "classes")
 	var classFiles []string
 	err = filepath.Walk(classes, func(path string, f os.FileInfo, err error) error {
@@ -364,13 +513,38 @@ func exeAndroid(tmpDir string, tools *androidTools, bi *buildInfo, extraJars, pe
 	if minSDK > targetSDK {
 		targetSDK = minSDK
 	}
+	for _, m := range deps.minSDKs {
+		if m.sdk > minSDK {
+			return fmt.Errorf("%s requires minSdkVersion %d, but the app supports %d; use -minsdk %[2]d", m.aar, m.sdk, minSDK)
+		}
+	}
+	// API levels 21 and later support multiple dex files natively.
+	legacyMultidex := bi.multidex && minSDK < 21
+	var mainDexRules string
+	if legacyMultidex {
+		mainDexRules = filepath.Join(tmpDir, "main-dex-rules.pro")
+		rules := keepClassRules(bi) + multidexKeepRules
+		if err := os.WriteFile(mainDexRules, []byte(rules), 0660); err != nil {
+			return err
+		}
+	}
 	if len(classFiles) > 0 {
-		d8 := exec.Command(
-			filepath.Join(tools.buildtools, "d8"),
-			"--lib", tools.androidjar,
-			"--output", dexDir,
-			"--min-api", strconv.Itoa(minSDK),
-		)
+		d8 := d8Cmd(tools, dexDir, minSDK, mainDexRules)
+		if bi.shrink {
+			java, r8jar, err := findR8(tools)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "gogio: R8 not found, building without -shrink: %v\n", err)
+			} else {
+				rules := filepath.Join(tmpDir, "proguard-rules.pro")
+				if err := writeShrinkRules(rules, bi); err != nil {
+					return err
+				}
+				d8 = r8Cmd(java, r8jar, rules, dexDir, minSDK, tools)
+				if mainDexRules != "" {
+					d8.Args = append(d8.Args, "--main-dex-rules", mainDexRules)
+				}
+			}
+		}
 		d8.Args = append(d8.Args, classFiles...)
 		if _, err := runCmd(d8); err != nil {
 			major, minor, ok := determineJDKVersion()
@@ -383,101 +557,87 @@ func exeAndroid(tmpDir string, tools *androidTools, bi *buildInfo, extraJars, pe
 
 	// Compile resources.
 	resDir := filepath.Join(tmpDir, "res")
-	valDir := filepath.Join(resDir, "values")
-	v21Dir := filepath.Join(resDir, "values-v21")
-	v26mipmapDir := filepath.Join(resDir, `mipmap-anydpi-v26`)
-	for _, dir := range []string{valDir, v21Dir, v26mipmapDir} {
-		if err := os.MkdirAll(dir, 0755); err != nil {
-			return err
-		}
-	}
 	iconSnip := ""
 	if _, err := os.Stat(bi.iconPath); err == nil {
-		err := buildIcons(resDir, bi.iconPath, []iconVariant{
-			{path: filepath.Join("mipmap-hdpi", "ic_launcher.png"), size: 72},
-			{path: filepath.Join("mipmap-xhdpi", "ic_launcher.png"), size: 96},
-			{path: filepath.Join("mipmap-xxhdpi", "ic_launcher.png"), size: 144},
-			{path: filepath.Join("mipmap-xxxhdpi", "ic_launcher.png"), size: 192},
-			{path: filepath.Join("mipmap-mdpi", "ic_launcher_adaptive.png"), size: 108},
-			{path: filepath.Join("mipmap-hdpi", "ic_launcher_adaptive.png"), size: 162},
-			{path: filepath.Join("mipmap-xhdpi", "ic_launcher_adaptive.png"), size: 216},
-			{path: filepath.Join("mipmap-xxhdpi", "ic_launcher_adaptive.png"), size: 324},
-			{path: filepath.Join("mipmap-xxxhdpi", "ic_launcher_adaptive.png"), size: 432},
-		})
-		if err != nil {
-			return err
-		}
-		err = os.WriteFile(filepath.Join(v26mipmapDir, `ic_launcher.xml`), []byte(`<?xml version="1.0" encoding="utf-8"?>
-<adaptive-icon xmlns:android="http://schemas.android.com/apk/res/android">
-    <background android:drawable="@mipmap/ic_launcher_adaptive" />
-    <foreground android:drawable="@mipmap/ic_launcher_adaptive" />
-</adaptive-icon>`), 0660)
-		if err != nil {
+		if err := writeAndroidIcons(resDir, bi.iconPath); err != nil {
 			return err
 		}
 		iconSnip = `android:icon="@mipmap/ic_launcher"`
 	}
-	err = os.WriteFile(filepath.Join(valDir, "themes.xml"), []byte(themes), 0660)
-	if err != nil {
+	if err := writeAndroidThemes(resDir, bi); err != nil {
 		return err
 	}
-	err = os.WriteFile(filepath.Join(v21Dir, "themes.xml"), []byte(themesV21), 0660)
+	if err := writeAndroidStrings(resDir, UppercaseName(bi.name)); err != nil {
+		return err
+	}
+	hasNetConfig, err := writeNetworkConfig(resDir, bi)
 	if err != nil {
 		return err
 	}
-	resZip := filepath.Join(tmpDir, "resources.zip")
 	aapt2 := filepath.Join(tools.buildtools, "aapt2")
-	_, err = runCmd(exec.Command(
-		aapt2,
-		"compile",
-		"-o", resZip,
-		"--dir", resDir))
+	resArgs, err := compileAndroidRes(aapt2, tmpDir, resDir, bi)
 	if err != nil {
 		return err
 	}
 
 	// Link APK.
 	permissions, features := getPermissions(perms)
-	appName := UppercaseName(bi.name)
+	permissions, features = deps.mergeManifest(permissions, features)
+	manifestFeatures := mergeFeatures(features, bi.features)
+	if bi.wear {
+		manifestFeatures, err = wearFeatures(manifestFeatures)
+		if err != nil {
+			return err
+		}
+	}
 	manifestSrc := manifestData{
 		AppID:       bi.appID,
 		Version:     bi.version,
 		MinSDK:      minSDK,
 		TargetSDK:   targetSDK,
 		Permissions: permissions,
-		Features:    features,
+		Features:    manifestFeatures,
 		IconSnip:    iconSnip,
-		AppName:     appName,
+		Application: bi.appClass,
+		Activity:    "org.gioui.GioActivity",
+		Wear:        bi.wear,
+		NetConfig:   hasNetConfig,
+		Cleartext:   bi.cleartext,
+		Queries:     bi.queries,
+		// Querying the schemes allows the app to verify and launch
+		// other apps that handle them on Android 11 and later.
+		QuerySchemes:  bi.schemes,
+		ConfigChanges: bi.configChanges,
+		TestOnly:      bi.testOnly,
+	}
+	manifestSrc.Debuggable, err = androidDebuggable(bi)
+	if err != nil {
+		return err
 	}
-	tmpl, err := template.New("test").Parse(
-		`<?xml version="1.0" encoding="utf-8"?>
-<manifest xmlns:android="http://schemas.android.com/apk/res/android"
-	package="{{.AppID}}"
-	android:versionCode="{{.Version.VersionCode}}"
-	android:versionName="{{.Version}}">
-	<uses-sdk android:minSdkVersion="{{.MinSDK}}" android:targetSdkVersion="{{.TargetSDK}}" />
-{{range .Permissions}}	<uses-permission android:name="{{.}}"/>
-{{end}}{{range .Features}}	<uses-feature android:{{.}} android:required="false"/>
-{{end}}	<application {{.IconSnip}} android:label="{{.AppName}}">
-		<activity android:name="org.gioui.GioActivity"
-			android:label="{{.AppName}}"
-			android:theme="@style/Theme.GioApp"
-			android:configChanges="screenSize|screenLayout|smallestScreenSize|orientation|keyboardHidden"
-			android:windowSoftInputMode="adjustResize"
-			android:exported="true">
-			<intent-filter>
-				<action android:name="android.intent.action.MAIN" />
-				<category android:name="android.intent.category.LAUNCHER" />
-			</intent-filter>
-		</activity>
-	</application>
-</manifest>`)
-	var manifestBuffer bytes.Buffer
-	if err := tmpl.Execute(&manifestBuffer, manifestSrc); err != nil {
+	if bi.activityClass != "" {
+		manifestSrc.Activity = bi.activityClass
+	}
+	if legacyMultidex && bi.appClass == "" {
+		manifestSrc.Application = multidexApplication
+	}
+	for _, class := range []string{manifestSrc.Application, bi.activityClass} {
+		if class == "" {
+			continue
+		}
+		found, err := findClass(class, bi.appID, classes, extraJars)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return fmt.Errorf("class %s not found in the package jars", class)
+		}
+	}
+	manifestBuffer, err := androidManifest(manifestSrc)
+	if err != nil {
 		return err
 	}
 	manifest := filepath.Join(tmpDir, "AndroidManifest.xml")
-	if err := os.WriteFile(manifest, manifestBuffer.Bytes(), 0660); err != nil {
+	if err := os.WriteFile(manifest, manifestBuffer, 0660); err != nil {
 		return err
 	}
 
@@ -492,11 +652,20 @@ func exeAndroid(tmpDir string, tools *androidTools, bi *buildInfo, extraJars, pe
 	if isBundle {
 		args = append(args, "--proto-format")
 	}
-	args = append(args, resZip)
+	if bi.assetsDir != "" {
+		args = append(args, "-A", bi.assetsDir)
+	}
+	for _, assets := range deps.assets {
+		args = append(args, "-A", assets)
+	}
+	args = append(args, resArgs...)
 
 	if _, err := runCmd(exec.Command(aapt2, args...)); err != nil {
 		return err
 	}
+	if dryRunSkip("adding the libraries and classes to " + linkAPK) {
+		return nil
+	}
 
 	// The Go standard library archive/zip doesn't support appending to zip
 	// files. Copy files from `link.apk` (generated by aapt2) along with classes.dex and
@@ -576,22 +745,123 @@ func exeAndroid(tmpDir string, tools *androidTools, bi *buildInfo, extraJars, pe
 		if err := appendToZip(filepath.Join("lib", libFile), filepath.Join(tmpDir, "jni", libFile)); err != nil {
 			return err
 		}
+		// Append libraries from AAR dependencies.
+		for _, lib := range deps.libs[arch.jniArch] {
+			if err := appendToZip(filepath.Join("lib", arch.jniArch, filepath.Base(lib)), lib); err != nil {
+				return err
+			}
+		}
 	}
 
-	// Append classes.dex.
+	// Append classes.dex, and classes2.dex and so on for multidex apps.
 	if len(classFiles) > 0 {
-		classesFolder := "classes.dex"
-		if isBundle {
-			classesFolder = "dex/classes.dex"
-		}
-		if err := appendToZip(classesFolder, filepath.Join(dexDir, "classes.dex")); err != nil {
+		dexFiles, err := filepath.Glob(filepath.Join(dexDir, "classes*.dex"))
+		if err != nil {
 			return err
 		}
+		for _, dex := range dexFiles {
+			classesFolder := filepath.Base(dex)
+			if isBundle {
+				classesFolder = "dex/" + classesFolder
+			}
+			if err := appendToZip(classesFolder, dex); err != nil {
+				return err
+			}
+		}
 	}
 
 	return unsignedAPKZip.Close()
 }
 
+// gioKeepRules are the R8 rules that keep the Gio Java classes, which are
+// accessed from native code.
+const gioKeepRules = `-keep class org.gioui.** { *; }
+`
+
+// findR8 returns the java command and the build tools jar that contains
+// the R8 shrinker.
+func findR8(tools *androidTools) (string, string, error) {
+	jar := filepath.Join(tools.buildtools, "lib", "d8.jar")
+	if _, err := os.Stat(jar); err != nil {
+		return "", "", err
+	}
+	javac, err := findJavaC()
+	if err != nil {
+		return "", "", err
+	}
+	return filepath.Join(filepath.Dir(javac), "java"+exeSuffix), jar, nil
+}
+
+// multidexApplication is the Application class of legacy multidex apps
+// without a custom Application class.
+const multidexApplication = "androidx.multidex.MultiDexApplication"
+
+// multidexKeepRules keeps the multidex support library in the main dex
+// file, for loading the other dex files.
+const multidexKeepRules = `-keep class androidx.multidex.** { *; }
+`
+
+// keepClassRules returns the rules that keep the Gio classes and any custom
+// application and activity classes.
+func keepClassRules(bi *buildInfo) string {
+	rules := gioKeepRules
+	for _, class := range []string{bi.appClass, bi.activityClass} {
+		if strings.HasPrefix(class, ".") {
+			class = bi.appID + class
+		}
+		if class != "" {
+			rules += fmt.Sprintf("-keep class %s { *; }\n", class)
+		}
+	}
+	return rules
+}
+
+// d8Cmd returns the d8 command that dexes classes. For legacy multidex,
+// the classes kept by the mainDexRules file are dexed into the main
+// classes.dex file.
+func d8Cmd(tools *androidTools, dexDir string, minSDK int, mainDexRules string) *exec.Cmd {
+	cmd := exec.Command(
+		filepath.Join(tools.buildtools, "d8"),
+		"--lib", tools.androidjar,
+		"--output", dexDir,
+		"--min-api", strconv.Itoa(minSDK),
+	)
+	if mainDexRules != "" {
+		cmd.Args = append(cmd.Args, "--main-dex-rules", mainDexRules)
+	}
+	return cmd
+}
+
+// writeShrinkRules writes the R8 rules that keep the Gio classes and any
+// custom application and activity classes, followed by the rules from the
+// proguard-rules.pro file in the package directory.
+func writeShrinkRules(path string, bi *buildInfo) error {
+	rules := keepClassRules(bi)
+	user, err := os.ReadFile(filepath.Join(bi.pkgDir, "proguard-rules.pro"))
+	switch {
+	case err == nil:
+		rules += string(user)
+	case !errors.Is(err, fs.ErrNotExist):
+		return err
+	}
+	return os.WriteFile(path, []byte(rules), 0660)
+}
+
+// r8Cmd returns the R8 command that shrinks and dexes classes according to
+// the rules file.
+func r8Cmd(java, r8jar, rules, dexDir string, minSDK int, tools *androidTools) *exec.Cmd {
+	return exec.Command(
+		java,
+		"-cp", r8jar,
+		"com.android.tools.r8.R8",
+		"--release",
+		"--lib", tools.androidjar,
+		"--output", dexDir,
+		"--min-api", strconv.Itoa(minSDK),
+		"--pg-conf", rules,
+	)
+}
+
 func determineJDKVersion() (int, int, bool) {
 	path, err := findJavaC()
 	if err != nil {
@@ -608,118 +878,1250 @@ func determineJDKVersion() (int, int, bool) {
 	return major, minor, err == nil
 }
 
-func signAPK(tmpDir string, apkFile string, tools *androidTools, bi *buildInfo) error {
-	if err := zipalign(tools, filepath.Join(tmpDir, "app.zip"), apkFile); err != nil {
-		return err
-	}
+// aarDeps are the merged contents of the AAR dependencies of a program.
+type aarDeps struct {
+	jars []string
+	// assets are the asset directories.
+	assets []string
+	// libs maps ABIs to native libraries.
+	libs        map[string][]string
+	permissions []string
+	features    []string
+	minSDKs     []aarMinSDK
+}
 
-	if bi.key == "" {
-		if err := defaultAndroidKeystore(tmpDir, bi); err != nil {
-			return err
-		}
-	}
+type aarMinSDK struct {
+	aar string
+	sdk int
+}
 
-	_, err := runCmd(exec.Command(
-		filepath.Join(tools.buildtools, "apksigner"),
-		"sign",
-		"--ks-pass", "pass:"+bi.password,
-		"--ks", bi.key,
-		apkFile,
-	))
+// aarManifest is the subset of an AAR AndroidManifest.xml merged into the
+// app manifest.
+type aarManifest struct {
+	UsesSDK struct {
+		MinSDK int `xml:"minSdkVersion,attr"`
+	} `xml:"uses-sdk"`
+	Permissions []struct {
+		Name string `xml:"name,attr"`
+	} `xml:"uses-permission"`
+	Features []struct {
+		Name string `xml:"name,attr"`
+	} `xml:"uses-feature"`
+}
 
-	return err
+// extractAARs extracts the classes, assets and native libraries of the aars
+// into dir, and collects their manifest entries.
+func extractAARs(dir string, aars []string) (*aarDeps, error) {
+	deps := &aarDeps{libs: make(map[string][]string)}
+	for i, aar := range aars {
+		if err := deps.extract(filepath.Join(dir, strconv.Itoa(i)), aar); err != nil {
+			return nil, fmt.Errorf("%s: %v", aar, err)
+		}
+	}
+	return deps, nil
 }
 
-func signAAB(tmpDir string, aabFile string, tools *androidTools, bi *buildInfo) error {
-	allBundleTools, err := filepath.Glob(filepath.Join(tools.buildtools, "bundletool*.jar"))
+func (d *aarDeps) extract(dir, aar string) error {
+	r, err := zip.OpenReader(aar)
 	if err != nil {
 		return err
 	}
-
-	bundletool := ""
-	for _, v := range allBundleTools {
-		bundletool = v
-		break
+	defer r.Close()
+	hasAssets := false
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		if !filepath.IsLocal(f.Name) {
+			return fmt.Errorf("invalid entry %q", f.Name)
+		}
+		dst := filepath.Join(dir, filepath.FromSlash(f.Name))
+		parts := strings.Split(f.Name, "/")
+		switch {
+		case f.Name == "AndroidManifest.xml":
+			if err := d.parseManifest(aar, f); err != nil {
+				return err
+			}
+			continue
+		case f.Name == "classes.jar", parts[0] == "libs" && len(parts) == 2 && filepath.Ext(f.Name) == ".jar":
+			d.jars = append(d.jars, dst)
+		case parts[0] == "assets":
+			hasAssets = true
+		case parts[0] == "jni" && len(parts) == 3 && filepath.Ext(f.Name) == ".so":
+			d.libs[parts[1]] = append(d.libs[parts[1]], dst)
+		default:
+			continue
+		}
+		if err := extractFile(dst, f); err != nil {
+			return err
+		}
 	}
-
-	if bundletool == "" {
-		return fmt.Errorf("bundletool was not found at %s. Download it from https://github.com/google/bundletool/releases and move to the respective folder", tools.buildtools)
+	if hasAssets {
+		d.assets = append(d.assets, filepath.Join(dir, "assets"))
 	}
+	return nil
+}
 
-	_, err = runCmd(exec.Command(
-		"java",
-		"-jar", bundletool,
-		"build-bundle",
-		"--modules="+filepath.Join(tmpDir, "app.zip"),
-		"--output="+filepath.Join(tmpDir, "app.aab"),
-	))
+func (d *aarDeps) parseManifest(aar string, f *zip.File) error {
+	r, err := f.Open()
 	if err != nil {
 		return err
 	}
-
-	if err := zipalign(tools, filepath.Join(tmpDir, "app.aab"), aabFile); err != nil {
-		return err
+	defer r.Close()
+	var m aarManifest
+	if err := xml.NewDecoder(r).Decode(&m); err != nil {
+		return fmt.Errorf("AndroidManifest.xml: %v", err)
 	}
-
-	if bi.key == "" {
-		if err := defaultAndroidKeystore(tmpDir, bi); err != nil {
-			return err
-		}
+	if m.UsesSDK.MinSDK > 0 {
+		d.minSDKs = append(d.minSDKs, aarMinSDK{aar: filepath.Base(aar), sdk: m.UsesSDK.MinSDK})
 	}
-
-	keytoolList, err := runCmd(exec.Command(
-		"keytool",
-		"-keystore", bi.key,
-		"-list",
-		"-keypass", bi.password,
-		"-v",
-	))
-	if err != nil {
-		return err
+	for _, p := range m.Permissions {
+		d.permissions = append(d.permissions, p.Name)
 	}
-
-	var alias string
-	for _, t := range strings.Split(keytoolList, "\n") {
-		if i, _ := fmt.Sscanf(t, "Alias name: %s", &alias); i > 0 {
-			break
+	for _, f := range m.Features {
+		if f.Name != "" {
+			d.features = append(d.features, fmt.Sprintf("name=%q", f.Name))
 		}
 	}
-
-	_, err = runCmd(exec.Command(
-		filepath.Join("jarsigner"),
-		"-sigalg", "SHA256withRSA",
-		"-digestalg", "SHA-256",
-		"-keystore", bi.key,
-		"-storepass", bi.password,
-		aabFile,
-		strings.TrimSpace(alias),
-	))
-
-	return err
+	return nil
 }
 
-func zipalign(tools *androidTools, input, output string) error {
-	_, err := runCmd(exec.Command(
-		filepath.Join(tools.buildtools, "zipalign"),
-		"-f",
-		"4", // 32-bit alignment.
-		input,
-		output,
-	))
-	return err
+// phoneFeatures are the features not available on Wear OS watches.
+var phoneFeatures = map[string]bool{
+	`name="android.hardware.camera"`:                 true,
+	`name="android.hardware.telephony"`:              true,
+	`name="android.hardware.type.pc"`:                true,
+	`name="android.software.leanback"`:               true,
+	`name="android.hardware.touchscreen.multitouch"`: true,
 }
 
-func defaultAndroidKeystore(tmpDir string, bi *buildInfo) error {
-	home, err := os.UserHomeDir()
-	if err != nil {
-		return err
+// wearFeatures returns the features of a Wear OS app, dropping the
+// default PC feature. Other phone-only features are an error.
+func wearFeatures(features []androidFeature) ([]androidFeature, error) {
+	var wear []androidFeature
+	for _, f := range features {
+		if f.Attr == `name="android.hardware.type.pc"` && !f.Required {
+			continue
+		}
+		if phoneFeatures[f.Attr] {
+			return nil, fmt.Errorf("-wear can't be combined with the uses-feature %s", f.Attr)
+		}
+		wear = append(wear, f)
 	}
+	return wear, nil
+}
 
-	// Use debug.keystore, if exists.
-	bi.key = filepath.Join(home, ".android", "debug.keystore")
-	bi.password = "android"
-	if _, err := os.Stat(bi.key); err == nil {
-		return nil
+// androidFeature is a uses-feature manifest entry.
+type androidFeature struct {
+	// Attr is the name or glEsVersion attribute of the feature.
+	Attr     string
+	Required bool
+}
+
+// key returns the attribute that identifies the feature.
+func (f androidFeature) key() string {
+	if k, _, ok := strings.Cut(f.Attr, "="); ok && k != "name" {
+		return k
+	}
+	return f.Attr
+}
+
+// parseAndroidFeatures parses a comma separated list of uses-feature
+// entries in the name[:required] form, where required is true or false
+// and defaults to true. The glEsVersion entry specifies the OpenGL ES
+// version, such as glEsVersion:3.0 or glEsVersion:0x00030000.
+func parseAndroidFeatures(s string) ([]androidFeature, error) {
+	var features []androidFeature
+	for _, entry := range getCommaList(s) {
+		name, req, hasReq := strings.Cut(entry, ":")
+		if name == "glEsVersion" {
+			v, err := parseGLESVersion(req)
+			if err != nil {
+				return nil, fmt.Errorf("invalid feature %q: %v", entry, err)
+			}
+			features = append(features, androidFeature{Attr: fmt.Sprintf("glEsVersion=\"0x%08x\"", v), Required: true})
+			continue
+		}
+		if name == "" || strings.ContainsAny(name, "\"<>& ") {
+			return nil, fmt.Errorf("invalid feature name %q", name)
+		}
+		f := androidFeature{Attr: fmt.Sprintf("name=%q", name), Required: true}
+		if hasReq {
+			r, err := strconv.ParseBool(req)
+			if err != nil {
+				return nil, fmt.Errorf("invalid feature %q: required must be true or false", entry)
+			}
+			f.Required = r
+		}
+		features = append(features, f)
+	}
+	return features, nil
+}
+
+// parseGLESVersion parses an OpenGL ES version in major.minor or in the
+// hexadecimal manifest form.
+func parseGLESVersion(v string) (uint32, error) {
+	if strings.HasPrefix(v, "0x") {
+		n, err := strconv.ParseUint(v[2:], 16, 32)
+		return uint32(n), err
+	}
+	var major, minor uint32
+	if _, err := fmt.Sscanf(v, "%d.%d", &major, &minor); err != nil {
+		return 0, fmt.Errorf("expected major.minor version, got %q", v)
+	}
+	return major<<16 | minor, nil
+}
+
+// mergeFeatures returns the optional default features overridden and
+// extended by the custom features.
+func mergeFeatures(defaults []string, custom []androidFeature) []androidFeature {
+	var features []androidFeature
+	index := make(map[string]int)
+	for _, attr := range defaults {
+		f := androidFeature{Attr: attr}
+		index[f.key()] = len(features)
+		features = append(features, f)
+	}
+	for _, f := range custom {
+		if i, ok := index[f.key()]; ok {
+			features[i] = f
+			continue
+		}
+		index[f.key()] = len(features)
+		features = append(features, f)
+	}
+	return features
+}
+
+// mergeManifest returns the union of the permissions and features with
+// the ones declared by the AAR dependencies.
+func (d *aarDeps) mergeManifest(permissions, features []string) ([]string, []string) {
+	union := func(list, extra []string) []string {
+		seen := make(map[string]bool)
+		for _, x := range list {
+			seen[x] = true
+		}
+		for _, x := range extra {
+			if !seen[x] {
+				list = append(list, x)
+				seen[x] = true
+			}
+		}
+		return list
+	}
+	return union(permissions, d.permissions), union(features, d.features)
+}
+
+func extractFile(dst string, f *zip.File) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	r, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	w, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+var manifestTmpl = template.Must(template.New("manifest").Parse(
+	`<?xml version="1.0" encoding="utf-8"?>
+<manifest xmlns:android="http://schemas.android.com/apk/res/android"
+	package="{{.AppID}}"
+	android:versionCode="{{.Version.VersionCode}}"
+	android:versionName="{{.Version}}">
+	<uses-sdk android:minSdkVersion="{{.MinSDK}}" android:targetSdkVersion="{{.TargetSDK}}" />
+{{range .Permissions}}	<uses-permission android:name="{{.}}"/>
+{{end}}{{range .Features}}	<uses-feature android:{{.Attr}} android:required="{{.Required}}"/>
+{{end}}{{if .Wear}}	<uses-feature android:name="android.hardware.type.watch"/>
+{{end}}{{if or .Queries .QuerySchemes}}	<queries>
+{{range .Queries}}		<package android:name="{{.}}"/>
+{{end}}{{range .QuerySchemes}}		<intent>
+			<action android:name="android.intent.action.VIEW"/>
+			<data android:scheme="{{.}}"/>
+		</intent>
+{{end}}	</queries>
+{{end}}	<application {{.IconSnip}} android:label="@string/app_name"{{with .Application}} android:name="{{.}}"{{end}}
+		{{- if .NetConfig}} android:networkSecurityConfig="@xml/network_security_config"{{end}}
+		{{- if .Cleartext}} android:usesCleartextTraffic="true"{{end}}
+		{{- if .Debuggable}} android:debuggable="true"{{end}}
+		{{- if .TestOnly}} android:testOnly="true"{{end}}>
+{{- if .Wear}}
+		<uses-library android:name="com.google.android.wearable" android:required="false"/>
+		<meta-data android:name="com.google.android.wearable.standalone" android:value="true"/>
+{{- end}}
+		<activity android:name="{{.Activity}}"
+			android:label="@string/app_name"
+			android:theme="@style/Theme.GioApp"
+{{- with .ConfigChanges}}
+			android:configChanges="{{.}}"
+{{- end}}
+			android:windowSoftInputMode="adjustResize"
+			android:exported="true">
+			<intent-filter>
+				<action android:name="android.intent.action.MAIN" />
+				<category android:name="android.intent.category.LAUNCHER" />
+			</intent-filter>
+		</activity>
+	</application>
+</manifest>`))
+
+// androidManifest returns the AndroidManifest.xml of an APK or bundle.
+func androidManifest(data manifestData) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := manifestTmpl.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// findClass reports whether the class is among the compiled classes or
+// in one of the jars. Class names starting with '.' are relative to the
+// app id.
+func findClass(class, appID, classes string, jars []string) (bool, error) {
+	if strings.HasPrefix(class, ".") {
+		class = appID + class
+	}
+	file := strings.ReplaceAll(class, ".", "/") + ".class"
+	if _, err := os.Stat(filepath.Join(classes, filepath.FromSlash(file))); err == nil {
+		return true, nil
+	}
+	for _, jar := range jars {
+		r, err := zip.OpenReader(jar)
+		if err != nil {
+			return false, err
+		}
+		_, err = r.Open(file)
+		r.Close()
+		if err == nil {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// writeAndroidThemes writes the Theme.GioApp styles and the splash screen
+// icon to the resDir resource directory.
+func writeAndroidThemes(resDir string, bi *buildInfo) error {
+	if bi.splashIcon != "" {
+		err := buildIcons(resDir, bi.splashIcon, []iconVariant{
+			{path: filepath.Join("drawable-mdpi", "splash_icon.png"), size: 288},
+			{path: filepath.Join("drawable-hdpi", "splash_icon.png"), size: 432},
+			{path: filepath.Join("drawable-xhdpi", "splash_icon.png"), size: 576},
+			{path: filepath.Join("drawable-xxhdpi", "splash_icon.png"), size: 864},
+			{path: filepath.Join("drawable-xxxhdpi", "splash_icon.png"), size: 1152},
+		})
+		if err != nil {
+			return fmt.Errorf("invalid -splash-icon: %v", err)
+		}
+	}
+	statusBarColor := bi.themeColor
+	if statusBarColor == "" {
+		statusBarColor = "#40000000"
+	}
+	splashColor := bi.splashColor
+	if splashColor == "" {
+		splashColor = iconBackground(bi.iconPath)
+	}
+	for dir, api := range map[string]int{"values": 0, "values-v21": 21, "values-v31": 31} {
+		dir = filepath.Join(resDir, dir)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		var buf bytes.Buffer
+		err := themesTmpl.Execute(&buf, struct {
+			API            int
+			StatusBarColor string
+			SplashColor    string
+			SplashIcon     bool
+		}{api, statusBarColor, splashColor, bi.splashIcon != ""})
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(dir, "themes.xml"), buf.Bytes(), 0660); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeAndroidStrings writes the app_name string resource of the label
+// to resDir. Unlike the manifest, the resource may contain any text.
+func writeAndroidStrings(resDir, label string) error {
+	dir := filepath.Join(resDir, "values")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	buf.WriteString(`<?xml version="1.0" encoding="utf-8"?>
+<resources>
+	<string name="app_name">`)
+	if err := xml.EscapeText(&buf, []byte(androidString(label))); err != nil {
+		return err
+	}
+	buf.WriteString("</string>\n</resources>\n")
+	return os.WriteFile(filepath.Join(dir, "strings.xml"), buf.Bytes(), 0660)
+}
+
+// androidString escapes the characters that are special in Android string
+// resources.
+func androidString(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, `'`, `\'`, `"`, `\"`, "\n", `\n`).Replace(s)
+	if strings.HasPrefix(s, "@") || strings.HasPrefix(s, "?") {
+		// Escape resource references.
+		s = `\` + s
+	}
+	return s
+}
+
+// androidName returns the name of the app without the characters that are
+// invalid in identifiers and file names, such as spaces, for the default
+// output files of Android builds.
+func androidName(name string) string {
+	clean := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-', r == '.':
+			return r
+		}
+		return -1
+	}, name)
+	if clean == "" {
+		return "app"
+	}
+	return clean
+}
+
+// cleartextNetworkConfig is the network security configuration that
+// permits cleartext traffic.
+const cleartextNetworkConfig = `<?xml version="1.0" encoding="utf-8"?>
+<network-security-config>
+	<base-config cleartextTrafficPermitted="true"/>
+</network-security-config>`
+
+// writeNetworkConfig writes the network security configuration from the
+// -network-config file or the -allow-cleartext flag to resDir, and reports
+// whether there is one.
+func writeNetworkConfig(resDir string, bi *buildInfo) (bool, error) {
+	config := []byte(cleartextNetworkConfig)
+	switch {
+	case bi.networkConfig != "":
+		var err error
+		config, err = os.ReadFile(bi.networkConfig)
+		if err != nil {
+			return false, fmt.Errorf("invalid -network-config: %v", err)
+		}
+	case !bi.cleartext:
+		return false, nil
+	}
+	dir := filepath.Join(resDir, "xml")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return false, err
+	}
+	return true, os.WriteFile(filepath.Join(dir, "network_security_config.xml"), config, 0660)
+}
+
+// writeAndroidIcons writes the launcher icon resources of the icon to resDir.
+// An SVG icon becomes a vector drawable for the adaptive icon, and the legacy
+// icons are rasterized from it. If the SVG uses features that have no vector
+// drawable equivalent, the PNG image with the same name next to it is used
+// instead.
+func writeAndroidIcons(resDir, icon string) error {
+	variants := []iconVariant{
+		{path: filepath.Join("mipmap-hdpi", "ic_launcher.png"), size: 72},
+		{path: filepath.Join("mipmap-xhdpi", "ic_launcher.png"), size: 96},
+		{path: filepath.Join("mipmap-xxhdpi", "ic_launcher.png"), size: 144},
+		{path: filepath.Join("mipmap-xxxhdpi", "ic_launcher.png"), size: 192},
+		{path: filepath.Join("mipmap-mdpi", "ic_launcher_adaptive.png"), size: 108},
+		{path: filepath.Join("mipmap-hdpi", "ic_launcher_adaptive.png"), size: 162},
+		{path: filepath.Join("mipmap-xhdpi", "ic_launcher_adaptive.png"), size: 216},
+		{path: filepath.Join("mipmap-xxhdpi", "ic_launcher_adaptive.png"), size: 324},
+		{path: filepath.Join("mipmap-xxxhdpi", "ic_launcher_adaptive.png"), size: 432},
+	}
+	adaptive := "@mipmap/ic_launcher_adaptive"
+	var vector *vectorIcon
+	if filepath.Ext(icon) == ".svg" {
+		v, err := readVectorIcon(icon)
+		if err != nil {
+			raster := strings.TrimSuffix(icon, ".svg") + ".png"
+			if _, serr := os.Stat(raster); serr != nil {
+				return fmt.Errorf("%s: %v, and there is no %s to use instead", icon, err, raster)
+			}
+			warnOnce(fmt.Sprintf("%s: %v; using %s instead", icon, err, raster))
+			icon = raster
+		}
+		vector = v
+	}
+	if vector != nil {
+		dir := filepath.Join(resDir, "drawable")
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(dir, "ic_launcher_adaptive.xml"), vector.drawable(), 0660); err != nil {
+			return err
+		}
+		for _, v := range variants[:4] {
+			if err := writeVectorPNG(filepath.Join(resDir, v.path), vector, v.size); err != nil {
+				return err
+			}
+		}
+		adaptive = "@drawable/ic_launcher_adaptive"
+	} else if err := buildIcons(resDir, icon, variants); err != nil {
+		return err
+	}
+	v26mipmapDir := filepath.Join(resDir, `mipmap-anydpi-v26`)
+	if err := os.MkdirAll(v26mipmapDir, 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(v26mipmapDir, `ic_launcher.xml`), []byte(`<?xml version="1.0" encoding="utf-8"?>
+<adaptive-icon xmlns:android="http://schemas.android.com/apk/res/android">
+    <background android:drawable="`+adaptive+`" />
+    <foreground android:drawable="`+adaptive+`" />
+</adaptive-icon>`), 0660)
+}
+
+// vectorIcon is an SVG icon that can be expressed as an Android vector
+// drawable: filled paths with solid colors.
+type vectorIcon struct {
+	// size is the size of the viewport.
+	size  f32.Point
+	paths []vectorPath
+}
+
+type vectorPath struct {
+	fill color.NRGBA
+	segs []vectorSegment
+}
+
+// vectorSegment is a move ('M'), line ('L') or cubic ('C') segment of a
+// path, in viewport coordinates.
+type vectorSegment struct {
+	op  byte
+	pts []f32.Point
+}
+
+// readVectorIcon reads the SVG image at path, or returns an error
+// describing the first feature that has no vector drawable equivalent.
+func readVectorIcon(path string) (*vectorIcon, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseVectorIcon(f)
+}
+
+func parseVectorIcon(r io.Reader) (*vectorIcon, error) {
+	d := xml.NewDecoder(r)
+	v := new(vectorIcon)
+	var origin f32.Point
+	depth := 0
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch tok := tok.(type) {
+		case xml.EndElement:
+			depth--
+			continue
+		case xml.StartElement:
+			depth++
+			name := tok.Name.Local
+			if depth == 1 && name != "svg" {
+				return nil, errors.New("not an SVG image")
+			}
+			if tok.Name.Space != "" && tok.Name.Space != "http://www.w3.org/2000/svg" {
+				// Editor metadata, such as Inkscape's.
+				if err := d.Skip(); err != nil {
+					return nil, err
+				}
+				depth--
+				continue
+			}
+			attrs := make(map[string]string)
+			for _, a := range tok.Attr {
+				if a.Name.Space == "" && a.Name.Local != "xmlns" && a.Name.Local != "id" && a.Name.Local != "version" {
+					attrs[a.Name.Local] = a.Value
+				}
+			}
+			switch {
+			case name == "svg" && depth == 1:
+				origin, v.size, err = parseVectorViewport(attrs)
+				if err != nil {
+					return nil, err
+				}
+				continue
+			case name == "g":
+				for a := range attrs {
+					return nil, fmt.Errorf("unsupported %s attribute on <g>", a)
+				}
+				continue
+			case name == "path":
+				p, err := parseVectorPath(attrs, origin)
+				if err != nil {
+					return nil, err
+				}
+				if p != nil {
+					v.paths = append(v.paths, *p)
+				}
+			case name == "title" || name == "desc" || name == "metadata" || name == "defs":
+			default:
+				return nil, fmt.Errorf("unsupported <%s> element", name)
+			}
+			if err := d.Skip(); err != nil {
+				return nil, err
+			}
+			depth--
+		}
+	}
+	if len(v.paths) == 0 {
+		return nil, errors.New("no paths")
+	}
+	return v, nil
+}
+
+// parseVectorViewport returns the origin and size of the viewport from the
+// viewBox attribute, or from the width and height attributes if there is no
+// viewBox.
+func parseVectorViewport(attrs map[string]string) (f32.Point, f32.Point, error) {
+	var vals []float32
+	if vb, ok := attrs["viewBox"]; ok {
+		for _, f := range strings.FieldsFunc(vb, func(r rune) bool { return r == ',' || r == ' ' }) {
+			x, err := strconv.ParseFloat(f, 32)
+			if err != nil {
+				return f32.Point{}, f32.Point{}, fmt.Errorf("invalid viewBox %q", vb)
+			}
+			vals = append(vals, float32(x))
+		}
+		if len(vals) != 4 {
+			return f32.Point{}, f32.Point{}, fmt.Errorf("invalid viewBox %q", vb)
+		}
+	} else {
+		vals = []float32{0, 0, 0, 0}
+		for i, a := range []string{"width", "height"} {
+			x, err := strconv.ParseFloat(strings.TrimSuffix(attrs[a], "px"), 32)
+			if err != nil {
+				return f32.Point{}, f32.Point{}, fmt.Errorf("unsupported %s %q without viewBox", a, attrs[a])
+			}
+			vals[2+i] = float32(x)
+		}
+	}
+	if vals[2] <= 0 || vals[3] <= 0 {
+		return f32.Point{}, f32.Point{}, errors.New("empty viewBox")
+	}
+	return f32.Pt(vals[0], vals[1]), f32.Pt(vals[2], vals[3]), nil
+}
+
+// parseVectorPath parses the attributes of a <path> element. It returns nil
+// for paths that are not filled.
+func parseVectorPath(attrs map[string]string, origin f32.Point) (*vectorPath, error) {
+	p := &vectorPath{fill: color.NRGBA{A: 0xff}}
+	for a, val := range attrs {
+		switch a {
+		case "d":
+		case "fill":
+			switch {
+			case val == "none":
+				return nil, nil
+			case strings.HasPrefix(val, "#") && (len(val) == 4 || len(val) == 7):
+				hex := val[1:]
+				if len(hex) == 3 {
+					hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+				}
+				c, err := strconv.ParseUint(hex, 16, 32)
+				if err != nil {
+					return nil, fmt.Errorf("unsupported fill %q", val)
+				}
+				p.fill.R, p.fill.G, p.fill.B = uint8(c>>16), uint8(c>>8), uint8(c)
+			default:
+				return nil, fmt.Errorf("unsupported fill %q", val)
+			}
+		case "fill-rule":
+			if val != "nonzero" {
+				return nil, fmt.Errorf("unsupported fill-rule %q", val)
+			}
+		default:
+			return nil, fmt.Errorf("unsupported %s attribute on <path>", a)
+		}
+	}
+	add := func(op byte, pts ...f32.Point) {
+		for i := range pts {
+			pts[i] = pts[i].Sub(origin)
+		}
+		p.segs = append(p.segs, vectorSegment{op: op, pts: pts})
+	}
+	err := svg.WalkPath(attrs["d"],
+		func(p f32.Point) { add('M', p) },
+		func(p f32.Point) { add('L', p) },
+		func(p0, p1, p2 f32.Point) { add('C', p0, p1, p2) },
+	)
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// pathData returns the path in the android:pathData format.
+func (p *vectorPath) pathData() string {
+	var b strings.Builder
+	for _, s := range p.segs {
+		b.WriteByte(s.op)
+		for i, pt := range s.pts {
+			if i > 0 {
+				b.WriteByte(' ')
+			}
+			b.WriteString(strconv.FormatFloat(float64(pt.X), 'g', -1, 32))
+			b.WriteByte(',')
+			b.WriteString(strconv.FormatFloat(float64(pt.Y), 'g', -1, 32))
+		}
+	}
+	return b.String()
+}
+
+// drawable returns the icon as a vector drawable sized for the full area of
+// an adaptive icon layer.
+func (v *vectorIcon) drawable() []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `<?xml version="1.0" encoding="utf-8"?>
+<vector xmlns:android="http://schemas.android.com/apk/res/android"
+    android:width="108dp"
+    android:height="108dp"
+    android:viewportWidth="%g"
+    android:viewportHeight="%g">
+`, v.size.X, v.size.Y)
+	for _, p := range v.paths {
+		c := p.fill
+		fmt.Fprintf(&b, "    <path android:fillColor=\"#%02X%02X%02X%02X\" android:pathData=\"%s\" />\n", c.A, c.R, c.G, c.B, p.pathData())
+	}
+	b.WriteString("</vector>\n")
+	return b.Bytes()
+}
+
+// rasterize draws the icon into a size×size image.
+func (v *vectorIcon) rasterize(size int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, size, size))
+	scale := f32.Pt(float32(size)/v.size.X, float32(size)/v.size.Y)
+	z := vector.NewRasterizer(size, size)
+	for _, p := range v.paths {
+		z.Reset(size, size)
+		for i, s := range p.segs {
+			pts := make([]f32.Point, len(s.pts))
+			for j, pt := range s.pts {
+				pts[j] = f32.Pt(pt.X*scale.X, pt.Y*scale.Y)
+			}
+			switch s.op {
+			case 'M':
+				if i > 0 {
+					z.ClosePath()
+				}
+				z.MoveTo(pts[0].X, pts[0].Y)
+			case 'L':
+				z.LineTo(pts[0].X, pts[0].Y)
+			case 'C':
+				z.CubeTo(pts[0].X, pts[0].Y, pts[1].X, pts[1].Y, pts[2].X, pts[2].Y)
+			}
+		}
+		z.ClosePath()
+		z.Draw(img, img.Bounds(), image.NewUniform(p.fill), image.Point{})
+	}
+	return img
+}
+
+// writeVectorPNG writes the icon rasterized at size as a PNG image to path.
+func writeVectorPNG(path string, v *vectorIcon, size int) (err error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}()
+	return png.Encode(f, v.rasterize(size))
+}
+
+// iconBackground returns the color of the top left pixel of the icon, or
+// white if the icon is missing or the pixel is not opaque.
+func iconBackground(icon string) string {
+	const white = "#FFFFFF"
+	f, err := os.Open(icon)
+	if err != nil {
+		return white
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return white
+	}
+	b := img.Bounds()
+	c := color.NRGBAModel.Convert(img.At(b.Min.X, b.Min.Y)).(color.NRGBA)
+	if c.A != 0xff {
+		return white
+	}
+	return fmt.Sprintf("#%02X%02X%02X", c.R, c.G, c.B)
+}
+
+// validAndroidColor reports whether c is an Android color resource in the
+// #RRGGBB or #AARRGGBB format.
+func validAndroidColor(c string) bool {
+	if !strings.HasPrefix(c, "#") || (len(c) != 7 && len(c) != 9) {
+		return false
+	}
+	_, err := strconv.ParseUint(c[1:], 16, 32)
+	return err == nil
+}
+
+func signAPK(tmpDir string, apkFile string, tools *androidTools, bi *buildInfo) error {
+	if err := zipalign(tools, filepath.Join(tmpDir, "app.zip"), apkFile); err != nil {
+		return err
+	}
+
+	if bi.key == "" {
+		if err := defaultAndroidKeystore(tmpDir, bi); err != nil {
+			return err
+		}
+	}
+
+	if bi.keyAlias != "" {
+		aliases, err := keystoreAliases(bi)
+		if err != nil {
+			return err
+		}
+		if _, err := selectKeyAlias(bi, aliases); err != nil {
+			return err
+		}
+	}
+
+	if _, err := runCmd(apksignerCmd(tools, bi, apkFile)); err != nil {
+		return err
+	}
+	if dryRunSkip("verifying " + apkFile) {
+		return nil
+	}
+	return verifyAPK(tools, apkFile)
+}
+
+// verifyAPK verifies the signatures of the apk file with apksigner, and
+// reports the signature schemes that verified.
+func verifyAPK(tools *androidTools, apkFile string) error {
+	out, err := runCmd(exec.Command(
+		filepath.Join(tools.buildtools, "apksigner"),
+		"verify", "--verbose",
+		apkFile,
+	))
+	if err != nil {
+		return fmt.Errorf("sign: verify %s: %v", apkFile, err)
+	}
+	schemes := verifiedSchemes(out)
+	if len(schemes) == 0 {
+		return fmt.Errorf("sign: no signature of %s verified:\n%s", apkFile, out)
+	}
+	fmt.Fprintf(os.Stderr, "gogio: %s verified with signature schemes %s\n", apkFile, strings.Join(schemes, ", "))
+	return nil
+}
+
+// verifiedSchemes returns the signature schemes reported as verified by
+// apksigner verify --verbose.
+func verifiedSchemes(out string) []string {
+	var schemes []string
+	for _, line := range strings.Split(out, "\n") {
+		// For example "Verified using v2 scheme (APK Signature Scheme v2): true".
+		rest, ok := strings.CutPrefix(strings.TrimSpace(line), "Verified using ")
+		if !ok || !strings.HasSuffix(rest, ": true") {
+			continue
+		}
+		scheme, _, _ := strings.Cut(rest, " ")
+		schemes = append(schemes, scheme)
+	}
+	return schemes
+}
+
+// apksignerCmd returns the command that signs the apk file with the key of
+// the keystore.
+func apksignerCmd(tools *androidTools, bi *buildInfo, apkFile string) *exec.Cmd {
+	cmd := exec.Command(
+		filepath.Join(tools.buildtools, "apksigner"),
+		"sign",
+		"--ks-pass", "pass:"+bi.password,
+		"--ks", bi.key,
+	)
+	if bi.keyAlias != "" {
+		cmd.Args = append(cmd.Args, "--ks-key-alias", bi.keyAlias)
+	}
+	if bi.keyPassword != "" {
+		cmd.Args = append(cmd.Args, "--key-pass", "pass:"+bi.keyPassword)
+	}
+	if bi.v4Signing {
+		// apksigner writes the signature to apkFile.idsig.
+		cmd.Args = append(cmd.Args, "--v4-signing-enabled", "true")
+	}
+	cmd.Args = append(cmd.Args, apkFile)
+	return cmd
+}
+
+// findBundletool returns the path of the bundletool jar in the build tools.
+func findBundletool(tools *androidTools) (string, error) {
+	allBundleTools, err := filepath.Glob(filepath.Join(tools.buildtools, "bundletool*.jar"))
+	if err != nil {
+		return "", err
+	}
+	if len(allBundleTools) == 0 {
+		return "", fmt.Errorf("bundletool was not found at %s. Download it from https://github.com/google/bundletool/releases and move to the respective folder", tools.buildtools)
+	}
+	return allBundleTools[0], nil
+}
+
+func signAAB(tmpDir string, aabFile string, tools *androidTools, bi *buildInfo) error {
+	bundletool, err := findBundletool(tools)
+	if err != nil {
+		return err
+	}
+
+	_, err = runCmd(exec.Command(
+		"java",
+		"-jar", bundletool,
+		"build-bundle",
+		"--modules="+filepath.Join(tmpDir, "app.zip"),
+		"--output="+filepath.Join(tmpDir, "app.aab"),
+	))
+	if err != nil {
+		return err
+	}
+
+	if err := zipalign(tools, filepath.Join(tmpDir, "app.aab"), aabFile); err != nil {
+		return err
+	}
+
+	if bi.key == "" {
+		if err := defaultAndroidKeystore(tmpDir, bi); err != nil {
+			return err
+		}
+	}
+
+	aliases, err := keystoreAliases(bi)
+	if err != nil {
+		return err
+	}
+	alias, err := selectKeyAlias(bi, aliases)
+	if err != nil {
+		return err
+	}
+
+	_, err = runCmd(jarsignerCmd(bi, aabFile, alias))
+	return err
+}
+
+// jarsignerCmd returns the command that signs the aab file with the key of
+// the keystore named alias.
+func jarsignerCmd(bi *buildInfo, aabFile, alias string) *exec.Cmd {
+	cmd := exec.Command(
+		"jarsigner",
+		"-sigalg", "SHA256withRSA",
+		"-digestalg", "SHA-256",
+		"-keystore", bi.key,
+		"-storepass", bi.password,
+	)
+	if bi.keyPassword != "" {
+		cmd.Args = append(cmd.Args, "-keypass", bi.keyPassword)
+	}
+	cmd.Args = append(cmd.Args, aabFile, alias)
+	return cmd
+}
+
+// buildUniversalAPK writes the universal apk of the signed aab file, which
+// contains the code and resources for all devices, signed with the key of
+// the bundle. It returns the path of the apk.
+func buildUniversalAPK(tmpDir, aabFile string, tools *androidTools, bi *buildInfo) (string, error) {
+	bundletool, err := findBundletool(tools)
+	if err != nil {
+		return "", err
+	}
+	aliases, err := keystoreAliases(bi)
+	if err != nil {
+		return "", err
+	}
+	alias, err := selectKeyAlias(bi, aliases)
+	if err != nil {
+		return "", err
+	}
+	apks := filepath.Join(tmpDir, "universal.apks")
+	if _, err := runCmd(universalAPKCmd(bundletool, bi, aabFile, apks, alias)); err != nil {
+		return "", err
+	}
+	apk := universalAPKPath(aabFile)
+	if dryRunSkip("extracting " + apk) {
+		return apk, nil
+	}
+	if err := extractUniversalAPK(apks, apk); err != nil {
+		return "", fmt.Errorf("%s: %v", apks, err)
+	}
+	fmt.Fprintf(os.Stderr, "gogio: wrote the universal apk %s\n", apk)
+	return apk, nil
+}
+
+// universalAPKCmd returns the bundletool command that writes the apks
+// archive with the universal apk of the aab file, signed with the key of
+// the keystore named alias.
+func universalAPKCmd(bundletool string, bi *buildInfo, aabFile, apks, alias string) *exec.Cmd {
+	cmd := exec.Command(
+		"java",
+		"-jar", bundletool,
+		"build-apks",
+		"--mode=universal",
+		"--overwrite",
+		"--bundle="+aabFile,
+		"--output="+apks,
+		"--ks="+bi.key,
+		"--ks-pass=pass:"+bi.password,
+		"--ks-key-alias="+alias,
+	)
+	if bi.keyPassword != "" {
+		cmd.Args = append(cmd.Args, "--key-pass=pass:"+bi.keyPassword)
+	}
+	return cmd
+}
+
+// universalAPKPath returns the path of the universal apk of the aab file.
+func universalAPKPath(aabFile string) string {
+	return strings.TrimSuffix(aabFile, ".aab") + "-universal.apk"
+}
+
+// extractUniversalAPK extracts the universal.apk of the apks archive
+// written by bundletool to dst.
+func extractUniversalAPK(apks, dst string) (err error) {
+	r, err := zip.OpenReader(apks)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	for _, f := range r.File {
+		if f.Name != "universal.apk" {
+			continue
+		}
+		src, err := f.Open()
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		w, err := os.Create(dst)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if cerr := w.Close(); err == nil {
+				err = cerr
+			}
+		}()
+		_, err = io.Copy(w, src)
+		return err
+	}
+	return errors.New("universal.apk not found")
+}
+
+// keystoreAliases returns the key aliases of the keystore.
+func keystoreAliases(bi *buildInfo) ([]string, error) {
+	if _, err := os.Stat(bi.key); err != nil && dryRunSkip("listing the keys of "+bi.key) {
+		// The keystore is generated by a skipped keytool -genkey command.
+		return []string{debugKeyAlias}, nil
+	}
+	keytoolList, err := runQuery(exec.Command(
+		"keytool",
+		"-keystore", bi.key,
+		"-list",
+		"-storepass", bi.password,
+		"-v",
+	))
+	if err != nil {
+		return nil, err
+	}
+	return parseKeystoreAliases(keytoolList), nil
+}
+
+// parseKeystoreAliases returns the aliases of a verbose keytool listing.
+func parseKeystoreAliases(list string) []string {
+	var aliases []string
+	for _, line := range strings.Split(list, "\n") {
+		if alias, ok := strings.CutPrefix(strings.TrimSpace(line), "Alias name:"); ok {
+			aliases = append(aliases, strings.TrimSpace(alias))
+		}
+	}
+	return aliases
+}
+
+// selectKeyAlias returns the -signalias alias after checking that the
+// keystore contains it, or the first alias of the keystore.
+func selectKeyAlias(bi *buildInfo, aliases []string) (string, error) {
+	if bi.keyAlias == "" {
+		if len(aliases) == 0 {
+			return "", fmt.Errorf("sign: no keys in keystore %s", bi.key)
+		}
+		return aliases[0], nil
+	}
+	for _, a := range aliases {
+		if a == bi.keyAlias {
+			return a, nil
+		}
+	}
+	return "", fmt.Errorf("sign: alias %q not found in keystore %s, which contains %s", bi.keyAlias, bi.key, strings.Join(aliases, ", "))
+}
+
+func zipalign(tools *androidTools, input, output string) error {
+	_, err := runCmd(exec.Command(
+		filepath.Join(tools.buildtools, "zipalign"),
+		"-f",
+		"4", // 32-bit alignment.
+		input,
+		output,
+	))
+	return err
+}
+
+// writeAssetLinks writes the Digital Asset Links file that verifies the
+// Android App Links of the app signed by the keystore.
+func writeAssetLinks(bi *buildInfo, dst string) error {
+	aliases, err := keystoreAliases(bi)
+	if err != nil {
+		return err
+	}
+	alias, err := selectKeyAlias(bi, aliases)
+	if err != nil {
+		return err
+	}
+	if dryRunSkip("writing " + dst) {
+		return nil
+	}
+	cert, err := execCmd(exec.Command(
+		"keytool",
+		"-exportcert", "-rfc",
+		"-keystore", bi.key,
+		"-storepass", bi.password,
+		"-alias", alias,
+	))
+	if err != nil {
+		return err
+	}
+	fingerprint, err := certFingerprint(cert)
+	if err != nil {
+		return err
+	}
+	links, err := assetLinks(bi.appID, fingerprint)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(dst, links, 0644); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "gogio: serve %s at https://<domain>/.well-known/assetlinks.json for every App Links domain\n", dst)
+	return nil
+}
+
+// certFingerprint returns the SHA-256 fingerprint of the PEM encoded
+// certificate, in the colon separated hexadecimal form of keytool.
+func certFingerprint(certPEM []byte) (string, error) {
+	block, _ := pem.Decode(certPEM)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return "", errors.New("no PEM encoded certificate found")
+	}
+	sum := sha256.Sum256(block.Bytes)
+	hexes := make([]string, len(sum))
+	for i, b := range sum {
+		hexes[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(hexes, ":"), nil
+}
+
+// assetLinks returns the assetlinks.json statement that delegates the
+// handling of all URLs of a domain to the app with the package name and
+// certificate fingerprint.
+func assetLinks(pkg, fingerprint string) ([]byte, error) {
+	type target struct {
+		Namespace    string   `json:"namespace"`
+		PackageName  string   `json:"package_name"`
+		Fingerprints []string `json:"sha256_cert_fingerprints"`
+	}
+	statements := []struct {
+		Relation []string `json:"relation"`
+		Target   target   `json:"target"`
+	}{{
+		Relation: []string{"delegate_permission/common.handle_all_urls"},
+		Target: target{
+			Namespace:    "android_app",
+			PackageName:  pkg,
+			Fingerprints: []string{fingerprint},
+		},
+	}}
+	links, err := json.MarshalIndent(statements, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(links, '\n'), nil
+}
+
+// compileAndroidRes compiles the generated resources in resDir and the -res
+// resources with aapt2, and returns the arguments that link them. The -res
+// resources are linked as an overlay, to take precedence over the generated
+// resources.
+func compileAndroidRes(aapt2, tmpDir, resDir string, bi *buildInfo) ([]string, error) {
+	resZip := filepath.Join(tmpDir, "resources.zip")
+	if _, err := runCmd(exec.Command(aapt2, "compile", "-o", resZip, "--dir", resDir)); err != nil {
+		return nil, err
+	}
+	if bi.res == "" {
+		return []string{resZip}, nil
+	}
+	userZip := filepath.Join(tmpDir, "user-resources.zip")
+	if _, err := runCmd(exec.Command(aapt2, "compile", "-o", userZip, "--dir", bi.res)); err != nil {
+		return nil, fmt.Errorf("-res: %v", err)
+	}
+	// Overlays may add resources as well as override them.
+	return []string{"--auto-add-overlay", resZip, "-R", userZip}, nil
+}
+
+// androidDebuggable reports whether the app is debuggable: if -debuggable is
+// set, or for -debug builds signed with the debug keystore. Apps signed with
+// the release keystore of -signkey are never debuggable, nor test only.
+func androidDebuggable(bi *buildInfo) (bool, error) {
+	if bi.key != "" {
+		switch {
+		case bi.debuggable:
+			return false, errors.New("-debuggable can't be set for apps signed with the release keystore of -signkey")
+		case bi.testOnly:
+			return false, errors.New("-test-only can't be set for apps signed with the release keystore of -signkey")
+		}
+		return false, nil
+	}
+	return bi.debuggable || bi.debug, nil
+}
+
+// debugKeyAlias is the alias of the key of generated debug keystores.
+const debugKeyAlias = "android"
+
+func defaultAndroidKeystore(tmpDir string, bi *buildInfo) error {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+
+	// Use debug.keystore, if exists.
+	bi.key = filepath.Join(home, ".android", "debug.keystore")
+	bi.password = "android"
+	if _, err := os.Stat(bi.key); err == nil {
+		return nil
 	}
 
 	// Generate new key.
@@ -733,7 +2135,7 @@ func defaultAndroidKeystore(tmpDir string, bi *buildInfo) error {
 		"-genkey",
 		"-keystore", bi.key,
 		"-storepass", bi.password,
-		"-alias", "android",
+		"-alias", debugKeyAlias,
 		"-keyalg", "RSA", "-keysize", "2048",
 		"-validity", "10000",
 		"-noprompt",
@@ -742,7 +2144,56 @@ func defaultAndroidKeystore(tmpDir string, bi *buildInfo) error {
 	return err
 }
 
-func findNDK(androidHome string) (string, error) {
+// findNDK returns the NDK to build with: the ndk directory if specified by
+// -ndk, the $ANDROID_NDK_HOME directory, or the latest NDK installed in the
+// SDK.
+func findNDK(androidHome, ndk string) (string, error) {
+	source := "-ndk"
+	if ndk == "" {
+		ndk = os.Getenv("ANDROID_NDK_HOME")
+		source = "$ANDROID_NDK_HOME"
+	}
+	if ndk == "" {
+		return detectNDK(androidHome)
+	}
+	err := validateNDK(ndk)
+	if err == nil {
+		return ndk, nil
+	}
+	detected := detectedNDKs(androidHome)
+	if len(detected) == 0 {
+		return "", fmt.Errorf("invalid %s: %v; no other NDK was detected", source, err)
+	}
+	return "", fmt.Errorf("invalid %s: %v; detected NDKs: %s", source, err, strings.Join(detected, ", "))
+}
+
+// validateNDK checks that ndk contains the clang toolchain for the host.
+func validateNDK(ndk string) error {
+	tcRoot := filepath.Join(ndk, "toolchains", "llvm", "prebuilt", archNDK(), "bin")
+	if _, err := os.Stat(tcRoot); err != nil {
+		return fmt.Errorf("%s is not an NDK with a %s toolchain", ndk, archNDK())
+	}
+	return nil
+}
+
+// detectedNDKs returns the valid NDKs installed in the SDK or at
+// $ANDROID_NDK_ROOT.
+func detectedNDKs(androidHome string) []string {
+	ndks, _ := filepath.Glob(filepath.Join(androidHome, "ndk", "*"))
+	ndks = append(ndks, filepath.Join(androidHome, "ndk-bundle"))
+	if root, ok := os.LookupEnv("ANDROID_NDK_ROOT"); ok {
+		ndks = append(ndks, root)
+	}
+	var valid []string
+	for _, ndk := range ndks {
+		if validateNDK(ndk) == nil {
+			valid = append(valid, ndk)
+		}
+	}
+	return valid
+}
+
+func detectNDK(androidHome string) (string, error) {
 	ndks, err := filepath.Glob(filepath.Join(androidHome, "ndk", "*"))
 	if err != nil {
 		return "", err
@@ -869,6 +2320,31 @@ func getPermissions(ps []string) ([]string, []string) {
 	return permissions, features
 }
 
+// checkAndroidSDK returns an error if -minsdk or -targetsdk are outside the
+// API levels supported by the platform and NDK.
+func checkAndroidSDK(bi *buildInfo, platform, ndkRoot string) error {
+	var levels sdkVersions
+	// The platform directory is named android-<level>.
+	if v, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(platform), "android-")); err == nil {
+		levels.max = v
+	}
+	if data, err := os.ReadFile(filepath.Join(ndkRoot, "meta", "platforms.json")); err == nil {
+		var meta struct {
+			Min int `json:"min"`
+		}
+		if err := json.Unmarshal(data, &meta); err != nil {
+			return fmt.Errorf("%s: %v", ndkRoot, err)
+		}
+		levels.min = meta.Min
+	}
+	sdk := fmt.Sprintf("the Android SDK platform %s and NDK %s", filepath.Base(platform), ndkRoot)
+	if err := checkSDKVersion("minsdk", bi.minsdk, sdk, levels); err != nil {
+		return err
+	}
+	// The target level only needs the platform.
+	return checkSDKVersion("targetsdk", bi.targetsdk, sdk, sdkVersions{max: levels.max})
+}
+
 func latestPlatform(sdk string) (string, error) {
 	allPlats, err := filepath.Glob(filepath.Join(sdk, "platforms", "android-*"))
 	if err != nil {
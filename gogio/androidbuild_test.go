@@ -0,0 +1,856 @@
+// SPDX-License-Identifier: Unlicense OR MIT
+
+package main
+
+import (
+	"archive/zip"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"encoding/xml"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAndroidSplash(t *testing.T) {
+	t.Parallel()
+
+	resDir := t.TempDir()
+	bi := &buildInfo{
+		themeColor:  "#FF102030",
+		splashIcon:  writeTestIcon(t, 512),
+		splashColor: "#123456",
+	}
+	if err := writeAndroidThemes(resDir, bi); err != nil {
+		t.Fatal(err)
+	}
+	themes, err := os.ReadFile(filepath.Join(resDir, "values-v31", "themes.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, item := range []string{
+		`<item name="android:statusBarColor">#FF102030</item>`,
+		`<item name="android:windowSplashScreenBackground">#123456</item>`,
+		`<item name="android:windowSplashScreenAnimatedIcon">@drawable/splash_icon</item>`,
+	} {
+		if !strings.Contains(string(themes), item) {
+			t.Errorf("themes.xml is missing %q:\n%s", item, themes)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(resDir, "drawable-xxxhdpi", "splash_icon.png")); err != nil {
+		t.Errorf("missing splash icon: %v", err)
+	}
+	themes, err = os.ReadFile(filepath.Join(resDir, "values", "themes.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(themes), "statusBarColor") || strings.Contains(string(themes), "SplashScreen") {
+		t.Errorf("base themes.xml contains newer attributes:\n%s", themes)
+	}
+}
+
+func TestValidAndroidColor(t *testing.T) {
+	t.Parallel()
+
+	for c, valid := range map[string]bool{
+		"#123456":   true,
+		"#80ABCDEF": true,
+		"123456":    false,
+		"#12345":    false,
+		"#GG0000":   false,
+	} {
+		if got := validAndroidColor(c); got != valid {
+			t.Errorf("validAndroidColor(%q) = %v, expected %v", c, got, valid)
+		}
+	}
+}
+
+func TestAndroidDebuggable(t *testing.T) {
+	t.Parallel()
+
+	bi := &buildInfo{appID: "com.example.app", debuggable: true}
+	debug, err := androidDebuggable(bi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := androidManifest(manifestData{AppID: bi.appID, Activity: ".MainActivity", Debuggable: debug, TestOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, attr := range []string{`android:debuggable="true"`, `android:testOnly="true"`} {
+		if !strings.Contains(string(manifest), attr) {
+			t.Errorf("manifest is missing %q:\n%s", attr, manifest)
+		}
+	}
+	if debug, _ := androidDebuggable(&buildInfo{debug: true}); !debug {
+		t.Error("-debug build with the debug keystore isn't debuggable")
+	}
+	if debug, err := androidDebuggable(&buildInfo{debug: true, key: "release.keystore"}); debug || err != nil {
+		t.Errorf("-debug build with a release keystore is debuggable %v, %v", debug, err)
+	}
+	bi.key = "release.keystore"
+	if _, err := androidDebuggable(bi); err == nil {
+		t.Error("-debuggable was accepted with a release keystore")
+	}
+}
+
+func TestAndroidManifestClasses(t *testing.T) {
+	t.Parallel()
+
+	manifest, err := androidManifest(manifestData{
+		AppID:       "com.example.app",
+		Application: "com.example.app.App",
+		Activity:    ".MainActivity",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, attr := range []string{
+		`<application  android:label="@string/app_name" android:name="com.example.app.App">`,
+		`<activity android:name=".MainActivity"`,
+	} {
+		if !strings.Contains(string(manifest), attr) {
+			t.Errorf("manifest is missing %q:\n%s", attr, manifest)
+		}
+	}
+	for class, valid := range map[string]bool{
+		"com.example.App":       true,
+		".App":                  true,
+		"com.example.Outer$In":  true,
+		"App":                   false,
+		"com.example.":          false,
+		"com.1example.App":      false,
+		"com.example.class.App": false,
+		"com.example-app.App":   false,
+	} {
+		if err := validateJavaClass(class); (err == nil) != valid {
+			t.Errorf("validateJavaClass(%q) = %v, expected valid: %v", class, err, valid)
+		}
+	}
+	jar := filepath.Join(t.TempDir(), "app.jar")
+	f, err := os.Create(jar)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := zip.NewWriter(f)
+	if _, err := w.Create("com/example/app/App.class"); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	for class, exp := range map[string]bool{".App": true, "com.example.app.App": true, ".Missing": false} {
+		found, err := findClass(class, "com.example.app", t.TempDir(), []string{jar})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found != exp {
+			t.Errorf("findClass(%q) = %v, expected %v", class, found, exp)
+		}
+	}
+}
+
+func TestAARDependency(t *testing.T) {
+	t.Parallel()
+
+	aar := filepath.Join(t.TempDir(), "dep.aar")
+	f, err := os.Create(aar)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := zip.NewWriter(f)
+	for name, content := range map[string]string{
+		"AndroidManifest.xml": `<manifest xmlns:android="http://schemas.android.com/apk/res/android" package="com.example.dep">
+	<uses-sdk android:minSdkVersion="21"/>
+	<uses-permission android:name="android.permission.VIBRATE"/>
+	<uses-permission android:name="android.permission.INTERNET"/>
+	<uses-feature android:name="android.hardware.nfc"/>
+</manifest>`,
+		"classes.jar":                 "",
+		"assets/dep/data.txt":         "data",
+		"jni/arm64-v8a/libdep.so":     "",
+		"res/values/values.xml":       "",
+		"jni/arm64-v8a/nested/lib.so": "",
+	} {
+		fw, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	deps, err := extractAARs(t.TempDir(), []string{aar})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deps.jars) != 1 || len(deps.libs["arm64-v8a"]) != 1 || len(deps.assets) != 1 {
+		t.Fatalf("got jars %v, libs %v, assets %v from AAR", deps.jars, deps.libs, deps.assets)
+	}
+	if data, err := os.ReadFile(filepath.Join(deps.assets[0], "dep", "data.txt")); err != nil || string(data) != "data" {
+		t.Errorf("AAR asset is %q (%v), expected \"data\"", data, err)
+	}
+	if len(deps.minSDKs) != 1 || deps.minSDKs[0].sdk != 21 {
+		t.Errorf("got minSdkVersion %v, expected 21", deps.minSDKs)
+	}
+	permissions, features := deps.mergeManifest(getPermissions([]string{"default", "network"}))
+	manifest, err := androidManifest(manifestData{
+		Permissions: permissions,
+		Features:    mergeFeatures(features, nil),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range []string{
+		`<uses-permission android:name="android.permission.VIBRATE"/>`,
+		`<uses-feature android:name="android.hardware.nfc" android:required="false"/>`,
+	} {
+		if !strings.Contains(string(manifest), entry) {
+			t.Errorf("manifest is missing %q:\n%s", entry, manifest)
+		}
+	}
+	if n := strings.Count(string(manifest), "android.permission.INTERNET"); n != 1 {
+		t.Errorf("manifest declares the INTERNET permission %d times", n)
+	}
+}
+
+func TestWearManifest(t *testing.T) {
+	t.Parallel()
+
+	_, defaults := getPermissions([]string{"default"})
+	features, err := wearFeatures(mergeFeatures(defaults, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := androidManifest(manifestData{
+		Features: features,
+		Wear:     true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range []string{
+		`<uses-feature android:name="android.hardware.type.watch"/>`,
+		`<meta-data android:name="com.google.android.wearable.standalone" android:value="true"/>`,
+	} {
+		if !strings.Contains(string(manifest), entry) {
+			t.Errorf("manifest is missing %q:\n%s", entry, manifest)
+		}
+	}
+	if strings.Contains(string(manifest), "android.hardware.type.pc") {
+		t.Errorf("Wear OS manifest declares the PC feature:\n%s", manifest)
+	}
+	_, defaults = getPermissions([]string{"default", "camera"})
+	if _, err := wearFeatures(mergeFeatures(defaults, nil)); err == nil {
+		t.Error("-wear with the camera feature didn't fail")
+	}
+}
+
+func TestAndroidFeatures(t *testing.T) {
+	t.Parallel()
+
+	custom, err := parseAndroidFeatures("android.hardware.camera:false, android.hardware.nfc, glEsVersion:3.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, defaults := getPermissions([]string{"default", "camera"})
+	manifest, err := androidManifest(manifestData{
+		Features: mergeFeatures(defaults, custom),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range []string{
+		`<uses-feature android:name="android.hardware.camera" android:required="false"/>`,
+		`<uses-feature android:name="android.hardware.nfc" android:required="true"/>`,
+		`<uses-feature android:glEsVersion="0x00030001" android:required="true"/>`,
+	} {
+		if !strings.Contains(string(manifest), entry) {
+			t.Errorf("manifest is missing %q:\n%s", entry, manifest)
+		}
+	}
+	if n := strings.Count(string(manifest), "glEsVersion"); n != 1 {
+		t.Errorf("manifest declares glEsVersion %d times:\n%s", n, manifest)
+	}
+	for _, invalid := range []string{"android.hardware.camera:maybe", "glEsVersion:three", `bad"name`} {
+		if _, err := parseAndroidFeatures(invalid); err == nil {
+			t.Errorf("parseAndroidFeatures(%q) didn't fail", invalid)
+		}
+	}
+}
+
+func TestAllowCleartext(t *testing.T) {
+	t.Parallel()
+
+	resDir := t.TempDir()
+	bi := &buildInfo{cleartext: true}
+	ok, err := writeNetworkConfig(resDir, bi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("-allow-cleartext didn't produce a network security configuration")
+	}
+	config, err := os.ReadFile(filepath.Join(resDir, "xml", "network_security_config.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(config), `cleartextTrafficPermitted="true"`) {
+		t.Errorf("network security configuration doesn't permit cleartext:\n%s", config)
+	}
+	manifest, err := androidManifest(manifestData{NetConfig: ok, Cleartext: bi.cleartext})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(manifest), `android:networkSecurityConfig="@xml/network_security_config"`) {
+		t.Errorf("manifest doesn't reference the network security configuration:\n%s", manifest)
+	}
+	if ok, err := writeNetworkConfig(t.TempDir(), &buildInfo{}); ok || err != nil {
+		t.Errorf("got network security configuration (%v) without -allow-cleartext", err)
+	}
+}
+
+func TestShrinkRules(t *testing.T) {
+	t.Parallel()
+
+	pkgDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(pkgDir, "proguard-rules.pro"), []byte("-keep class com.example.Lib\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	bi := &buildInfo{
+		appID:    "com.example.app",
+		pkgDir:   pkgDir,
+		appClass: ".App",
+	}
+	rules := filepath.Join(t.TempDir(), "proguard-rules.pro")
+	if err := writeShrinkRules(rules, bi); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rule := range []string{
+		"-keep class org.gioui.** { *; }",
+		"-keep class com.example.app.App { *; }",
+		"-keep class com.example.Lib",
+	} {
+		if !strings.Contains(string(data), rule) {
+			t.Errorf("rules are missing %q:\n%s", rule, data)
+		}
+	}
+	tools := &androidTools{androidjar: "android.jar"}
+	cmd := r8Cmd("java", "d8.jar", rules, "dex", 21, tools)
+	args := strings.Join(cmd.Args, " ")
+	for _, arg := range []string{"com.android.tools.r8.R8", "--pg-conf " + rules, "--min-api 21"} {
+		if !strings.Contains(args, arg) {
+			t.Errorf("R8 command %q is missing %q", args, arg)
+		}
+	}
+}
+
+func TestSignAlias(t *testing.T) {
+	t.Parallel()
+
+	bi := &buildInfo{
+		key:         "release.keystore",
+		password:    "storepass",
+		keyAlias:    "upload",
+		keyPassword: "keypass",
+	}
+	tools := &androidTools{buildtools: "build-tools"}
+	apksigner := strings.Join(apksignerCmd(tools, bi, "app.apk").Args, " ")
+	for _, exp := range []string{"--ks release.keystore", "--ks-key-alias upload", "--key-pass pass:keypass"} {
+		if !strings.Contains(apksigner, exp) {
+			t.Errorf("apksigner command %q is missing %q", apksigner, exp)
+		}
+	}
+	jarsigner := strings.Join(jarsignerCmd(bi, "app.aab", "upload").Args, " ")
+	if exp := "-storepass storepass -keypass keypass app.aab upload"; !strings.HasSuffix(jarsigner, exp) {
+		t.Errorf("jarsigner command %q doesn't end with %q", jarsigner, exp)
+	}
+
+	const list = `Keystore type: PKCS12
+
+Your keystore contains 2 entries
+
+Alias name: release
+Creation date: Jan 1, 2024
+Entry type: PrivateKeyEntry
+
+Alias name: upload
+Creation date: Jan 2, 2024
+Entry type: PrivateKeyEntry
+`
+	aliases := parseKeystoreAliases(list)
+	if alias, err := selectKeyAlias(bi, aliases); err != nil || alias != "upload" {
+		t.Errorf("selected alias %q, %v, expected upload", alias, err)
+	}
+	bi.keyAlias = "missing"
+	if _, err := selectKeyAlias(bi, aliases); err == nil {
+		t.Error("a missing alias was accepted")
+	}
+	bi.keyAlias = ""
+	if alias, _ := selectKeyAlias(bi, aliases); alias != "release" {
+		t.Errorf("default alias is %q, expected the first key", alias)
+	}
+}
+
+func TestSelectNDK(t *testing.T) {
+	t.Parallel()
+
+	sdk := t.TempDir()
+	ndk := filepath.Join(t.TempDir(), "ndk-r26")
+	bin := filepath.Join(ndk, "toolchains", "llvm", "prebuilt", archNDK(), "bin")
+	if err := os.MkdirAll(bin, 0755); err != nil {
+		t.Fatal(err)
+	}
+	clang := filepath.Join(bin, "aarch64-linux-android21-clang")
+	if err := os.WriteFile(clang, nil, 0755); err != nil {
+		t.Fatal(err)
+	}
+	root, err := findNDK(sdk, ndk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root != ndk {
+		t.Errorf("selected NDK %s, expected %s", root, ndk)
+	}
+	compiler, err := latestCompiler(filepath.Join(root, "toolchains", "llvm", "prebuilt", archNDK()), "arm64", 21)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := androidCompileCmd(&buildInfo{pkgPath: "example.com/app"}, "arm64", compiler, "libgio.so")
+	if env := cmd.Env[len(cmd.Env)-1]; env != "CC="+clang {
+		t.Errorf("build command uses %s, expected the clang of the selected NDK %s", env, clang)
+	}
+	if _, err := findNDK(sdk, t.TempDir()); err == nil {
+		t.Error("a directory without an NDK toolchain was accepted")
+	}
+}
+
+func TestMultidex(t *testing.T) {
+	t.Parallel()
+
+	tools := &androidTools{buildtools: "build-tools", androidjar: "android.jar"}
+	if args := strings.Join(d8Cmd(tools, "apk", 21, "").Args, " "); strings.Contains(args, "--main-dex-rules") {
+		t.Errorf("d8 command %q uses legacy multidex", args)
+	}
+	args := strings.Join(d8Cmd(tools, "apk", 16, "main-dex-rules.pro").Args, " ")
+	if exp := "--min-api 16 --main-dex-rules main-dex-rules.pro"; !strings.Contains(args, exp) {
+		t.Errorf("d8 command %q is missing %q", args, exp)
+	}
+	manifest, err := androidManifest(manifestData{
+		AppID:       "com.example.app",
+		Application: multidexApplication,
+		Activity:    "org.gioui.GioActivity",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := `android:name="androidx.multidex.MultiDexApplication"`; !strings.Contains(string(manifest), exp) {
+		t.Errorf("manifest is missing %q:\n%s", exp, manifest)
+	}
+}
+
+func TestAssetLinks(t *testing.T) {
+	t.Parallel()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "android"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	fingerprint, err := certFingerprint(cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(der)
+	if digest := strings.ReplaceAll(fingerprint, ":", ""); digest != strings.ToUpper(hex.EncodeToString(sum[:])) || len(fingerprint) != len(sum)*3-1 {
+		t.Errorf("fingerprint %s doesn't match the certificate digest %x", fingerprint, sum)
+	}
+	links, err := assetLinks("com.example.app", fingerprint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var statements []struct {
+		Relation []string
+		Target   struct {
+			Namespace    string
+			PackageName  string   `json:"package_name"`
+			Fingerprints []string `json:"sha256_cert_fingerprints"`
+		}
+	}
+	if err := json.Unmarshal(links, &statements); err != nil {
+		t.Fatal(err)
+	}
+	if len(statements) != 1 {
+		t.Fatalf("assetlinks.json has %d statements, expected 1:\n%s", len(statements), links)
+	}
+	target := statements[0].Target
+	if target.Namespace != "android_app" || target.PackageName != "com.example.app" || !reflect.DeepEqual(target.Fingerprints, []string{fingerprint}) {
+		t.Errorf("unexpected assetlinks.json target:\n%s", links)
+	}
+	if _, err := certFingerprint([]byte("not a certificate")); err == nil {
+		t.Error("a missing certificate was accepted")
+	}
+}
+
+func TestSchemeQueries(t *testing.T) {
+	t.Parallel()
+
+	manifest, err := androidManifest(manifestData{
+		AppID:        "com.example.app",
+		Activity:     "org.gioui.GioActivity",
+		Queries:      []string{"com.example.other"},
+		QuerySchemes: []string{"myapp"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	const exp = `	<queries>
+		<package android:name="com.example.other"/>
+		<intent>
+			<action android:name="android.intent.action.VIEW"/>
+			<data android:scheme="myapp"/>
+		</intent>
+	</queries>
+`
+	if !strings.Contains(string(manifest), exp) {
+		t.Errorf("manifest is missing the queries:\n%s", manifest)
+	}
+	if err := xml.Unmarshal(manifest, new(struct{})); err != nil {
+		t.Errorf("invalid manifest: %v\n%s", err, manifest)
+	}
+}
+
+func TestConfigChanges(t *testing.T) {
+	t.Parallel()
+
+	data := manifestData{
+		AppID:         "com.example.app",
+		Activity:      "org.gioui.GioActivity",
+		ConfigChanges: defaultConfigChanges,
+	}
+	manifest, err := androidManifest(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := "\n\t\t\tandroid:configChanges=\"" + defaultConfigChanges + "\"\n"; !strings.Contains(string(manifest), exp) {
+		t.Errorf("manifest is missing the default configuration changes:\n%s", manifest)
+	}
+	data.ConfigChanges = "orientation|uiMode"
+	if err := validateConfigChanges(data.ConfigChanges); err != nil {
+		t.Error(err)
+	}
+	manifest, err = androidManifest(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := `android:configChanges="orientation|uiMode"`; !strings.Contains(string(manifest), exp) {
+		t.Errorf("manifest is missing %q:\n%s", exp, manifest)
+	}
+	if err := validateConfigChanges("orientation|rotation"); err == nil {
+		t.Error("an unknown configuration change was accepted")
+	}
+}
+
+func TestVerifyAPK(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake apksigner requires a shell")
+	}
+	t.Parallel()
+
+	for _, test := range []struct {
+		script string
+		ok     bool
+	}{
+		{"echo 'DOES NOT VERIFY'; echo 'ERROR: APK Signature Scheme v2 signature did not verify' >&2; exit 1", false},
+		{"echo 'Verifies'; echo 'Verified using v1 scheme (JAR signing): false'; echo 'Verified using v2 scheme (APK Signature Scheme v2): true'", true},
+	} {
+		buildtools := t.TempDir()
+		if err := os.WriteFile(filepath.Join(buildtools, "apksigner"), []byte("#!/bin/sh\n"+test.script+"\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		err := verifyAPK(&androidTools{buildtools: buildtools}, "app.apk")
+		if test.ok && err != nil {
+			t.Errorf("verification failed: %v", err)
+		}
+		if !test.ok && err == nil {
+			t.Error("a failed verification didn't abort the build")
+		}
+	}
+	if schemes := verifiedSchemes("Verified using v1 scheme (JAR signing): false\nVerified using v3 scheme (APK Signature Scheme v3): true"); !reflect.DeepEqual(schemes, []string{"v3"}) {
+		t.Errorf("verified schemes are %v, expected [v3]", schemes)
+	}
+	if args := apksignerCmd(&androidTools{}, &buildInfo{v4Signing: true}, "app.apk").Args; !strings.Contains(strings.Join(args, " "), "--v4-signing-enabled true app.apk") {
+		t.Errorf("apksigner command %v doesn't enable v4 signing", args)
+	}
+}
+
+func TestAndroidRes(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake aapt2 requires a shell")
+	}
+	t.Parallel()
+
+	// The fake aapt2 lists the compiled resources in its output.
+	buildtools := t.TempDir()
+	const script = `#!/bin/sh
+while [ $# -gt 0 ]; do
+	case $1 in
+	-o) out=$2; shift;;
+	--dir) dir=$2; shift;;
+	esac
+	shift
+done
+(cd "$dir" && find . -type f | sort) > "$out"
+`
+	aapt2 := filepath.Join(buildtools, "aapt2")
+	if err := os.WriteFile(aapt2, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	tmpDir := t.TempDir()
+	resDir := filepath.Join(tmpDir, "res")
+	res := t.TempDir()
+	for _, f := range []string{filepath.Join(resDir, "values", "strings.xml"), filepath.Join(res, "drawable", "logo.xml")} {
+		if err := os.MkdirAll(filepath.Dir(f), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(f, []byte("<resources/>"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	args, err := compileAndroidRes(aapt2, tmpDir, resDir, &buildInfo{res: res})
+	if err != nil {
+		t.Fatal(err)
+	}
+	userZip := filepath.Join(tmpDir, "user-resources.zip")
+	exp := []string{"--auto-add-overlay", filepath.Join(tmpDir, "resources.zip"), "-R", userZip}
+	if !reflect.DeepEqual(args, exp) {
+		t.Errorf("link arguments are %q, expected %q", args, exp)
+	}
+	compiled, err := os.ReadFile(userZip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(compiled), "./drawable/logo.xml") {
+		t.Errorf("compiled -res resources %q don't contain the drawable", compiled)
+	}
+	if args, _ := compileAndroidRes(aapt2, tmpDir, resDir, &buildInfo{}); len(args) != 1 {
+		t.Errorf("link arguments without -res are %q", args)
+	}
+}
+
+func TestAndroidVectorIcon(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	icon := filepath.Join(dir, "icon.svg")
+	const src = `<svg xmlns="http://www.w3.org/2000/svg" viewBox="-2 -2 24 24">
+	<title>Icon</title>
+	<g><path fill="#f00" d="M0 0H20V20H0Z"/></g>
+	<path d="M5 5c0 5 10 5 10 0z"/>
+</svg>`
+	if err := os.WriteFile(icon, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	resDir := filepath.Join(dir, "res")
+	if err := writeAndroidIcons(resDir, icon); err != nil {
+		t.Fatal(err)
+	}
+	drawable, err := os.ReadFile(filepath.Join(resDir, "drawable", "ic_launcher_adaptive.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, exp := range []string{
+		`android:viewportWidth="24"`,
+		`<path android:fillColor="#FFFF0000" android:pathData="M2,2L22,2L22,22L2,22L2,2" />`,
+		`<path android:fillColor="#FF000000" android:pathData="M7,7C7,12 17,12 17,7L7,7" />`,
+	} {
+		if !strings.Contains(string(drawable), exp) {
+			t.Errorf("vector drawable doesn't contain %s:\n%s", exp, drawable)
+		}
+	}
+	adaptive, err := os.ReadFile(filepath.Join(resDir, "mipmap-anydpi-v26", "ic_launcher.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(adaptive), `android:drawable="@drawable/ic_launcher_adaptive"`) {
+		t.Errorf("adaptive icon doesn't use the vector drawable:\n%s", adaptive)
+	}
+	f, err := os.Open(filepath.Join(resDir, "mipmap-hdpi", "ic_launcher.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy, err := png.Decode(f)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := legacy.Bounds(); b.Dx() != 72 || b.Dy() != 72 {
+		t.Errorf("legacy icon is %v, expected 72x72", b)
+	}
+	if c := color.NRGBAModel.Convert(legacy.At(10, 10)); c != (color.NRGBA{R: 0xff, A: 0xff}) {
+		t.Errorf("rasterized icon is %v inside the square, expected red", c)
+	}
+	if _, _, _, a := legacy.At(2, 2).RGBA(); a != 0 {
+		t.Errorf("rasterized icon is not transparent outside the square")
+	}
+
+	// Arcs have no vector drawable equivalent.
+	arc := filepath.Join(dir, "arc.svg")
+	if err := os.WriteFile(arc, []byte(`<svg viewBox="0 0 10 10"><path d="M0 5a5 5 0 0 1 10 0z"/></svg>`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeAndroidIcons(filepath.Join(dir, "arc"), arc); err == nil {
+		t.Error("unsupported SVG icon without a PNG fallback succeeded")
+	}
+	f, err = os.Create(filepath.Join(dir, "arc.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = png.Encode(f, image.NewNRGBA(image.Rect(0, 0, 432, 432)))
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeAndroidIcons(filepath.Join(dir, "arc"), arc); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "arc", "mipmap-xxxhdpi", "ic_launcher_adaptive.png")); err != nil {
+		t.Errorf("unsupported SVG icon didn't fall back to the PNG: %v", err)
+	}
+}
+
+func TestAndroidSDKRange(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	platform := filepath.Join(dir, "platforms", "android-34")
+	ndk := filepath.Join(dir, "ndk")
+	if err := os.MkdirAll(filepath.Join(ndk, "meta"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(ndk, "meta", "platforms.json"), []byte(`{"min": 21, "max": 34}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		minsdk, targetsdk int
+		err               string
+	}{
+		{minsdk: 0, targetsdk: 0},
+		{minsdk: 24, targetsdk: 34},
+		{minsdk: 35, err: "-minsdk 35 is newer than 34"},
+		{minsdk: 19, err: "-minsdk 19 is older than 21"},
+		{targetsdk: 36, err: "-targetsdk 36 is newer than 34"},
+	} {
+		err := checkAndroidSDK(&buildInfo{minsdk: test.minsdk, targetsdk: test.targetsdk}, platform, ndk)
+		switch {
+		case test.err == "" && err != nil:
+			t.Errorf("-minsdk %d -targetsdk %d: %v", test.minsdk, test.targetsdk, err)
+		case test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)):
+			t.Errorf("-minsdk %d -targetsdk %d: got error %v, expected %q", test.minsdk, test.targetsdk, err, test.err)
+		}
+	}
+}
+
+func TestAndroidLabel(t *testing.T) {
+	t.Parallel()
+
+	bi := &buildInfo{name: "My App's \"Best\"", target: "android"}
+	resDir := t.TempDir()
+	if err := writeAndroidStrings(resDir, UppercaseName(bi.name)); err != nil {
+		t.Fatal(err)
+	}
+	strs, err := os.ReadFile(filepath.Join(resDir, "values", "strings.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := `<string name="app_name">My App\&#39;s \&#34;Best\&#34;</string>`; !strings.Contains(string(strs), exp) {
+		t.Errorf("strings.xml doesn't contain %q:\n%s", exp, strs)
+	}
+	if out := outputPath(bi); out != "MyAppsBest.apk" {
+		t.Errorf("output path is %q, expected MyAppsBest.apk", out)
+	}
+}
+
+func TestUniversalAPK(t *testing.T) {
+	t.Parallel()
+
+	bi := &buildInfo{
+		key:         "release.keystore",
+		password:    "storepass",
+		keyPassword: "keypass",
+	}
+	args := universalAPKCmd("bundletool-all.jar", bi, "out/app.aab", "universal.apks", "upload").Args
+	exp := []string{
+		"java", "-jar", "bundletool-all.jar", "build-apks", "--mode=universal", "--overwrite",
+		"--bundle=out/app.aab", "--output=universal.apks",
+		"--ks=release.keystore", "--ks-pass=pass:storepass", "--ks-key-alias=upload", "--key-pass=pass:keypass",
+	}
+	if !reflect.DeepEqual(args, exp) {
+		t.Errorf("bundletool command is\n%v\nexpected\n%v", args, exp)
+	}
+	if apk := universalAPKPath(filepath.Join("out", "app.aab")); apk != filepath.Join("out", "app-universal.apk") {
+		t.Errorf("universal apk is %s, expected next to the aab", apk)
+	}
+
+	dir := t.TempDir()
+	apks := filepath.Join(dir, "universal.apks")
+	f, err := os.Create(apks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	for name, content := range map[string]string{"toc.pb": "toc", "universal.apk": "apk"} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(w, content)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	apk := universalAPKPath(filepath.Join(dir, "app.aab"))
+	if err := extractUniversalAPK(apks, apk); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(apk); err != nil || string(data) != "apk" {
+		t.Errorf("extracted apk is %q, %v, expected the universal.apk entry", data, err)
+	}
+}
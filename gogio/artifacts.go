@@ -0,0 +1,113 @@
+// SPDX-License-Identifier: Unlicense OR MIT
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// artifact is a build output, as listed in the -manifest-out file.
+type artifact struct {
+	Path   string
+	Size   int64
+	Target string
+	// Arch is the architecture of the artifact, or a comma separated list
+	// of architectures for artifacts that contain several.
+	Arch string `json:",omitempty"`
+	// SHA256 is the hex encoded checksum of the artifact. The checksum of
+	// a directory covers the paths and contents of its files.
+	SHA256 string
+}
+
+var (
+	artifactsMu sync.Mutex
+	// artifacts are the outputs recorded by the build.
+	artifacts []artifact
+)
+
+// addArtifact records an output of the build for arch.
+func addArtifact(path, arch string) {
+	artifactsMu.Lock()
+	defer artifactsMu.Unlock()
+	artifacts = append(artifacts, artifact{Path: path, Arch: arch})
+}
+
+// buildArtifacts returns the recorded outputs of the build, or the output
+// path if the target didn't record any.
+func buildArtifacts(bi *buildInfo) []artifact {
+	artifactsMu.Lock()
+	defer artifactsMu.Unlock()
+	arts := append([]artifact(nil), artifacts...)
+	if len(arts) == 0 {
+		arts = append(arts, artifact{Path: outputPath(bi), Arch: strings.Join(bi.archs, ",")})
+	}
+	for i := range arts {
+		arts[i].Target = bi.target
+	}
+	return arts
+}
+
+// writeArtifactManifest writes the artifacts, with their sizes and
+// checksums, as a JSON array to the file at path.
+func writeArtifactManifest(path string, arts []artifact) error {
+	for i := range arts {
+		size, sum, err := checksum(arts[i].Path)
+		if err != nil {
+			return err
+		}
+		arts[i].Size, arts[i].SHA256 = size, sum
+	}
+	data, err := json.MarshalIndent(arts, "", "\t")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// checksum returns the size and SHA-256 checksum of the file or directory
+// at path.
+func checksum(path string) (int64, string, error) {
+	h := sha256.New()
+	var size int64
+	err := filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if p != path {
+			rel, err := filepath.Rel(path, p)
+			if err != nil {
+				return err
+			}
+			io.WriteString(h, filepath.ToSlash(rel)+"\x00")
+		}
+		if d.Type()&fs.ModeSymlink != 0 {
+			// Bundles such as frameworks link to their current version.
+			dst, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			io.WriteString(h, dst)
+			return nil
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		n, err := io.Copy(h, f)
+		size += n
+		return err
+	})
+	if err != nil {
+		return 0, "", err
+	}
+	return size, hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,84 @@
+// SPDX-License-Identifier: Unlicense OR MIT
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestArtifactManifest(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping windows build in short mode")
+	}
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":  "module example.com/app\n\ngo 1.21\n",
+		"main.go": "package main\n\nfunc main() {}\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	out := t.TempDir()
+	manifest := filepath.Join(out, "artifacts.json")
+	defer func(tgt, dest, mout string) {
+		*target, *destPath, *manifestOut = tgt, dest, mout
+	}(*target, *destPath, *manifestOut)
+	*target, *destPath, *manifestOut = "windows", filepath.Join(out, "app.exe"), manifest
+
+	bi := &buildInfo{
+		name:    "app",
+		pkgPath: ".",
+		pkgDir:  dir,
+		target:  "windows",
+		archs:   []string{"amd64", "arm64"},
+		noCache: true,
+	}
+	if err := runBuild(bi); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var arts []artifact
+	if err := json.Unmarshal(data, &arts); err != nil {
+		t.Fatal(err)
+	}
+	if len(arts) != len(bi.archs) {
+		t.Fatalf("manifest lists %d artifacts, expected %d:\n%s", len(arts), len(bi.archs), data)
+	}
+	for i, arch := range bi.archs {
+		a := arts[i]
+		exe := filepath.Join(out, "app_"+arch+".exe")
+		content, err := os.ReadFile(exe)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sum := sha256.Sum256(content)
+		exp := artifact{
+			Path:   exe,
+			Size:   int64(len(content)),
+			Target: "windows",
+			Arch:   arch,
+			SHA256: hex.EncodeToString(sum[:]),
+		}
+		if a != exp {
+			t.Errorf("artifact %d is %+v, expected %+v", i, a, exp)
+		}
+	}
+}
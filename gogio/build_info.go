@@ -7,8 +7,12 @@ import (
 	"os/exec"
 	"path"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 	"unicode"
 	"unicode/utf8"
 )
@@ -23,6 +27,7 @@ type buildInfo struct {
 	pkgDir         string
 	pkgPath        string
 	iconPath       string
+	assetsDir      string
 	tags           string
 	target         string
 	version        Semver
@@ -31,6 +36,80 @@ type buildInfo struct {
 	notaryAppleID  string
 	notaryPassword string
 	notaryTeamID   string
+	notaryProfile  string
+	schemes        []string
+	debug          bool
+	strip          bool
+	category       string
+	copyright      string
+	themeColor     string
+	splashIcon     string
+	splashColor    string
+	appClass       string
+	activityClass  string
+	wear           bool
+	features       []androidFeature
+	networkConfig  string
+	cleartext      bool
+	shrink         bool
+	deviceCaps     []string
+	domains        []string
+	bgModes        []string
+	altIcons       []string
+	iconShape      string
+	statusBar      string
+	ats            string
+	push           string
+	frameworks     []string
+	exportOptions  string
+	upload         bool
+	apiKey         string
+	apiIssuer      string
+	jobs           int
+	wasmExec       string
+	singleFile     bool
+	title          string
+	keyAlias       string
+	keyPassword    string
+	ndk            string
+	multidex       bool
+	assetLinks     bool
+	queries        []string
+	retries        int
+	urlRole        string
+	usage          []usageDescription
+	keepApp        bool
+	otaURL         string
+	otaIcons       []string
+	noCache        bool
+	console        bool
+	configChanges  string
+	v4Signing      bool
+	resources      string
+	publisher      string
+	company        string
+	product        string
+	description    string
+	outputTmpl     string
+	localNames     []localizedName
+	debuggable     bool
+	testOnly       bool
+	res            string
+	// simulator is the -simulator flag, or nil if unset.
+	simulator *bool
+	timestamp bool
+	minify    bool
+	loader    bool
+	// webConfig is the compact JSON object of -web-config, if any.
+	webConfig    string
+	universalAPK bool
+	// cc, cflags, cgoLdflags, sysroot and targetTriple override the C
+	// toolchain of cgo builds.
+	cc           string
+	cflags       string
+	cgoLdflags   string
+	sysroot      string
+	targetTriple string
 }
 
 type Semver struct {
@@ -44,29 +123,161 @@ func newBuildInfo(pkgPath string) (*buildInfo, error) {
 		return nil, err
 	}
 	appID := getAppID(pkgMetadata)
+	if err := checkCgoFlags(); err != nil {
+		return nil, err
+	}
+	if *target == "js" && *themeColor != "" && !validAndroidColor(*themeColor) {
+		return nil, fmt.Errorf("invalid -theme-color %q: expected #RRGGBB or #AARRGGBB", *themeColor)
+	}
+	if *target == "android" {
+		if err := validateAndroidAppID(appID); err != nil {
+			return nil, err
+		}
+		for _, c := range []struct{ flag, class string }{
+			{"-application-class", *appClass},
+			{"-activity-class", *activityClass},
+		} {
+			if c.class == "" {
+				continue
+			}
+			if err := validateJavaClass(c.class); err != nil {
+				return nil, fmt.Errorf("invalid %s: %v", c.flag, err)
+			}
+		}
+		for _, c := range []struct{ flag, color string }{
+			{"-theme-color", *themeColor},
+			{"-splash-color", *splashColor},
+		} {
+			if c.color != "" && !validAndroidColor(c.color) {
+				return nil, fmt.Errorf("invalid %s %q: expected #RRGGBB or #AARRGGBB", c.flag, c.color)
+			}
+		}
+	}
+	features, err := parseAndroidFeatures(*usesFeatures)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -features: %v", err)
+	}
+	domains := getCommaList(*assocDomains)
+	for _, d := range domains {
+		if err := validateAssociatedDomain(d); err != nil {
+			return nil, fmt.Errorf("invalid -associated-domains: %v", err)
+		}
+	}
+	if *cfgChanges != "" {
+		if err := validateConfigChanges(*cfgChanges); err != nil {
+			return nil, fmt.Errorf("invalid -config-changes: %v", err)
+		}
+	}
+	pkgQueries, err := getListFlag(*queries)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -queries: %v", err)
+	}
+	for _, q := range pkgQueries {
+		if err := validateAndroidAppID(q); err != nil {
+			return nil, fmt.Errorf("invalid -queries: %v", err)
+		}
+	}
+	uriSchemes, err := getListFlag(*schemes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -schemes: %v", err)
+	}
+	fws := getCommaList(*frameworks)
+	for _, fw := range fws {
+		if err := validateFramework(fw); err != nil {
+			return nil, fmt.Errorf("invalid -embed-frameworks: %v", err)
+		}
+	}
+	if *exportOpts != "" {
+		if _, err := os.Stat(*exportOpts); err != nil {
+			return nil, fmt.Errorf("invalid -export-options: %v", err)
+		}
+	}
+	usage, err := getUsageDescriptions(*usageStrings)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -usage: %v", err)
+	}
+	names, err := getLocalizedNames(*localNames)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -localized-names: %v", err)
+	}
+	modes := getCommaList(*bgModes)
+	for _, m := range modes {
+		if !backgroundModes[m] {
+			return nil, fmt.Errorf("invalid -background-modes: unknown mode %q", m)
+		}
+	}
+	alts := getCommaList(*altIcons)
+	seenIcons := map[string]bool{"AppIcon": true}
+	for _, icon := range alts {
+		name := altIconName(icon)
+		if seenIcons[name] {
+			return nil, fmt.Errorf("invalid -alt-icons: duplicate icon name %q", name)
+		}
+		seenIcons[name] = true
+	}
 	appIcon := filepath.Join(pkgMetadata.Dir, "appicon.png")
 	if *iconPath != "" {
 		appIcon = *iconPath
 	}
+	if isIconCatalog(appIcon) {
+		switch *target {
+		case "ios", "tvos", "macos-catalyst", "macos":
+		default:
+			return nil, fmt.Errorf("invalid -icon: asset catalogs are not supported by %s", *target)
+		}
+	}
 	appName := getPkgName(pkgMetadata)
 	if *name != "" {
 		appName = *name
 	}
+	if *assetsDir != "" {
+		if fi, err := os.Stat(*assetsDir); err != nil {
+			return nil, fmt.Errorf("invalid -assets: %v", err)
+		} else if !fi.IsDir() {
+			return nil, fmt.Errorf("invalid -assets: %s is not a directory", *assetsDir)
+		}
+	}
+	if *userRes != "" {
+		if fi, err := os.Stat(*userRes); err != nil {
+			return nil, fmt.Errorf("invalid -res: %v", err)
+		} else if !fi.IsDir() {
+			return nil, fmt.Errorf("invalid -res: %s is not a directory", *userRes)
+		}
+	}
+	config, err := getWebConfig(*webConfig)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -web-config: %v", err)
+	}
+	ats, err := appTransportSecurity(*atsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -ats: %v", err)
+	}
+	if strings.Contains(ats, "NSAllowsArbitraryLoads") {
+		fmt.Fprintln(os.Stderr, "gogio: warning: -ats allows arbitrary loads, which may require a justification in App Store review")
+	}
+	ldflags, err := getLdFlags(appID, pkgMetadata.Dir)
+	if err != nil {
+		return nil, err
+	}
 	ver, err := parseSemver(*version)
 	if err != nil {
 		return nil, err
 	}
+	if *autoVersion || ver.VersionCode == 0 {
+		ver.VersionCode = commitVersionCode(pkgMetadata.Dir, ver.VersionCode)
+	}
 	bi := &buildInfo{
 		appID:          appID,
 		archs:          getArchs(),
-		ldflags:        getLdFlags(appID),
+		ldflags:        ldflags,
 		minsdk:         *minsdk,
 		targetsdk:      *targetsdk,
 		name:           appName,
 		pkgDir:         pkgMetadata.Dir,
 		pkgPath:        pkgPath,
 		iconPath:       appIcon,
-		tags:           *extraTags,
+		assetsDir:      *assetsDir,
+		tags:           buildTags(),
 		target:         *target,
 		version:        ver,
 		key:            *signKey,
@@ -74,7 +285,81 @@ func newBuildInfo(pkgPath string) (*buildInfo, error) {
 		notaryAppleID:  *notaryID,
 		notaryPassword: *notaryPass,
 		notaryTeamID:   *notaryTeamID,
+		notaryProfile:  *notaryProfile,
+		schemes:        uriSchemes,
+		debug:          *debugBuild,
+		strip:          *stripSymbols && !*debugBuild,
+		category:       *category,
+		copyright:      *copyright,
+		themeColor:     *themeColor,
+		splashIcon:     *splashIcon,
+		splashColor:    *splashColor,
+		appClass:       *appClass,
+		activityClass:  *activityClass,
+		wear:           *wearOS,
+		features:       features,
+		networkConfig:  *networkConfig,
+		cleartext:      *cleartext,
+		shrink:         *shrink,
+		deviceCaps:     getCommaList(*deviceCaps),
+		domains:        domains,
+		bgModes:        modes,
+		altIcons:       alts,
+		iconShape:      *iconShape,
+		statusBar:      *statusBar,
+		ats:            ats,
+		push:           *pushEnv,
+		frameworks:     fws,
+		exportOptions:  *exportOpts,
+		upload:         *uploadApp,
+		apiKey:         *apiKey,
+		apiIssuer:      *apiIssuer,
+		jobs:           *jobs,
+		wasmExec:       *wasmExec,
+		singleFile:     *singleFile,
+		title:          *pageTitle,
+		keyAlias:       *signAlias,
+		keyPassword:    *signKeyPass,
+		ndk:            *ndkDir,
+		multidex:       *multidex,
+		assetLinks:     *appLinks,
+		queries:        pkgQueries,
+		retries:        *retries,
+		urlRole:        *urlRole,
+		usage:          usage,
+		keepApp:        *keepApp,
+		otaURL:         *otaURL,
+		otaIcons:       getCommaList(*otaIcons),
+		noCache:        *noCache,
+		console:        *consoleApp,
+		configChanges:  *cfgChanges,
+		v4Signing:      *v4Signing,
+		resources:      *winResources,
+		publisher:      *publisher,
+		company:        *company,
+		product:        *product,
+		description:    *description,
+		outputTmpl:     *outputTmpl,
+		localNames:     names,
+		debuggable:     *debuggable,
+		testOnly:       *testOnly,
+		res:            *userRes,
+		timestamp:      !*noTimestamp,
+		minify:         *minifyWeb && !*debugBuild,
+		loader:         *webLoader,
+		webConfig:      config,
+		universalAPK:   *universalAPK,
+		cc:             *cgoCC,
+		cflags:         *cgoCFlags,
+		cgoLdflags:     *cgoLdflags,
+		sysroot:        *sysroot,
+		targetTriple:   *targetTriple,
 	}
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "simulator" {
+			bi.simulator = simulator
+		}
+	})
 	return bi, nil
 }
 
@@ -100,6 +385,21 @@ func parseSemver(v string) (Semver, error) {
 	return sv, nil
 }
 
+// commitVersionCode returns the number of commits in the git history of
+// dir, which increases with every commit, or fallback if dir is not in a
+// git repository.
+func commitVersionCode(dir string, fallback uint32) uint32 {
+	count, err := gitOutput(dir, "rev-list", "--count", "HEAD")
+	if err != nil {
+		return fallback
+	}
+	n, err := strconv.ParseUint(count, 10, 32)
+	if err != nil || n == 0 {
+		return fallback
+	}
+	return uint32(n)
+}
+
 func getArchs() []string {
 	if *archNames != "" {
 		return strings.Split(*archNames, ",")
@@ -107,12 +407,12 @@ func getArchs() []string {
 	switch *target {
 	case "js":
 		return []string{"wasm"}
-	case "ios", "tvos":
+	case "ios", "tvos", "macos-catalyst":
 		// Only 64-bit support.
 		return []string{"arm64", "amd64"}
 	case "android":
 		return []string{"arm", "arm64", "386", "amd64"}
-	case "windows":
+	case "windows", "linux", "freebsd":
 		goarch := os.Getenv("GOARCH")
 		if goarch == "" {
 			goarch = runtime.GOARCH
@@ -126,24 +426,368 @@ func getArchs() []string {
 	}
 }
 
-func getLdFlags(appID string) string {
+// getCommaList splits a comma separated list, trimming spaces and
+// skipping empty entries.
+func getCommaList(s string) []string {
+	var list []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// getListFlag parses a comma separated list like getCommaList, where an
+// @path entry is replaced by the entries of the file at path. The file
+// lists one or more entries per line, and blank lines and # comments are
+// skipped.
+func getListFlag(s string) ([]string, error) {
+	var list []string
+	for _, v := range getCommaList(s) {
+		path, ok := strings.CutPrefix(v, "@")
+		if !ok {
+			list = append(list, v)
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			line, _, _ = strings.Cut(line, "#")
+			list = append(list, getCommaList(line)...)
+		}
+	}
+	return list, nil
+}
+
+// usageDescription is an Info.plist usage description, such as
+// NSCameraUsageDescription, that explains why the app uses a privacy
+// sensitive API.
+type usageDescription struct {
+	key, text string
+}
+
+// usageKey matches the Info.plist keys of usage descriptions.
+var usageKey = regexp.MustCompile(`^[A-Z][A-Za-z0-9]*UsageDescription$`)
+
+// getUsageDescriptions parses a comma separated list of key=description
+// pairs. Descriptions may contain commas, as long as the text following a
+// comma doesn't start with a key and an equal sign.
+func getUsageDescriptions(s string) ([]usageDescription, error) {
+	var usage []usageDescription
+	for _, v := range strings.Split(s, ",") {
+		key, text, ok := strings.Cut(v, "=")
+		key = strings.TrimSpace(key)
+		if !ok || strings.ContainsAny(key, " \t") {
+			if len(usage) == 0 {
+				if strings.TrimSpace(v) == "" {
+					continue
+				}
+				return nil, fmt.Errorf("%q is not in the key=description form", strings.TrimSpace(v))
+			}
+			// The comma is part of the previous description.
+			usage[len(usage)-1].text += "," + v
+			continue
+		}
+		if !usageKey.MatchString(key) {
+			return nil, fmt.Errorf("%q is not a usage description key, such as NSCameraUsageDescription", key)
+		}
+		usage = append(usage, usageDescription{key: key, text: text})
+	}
+	for i := range usage {
+		usage[i].text = strings.TrimSpace(usage[i].text)
+		if usage[i].text == "" {
+			return nil, fmt.Errorf("empty description for %s", usage[i].key)
+		}
+	}
+	return usage, nil
+}
+
+// localizedName is the display name of an app in a locale, such as fr or
+// pt-BR.
+type localizedName struct {
+	locale, name string
+}
+
+// localeName matches the locale identifiers of .lproj directories.
+var localeName = regexp.MustCompile(`^[a-z]{2,3}([-_][A-Za-z0-9]+)*$`)
+
+// getLocalizedNames parses a comma separated list of locale=name pairs.
+// Like usage descriptions, names may contain commas.
+func getLocalizedNames(s string) ([]localizedName, error) {
+	var names []localizedName
+	for _, v := range strings.Split(s, ",") {
+		locale, name, ok := strings.Cut(v, "=")
+		locale = strings.TrimSpace(locale)
+		if !ok || !localeName.MatchString(locale) {
+			if len(names) == 0 {
+				if strings.TrimSpace(v) == "" {
+					continue
+				}
+				return nil, fmt.Errorf("%q is not in the locale=name form", strings.TrimSpace(v))
+			}
+			// The comma is part of the previous name.
+			names[len(names)-1].name += "," + v
+			continue
+		}
+		for _, n := range names {
+			if n.locale == locale {
+				return nil, fmt.Errorf("duplicate locale %s", locale)
+			}
+		}
+		names = append(names, localizedName{locale: locale, name: name})
+	}
+	for i := range names {
+		names[i].name = strings.TrimSpace(names[i].name)
+		if names[i].name == "" {
+			return nil, fmt.Errorf("empty name for %s", names[i].locale)
+		}
+	}
+	return names, nil
+}
+
+// gitOutput runs git with args in dir and returns its output. Tests replace
+// it to fake the repository state.
+var gitOutput = func(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	return runQuery(cmd)
+}
+
+// buildMetadataFlags returns the linker flags that set the variables named by
+// -buildtimevar and -commitvar to the build time and the short hash of the
+// commit checked out in dir. The commit is omitted if dir is not in a git
+// repository.
+func buildMetadataFlags(dir string) []string {
+	var ldflags []string
+	if v := *buildTimeVar; v != "" {
+		ldflags = append(ldflags, "-X", v+"="+time.Now().UTC().Format(time.RFC3339))
+	}
+	if v := *commitVar; v != "" {
+		if commit, err := gitOutput(dir, "rev-parse", "--short", "HEAD"); err == nil && commit != "" {
+			ldflags = append(ldflags, "-X", v+"="+commit)
+		}
+	}
+	return ldflags
+}
+
+// checkCgoFlags returns an error if the C toolchain flags are set for a
+// target that doesn't use cgo, or if they conflict. -cflags and -ldflags-cgo
+// replace the computed flags, so -sysroot and -target-triple, which adjust
+// them, can't be combined with them.
+func checkCgoFlags() error {
+	overrides := []struct{ name, val string }{
+		{"cc", *cgoCC},
+		{"cflags", *cgoCFlags},
+		{"ldflags-cgo", *cgoLdflags},
+		{"sysroot", *sysroot},
+		{"target-triple", *targetTriple},
+	}
+	for _, o := range overrides {
+		if o.val != "" && (*target == "js" || *target == "windows") {
+			return fmt.Errorf("invalid -%s: %s builds don't use cgo", o.name, *target)
+		}
+	}
+	for _, f := range overrides[1:3] {
+		if f.val == "" {
+			continue
+		}
+		if _, err := splitQuoted(f.val); err != nil {
+			return fmt.Errorf("invalid -%s: %v", f.name, err)
+		}
+		for _, adj := range overrides[3:] {
+			if adj.val != "" {
+				return fmt.Errorf("invalid -%s: -%[1]s and -%s are mutually exclusive; pass the %[1]s in -%[2]s instead", adj.name, f.name)
+			}
+		}
+	}
+	return nil
+}
+
+// cgoEnv returns the CC, CGO_CFLAGS and CGO_LDFLAGS environment variables
+// for a cgo build with the cc compiler and the cflags and ldflags computed
+// for the target, after applying the -cc, -cflags, -ldflags-cgo, -sysroot
+// and -target-triple overrides. Variables without a value are left out, to
+// keep the defaults of the go tool.
+func cgoEnv(bi *buildInfo, cc string, cflags, ldflags []string) []string {
+	if bi.cc != "" {
+		cc = bi.cc
+	}
+	var env []string
+	if cc != "" {
+		env = append(env, "CC="+cc)
+	}
+	if v := cgoFlags(bi, "CGO_CFLAGS", bi.cflags, cflags); v != "" {
+		env = append(env, "CGO_CFLAGS="+v)
+	}
+	if v := cgoFlags(bi, "CGO_LDFLAGS", bi.cgoLdflags, ldflags); v != "" {
+		env = append(env, "CGO_LDFLAGS="+v)
+	}
+	return env
+}
+
+// cgoFlags returns the value of the cgo flags variable: the override if
+// set, or else the computed flags with the -sysroot and -target-triple
+// applied.
+func cgoFlags(bi *buildInfo, variable, override string, flags []string) string {
+	if override != "" {
+		return override
+	}
+	if bi.sysroot == "" && bi.targetTriple == "" {
+		return strings.Join(flags, " ")
+	}
+	if flags == nil {
+		// Adjust the flags the go tool would otherwise use.
+		flags = []string{"-g", "-O2"}
+		if v, ok := os.LookupEnv(variable); ok {
+			flags = strings.Fields(v)
+		}
+	}
+	flags = append([]string(nil), flags...)
+	if bi.targetTriple != "" {
+		flags = setCompilerFlag(flags, "-target", bi.targetTriple)
+	}
+	if bi.sysroot != "" {
+		if i := slices.Index(flags, "-isysroot"); i != -1 && i+1 < len(flags) {
+			flags[i+1] = bi.sysroot
+		} else {
+			flags = append(flags, "--sysroot="+bi.sysroot)
+		}
+	}
+	return strings.Join(flags, " ")
+}
+
+// setCompilerFlag sets the value of the name flag, or adds the flag if
+// flags doesn't contain it.
+func setCompilerFlag(flags []string, name, value string) []string {
+	if i := slices.Index(flags, name); i != -1 && i+1 < len(flags) {
+		flags[i+1] = value
+		return flags
+	}
+	return append(flags, name, value)
+}
+
+// buildTags returns the comma separated build tags of -tags, followed by
+// the -target-tags of the target.
+func buildTags() string {
+	sep := func(r rune) bool { return r == ',' || r == ' ' }
+	tags := strings.FieldsFunc(*extraTags, sep)
+	for _, t := range targetTags[*target] {
+		tags = append(tags, strings.FieldsFunc(t, sep)...)
+	}
+	return strings.Join(tags, ",")
+}
+
+func getLdFlags(appID, pkgDir string) (string, error) {
 	var ldflags []string
-	if extra := *extraLdflags; extra != "" {
-		ldflags = append(ldflags, strings.Split(extra, " ")...)
+	switch *target {
+	case "ios", "tvos", "macos", "macos-catalyst":
+		// Stripped after extracting the dSYM bundle.
+	default:
+		if *stripSymbols && !*debugBuild {
+			ldflags = append(ldflags, "-s", "-w")
+		}
+	}
+	// Build metadata goes before -ldflags to allow them to override it.
+	ldflags = append(ldflags, buildMetadataFlags(pkgDir)...)
+	extra, err := splitQuoted(*extraLdflags)
+	if err != nil {
+		return "", fmt.Errorf("invalid -ldflags: %v", err)
+	}
+	ldflags = append(ldflags, extra...)
+	if *ldflagsFile != "" {
+		content, err := os.ReadFile(*ldflagsFile)
+		if err != nil {
+			return "", fmt.Errorf("invalid -ldflags-file: %v", err)
+		}
+		extra, err := splitQuoted(string(content))
+		if err != nil {
+			return "", fmt.Errorf("invalid -ldflags-file: %s: %v", *ldflagsFile, err)
+		}
+		ldflags = append(ldflags, extra...)
+	}
+	for _, f := range targetLdflags[*target] {
+		extra, err := splitQuoted(f)
+		if err != nil {
+			return "", fmt.Errorf("invalid -target-ldflags: %v", err)
+		}
+		ldflags = append(ldflags, extra...)
 	}
 	// Pass appID along, to be used for logging on platforms like Android.
-	ldflags = append(ldflags, fmt.Sprintf("-X gioui.org/app.ID=%s", appID))
+	ldflags = append(ldflags, "-X", "gioui.org/app.ID="+appID)
 	// Support earlier Gio versions that had a separate app id recorded.
 	// TODO: delete this in the future.
-	ldflags = append(ldflags, fmt.Sprintf("-X gioui.org/app/internal/log.appID=%s", appID))
+	ldflags = append(ldflags, "-X", "gioui.org/app/internal/log.appID="+appID)
 	// Pass along all remaining arguments to the app.
-	if appArgs := flag.Args()[1:]; len(appArgs) > 0 {
-		ldflags = append(ldflags, fmt.Sprintf("-X gioui.org/app.extraArgs=%s", strings.Join(appArgs, "|")))
+	if args := flag.Args(); len(args) > 1 {
+		appArgs := args[1:]
+		ldflags = append(ldflags, "-X", "gioui.org/app.extraArgs="+strings.Join(appArgs, "|"))
 	}
 	if m := *linkMode; m != "" {
 		ldflags = append(ldflags, "-linkmode="+m)
 	}
-	return strings.Join(ldflags, " ")
+	joined, err := joinQuoted(ldflags)
+	if err != nil {
+		return "", fmt.Errorf("invalid -ldflags: %v", err)
+	}
+	return joined, nil
+}
+
+// splitQuoted splits s into fields separated by white space, where single
+// or double quotes group a field that contains white space. It follows the
+// quoting rules of the -ldflags flag of the go command: there are no
+// escapes, and quotes inside a field don't count. A quoted field must be
+// followed by white space; the go command would split 'a'b into a and b.
+func splitQuoted(s string) ([]string, error) {
+	var fields []string
+	for {
+		s = strings.TrimLeft(s, " \t\n\r")
+		if s == "" {
+			return fields, nil
+		}
+		if q := s[0]; q == '"' || q == '\'' {
+			end := strings.IndexByte(s[1:], q)
+			if end == -1 {
+				return nil, fmt.Errorf("unterminated %c string", q)
+			}
+			field := s[:end+2]
+			s = s[end+2:]
+			if s != "" && !strings.ContainsAny(s[:1], " \t\n\r") {
+				return nil, fmt.Errorf("quoted string %s is not followed by white space", field)
+			}
+			fields = append(fields, field[1:len(field)-1])
+			continue
+		}
+		end := strings.IndexAny(s, " \t\n\r")
+		if end == -1 {
+			end = len(s)
+		}
+		fields = append(fields, s[:end])
+		s = s[end:]
+	}
+}
+
+// joinQuoted joins fields into a string that splitQuoted splits back into
+// the fields. Like the go command, it can't represent fields that contain
+// both single and double quotes.
+func joinQuoted(fields []string) (string, error) {
+	quoted := make([]string, len(fields))
+	for i, f := range fields {
+		single, double := strings.ContainsRune(f, '\''), strings.ContainsRune(f, '"')
+		switch {
+		case f != "" && !single && !double && !strings.ContainsAny(f, " \t\n\r"):
+			quoted[i] = f
+		case !single:
+			quoted[i] = "'" + f + "'"
+		case !double:
+			quoted[i] = `"` + f + `"`
+		default:
+			return "", fmt.Errorf("%q contains both single and double quotes and can't be quoted", f)
+		}
+	}
+	return strings.Join(quoted, " "), nil
 }
 
 type packageMetadata struct {
@@ -152,11 +796,14 @@ type packageMetadata struct {
 }
 
 func getPkgMetadata(pkgPath string) (*packageMetadata, error) {
-	pkgImportPath, err := runCmd(exec.Command("go", "list", "-tags", *extraTags, "-f", "{{.ImportPath}}", pkgPath))
+	if isGoFile(pkgPath) {
+		return getFileMetadata(pkgPath)
+	}
+	pkgImportPath, err := runQuery(exec.Command("go", "list", "-tags", buildTags(), "-f", "{{.ImportPath}}", pkgPath))
 	if err != nil {
 		return nil, err
 	}
-	pkgDir, err := runCmd(exec.Command("go", "list", "-tags", *extraTags, "-f", "{{.Dir}}", pkgPath))
+	pkgDir, err := runQuery(exec.Command("go", "list", "-tags", buildTags(), "-f", "{{.Dir}}", pkgPath))
 	if err != nil {
 		return nil, err
 	}
@@ -166,6 +813,51 @@ func getPkgMetadata(pkgPath string) (*packageMetadata, error) {
 	}, nil
 }
 
+// isGoFile reports whether the package argument is a single Go source file.
+func isGoFile(pkgPath string) bool {
+	if !strings.HasSuffix(pkgPath, ".go") {
+		return false
+	}
+	fi, err := os.Stat(pkgPath)
+	return err == nil && !fi.IsDir()
+}
+
+// getFileMetadata returns the metadata of a program in a single Go source
+// file, which go list reports as the command-line-arguments package. Like go
+// build, the program is named after the file, except for main.go files that
+// are named after their directory. The import path is the name in the module
+// of the directory, if any.
+func getFileMetadata(file string) (*packageMetadata, error) {
+	dir, err := filepath.Abs(filepath.Dir(file))
+	if err != nil {
+		return nil, err
+	}
+	name := strings.TrimSuffix(filepath.Base(file), ".go")
+	if name == "main" {
+		name = filepath.Base(dir)
+	}
+	pkgPath := name
+	cmd := exec.Command("go", "list", "-m", "-f", "{{.Path}}")
+	cmd.Dir = dir
+	if mod, err := runQuery(cmd); err == nil && mod != "" && mod != "command-line-arguments" {
+		pkgPath = path.Join(mod, name)
+	}
+	return &packageMetadata{
+		PkgPath: pkgPath,
+		Dir:     dir,
+	}, nil
+}
+
+// pkgOutputDir returns the default output directory of the macOS and
+// Windows builds: the package directory, or the directory of a single Go
+// source file.
+func pkgOutputDir(bi *buildInfo) string {
+	if isGoFile(bi.pkgPath) {
+		return filepath.Dir(bi.pkgPath)
+	}
+	return bi.pkgPath
+}
+
 func getAppID(pkgMetadata *packageMetadata) string {
 	if *appID != "" {
 		return *appID
@@ -190,7 +882,9 @@ func getAppID(pkgMetadata *packageMetadata) string {
 	appid := []rune(pkgDomain + name)
 
 	// a Java-language-style package name may contain upper- and lower-case
-	// letters and underscores with individual parts separated by '.'.
+	// letters, digits and underscores with individual parts separated by
+	// '.'. Digits are replaced as well, so no part starts with one and the
+	// app ids of existing apps stay the same.
 	// https://developer.android.com/guide/topics/manifest/manifest-element
 	for i, c := range appid {
 		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' ||
@@ -198,7 +892,86 @@ func getAppID(pkgMetadata *packageMetadata) string {
 			appid[i] = '_'
 		}
 	}
-	return string(appid)
+	// Parts must be Java identifiers, so they can't be reserved words.
+	parts := strings.Split(string(appid), ".")
+	for i, p := range parts {
+		if javaKeywords[p] {
+			parts[i] = "_" + p
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+// validateAndroidAppID reports whether id is usable as an Android package
+// name.
+func validateAndroidAppID(id string) error {
+	parts := strings.Split(id, ".")
+	if len(parts) < 2 {
+		return fmt.Errorf("invalid app id %q: Android requires at least two '.' separated parts", id)
+	}
+	for _, p := range parts {
+		if p == "" {
+			return fmt.Errorf("invalid app id %q: empty part", id)
+		}
+		if '0' <= p[0] && p[0] <= '9' {
+			return fmt.Errorf("invalid app id %q: part %q starts with a digit", id, p)
+		}
+		if javaKeywords[p] {
+			return fmt.Errorf("invalid app id %q: part %q is a reserved Java keyword", id, p)
+		}
+		for _, c := range p {
+			if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '_') {
+				return fmt.Errorf("invalid app id %q: part %q contains %q", id, p, c)
+			}
+		}
+	}
+	return nil
+}
+
+// validateJavaClass checks that class is a fully qualified Java class name,
+// or a class name relative to the app id starting with '.'.
+func validateJavaClass(class string) error {
+	name := strings.TrimPrefix(class, ".")
+	parts := strings.Split(name, ".")
+	if len(parts) < 2 && name == class {
+		return fmt.Errorf("class name %q is neither fully qualified nor starts with '.'", class)
+	}
+	for _, p := range parts {
+		if p == "" {
+			return fmt.Errorf("class name %q has an empty part", class)
+		}
+		if '0' <= p[0] && p[0] <= '9' {
+			return fmt.Errorf("class name %q: part %q starts with a digit", class, p)
+		}
+		if javaKeywords[p] {
+			return fmt.Errorf("class name %q: part %q is a reserved Java keyword", class, p)
+		}
+		for _, c := range p {
+			if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '_' || c == '$') {
+				return fmt.Errorf("class name %q: part %q contains %q", class, p, c)
+			}
+		}
+	}
+	return nil
+}
+
+// javaKeywords are the reserved words that can't be used as Java package
+// name parts.
+var javaKeywords = map[string]bool{
+	"abstract": true, "assert": true, "boolean": true, "break": true,
+	"byte": true, "case": true, "catch": true, "char": true,
+	"class": true, "const": true, "continue": true, "default": true,
+	"do": true, "double": true, "else": true, "enum": true,
+	"extends": true, "false": true, "final": true, "finally": true,
+	"float": true, "for": true, "goto": true, "if": true,
+	"implements": true, "import": true, "instanceof": true, "int": true,
+	"interface": true, "long": true, "native": true, "new": true,
+	"null": true, "package": true, "private": true, "protected": true,
+	"public": true, "return": true, "short": true, "static": true,
+	"strictfp": true, "super": true, "switch": true, "synchronized": true,
+	"this": true, "throw": true, "throws": true, "transient": true,
+	"true": true, "try": true, "void": true, "volatile": true,
+	"while": true,
 }
 
 func getPkgName(pkgMetadata *packageMetadata) string {
@@ -1,6 +1,13 @@
 package main
 
-import "testing"
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
 
 type expval struct {
 	in, out string
@@ -21,6 +28,12 @@ func TestAppID(t *testing.T) {
 		{"example.com/dir.ext/app", "com.example.app"},
 		{"example.com/dir/app.ext", "com.example.app.ext"},
 		{"example-com.net/dir/app", "net.example_com.app"},
+		{"example.com/app2", "com.example.app_"},
+		{"example.com/2048", "com.example.____"},
+		{"3d.example.com/app", "com.example._d.app"},
+		{"example.com/new", "com.example._new"},
+		{"2048", "localhost.____"},
+		{"int", "localhost._int"},
 	}
 
 	for i, test := range tests {
@@ -30,3 +43,307 @@ func TestAppID(t *testing.T) {
 		}
 	}
 }
+
+func TestValidateAndroidAppID(t *testing.T) {
+	t.Parallel()
+
+	valid := []string{"com.example.app", "com.example._2048", "org.gioui.App_1"}
+	for _, id := range valid {
+		if err := validateAndroidAppID(id); err != nil {
+			t.Errorf("%q: unexpected error: %v", id, err)
+		}
+	}
+	invalid := []string{"example", "com..app", "com.example.2048", "com.example.class", "com.exa-mple"}
+	for _, id := range invalid {
+		if err := validateAndroidAppID(id); err == nil {
+			t.Errorf("%q: expected an error", id)
+		}
+	}
+}
+
+func TestBuildMetadataLdFlags(t *testing.T) {
+	defer func(old func(string, ...string) (string, error)) { gitOutput = old }(gitOutput)
+	gitOutput = func(dir string, args ...string) (string, error) {
+		return "abc1234", nil
+	}
+	ldflags, err := getLdFlags("com.example.app", ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := "-X main.buildCommit=abc1234"; !strings.Contains(ldflags, exp) {
+		t.Errorf("ldflags %q don't contain %q", ldflags, exp)
+	}
+	if exp := "-X main.buildTime="; !strings.Contains(ldflags, exp) {
+		t.Errorf("ldflags %q don't contain %q", ldflags, exp)
+	}
+
+	gitOutput = func(dir string, args ...string) (string, error) {
+		return "", errors.New("not a git repository")
+	}
+	if ldflags, _ := getLdFlags("com.example.app", "."); strings.Contains(ldflags, "buildCommit") {
+		t.Errorf("ldflags %q contain a commit outside a git repository", ldflags)
+	}
+}
+
+func TestCommitVersionCode(t *testing.T) {
+	defer func(old func(string, ...string) (string, error)) { gitOutput = old }(gitOutput)
+	gitOutput = func(dir string, args ...string) (string, error) {
+		if strings.Join(args, " ") != "rev-list --count HEAD" {
+			t.Errorf("unexpected git command %q", args)
+		}
+		return "1234", nil
+	}
+	if code := commitVersionCode(".", 1); code != 1234 {
+		t.Errorf("version code is %d, expected the commit count 1234", code)
+	}
+	gitOutput = func(dir string, args ...string) (string, error) {
+		return "", errors.New("not a git repository")
+	}
+	if code := commitVersionCode(".", 7); code != 7 {
+		t.Errorf("version code is %d outside a git repository, expected 7", code)
+	}
+}
+
+func TestLdFlagsFile(t *testing.T) {
+	defer func(flags, file string) { *extraLdflags, *ldflagsFile = flags, file }(*extraLdflags, *ldflagsFile)
+	file := filepath.Join(t.TempDir(), "ldflags")
+	const content = "-X main.key=secret\n-X 'main.message=hello world'\n"
+	if err := os.WriteFile(file, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	*extraLdflags = "-X main.mode=release"
+	*ldflagsFile = file
+	ldflags, err := getLdFlags("com.example.app", ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	const exp = `-X main.mode=release -X main.key=secret -X 'main.message=hello world'`
+	if !strings.Contains(ldflags, exp) {
+		t.Errorf("ldflags %q don't contain %q", ldflags, exp)
+	}
+	if exp := "-X gioui.org/app.ID=com.example.app"; !strings.Contains(ldflags, exp) {
+		t.Errorf("ldflags %q don't contain %q", ldflags, exp)
+	}
+	if fields, err := splitQuoted(ldflags); err != nil || !slices.Contains(fields, "main.message=hello world") {
+		t.Errorf("ldflags %q split into %q, %v", ldflags, fields, err)
+	}
+	if err := os.WriteFile(file, []byte("-X 'main.message=hello"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := getLdFlags("com.example.app", "."); err == nil {
+		t.Error("an unterminated quote was accepted")
+	}
+}
+
+func TestQuoted(t *testing.T) {
+	t.Parallel()
+	for _, fields := range [][]string{
+		{"-X", "main.message=hello world"},
+		{"-X", `main.message=say "hi"`},
+		{"-X", "main.message=it's here"},
+		{"-X", "main.empty="},
+		{""},
+	} {
+		joined, err := joinQuoted(fields)
+		if err != nil {
+			t.Errorf("joinQuoted(%q): %v", fields, err)
+			continue
+		}
+		if split, err := splitQuoted(joined); err != nil || !slices.Equal(split, fields) {
+			t.Errorf("joinQuoted(%q) = %q, which splits into %q, %v", fields, joined, split, err)
+		}
+	}
+	if joined, err := joinQuoted([]string{`it's "quoted"`}); err == nil {
+		t.Errorf("a field with both quotes was joined into %q", joined)
+	}
+	if fields, err := splitQuoted(`'a'b`); err == nil {
+		t.Errorf("a quoted string followed by a letter was split into %q", fields)
+	}
+	if fields, err := splitQuoted(`"a" 'b'`); err != nil || !slices.Equal(fields, []string{"a", "b"}) {
+		t.Errorf("quoted strings were split into %q, %v", fields, err)
+	}
+}
+
+func TestDebugLdFlags(t *testing.T) {
+	defer func(old bool) { *debugBuild = old }(*debugBuild)
+	*debugBuild = false
+	if ldflags, _ := getLdFlags("com.example.app", "."); !strings.HasPrefix(ldflags, "-s -w ") {
+		t.Errorf("release ldflags %q don't strip symbols", ldflags)
+	}
+	*debugBuild = true
+	if ldflags, _ := getLdFlags("com.example.app", "."); strings.Contains(ldflags, "-s") || strings.Contains(ldflags, "-w") {
+		t.Errorf("debug ldflags %q strip symbols", ldflags)
+	}
+}
+
+func TestSingleFileBuildInfo(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":   "module example.com/tools\n\ngo 1.21\n",
+		"hello.go": "//go:build ignore\n\npackage main\n\nfunc main() {}\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer func(tgt string) { *target = tgt }(*target)
+	*target = "android"
+	file := filepath.Join(dir, "hello.go")
+	bi, err := newBuildInfo(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bi.name != "hello" || bi.appID != "com.example.hello" || bi.pkgDir != dir || bi.pkgPath != file {
+		t.Errorf("got name %q, app id %q, directory %q and package %q, expected hello, com.example.hello, %s and %s",
+			bi.name, bi.appID, bi.pkgDir, bi.pkgPath, dir, file)
+	}
+	bi.target = "windows"
+	if out := outputPath(bi); out != dir {
+		t.Errorf("output path is %q, expected the directory of the file %q", out, dir)
+	}
+}
+
+func TestListFlagFiles(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":      "module example.com/app\n\ngo 1.21\n",
+		"main.go":     "package main\n\nfunc main() {}\n",
+		"schemes.txt": "# URI schemes of the app.\n\ngio\n  gio-dev  # Development builds.\nexample, example-beta\n",
+		"queries.txt": "com.example.other\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	defer func(tgt, s, q string) { *target, *schemes, *queries = tgt, s, q }(*target, *schemes, *queries)
+	*target = "android"
+	*schemes = "inline, @schemes.txt"
+	*queries = "@" + filepath.Join(dir, "queries.txt")
+	bi, err := newBuildInfo(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := []string{"inline", "gio", "gio-dev", "example", "example-beta"}; !slices.Equal(bi.schemes, exp) {
+		t.Errorf("schemes are %q, expected %q", bi.schemes, exp)
+	}
+	if exp := []string{"com.example.other"}; !slices.Equal(bi.queries, exp) {
+		t.Errorf("queries are %q, expected %q", bi.queries, exp)
+	}
+	*schemes = "@missing.txt"
+	if _, err := newBuildInfo("."); err == nil {
+		t.Error("missing -schemes file was accepted")
+	}
+}
+
+func TestCgoOverrides(t *testing.T) {
+	t.Parallel()
+
+	bi := &buildInfo{cc: "/opt/cross/bin/cc", cflags: "-O0 -DCUSTOM"}
+	cmd := androidCompileCmd(bi, "arm64", "/ndk/clang", "libgio.so")
+	env := cmd.Env[len(cmd.Env)-2:]
+	exp := []string{"CC=/opt/cross/bin/cc", "CGO_CFLAGS=-O0 -DCUSTOM"}
+	if !slices.Equal(env, exp) {
+		t.Errorf("build environment ends with %q, expected %q", env, exp)
+	}
+
+	bi = &buildInfo{sysroot: "/sdk", targetTriple: "arm64-apple-ios15.0"}
+	cflags := []string{"-arch", "arm64", "-isysroot", "/xcode/sdk"}
+	env = cgoEnv(bi, "clang", cflags, append([]string{"-lresolv"}, cflags...))
+	exp = []string{
+		"CC=clang",
+		"CGO_CFLAGS=-arch arm64 -isysroot /sdk -target arm64-apple-ios15.0",
+		"CGO_LDFLAGS=-lresolv -arch arm64 -isysroot /sdk -target arm64-apple-ios15.0",
+	}
+	if !slices.Equal(env, exp) {
+		t.Errorf("cgo environment is %q, expected %q", env, exp)
+	}
+	if cflags[3] != "/xcode/sdk" {
+		t.Error("cgoEnv modified the computed flags")
+	}
+	if env := cgoEnv(&buildInfo{}, "", nil, nil); len(env) != 0 {
+		t.Errorf("cgo environment without overrides is %q", env)
+	}
+}
+
+func TestCheckCgoFlags(t *testing.T) {
+	defer func(tgt, cc, cflags, sr string) {
+		*target, *cgoCC, *cgoCFlags, *sysroot = tgt, cc, cflags, sr
+	}(*target, *cgoCC, *cgoCFlags, *sysroot)
+
+	tests := []struct {
+		target, cc, cflags, sysroot string
+		err                         string
+	}{
+		{target: "android", cc: "cc", cflags: "-O0"},
+		{target: "linux", sysroot: "/sysroot"},
+		{target: "ios", cflags: "-O0", sysroot: "/sdk", err: "mutually exclusive"},
+		{target: "android", cflags: `"-DX`, err: "invalid -cflags"},
+		{target: "js", cc: "cc", err: "don't use cgo"},
+	}
+	for _, test := range tests {
+		*target, *cgoCC, *cgoCFlags, *sysroot = test.target, test.cc, test.cflags, test.sysroot
+		err := checkCgoFlags()
+		switch {
+		case test.err == "" && err != nil:
+			t.Errorf("%+v: %v", test, err)
+		case test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)):
+			t.Errorf("%+v: got error %v, expected %q", test, err, test.err)
+		}
+	}
+}
+
+func TestTargetTags(t *testing.T) {
+	defer func(tgt, tags, flags string) {
+		*target, *extraTags, *extraLdflags = tgt, tags, flags
+		clear(targetTags)
+		clear(targetLdflags)
+	}(*target, *extraTags, *extraLdflags)
+	*extraTags, *extraLdflags = "nowayland", "-X main.mode=base"
+	if err := targetTags.Set("ios,android=mobile"); err != nil {
+		t.Fatal(err)
+	}
+	if err := targetLdflags.Set("android=-X main.mode=android"); err != nil {
+		t.Fatal(err)
+	}
+	if err := targetTags.Set("ios,phone=mobile"); err == nil {
+		t.Error("unknown target accepted")
+	}
+
+	tests := []struct {
+		target, tags, mode string
+	}{
+		{"android", "nowayland,mobile", "main.mode=android"},
+		{"linux", "nowayland", "main.mode=base"},
+	}
+	for _, test := range tests {
+		*target = test.target
+		cmd := androidCompileCmd(&buildInfo{tags: buildTags()}, "arm64", "clang", "libgio.so")
+		if i := slices.Index(cmd.Args, "-tags"); i == -1 || cmd.Args[i+1] != test.tags {
+			t.Errorf("%s: go build arguments %q, expected -tags %s", test.target, cmd.Args, test.tags)
+		}
+		ldflags, err := getLdFlags("com.example.app", ".")
+		if err != nil {
+			t.Fatal(err)
+		}
+		fields, _ := splitQuoted(ldflags)
+		var mode string
+		for i, f := range fields {
+			if f == "-X" && i+1 < len(fields) && strings.HasPrefix(fields[i+1], "main.mode=") {
+				mode = fields[i+1]
+			}
+		}
+		if mode != test.mode {
+			t.Errorf("%s: last main.mode setting is %q, expected %q", test.target, mode, test.mode)
+		}
+	}
+}
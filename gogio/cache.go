@@ -0,0 +1,303 @@
+// SPDX-License-Identifier: Unlicense OR MIT
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// buildCacheDir returns the directory of the build cache. Tests replace it
+// to use a temporary cache.
+var buildCacheDir = func() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "gogio", "build"), nil
+}
+
+// goVersion returns the version of the go tool, which is part of every
+// cache key.
+var goVersion = sync.OnceValues(func() (string, error) {
+	return runQuery(exec.Command("go", "env", "GOVERSION"))
+})
+
+// errBuildTime reports that the output of go build embeds the build time,
+// which a cached output would get wrong.
+var errBuildTime = errors.New("the program embeds the -buildtimevar build time")
+
+// cachePackage is the subset of the go list -json output of a package that
+// determines its part of the cache key.
+type cachePackage struct {
+	Dir        string
+	ImportPath string
+	Name       string
+	Standard   bool
+	GoFiles    []string
+	CgoFiles   []string
+	CFiles     []string
+	CXXFiles   []string
+	MFiles     []string
+	HFiles     []string
+	SFiles     []string
+	SysoFiles  []string
+	EmbedFiles []string
+	Module     *struct {
+		Main  bool
+		GoMod string
+	}
+}
+
+// cachePackageFields are the fields of cachePackage, for go list -json.
+const cachePackageFields = "Dir,ImportPath,Name,Standard,GoFiles,CgoFiles,CFiles,CXXFiles,MFiles,HFiles,SFiles,SysoFiles,EmbedFiles,Module"
+
+// runGoBuild runs the go build command that writes the out file, unless
+// the build cache holds the output of an earlier build with the same
+// inputs. Then the cached output is copied to out instead.
+func runGoBuild(bi *buildInfo, cmd *exec.Cmd, out string) error {
+	if bi.noCache || *dryRun {
+		_, err := runCmd(cmd)
+		return err
+	}
+	entry, err := buildCacheEntry(bi, cmd)
+	if errors.Is(err, errBuildTime) {
+		if *printCommands {
+			fmt.Fprintf(cmdLog, "# not caching %s: %v\n", out, err)
+		}
+		_, err := runCmd(cmd)
+		return err
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "gogio: warning: not caching %s: %v\n", out, err)
+		_, err := runCmd(cmd)
+		return err
+	}
+	if err := copyCached(out, entry); err == nil {
+		if *printCommands {
+			fmt.Fprintf(cmdLog, "# %s reused from %s\n", out, entry)
+		}
+		return nil
+	}
+	if _, err := runCmd(cmd); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(entry), 0755); err == nil {
+		// Write to a temporary file to not expose partial entries to
+		// concurrent builds.
+		tmp := fmt.Sprintf("%s.%d.tmp", entry, os.Getpid())
+		if err = copyCached(tmp, out); err == nil {
+			err = os.Rename(tmp, entry)
+		}
+		if err != nil {
+			os.Remove(tmp)
+			fmt.Fprintf(os.Stderr, "gogio: warning: not caching %s: %v\n", out, err)
+		}
+	}
+	return nil
+}
+
+// copyCached copies the src file to dst, preserving its permissions.
+func copyCached(dst, src string) error {
+	fi, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if err := copyFile(dst, src); err != nil {
+		return err
+	}
+	return os.Chmod(dst, fi.Mode().Perm())
+}
+
+// buildCacheEntry returns the path of the cache entry for the output of the
+// go build command. The entry is keyed on the go version, the command
+// arguments except the output path, the Go and cgo environment, the source
+// and embedded files of the non-standard packages of the build, and the
+// go.mod and go.sum files of the main module. It returns errBuildTime if the
+// program declares the -buildtimevar variable; otherwise the setting of the
+// variable has no effect and is left out of the key.
+func buildCacheEntry(bi *buildInfo, cmd *exec.Cmd) (string, error) {
+	dir, err := buildCacheDir()
+	if err != nil {
+		return "", err
+	}
+	version, err := goVersion()
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "gogio build cache 1\n%s\n", version)
+	ldflags := cacheLdflags(bi.ldflags)
+	for i := 0; i < len(cmd.Args); i++ {
+		arg := cmd.Args[i]
+		if arg == "-o" && i+1 < len(cmd.Args) {
+			i++
+			fmt.Fprintf(h, "-o %s\n", filepath.Base(cmd.Args[i]))
+			continue
+		}
+		if bi.ldflags != "" {
+			arg = strings.Replace(arg, bi.ldflags, ldflags, 1)
+		}
+		fmt.Fprintf(h, "%s\n", arg)
+	}
+	for _, e := range cmd.Env {
+		if strings.HasPrefix(e, "GO") || strings.HasPrefix(e, "CGO_") || strings.HasPrefix(e, "CC=") || strings.HasPrefix(e, "CXX=") {
+			fmt.Fprintf(h, "%s\n", e)
+		}
+	}
+	pkgs, err := listCachePackages(bi, cmd.Env)
+	if err != nil {
+		return "", err
+	}
+	declared, err := declaresBuildTime(pkgs, *buildTimeVar)
+	if err != nil {
+		return "", err
+	}
+	if declared {
+		return "", errBuildTime
+	}
+	for _, p := range pkgs {
+		if p.Module != nil && p.Module.Main && p.Module.GoMod != "" {
+			sum := filepath.Join(filepath.Dir(p.Module.GoMod), "go.sum")
+			if err := hashFiles(h, "", p.Module.GoMod, sum); err != nil {
+				return "", err
+			}
+			break
+		}
+	}
+	for _, p := range pkgs {
+		if p.Standard {
+			continue
+		}
+		fmt.Fprintf(h, "package %s\n", p.ImportPath)
+		for _, files := range [][]string{p.GoFiles, p.CgoFiles, p.CFiles, p.CXXFiles, p.MFiles, p.HFiles, p.SFiles, p.SysoFiles, p.EmbedFiles} {
+			if err := hashFiles(h, p.Dir, files...); err != nil {
+				return "", err
+			}
+		}
+	}
+	return filepath.Join(dir, hex.EncodeToString(h.Sum(nil))), nil
+}
+
+// listCachePackages lists the packages of the build with go list -deps.
+func listCachePackages(bi *buildInfo, env []string) ([]cachePackage, error) {
+	list := exec.Command("go", "list", "-deps", "-tags", bi.tags, "-json="+cachePackageFields, bi.pkgPath)
+	list.Env = env
+	out, err := runQuery(list)
+	if err != nil {
+		return nil, err
+	}
+	var pkgs []cachePackage
+	d := json.NewDecoder(strings.NewReader(out))
+	for d.More() {
+		var p cachePackage
+		if err := d.Decode(&p); err != nil {
+			return nil, fmt.Errorf("go list: %v", err)
+		}
+		pkgs = append(pkgs, p)
+	}
+	return pkgs, nil
+}
+
+// declaresBuildTime reports whether one of the packages declares the
+// variable v, in the importpath.name form of -buildtimevar.
+func declaresBuildTime(pkgs []cachePackage, v string) (bool, error) {
+	i := strings.LastIndex(v, ".")
+	if i == -1 {
+		return false, nil
+	}
+	path, name := v[:i], v[i+1:]
+	for _, p := range pkgs {
+		// The linker refers to the main package as main.
+		if p.ImportPath != path && !(path == "main" && p.Name == "main") {
+			continue
+		}
+		fset := token.NewFileSet()
+		for _, f := range append(append([]string(nil), p.GoFiles...), p.CgoFiles...) {
+			file, err := parser.ParseFile(fset, filepath.Join(p.Dir, f), nil, parser.SkipObjectResolution)
+			if err != nil {
+				return false, err
+			}
+			for _, decl := range file.Decls {
+				gen, ok := decl.(*ast.GenDecl)
+				if !ok || gen.Tok != token.VAR {
+					continue
+				}
+				for _, spec := range gen.Specs {
+					for _, n := range spec.(*ast.ValueSpec).Names {
+						if n.Name == name {
+							return true, nil
+						}
+					}
+				}
+			}
+		}
+	}
+	return false, nil
+}
+
+// hashFiles adds the names and contents of the files, relative to dir, to
+// h. Files that don't exist are hashed as missing.
+func hashFiles(h hash.Hash, dir string, files ...string) error {
+	for _, name := range files {
+		path := name
+		if dir != "" {
+			path = filepath.Join(dir, name)
+		}
+		fmt.Fprintf(h, "%s\n", path)
+		src, err := os.Open(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			io.WriteString(h, "missing\n")
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(h, src)
+		src.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cacheLdflags returns the linker flags without the setting of the
+// -buildtimevar variable, which changes with every build.
+func cacheLdflags(ldflags string) string {
+	v := *buildTimeVar
+	if v == "" {
+		return ldflags
+	}
+	fields, err := splitQuoted(ldflags)
+	if err != nil {
+		return ldflags
+	}
+	var kept []string
+	for i := 0; i < len(fields); i++ {
+		if fields[i] == "-X" && i+1 < len(fields) && strings.HasPrefix(fields[i+1], v+"=") {
+			i++
+			continue
+		}
+		kept = append(kept, fields[i])
+	}
+	joined, err := joinQuoted(kept)
+	if err != nil {
+		return ldflags
+	}
+	return joined
+}
@@ -0,0 +1,109 @@
+// SPDX-License-Identifier: Unlicense OR MIT
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBuildCache(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping go build in short mode")
+	}
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":     "module example.com/app\n\ngo 1.21\n",
+		"main.go":    "package main\n\nimport _ \"embed\"\n\n//go:embed data.txt\nvar data string\n\nfunc main() { println(data) }\n",
+		"data.txt":   "first",
+		"version.go": "//go:build buildtime\n\npackage main\n\nvar buildTime string\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	cache := t.TempDir()
+	defer func(f func() (string, error)) { buildCacheDir = f }(buildCacheDir)
+	buildCacheDir = func() (string, error) { return cache, nil }
+	defer func(x bool, w io.Writer) { *printCommands, cmdLog = x, w }(*printCommands, cmdLog)
+	var log bytes.Buffer
+	*printCommands, cmdLog = true, &log
+
+	bi := &buildInfo{
+		name:    "app",
+		pkgPath: ".",
+		ldflags: "-X main.buildTime=2024-01-01T00:00:00Z",
+	}
+	defer func(v string) { *buildTimeVar = v }(*buildTimeVar)
+	*buildTimeVar = "main.buildTime"
+	build := func(out string) []byte {
+		cmd := exec.Command("go", "build", "-ldflags="+bi.ldflags, "-tags", bi.tags, "-o", out, bi.pkgPath)
+		cmd.Env = append(os.Environ(), "GOOS=linux", "GOARCH=amd64", "CGO_ENABLED=0")
+		if err := runGoBuild(bi, cmd, out); err != nil {
+			t.Fatal(err)
+		}
+		content, err := os.ReadFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return content
+	}
+	first := build(filepath.Join(t.TempDir(), "app"))
+	if !strings.Contains(log.String(), "go build") {
+		t.Fatalf("the first build didn't run go build:\n%s", log.String())
+	}
+	log.Reset()
+	// The build time differs, but the output is reused regardless.
+	bi.ldflags = "-X main.buildTime=2024-01-02T00:00:00Z"
+	second := build(filepath.Join(t.TempDir(), "app"))
+	if strings.Contains(log.String(), "go build") || !strings.Contains(log.String(), "reused from") {
+		t.Errorf("the second build didn't reuse the cached binary:\n%s", log.String())
+	}
+	if !bytes.Equal(first, second) {
+		t.Error("the reused binary differs from the cached binary")
+	}
+	log.Reset()
+	bi.noCache = true
+	build(filepath.Join(t.TempDir(), "app"))
+	if !strings.Contains(log.String(), "go build") {
+		t.Errorf("-no-cache reused the cached binary:\n%s", log.String())
+	}
+	bi.noCache = false
+
+	// A changed embedded file misses the cache.
+	log.Reset()
+	if err := os.WriteFile(filepath.Join(dir, "data.txt"), []byte("second"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	changed := build(filepath.Join(t.TempDir(), "app"))
+	if !strings.Contains(log.String(), "go build") {
+		t.Errorf("the build with a changed embedded file reused the cached binary:\n%s", log.String())
+	}
+	if !bytes.Contains(changed, []byte("second")) {
+		t.Error("the binary doesn't embed the changed file")
+	}
+
+	// Programs that declare the build time variable are not cached.
+	bi.tags = "buildtime"
+	for i := 0; i < 2; i++ {
+		log.Reset()
+		build(filepath.Join(t.TempDir(), "app"))
+		if !strings.Contains(log.String(), "go build") || !strings.Contains(log.String(), "not caching") {
+			t.Errorf("build %d of a program with a build time reused a cached binary:\n%s", i, log.String())
+		}
+	}
+}
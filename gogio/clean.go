@@ -0,0 +1,72 @@
+// SPDX-License-Identifier: Unlicense OR MIT
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// staleWorkDirAge is the age after which clean considers a work directory
+// abandoned. Younger directories may belong to running builds.
+const staleWorkDirAge = 24 * time.Hour
+
+// runClean runs the clean command with args, printing the removed paths to
+// w.
+func runClean(w io.Writer, args []string) error {
+	fs := flag.NewFlagSet("clean", flag.ContinueOnError)
+	dryRun := fs.Bool("n", false, "print the paths that would be removed, without removing them.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	paths, err := cleanPaths(append([]string{os.TempDir()}, fs.Args()...), time.Now())
+	if err != nil {
+		return err
+	}
+	for _, p := range paths {
+		fmt.Fprintf(w, "rm -rf %s\n", p)
+		if *dryRun {
+			continue
+		}
+		if err := os.RemoveAll(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cleanPaths returns the build cache directory and the stale gogio-*
+// work directories in the roots, such as the directories of -tmpdir and
+// -work=dir, that exist. Directories without the workDirMarker file
+// weren't created by gogio and are left alone.
+func cleanPaths(roots []string, now time.Time) ([]string, error) {
+	var paths []string
+	cache, err := buildCacheDir()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(cache); err == nil {
+		paths = append(paths, cache)
+	}
+	for _, root := range roots {
+		dirs, err := filepath.Glob(filepath.Join(root, "gogio-*"))
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range dirs {
+			fi, err := os.Stat(d)
+			if err != nil || !fi.IsDir() || now.Sub(fi.ModTime()) < staleWorkDirAge {
+				continue
+			}
+			if _, err := os.Stat(filepath.Join(d, workDirMarker)); err != nil {
+				continue
+			}
+			paths = append(paths, d)
+		}
+	}
+	return paths, nil
+}
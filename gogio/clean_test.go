@@ -0,0 +1,73 @@
+// SPDX-License-Identifier: Unlicense OR MIT
+
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestClean(t *testing.T) {
+	cache := filepath.Join(t.TempDir(), "build")
+	defer func(f func() (string, error)) { buildCacheDir = f }(buildCacheDir)
+	buildCacheDir = func() (string, error) { return cache, nil }
+	// Keep clean away from the work directories of real builds.
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+	t.Setenv("TMP", tmp)
+	work := t.TempDir()
+
+	entry := filepath.Join(cache, "0123abcd")
+	stale := filepath.Join(tmp, "gogio-1234")
+	staleWork := filepath.Join(work, "gogio-android")
+	fresh := filepath.Join(tmp, "gogio-5678")
+	// A directory the user created, whose name happens to match.
+	unmarked := filepath.Join(work, "gogio-notes")
+	for _, f := range []string{
+		entry,
+		filepath.Join(stale, "sign.keystore"), filepath.Join(stale, workDirMarker),
+		filepath.Join(staleWork, "app.zip"), filepath.Join(staleWork, workDirMarker),
+		filepath.Join(fresh, "app.zip"), filepath.Join(fresh, workDirMarker),
+		filepath.Join(unmarked, "notes.txt"),
+	} {
+		if err := os.MkdirAll(filepath.Dir(f), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(f, []byte("data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := time.Now().Add(-2 * staleWorkDirAge)
+	for _, d := range []string{stale, staleWork, unmarked} {
+		if err := os.Chtimes(d, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := runClean(io.Discard, []string{"-n", work}); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{entry, stale, staleWork, fresh, unmarked} {
+		if _, err := os.Stat(p); err != nil {
+			t.Errorf("clean -n removed %s", p)
+		}
+	}
+
+	if err := runClean(io.Discard, []string{work}); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{cache, stale, staleWork} {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Errorf("clean didn't remove %s", p)
+		}
+	}
+	if _, err := os.Stat(fresh); err != nil {
+		t.Errorf("clean removed the work directory of a recent build: %v", err)
+	}
+	if _, err := os.Stat(unmarked); err != nil {
+		t.Errorf("clean removed a directory that isn't a work directory: %v", err)
+	}
+}
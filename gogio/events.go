@@ -0,0 +1,80 @@
+// SPDX-License-Identifier: Unlicense OR MIT
+
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// buildEvent is an event of the -json build event stream, which is written
+// as newline delimited JSON objects.
+//
+// The Action field is one of
+//
+//	start     the Phase started
+//	end       the Phase ended, with Error set if it failed
+//	build     the program was built for Arch, with Error set if it failed
+//	artifact  the build output was written to Path
+//	fail      the build failed with Error
+type buildEvent struct {
+	Time   time.Time
+	Action string
+	Phase  string `json:",omitempty"`
+	Arch   string `json:",omitempty"`
+	Path   string `json:",omitempty"`
+	Error  string `json:",omitempty"`
+}
+
+// eventWriter writes build events to a stream.
+type eventWriter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+var (
+	// events is the -json event stream, or nil.
+	events *eventWriter
+	// cmdLog receives the human readable output, such as the commands
+	// printed by -x.
+	cmdLog io.Writer = os.Stdout
+)
+
+func newEventWriter(w io.Writer) *eventWriter {
+	return &eventWriter{enc: json.NewEncoder(w)}
+}
+
+// emit writes the event to the event stream, if any.
+func emit(e buildEvent) {
+	if events == nil {
+		return
+	}
+	e.Time = time.Now()
+	events.mu.Lock()
+	defer events.mu.Unlock()
+	events.enc.Encode(e)
+}
+
+// emitBuild emits the result of building the program for arch.
+func emitBuild(arch string, err error) {
+	e := buildEvent{Action: "build", Arch: arch}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	emit(e)
+}
+
+// runPhase runs f surrounded by the start and end events of the phase.
+func runPhase(phase string, f func() error) error {
+	emit(buildEvent{Action: "start", Phase: phase})
+	err := f()
+	e := buildEvent{Action: "end", Phase: phase}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	emit(e)
+	return err
+}
@@ -0,0 +1,84 @@
+// SPDX-License-Identifier: Unlicense OR MIT
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestJSBuildEvents(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping js build in short mode")
+	}
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":  "module example.com/app\n\ngo 1.21\n",
+		"main.go": "package main\n\nfunc main() {}\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	out := filepath.Join(t.TempDir(), "app")
+	defer func(tgt, dest, post string) {
+		*target, *destPath, *postBuild = tgt, dest, post
+	}(*target, *destPath, *postBuild)
+	*target, *destPath, *postBuild = "js", out, "echo hook output"
+	var stream, log bytes.Buffer
+	events = newEventWriter(&stream)
+	defer func(w io.Writer) { events, cmdLog = nil, w }(cmdLog)
+	// Like -json, which sends the human readable output to stderr.
+	cmdLog = &log
+
+	bi := &buildInfo{
+		name:    "app",
+		pkgPath: ".",
+		target:  "js",
+		noCache: true,
+	}
+	if err := runBuild(bi); err != nil {
+		t.Fatal(err)
+	}
+	var got []buildEvent
+	dec := json.NewDecoder(&stream)
+	for dec.More() {
+		var e buildEvent
+		if err := dec.Decode(&e); err != nil {
+			t.Fatal(err)
+		}
+		if e.Time.IsZero() {
+			t.Errorf("event %+v has no time", e)
+		}
+		got = append(got, buildEvent{Action: e.Action, Phase: e.Phase, Arch: e.Arch, Path: e.Path, Error: e.Error})
+	}
+	exp := []buildEvent{
+		{Action: "start", Phase: "build"},
+		{Action: "build", Arch: "wasm"},
+		{Action: "end", Phase: "build"},
+		{Action: "artifact", Path: out},
+		{Action: "start", Phase: "postbuild"},
+		{Action: "end", Phase: "postbuild"},
+	}
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("build events are %+v, expected %+v", got, exp)
+	}
+	if !strings.Contains(log.String(), "hook output") {
+		t.Errorf("the -postbuild output %q is missing from the command log", log.String())
+	}
+}
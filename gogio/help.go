@@ -7,71 +7,516 @@ const mainUsage = `The gogio command builds and packages Gio (gioui.org) program
 Usage:
 
 	gogio -target <target> [flags] <package> [run arguments]
+	gogio version
+	gogio clean [-n] [dir...]
 
 The gogio tool builds and packages Gio programs for platforms where additional
 metadata or support files are required.
 
+The version command, also available as gogio --version, prints the gogio
+version and the Go version it was built with.
+
+The clean command removes the build cache and the work directories of
+earlier builds that are more than a day old, to reclaim disk space. Only
+directories marked as work directories by gogio are removed. Work
+directories, including the debug keystores generated for Android builds, are
+looked for in the default directory for temporary files and in the dir
+arguments, such as the directories of -tmpdir and -work=dir. The
+~/.android/debug.keystore shared with the Android tools is left alone. The
+-n flag prints the paths that would be removed without removing them.
+
 The package argument specifies an import path or a single Go source file to
-package. Any run arguments are appended to os.Args at runtime.
+package. Any run arguments are appended to os.Args at runtime. Like go build,
+a program in a single file is named after the file, or after its directory
+for a main.go file. The go tool ignores the .syso resources of single file
+programs, so their Windows executables lack the icon and manifest.
 
 Compiled Java class files from jar files in the package directory are
-included in Android builds.
+included in Android builds. So are the classes, assets, native libraries,
+permissions and features of Android Archive (.aar) files in the package
+directory.
 
 The mandatory -target flag selects the target platform: ios or android for the
-mobile platforms, tvos for Apple's tvOS, js for WebAssembly/WebGL, macos for
-MacOS and windows for Windows.
+mobile platforms, tvos for Apple's tvOS, macos-catalyst for running an iOS
+program on MacOS through Mac Catalyst, js for WebAssembly/WebGL, macos for
+MacOS, windows for Windows, linux for Linux and freebsd for FreeBSD.
 
 The -arch flag specifies a comma separated list of GOARCHs to include. The
 default is all supported architectures.
 
 The -o flag specifies an output file or directory, depending on the target.
 
+If -o names an existing directory, the output is written to it with its
+default name, such as app.apk, unless the directory is itself an output such
+as an app bundle or an earlier WebAssembly build.
+
+The -output-name flag specifies a template for the output name used when -o
+is empty or names a directory. The placeholders {name}, {version},
+{versioncode}, {arch}, {target} and {ext} are replaced by the app name, the
+major, minor and patch of the -version, the version code, the architecture,
+the target and the extension of the output, such as apk. For example,
+-output-name {name}-{version}-{arch}.{ext} names an Android build
+myapp-1.2.3-arm64.apk. Outputs that contain several architectures, such as
+Android apks, use universal for {arch}, while targets that write an output per
+architecture render the template for each. The extension is appended if the
+template omits it.
+
 The -buildmode flag selects the build mode. Two build modes are available, exe
 and archive. Buildmode exe outputs an .ipa file for iOS or tvOS, an .apk file
 for Android or a directory with the WebAssembly module and support files for
 a browser.
 
+The -title flag specifies the title of the web page of WebAssembly builds,
+and defaults to the app name. The -theme-color flag also sets the theme color
+of the web page, which browsers use for their interface.
+
+The -web-config flag specifies build time configuration of WebAssembly builds,
+such as the base URL of an API, as a JSON object or the path of a file with a
+JSON object. The web page sets the object as window.gioConfig before the app
+starts, and the app reads it with syscall/js:
+
+	base := js.Global().Get("gioConfig").Get("apiBase").String()
+
+Like for the other targets, the -X flags of -ldflags also set variables of the
+WebAssembly program.
+
+The -loader flag adds a loading overlay to the web page of WebAssembly builds,
+with a progress bar of the download of the WebAssembly module that is removed
+when the app draws its first frame. The progress is based on the
+Content-Length of the response, and the bar has the -theme-color color.
+
+The -minify flag strips the comments, indentation and blank lines of the
+generated HTML page and JavaScript of WebAssembly builds, for production
+deployments. The WebAssembly module is not affected, and the flag is ignored
+for -debug builds.
+
+The -single-file flag outputs a single HTML file for WebAssembly builds, with
+the WebAssembly module, the JavaScript and the icon inlined in base64, for
+sharing demos. The output defaults to <name>.html. The inlined module is a
+third larger than the .wasm file, and very large modules may exceed the data
+URL limits of some browsers. The flag can't be combined with -assets.
+
+The -wasm-exec flag specifies the wasm_exec.js driver of WebAssembly builds,
+for toolchains such as TinyGo that need a different driver. It defaults to the
+driver of the go command in $PATH, as reported by go env GOROOT.
+
 The -ldflags and -tags flags pass extra linker flags and tags to the go tool.
+The -ldflags-file flag specifies a file of extra linker flags, which are
+appended to the -ldflags flags. The flags in the file are separated by spaces
+or newlines, and single or double quotes group a flag that contains spaces,
+such as -X 'main.message=hello world'.
+
+The -target-tags and -target-ldflags flags add tags and linker flags for some
+targets only, in the targets=value form. For example, -target-tags
+ios,android=mobile adds the mobile tag to iOS and Android builds. The flags
+may be repeated. Target tags are added to the -tags tags, and target linker
+flags follow the -ldflags and -ldflags-file flags, so their -X settings take
+precedence.
+
+The -cc, -cflags and -ldflags-cgo flags override the CC, CGO_CFLAGS and
+CGO_LDFLAGS that gogio computes for the cgo builds of the Android, iOS, tvOS,
+Mac Catalyst, MacOS, Linux and FreeBSD targets, for toolchains that need a
+custom compiler or flags. -cflags and -ldflags-cgo replace the computed flags
+entirely. The -sysroot and -target-triple flags instead replace the sysroot
+and the clang -target of the computed flags, and can't be combined with
+-cflags or -ldflags-cgo.
+
+The -strip flag, enabled by default, strips symbol and debug information from
+the binaries of all targets. The -debug flag disables stripping. For iOS, tvOS
+and MacOS, the debug information is always extracted into a <name>.app.dSYM
+bundle next to the output before stripping, for symbolicating crash reports.
+
+The -buildtimevar and -commitvar flags specify string variables, in the form
+importpath.name, that are set with the linker -X flag to the build time in
+RFC 3339 format and the short hash of the git commit of the package directory.
+They default to main.buildTime and main.buildCommit. The commit variable is
+left alone if the package is not in a git repository. Specify an empty name
+to disable either variable.
+
+For Linux and FreeBSD, buildmode exe outputs a .tar.gz file containing the
+program in bin/ and a desktop entry and icons in share/, ready to be extracted
+into an installation prefix such as /usr/local or ~/.local. For Linux, specify
+an output ending in .AppImage to package an AppImage instead. The AppImage is
+packaged by the appimagetool program if it is found in $PATH; otherwise gogio
+writes the AppDir directory next to the requested output and prints
+instructions for packaging it.
+
+The -format flag selects the package format for targets that support several.
+For Linux, the formats are tar, appimage and flatpak. If unspecified, the
+format is derived from the output name. Format flatpak outputs a directory
+containing the program, its desktop entry and icon, and a Flatpak manifest named
+after the app id. If flatpak-builder is found in $PATH, it is run to build the
+Flatpak into a repo directory next to the manifest.
+
+For Windows, the formats are exe, the default, and msix. Format msix packages
+the program for the Microsoft Store: the AppxManifest.xml declares the app id
+as the package identity, the major, minor and patch of the -version, the
+-product as display name, and a protocol for every -schemes scheme. The logos
+are generated from the -icon, which is required. The package is packed by
+makeappx and signed by signtool with the .pfx certificate of -signkey and the
+-signpass password, if the tools are found in $PATH; otherwise gogio writes the
+package directory next to the requested output, with a -msix suffix, and prints
+instructions for packing it. The -publisher flag specifies the Publisher of the
+package identity, which must match the subject of the signing certificate. It
+defaults to CN=<app id>.
+
+iOS and tvOS apps for devices are signed with codesign, using the first
+unexpired provisioning profile for the bundle id whose certificate has a code
+signing identity in the keychain, as listed by security find-identity.
+
+The -export-options flag specifies an ExportOptions.plist file for exporting
+iOS and tvOS .ipa files with xcodebuild -exportArchive instead of signing them
+with codesign. The export options select the distribution method, such as
+app-store, ad-hoc or enterprise, and xcodebuild signs the app accordingly.
+
+The -upload flag uploads the .ipa file of iOS and tvOS builds to App Store
+Connect, for TestFlight or App Store review. The -api-key and -api-issuer flags
+specify the key id and issuer id of an App Store Connect API key, whose
+private key is read from the AuthKey_<key id>.p8 file in a private_keys,
+~/private_keys, ~/.private_keys or ~/.appstoreconnect/private_keys directory.
+
+The -retries flag specifies how many times uploads, macOS notarizations and
+timestamped signatures are retried after network or server failures, with an
+exponential backoff starting at 5 seconds. Authentication failures are not
+retried. The default is 3.
 
 As a special case for iOS or tvOS, specifying a path that ends with ".app"
-will output an app directory suitable for a simulator.
+will output an app directory suitable for a simulator. The -simulator flag
+overrides the inference from the output: -simulator=false builds a signed
+.app for devices, for sideloading, and -simulator requires an .app output.
+Only the -arch architectures supported by the simulator or devices are built.
+
+The -ota-url flag specifies the HTTPS URL where an iOS .ipa built for ad-hoc or
+enterprise distribution will be hosted, and writes a manifest.plist next to the
+.ipa for installing it over the air. The -ota-icons flag specifies the HTTPS
+URLs of the 57x57 and 512x512 images shown during the install. Host the
+manifest.plist in the same directory as the .ipa, and link to it with an
+itms-services://?action=download-manifest&url= link.
+
+The -keep-app flag also writes the signed .app of an iOS or tvOS .ipa next to
+it, such as app.app for app.ipa, for inspecting the bundle with tools such as
+codesign -dv.
 
 The other buildmode is archive, which will output an .aar library for Android
-or a .framework for iOS and tvOS.
+or a .framework for iOS and tvOS. If -o ends in .a, iOS and tvOS archives are
+plain static libraries instead, with the header of the framework written next
+to the library, such as libgio.h for libgio.a, for adding to existing Xcode
+projects.
 
-The -icon flag specifies a path to a PNG image to use as app icon on iOS and Android.
+The -icon flag specifies a path to a PNG image to use as app icon on iOS, Android
+and the other platforms that support app icons.
 If left unspecified, the appicon.png file from the main package is used
-(if it exists).
+(if it exists). tvOS requires a layered icon: the front and back layers, and
+an optional middle layer, are read from the <icon>_front.png, <icon>_back.png
+and <icon>_middle.png files next to the icon. The top shelf images are derived
+from the back layer.
+
+On Android, the -icon flag may also specify an SVG image, which is translated
+to a vector drawable for the adaptive icon. The legacy icons of older devices
+are rasterized from it. Only filled paths with solid colors are supported; for
+images that use other features, such as strokes, gradients, transforms or arcs,
+the PNG image with the same name next to the SVG image is used instead.
+
+Icons are resized to the sizes required by the target. A warning is printed
+for icons that are smaller than the largest size, which makes them blurry, or
+that are not square. The -strict flag turns the warnings into errors. The
+-icon-scaler flag selects the resizing algorithm: catmullrom, the default, is
+the sharpest, in particular for upscaled icons; bilinear is faster and softer;
+nearest is the fastest and keeps the hard edges of pixel art.
+
+For iOS, tvOS and MacOS, the -icon flag may also specify an Xcode asset
+catalog (.xcassets) or app icon set (.appiconset) directory, which is compiled
+with actool instead of generating the icons from an image. The app icon set
+must contain the 60x60 @2x and @3x and 1024x1024 icons for iOS, or a single
+1024x1024 universal icon, and the 512x512 @1x and @2x icons for MacOS. For
+tvOS, the asset catalog must contain brand assets.
+
+The -icon-shape flag specifies the shape of the app icons of the desktop
+platforms and the web: square, the default, rounded for rounded corners, or
+circle. The icon is made transparent outside the shape. iOS and Android apply
+their own masks to icons and ignore the flag.
+
+The -assets flag specifies a directory whose contents are included in the app,
+preserving the directory structure. The files are placed in the assets/
+directory of Android apps, the bundle root of iOS and tvOS apps, the
+Contents/Resources directory of macOS apps and the output directory of
+WebAssembly builds.
+
+The -res flag specifies an Android res directory, such as one with drawable,
+layout or xml subdirectories. Its resources are compiled with aapt2 and linked
+into the app along with the generated icon, theme and string resources. On
+conflicts, the resources of -res take precedence. Android archives include
+the -res resources in their res/ directory.
 
 The -appid flag specifies the package name for Android or the bundle id for
 iOS and tvOS. A bundle id must be provisioned through Xcode before the gogio
-tool can use it.
+tool can use it. Android package names must have at least two '.' separated
+parts, and each part must be a Java identifier that doesn't start with a
+digit. If -appid is unspecified, the app id is derived from the import path of
+the package, with characters other than letters, underscores and dots replaced
+by underscores, and an underscore prefixed to parts that are reserved Java
+keywords. Digits are replaced too, for compatibility with the app ids derived
+by earlier versions of gogio, so example.com/app2 derives com.example.app_.
 
 The -version flag specifies the integer version code for Android and the last
 component of the 1.0.X version for iOS and tvOS.
 
+If the version code of -version is zero, or if the -autoversioncode flag is
+specified, the version code is the number of commits in the git history of
+the package directory, which increases with every commit. Outside a git
+repository, the version code of -version is used.
+
+The -ndk flag specifies the Android NDK directory for building the native
+code of Android apps. It defaults to $ANDROID_NDK_HOME, or else the latest
+NDK installed in the Android SDK.
+
 For Android builds the -minsdk flag specify the minimum SDK level. For example,
 use -minsdk 22 to target Android 5.1 (Lollipop) and later.
 
 For Windows builds the -minsdk flag specify the minimum OS version. For example,
 use -mindk 10 to target Windows 10 and later, -minsdk 6 for Windows Vista and later.
 
+The -console flag builds Windows programs for the console subsystem, so that
+their standard output and error are attached to the terminal that started
+them. Windows opens a console window for console programs started from
+Explorer, including the instances started to handle the -schemes URIs of the
+app. The default is the GUI subsystem.
+
+The -resources flag embeds custom resources in Windows programs, next to the
+icon, manifest and version information generated by gogio. It names either an
+.rc resource script or a directory. Resource scripts may contain STRINGTABLE
+blocks and resources that name a file, such as
+
+	101 BITMAP "logo.bmp"
+
+where file names are relative to the script. Directories contain a
+subdirectory per resource type, such as RCDATA, BITMAP, ICON, HTML or STRING,
+or a type number, with files named after the resource ids, such as
+RCDATA/101.bin; the files of STRING hold the strings. Only numeric ids are
+supported, and they must not collide with the resources generated by gogio,
+which use id 1.
+
 For iOS builds the -minsdk flag specify the minimum iOS version. For example, 
 use -mindk 15 to target iOS 15.0 and later.
 
+For Android and iOS builds, the -minsdk and -targetsdk levels are checked
+against the levels supported by the installed SDK platform and NDK, or the
+deployment targets of the Xcode SDK, before building.
+
+The -device-capabilities flag specifies a comma separated list of the
+UIRequiredDeviceCapabilities of iOS device builds, replacing the default
+arm64. Simulator builds don't require any capabilities.
+
+The -associated-domains flag specifies a comma separated list of associated
+domains, such as applinks:example.com for universal links, that are added to
+the entitlements of signed iOS apps. The provisioning profile must include the
+Associated Domains capability, and each domain must serve an
+apple-app-site-association file.
+
+The -push flag specifies the APNs environment of push notifications,
+development or production, that is set in the aps-environment entitlement of
+signed iOS apps. The provisioning profile must include the Push Notifications
+capability.
+
+The -background-modes flag specifies a comma separated list of the
+UIBackgroundModes of iOS apps, such as audio, location, fetch or
+remote-notification.
+
+The -usage flag specifies a comma separated list of usage descriptions for the
+Info.plist of iOS apps, in the key=description form. For example,
+-usage "NSCameraUsageDescription=Needed for scanning" explains the use of the
+camera to the user. App Store review rejects apps that use privacy sensitive
+APIs without a description.
+
+The -statusbar-style flag specifies the initial status bar style of iOS apps:
+default, light for light content on dark backgrounds, dark for dark content
+on light backgrounds, or hidden to hide the status bar. Styles other than
+default apply to the whole app.
+
+The -ats flag specifies the NSAppTransportSecurity configuration of iOS apps:
+allow-local to allow insecure connections to the local network, allow-all to
+allow arbitrary loads, or the path of a file containing the plist <dict> with
+exceptions, such as NSExceptionDomains. Allowing arbitrary loads may require
+a justification in App Store review.
+
+The -embed-frameworks flag specifies a comma separated list of .framework
+directories and .dylib files to embed in the Frameworks directory of iOS
+apps. The install names of the embedded libraries and the references to them
+are changed to be relative to the app, and signed apps sign each embedded
+library.
+
+The -alt-icons flag specifies a comma separated list of PNG images to include
+as alternate iOS app icons, named after their files without extension. For
+example, -alt-icons icons/Dark.png adds the Dark alternate icon.
+
 For Android builds the -targetsdk flag specify the target SDK level. For example,
 use -targetsdk 33 to target Android 13 (Tiramisu) and later.
 
+The -category flag specifies the LSApplicationCategoryType of MacOS apps, such
+as public.app-category.productivity. The public.app-category. prefix may be
+omitted. Unknown categories are reported with a warning.
+
+The -localized-names flag specifies a comma separated list of display names of
+iOS, tvOS and macOS apps per locale, in the locale=name form. For example,
+-localized-names "fr=Mon App,de=Meine App". Every name is written as the
+CFBundleDisplayName of a <locale>.lproj/InfoPlist.strings file in the app
+bundle, while the app name remains the display name of other locales.
+
+The -copyright flag specifies the human readable copyright notice of the app,
+stored in NSHumanReadableCopyright for MacOS and LegalCopyright for Windows.
+
+The -company, -product and -description flags specify the CompanyName,
+ProductName and FileDescription of the version information of Windows programs.
+The company defaults to the domain of the app id, such as gioui.org for
+org.gioui.example, the product to the app name and the description to the
+product. MSIX packages use the company as publisher display name and the
+description as app description.
+
+The -theme-color flag specifies the color of the Android status bar, and the
+-splash-color and -splash-icon flags specify the background color and icon of
+the Android 12 splash screen. Colors are in the #RRGGBB or #AARRGGBB format.
+The splash screen color defaults to the background color of the app icon.
+
+The -application-class and -activity-class flags specify the Android
+Application subclass and the Activity class of the app, instead of
+org.gioui.GioActivity. The classes must be included in a jar file in a package
+directory, and names starting with '.' are relative to the app id.
+
+The -features flag specifies a comma separated list of Android uses-feature
+entries in the name[:required] form, where required defaults to true. For
+example, -features android.hardware.camera:false,glEsVersion:3.0 declares an
+optional camera and requires OpenGL ES 3.0. The entries override the optional
+features otherwise declared by gogio.
+
+The -network-config flag specifies an Android network security configuration
+XML file to include in the app. Alternatively, the -allow-cleartext flag
+generates a configuration that permits cleartext traffic, for example to a
+development server.
+
+The -shrink flag removes unused Java classes and members from Android apps
+with the R8 shrinker of the build tools, keeping the Gio classes and the rules
+of a proguard-rules.pro file in the package directory. Without R8, the flag is
+ignored.
+
+The -multidex flag enables multidex for Android apps that exceed the limit of
+64K methods in a dex file, for example because of large jar files. API levels
+21 and later support multiple dex files natively. For lower -minsdk levels,
+the androidx.multidex library must be included as a jar in the package
+directory; the Application class defaults to its MultiDexApplication, and a
+custom -application-class must extend it.
+
+The -assetlinks flag writes an assetlinks.json file next to the Android
+output, with the package name and the SHA-256 fingerprint of the signing
+certificate. Serve it at /.well-known/assetlinks.json of every domain of the
+App Links of the app for Android to verify them.
+
+The -wear flag packages an Android app as a standalone Wear OS app, requiring
+the android.hardware.type.watch feature. Phone only features such as the
+camera are rejected.
+
+The -schemes flag specifies a comma separated list of URI schemes the program
+handles. On Linux and FreeBSD, the schemes are registered as x-scheme-handler
+MIME types in the desktop entry. On Android, the schemes are added as intent
+<queries>, which Android 11 and later require for verifying and launching apps
+that handle them. On iOS, tvOS and macOS, the schemes are added to the
+CFBundleURLTypes of the Info.plist, each named by the app id followed by the
+scheme.
+
+Entries of the -schemes and -queries lists of the form @path are replaced by
+the entries of the file at path, one or more per line. Blank lines and
+comments starting with # are skipped, and the file entries are merged with
+the other entries of the list.
+
+The -url-role flag specifies the CFBundleTypeRole of the URL schemes of Apple
+apps: Editor, the default, Viewer or None.
+
+The -config-changes flag specifies the '|' separated android:configChanges
+of the Android activity, the configuration changes that Gio handles instead
+of restarting the activity. The default is
+screenSize|screenLayout|smallestScreenSize|orientation|keyboard|keyboardHidden,
+which covers rotation, resizing and attaching a hardware keyboard.
+
+The -queries flag specifies a comma separated list of the package names of
+other Android apps the app queries or launches. They are added to the
+<queries> of the manifest, along with the intents of the -schemes.
+
 The -work flag prints the path to the working directory and suppress
-its deletion.
+its deletion. With -work=dir, the working directory is the stable
+dir/gogio-<target> directory instead of a randomly named one, for scripting
+against or comparing the intermediate files of builds. Its contents are
+removed at the start of every build.
+
+The -prebuild and -postbuild flags specify shell commands to run in the package
+directory before and after the build. The post-build command runs only if the
+build succeeds, and a failing command fails the build. The commands can access
+the build target, absolute output path, version, app id and name through the
+GOGIO_TARGET, GOGIO_OUTPUT, GOGIO_VERSION, GOGIO_APPID and GOGIO_NAME
+environment variables.
+
+The -tmpdir flag specifies the directory in which the temporary working
+directory is created. It defaults to the system directory for temporary files.
+Use it if that directory is small or on a different file system than the
+output.
+
+The -jobs flag specifies the maximum number of architectures and other build
+steps that are built concurrently. It defaults to the number of CPUs.
+
+The -json flag writes a stream of build events to stdout, one JSON object
+per line, for tools such as IDEs and CI dashboards. Other output, such as the
+commands printed by -x, is written to stderr. Each event has a Time and an
+Action field. Action start and end events mark the prebuild, build and
+postbuild phases in their Phase field, build events report the result of
+building an architecture in their Arch field, an artifact event reports the
+output path in its Path field, and a fail event ends a failed build. Failed
+phases and builds also set the Error field.
+
+The -manifest-out flag specifies a file to write a JSON array of the build
+artifacts to, such as the apk, ipa or per-architecture executables and their
+dSYM bundles. Each artifact has a Path, its Size in bytes, the Target, the
+architectures in Arch and a SHA256 checksum. The checksum of a directory, such
+as an app bundle, covers the paths and contents of its files.
+
+The outputs of go build are cached in the gogio directory of the user cache
+directory, keyed on the Go version, the build flags and environment, the
+source and embedded files of the package and its dependencies outside the
+standard library, and the go.mod and go.sum files of the main module. A build
+with the same inputs reuses the cached output. Programs that declare the
+-buildtimevar variable embed the time of every build and are not cached. The
+-no-cache flag disables the cache.
 
 The -x flag will print all the external commands executed by the gogio tool.
 
+The -dry-run flag prints the external commands of the build without running
+them, to show the full plan of a build. Commands that only read information,
+such as go list, still run, and the outputs written by gogio itself go to the
+temporary working directory, so a dry run produces no artifacts. Steps that
+process the outputs of skipped commands are skipped as well.
+
 The -signkey flag specifies the path of the keystore, used for signing Android apk/aab files
-or specifies the name of key on Keychain to sign MacOS app.
+or specifies the name of key on Keychain to sign MacOS app, or the .pfx certificate
+to sign Windows MSIX packages.
 
 The -signpass flag specifies the password of the keystore, ignored if -signkey is not provided.
 
+Signed Android apks are verified with apksigner, and the build fails if the
+verification fails. The -v4-signing flag adds a v4 signature for incremental
+installs, which apksigner writes to a .apk.idsig file next to the apk.
+
+The -universal-apk flag also writes a universal apk next to .aab outputs, for
+testing on devices. The apk is built by bundletool build-apks --mode=universal,
+signed with the key of the bundle, and named <name>-universal.apk.
+
+The -debuggable flag sets android:debuggable in the manifest of Android apps,
+which allows debuggers and run-as on devices. It is implied by -debug. The
+-test-only flag sets android:testOnly, which restricts installation to
+adb install -t. Neither is allowed for apps signed with the release keystore
+of -signkey, and -debug builds signed with it are not debuggable.
+
+The -signalias flag specifies the alias of the Android signing key in the
+keystore, which defaults to the first key. The -signkeypass flag specifies the
+password of the key, if it differs from the -signpass password of the
+keystore.
+
 The -notaryid flag specifies the Apple ID to use for notarization of MacOS app.
 
 The -notarypass flag specifies the password of the Apple ID, ignored if -notaryid is not 
@@ -80,4 +525,22 @@ for details. If not provided, the password will be prompted.
 
 The -notaryteamid flag specifies the team ID to use for notarization of MacOS app, ignored if
 -notaryid is not provided.
+
+The -notary-profile flag specifies the name of a keychain profile that stores
+the notarization credentials, as created by
+
+	xcrun notarytool store-credentials
+
+Unlike -notarypass, the credentials don't appear on the command line. The
+flag can't be combined with -notaryid, -notarypass or -notaryteamid.
+
+The nested code of macOS apps, such as frameworks and helpers, is signed
+before the app, from the inside out. Nested code keeps the entitlements of its
+own signature, and only the app's executable and bundle are signed with the
+app's entitlements.
+
+Apple apps are signed with a secure timestamp from Apple's timestamp server,
+which notarization requires and which keeps signatures valid after the signing
+certificate expires. The -no-timestamp flag signs without a timestamp, for
+signing without network access.
 `
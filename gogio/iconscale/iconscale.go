@@ -0,0 +1,79 @@
+// SPDX-License-Identifier: Unlicense OR MIT
+
+// Package iconscale resizes the images used for app icons, with a choice
+// between quality and speed.
+package iconscale
+
+import (
+	"fmt"
+	"image"
+
+	"golang.org/x/image/draw"
+)
+
+// A Scaler is an image scaling algorithm. The zero Scaler is CatmullRom.
+type Scaler int
+
+const (
+	// CatmullRom is the Catmull-Rom cubic filter. It is the slowest
+	// algorithm, but keeps upscaled images the sharpest.
+	CatmullRom Scaler = iota
+	// BiLinear interpolates linearly between pixels, which is faster than
+	// CatmullRom and gives softer edges.
+	BiLinear
+	// NearestNeighbor copies the nearest source pixel. It is the fastest
+	// algorithm and keeps the hard edges of pixel art, but aliases.
+	NearestNeighbor
+)
+
+var scalerNames = [...]string{
+	CatmullRom:      "catmullrom",
+	BiLinear:        "bilinear",
+	NearestNeighbor: "nearest",
+}
+
+func (s Scaler) String() string {
+	if s < 0 || int(s) >= len(scalerNames) {
+		return fmt.Sprintf("Scaler(%d)", int(s))
+	}
+	return scalerNames[s]
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (s Scaler) MarshalText() ([]byte, error) {
+	if s < 0 || int(s) >= len(scalerNames) {
+		return nil, fmt.Errorf("unknown scaler %d", int(s))
+	}
+	return []byte(scalerNames[s]), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler for the names
+// catmullrom, bilinear and nearest.
+func (s *Scaler) UnmarshalText(text []byte) error {
+	for i, n := range scalerNames {
+		if n == string(text) {
+			*s = Scaler(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown scaler %q, expected catmullrom, bilinear or nearest", text)
+}
+
+func (s Scaler) interpolator() draw.Interpolator {
+	switch s {
+	case BiLinear:
+		return draw.BiLinear
+	case NearestNeighbor:
+		return draw.NearestNeighbor
+	default:
+		return draw.CatmullRom
+	}
+}
+
+// Resize returns the src rectangle of img scaled to a w×h image with the
+// scaler.
+func Resize(img image.Image, src image.Rectangle, w, h int, s Scaler) *image.NRGBA {
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	s.interpolator().Scale(dst, dst.Bounds(), img, src, draw.Src, nil)
+	return dst
+}
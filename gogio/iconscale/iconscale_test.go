@@ -0,0 +1,67 @@
+// SPDX-License-Identifier: Unlicense OR MIT
+
+package iconscale
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestResize(t *testing.T) {
+	t.Parallel()
+
+	// A 4x4 image with a gradient and a transparent corner.
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{R: uint8(x * 64), G: uint8(y * 64), B: 0x80, A: 0xff})
+		}
+	}
+	img.SetNRGBA(3, 3, color.NRGBA{})
+	tests := []struct {
+		scaler Scaler
+		sum    string
+	}{
+		{CatmullRom, "45da0e6d38d4fd265e1d60a6afb9a66da31d4ab8c89e8c9b40135a52fcaad96e"},
+		{BiLinear, "c861f2dd3b844feaeb91b65d06caeb7d66f8abd48e35566b4f12dfd8e2d66cd0"},
+		{NearestNeighbor, "c2737b31aa1c2d669d6cca2e7f71a14b521aeedc4073414fbc376d93f48ce94d"},
+	}
+	for _, test := range tests {
+		for _, size := range []image.Point{{7, 5}, {2, 3}} {
+			scaled := Resize(img, img.Bounds(), size.X, size.Y, test.scaler)
+			if got := scaled.Bounds(); got != (image.Rectangle{Max: size}) {
+				t.Errorf("%v: resized image is %v, expected %v", test.scaler, got, size)
+			}
+			if size.X != 7 {
+				// Only the upscale has a known checksum.
+				continue
+			}
+			sum := sha256.Sum256(scaled.Pix)
+			if got := hex.EncodeToString(sum[:]); got != test.sum {
+				t.Errorf("%v: resized image has checksum %s, expected %s", test.scaler, got, test.sum)
+			}
+		}
+	}
+}
+
+func TestScalerText(t *testing.T) {
+	t.Parallel()
+
+	for _, s := range []Scaler{CatmullRom, BiLinear, NearestNeighbor} {
+		text, err := s.MarshalText()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got Scaler
+		if err := got.UnmarshalText(text); err != nil || got != s {
+			t.Errorf("%q parsed to %v, %v; expected %v", text, got, err, s)
+		}
+	}
+	var s Scaler
+	if err := s.UnmarshalText([]byte("lanczos")); err == nil {
+		t.Error("unknown scaler parsed")
+	}
+}
@@ -4,19 +4,23 @@ package main
 
 import (
 	"archive/zip"
+	"bytes"
 	"crypto/sha1"
 	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
-
-	"golang.org/x/sync/errgroup"
 )
 
 const (
@@ -26,6 +30,8 @@ const (
 	// Metal is available from iOS 8 on devices, yet from version 13 on the
 	// simulator.
 	minSimulatorVersion = 13
+	// Mac Catalyst on Apple silicon requires iOS 14.
+	minCatalystVersion = 14
 )
 
 func buildIOS(tmpDir, target string, bi *buildInfo) error {
@@ -36,51 +42,300 @@ func buildIOS(tmpDir, target string, bi *buildInfo) error {
 		if framework == "" {
 			framework = fmt.Sprintf("%s.framework", UppercaseName(appName))
 		}
-		return archiveIOS(tmpDir, target, framework, bi)
+		if filepath.Ext(framework) == ".a" {
+			if err := archiveIOSLib(tmpDir, target, framework, bi); err != nil {
+				return err
+			}
+			addArtifact(framework, strings.Join(bi.archs, ","))
+			addArtifact(strings.TrimSuffix(framework, ".a")+".h", "")
+			return nil
+		}
+		if err := archiveIOS(tmpDir, target, framework, bi); err != nil {
+			return err
+		}
+		addArtifact(framework, strings.Join(bi.archs, ","))
+		return nil
 	case "exe":
 		out := *destPath
+		if target == "macos-catalyst" {
+			if out == "" {
+				out = appName + ".app"
+			}
+			if !strings.HasSuffix(out, ".app") {
+				return fmt.Errorf("the specified output directory %q does not end in .app", out)
+			}
+			if err := exeIOS(tmpDir, target, out, bi, false); err != nil {
+				return err
+			}
+			exe := filepath.Join(out, "Contents", "MacOS", UppercaseName(appName))
+			if err := extractSymbols(bi, exe, dsymPath(out)); err != nil {
+				return err
+			}
+			addAppArtifacts(bi, out)
+			return nil
+		}
 		if out == "" {
 			out = appName + ".ipa"
 		}
-		forDevice := strings.HasSuffix(out, ".ipa")
-		// Filter out unsupported architectures.
-		for i := len(bi.archs) - 1; i >= 0; i-- {
-			switch bi.archs[i] {
-			case "arm", "arm64":
-				if forDevice {
-					continue
-				}
-			case "386", "amd64":
-				if !forDevice {
-					continue
+		if !strings.HasSuffix(out, ".app") && !strings.HasSuffix(out, ".ipa") {
+			return fmt.Errorf("the specified output directory %q does not end in .app or .ipa", out)
+		}
+		forDevice := iosForDevice(bi, out)
+		if !forDevice && strings.HasSuffix(out, ".ipa") {
+			return fmt.Errorf("-simulator requires an .app output, not %q", out)
+		}
+		bi.archs = iosArchs(bi.archs, forDevice)
+		if len(bi.archs) == 0 {
+			return fmt.Errorf("none of the -arch architectures are supported for %q", out)
+		}
+		if strings.HasSuffix(out, ".app") {
+			if bi.upload {
+				return fmt.Errorf("-upload requires an .ipa output, not %q", out)
+			}
+			if err := exeIOS(tmpDir, target, out, bi, forDevice); err != nil {
+				return err
+			}
+			if err := extractSymbols(bi, filepath.Join(out, UppercaseName(appName)), dsymPath(out)); err != nil {
+				return err
+			}
+			if forDevice {
+				// Device apps must be signed for sideloading.
+				if err := signIOS(bi, tmpDir, out); err != nil {
+					return err
 				}
 			}
-
-			bi.archs = append(bi.archs[:i], bi.archs[i+1:]...)
-		}
-		if !forDevice && !strings.HasSuffix(out, ".app") {
-			return fmt.Errorf("the specified output directory %q does not end in .app or .ipa", out)
+			addAppArtifacts(bi, out)
+			return nil
 		}
-		if !forDevice {
-			return exeIOS(tmpDir, target, out, bi)
+		pack := signIPA
+		if bi.exportOptions != "" {
+			pack = exportIOS
 		}
-		payload := filepath.Join(tmpDir, "Payload")
-		appDir := filepath.Join(payload, appName+".app")
-		if err := os.MkdirAll(appDir, 0755); err != nil {
+		if err := pack(tmpDir, target, out, bi); err != nil {
 			return err
 		}
-		if err := exeIOS(tmpDir, target, appDir, bi); err != nil {
-			return err
+		addAppArtifacts(bi, out)
+		if bi.otaURL != "" {
+			if err := writeOTAManifest(bi, filepath.Join(filepath.Dir(out), "manifest.plist")); err != nil {
+				return err
+			}
 		}
-		if err := signIOS(bi, tmpDir, appDir); err != nil {
-			return err
+		if bi.keepApp && !dryRunSkip("copying the .app") {
+			app := strings.TrimSuffix(out, ".ipa") + ".app"
+			if err := keepIPAApp(tmpDir, out, app, bi); err != nil {
+				return err
+			}
+			addArtifact(app, strings.Join(bi.archs, ","))
 		}
-		return zipDir(out, tmpDir, "Payload")
+		if !bi.upload {
+			return nil
+		}
+		return uploadIOS(bi, out)
 	default:
 		panic("unreachable")
 	}
 }
 
+// iosForDevice reports whether the out app is built for devices rather than
+// the simulator: as specified by -simulator, or for .ipa outputs.
+func iosForDevice(bi *buildInfo, out string) bool {
+	if bi.simulator != nil {
+		return !*bi.simulator
+	}
+	return strings.HasSuffix(out, ".ipa")
+}
+
+// iosArchs returns the archs supported by devices or by the simulator.
+func iosArchs(archs []string, device bool) []string {
+	var supported []string
+	for _, a := range archs {
+		switch a {
+		case "arm", "arm64":
+			if device {
+				supported = append(supported, a)
+			}
+		case "386", "amd64":
+			if !device {
+				supported = append(supported, a)
+			}
+		}
+	}
+	return supported
+}
+
+// signIPA builds the app, signs it with codesign and packages it in the out
+// .ipa file.
+func signIPA(tmpDir, target, out string, bi *buildInfo) error {
+	payload := filepath.Join(tmpDir, "Payload")
+	appDir := filepath.Join(payload, bi.name+".app")
+	if err := os.MkdirAll(appDir, 0755); err != nil {
+		return err
+	}
+	if err := exeIOS(tmpDir, target, appDir, bi, true); err != nil {
+		return err
+	}
+	if err := extractSymbols(bi, filepath.Join(appDir, UppercaseName(bi.name)), dsymPath(out)); err != nil {
+		return err
+	}
+	if err := signIOS(bi, tmpDir, appDir); err != nil {
+		return err
+	}
+	return zipDir(out, tmpDir, "Payload")
+}
+
+// uploadIOS uploads the ipa file to App Store Connect, printing the
+// progress of the upload.
+func uploadIOS(bi *buildInfo, ipa string) error {
+	return retry(bi.retries, "upload", func() error {
+		cmd := uploadCmd(bi, ipa)
+		// Keep the output for recognizing transient failures.
+		out := new(bytes.Buffer)
+		cmd.Stdout = io.MultiWriter(os.Stderr, out)
+		cmd.Stderr = cmd.Stdout
+		if *printCommands || *dryRun {
+			fmt.Fprintf(cmdLog, "%s\n", strings.Join(cmd.Args, " "))
+		}
+		if *dryRun {
+			return nil
+		}
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("upload of %s failed: %v%s", ipa, err, lastLines(out.Bytes(), cmdErrLines))
+		}
+		return nil
+	})
+}
+
+// uploadCmd returns the command that uploads the ipa file with the App Store
+// Connect API key. The altool command looks up the private key in the
+// AuthKey_<key id>.p8 file of a private_keys directory.
+func uploadCmd(bi *buildInfo, ipa string) *exec.Cmd {
+	platform := "ios"
+	if bi.target == "tvos" {
+		platform = "appletvos"
+	}
+	return exec.Command(
+		"xcrun", "altool",
+		"--upload-app",
+		"-f", ipa,
+		"-t", platform,
+		"--apiKey", bi.apiKey,
+		"--apiIssuer", bi.apiIssuer,
+	)
+}
+
+// exportIOS builds the app into an Xcode archive and exports it to the out
+// .ipa file with xcodebuild, which signs the app according to the export
+// options.
+func exportIOS(tmpDir, target, out string, bi *buildInfo) error {
+	archive := filepath.Join(tmpDir, bi.name+".xcarchive")
+	appDir := filepath.Join(archive, "Products", "Applications", bi.name+".app")
+	if err := os.MkdirAll(appDir, 0755); err != nil {
+		return err
+	}
+	if err := exeIOS(tmpDir, target, appDir, bi, true); err != nil {
+		return err
+	}
+	dsym := filepath.Join(archive, "dSYMs", bi.name+".app.dSYM")
+	if err := extractSymbols(bi, filepath.Join(appDir, UppercaseName(bi.name)), dsym); err != nil {
+		return err
+	}
+	if !dryRunSkip("copying " + dsym) {
+		if err := copyDir(dsymPath(out), dsym); err != nil {
+			return err
+		}
+	}
+	if err := os.WriteFile(filepath.Join(archive, "Info.plist"), []byte(xcarchivePlist(bi)), 0660); err != nil {
+		return err
+	}
+	exportDir := filepath.Join(tmpDir, "export")
+	if _, err := runCmd(exportArchiveCmd(archive, bi.exportOptions, exportDir)); err != nil {
+		return err
+	}
+	if dryRunSkip("copying the exported .ipa") {
+		return nil
+	}
+	ipas, err := filepath.Glob(filepath.Join(exportDir, "*.ipa"))
+	if err != nil {
+		return err
+	}
+	if len(ipas) != 1 {
+		return fmt.Errorf("xcodebuild exported %d .ipa files, expected 1", len(ipas))
+	}
+	return copyFile(out, ipas[0])
+}
+
+// exportArchiveCmd returns the command that exports the Xcode archive to
+// the exportDir directory.
+func exportArchiveCmd(archive, options, exportDir string) *exec.Cmd {
+	return exec.Command(
+		"xcodebuild",
+		"-exportArchive",
+		"-archivePath", archive,
+		"-exportOptionsPlist", options,
+		"-exportPath", exportDir,
+	)
+}
+
+// xcarchivePlist returns the Info.plist of an Xcode archive of the app.
+func xcarchivePlist(bi *buildInfo) string {
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>ApplicationProperties</key>
+	<dict>
+		<key>ApplicationPath</key>
+		<string>Applications/%[1]s.app</string>
+		<key>CFBundleIdentifier</key>
+		<string>%[2]s</string>
+		<key>CFBundleShortVersionString</key>
+		<string>%[3]s</string>
+		<key>CFBundleVersion</key>
+		<string>%[4]d</string>
+	</dict>
+	<key>ArchiveVersion</key>
+	<integer>2</integer>
+	<key>CreationDate</key>
+	<date>%[5]s</date>
+	<key>Name</key>
+	<string>%[1]s</string>
+	<key>SchemeName</key>
+	<string>%[1]s</string>
+</dict>
+</plist>`, bi.name, bi.appID, bi.version, bi.version.VersionCode, time.Now().UTC().Format(time.RFC3339))
+}
+
+// extractSymbols extracts the debug information of the exe binary into the
+// dsym bundle and strips exe, unless symbols are to be preserved. Apple
+// binaries are linked with symbols for dsymutil to work.
+func extractSymbols(bi *buildInfo, exe, dsym string) error {
+	if _, err := runCmd(dsymutilCmd(exe, dsym)); err != nil {
+		return err
+	}
+	if !bi.strip {
+		return nil
+	}
+	_, err := runCmd(exec.Command("xcrun", "strip", exe))
+	return err
+}
+
+// addAppArtifacts records the app at out and its dSYM bundle as build
+// artifacts.
+func addAppArtifacts(bi *buildInfo, out string) {
+	archs := strings.Join(bi.archs, ",")
+	addArtifact(out, archs)
+	addArtifact(dsymPath(out), archs)
+}
+
+// dsymPath returns the path of the dSYM bundle for the app or archive at out.
+func dsymPath(out string) string {
+	return strings.TrimSuffix(out, filepath.Ext(out)) + ".app.dSYM"
+}
+
+func dsymutilCmd(exe, dst string) *exec.Cmd {
+	return exec.Command("xcrun", "dsymutil", exe, "-o", dst)
+}
+
 func signIOS(bi *buildInfo, tmpDir, app string) error {
 	home, err := os.UserHomeDir()
 	if err != nil {
@@ -91,15 +346,16 @@ func signIOS(bi *buildInfo, tmpDir, app string) error {
 	if err != nil {
 		return err
 	}
-	provInfo := filepath.Join(tmpDir, "provision.plist")
 	var avail []string
-	for _, prov := range provisions {
+	var profiles []provisionProfile
+	for i, prov := range provisions {
+		provInfo := filepath.Join(tmpDir, fmt.Sprintf("provision-%d.plist", i))
 		// Decode the provision file to a plist.
-		_, err := runCmd(exec.Command("security", "cms", "-D", "-i", prov, "-o", provInfo))
+		_, err := runQuery(exec.Command("security", "cms", "-D", "-i", prov, "-o", provInfo))
 		if err != nil {
 			return err
 		}
-		expUnix, err := runCmd(exec.Command("/usr/libexec/PlistBuddy", "-c", "Print:ExpirationDate", provInfo))
+		expUnix, err := runQuery(exec.Command("/usr/libexec/PlistBuddy", "-c", "Print:ExpirationDate", provInfo))
 		if err != nil {
 			return err
 		}
@@ -110,11 +366,11 @@ func signIOS(bi *buildInfo, tmpDir, app string) error {
 		if exp.Before(time.Now()) {
 			continue
 		}
-		appIDPrefix, err := runCmd(exec.Command("/usr/libexec/PlistBuddy", "-c", "Print:ApplicationIdentifierPrefix:0", provInfo))
+		appIDPrefix, err := runQuery(exec.Command("/usr/libexec/PlistBuddy", "-c", "Print:ApplicationIdentifierPrefix:0", provInfo))
 		if err != nil {
 			return err
 		}
-		provAppID, err := runCmd(exec.Command("/usr/libexec/PlistBuddy", "-c", "Print:Entitlements:application-identifier", provInfo))
+		provAppID, err := runQuery(exec.Command("/usr/libexec/PlistBuddy", "-c", "Print:Entitlements:application-identifier", provInfo))
 		if err != nil {
 			return err
 		}
@@ -123,34 +379,377 @@ func signIOS(bi *buildInfo, tmpDir, app string) error {
 		if expAppID != provAppID {
 			continue
 		}
-		// Copy provisioning file.
-		embedded := filepath.Join(app, "embedded.mobileprovision")
-		if err := copyFile(embedded, prov); err != nil {
+		certs, err := provisionCerts(provInfo)
+		if err != nil {
 			return err
 		}
-		certDER, err := runCmdRaw(exec.Command("/usr/libexec/PlistBuddy", "-c", "Print:DeveloperCertificates:0", provInfo))
-		if err != nil {
+		profiles = append(profiles, provisionProfile{path: prov, plist: provInfo, appID: provAppID, certs: certs})
+	}
+	if len(profiles) == 0 {
+		return fmt.Errorf("sign: no valid provisioning profile found for bundle id %q among %v", bi.appID, avail)
+	}
+	identities, err := codesignIdentities()
+	if err != nil {
+		return err
+	}
+	profile, idHex, err := selectProvision(profiles, identities)
+	if err != nil {
+		return fmt.Errorf("sign: bundle id %q: %v", bi.appID, err)
+	}
+	// Copy provisioning file.
+	embedded := filepath.Join(app, "embedded.mobileprovision")
+	if err := copyFile(embedded, profile.path); err != nil {
+		return err
+	}
+	entitlements, err := runQuery(exec.Command("/usr/libexec/PlistBuddy", "-x", "-c", "Print:Entitlements", profile.plist))
+	if err != nil {
+		return err
+	}
+	entitlements, err = signEntitlements(bi, entitlements)
+	if err != nil {
+		return fmt.Errorf("sign: provisioning profile %q: %v", profile.path, err)
+	}
+	if len(bi.domains) > 0 {
+		for _, d := range bi.domains {
+			_, host, _ := strings.Cut(d, ":")
+			host, _, _ = strings.Cut(host, "?")
+			fmt.Fprintf(os.Stderr, "gogio: serve https://%s/.well-known/apple-app-site-association listing the app id %s\n", strings.TrimPrefix(host, "*."), profile.appID)
+		}
+	}
+	entFile := filepath.Join(tmpDir, "entitlements.plist")
+	if err := os.WriteFile(entFile, []byte(entitlements), 0660); err != nil {
+		return err
+	}
+	// Embedded frameworks are signed before the app that contains them.
+	frameworks, err := filepath.Glob(filepath.Join(bundleContents(app, bi.target), "Frameworks", "*"))
+	if err != nil {
+		return err
+	}
+	for _, fw := range frameworks {
+		if err := codesign(bi, func() *exec.Cmd { return codesignFrameworkCmd(idHex, fw, bi.timestamp) }); err != nil {
 			return err
 		}
+	}
+	return codesign(bi, func() *exec.Cmd { return codesignCmd(idHex, entFile, app, bi.timestamp) })
+}
+
+// bundleContents returns the directory of the app bundle that contains its
+// Info.plist and Frameworks: the bundle root of iOS and tvOS apps, and the
+// Contents directory of Mac Catalyst apps, which use the MacOS bundle layout.
+func bundleContents(app, target string) string {
+	if target == "macos-catalyst" {
+		return filepath.Join(app, "Contents")
+	}
+	return app
+}
+
+// provisionProfile is an unexpired provisioning profile for the app.
+type provisionProfile struct {
+	path string
+	// plist is the decoded profile.
+	plist string
+	appID string
+	// certs are the DER encoded developer certificates of the profile.
+	certs [][]byte
+}
+
+// signIdentity is a code signing identity available to codesign.
+type signIdentity struct {
+	// hash is the upper case hex SHA-1 hash of the certificate.
+	hash string
+	name string
+}
+
+// provisionCerts returns the developer certificates of the decoded
+// provisioning profile.
+func provisionCerts(plist string) ([][]byte, error) {
+	var certs [][]byte
+	for i := 0; ; i++ {
+		der, err := execCmd(exec.Command("/usr/libexec/PlistBuddy", "-c", fmt.Sprintf("Print:DeveloperCertificates:%d", i), plist))
+		if err != nil {
+			if i > 0 {
+				// Past the last certificate.
+				return certs, nil
+			}
+			return nil, err
+		}
 		// Omit trailing newline.
-		certDER = certDER[:len(certDER)-1]
-		entitlements, err := runCmd(exec.Command("/usr/libexec/PlistBuddy", "-x", "-c", "Print:Entitlements", provInfo))
+		certs = append(certs, bytes.TrimSuffix(der, []byte("\n")))
+	}
+}
+
+// codesignIdentities returns the valid code signing identities in the
+// keychain.
+func codesignIdentities() ([]signIdentity, error) {
+	out, err := runQuery(exec.Command("security", "find-identity", "-v", "-p", "codesigning"))
+	if err != nil {
+		return nil, err
+	}
+	return parseIdentities(out), nil
+}
+
+// parseIdentities parses the identities of the output of security
+// find-identity, which are listed in numbered lines of the hex SHA-1 hash
+// and the quoted name of the certificate.
+func parseIdentities(out string) []signIdentity {
+	var ids []signIdentity
+	for _, line := range strings.Split(out, "\n") {
+		_, rest, ok := strings.Cut(strings.TrimSpace(line), ") ")
+		if !ok {
+			continue
+		}
+		hash, name, _ := strings.Cut(strings.TrimSpace(rest), " ")
+		if _, err := hex.DecodeString(hash); err != nil || len(hash) != 2*sha1.Size {
+			continue
+		}
+		ids = append(ids, signIdentity{hash: strings.ToUpper(hash), name: strings.Trim(name, `"`)})
+	}
+	return ids
+}
+
+// selectProvision returns the first of the profiles with a developer
+// certificate of an installed identity, along with the hash of the
+// identity. Profiles whose certificates aren't installed would fail to
+// sign.
+func selectProvision(profiles []provisionProfile, ids []signIdentity) (provisionProfile, string, error) {
+	installed := make(map[string]bool)
+	for _, id := range ids {
+		installed[id.hash] = true
+	}
+	var paths []string
+	for _, p := range profiles {
+		for _, cert := range p.certs {
+			sum := sha1.Sum(cert)
+			if hash := strings.ToUpper(hex.EncodeToString(sum[:])); installed[hash] {
+				return p, hash, nil
+			}
+		}
+		paths = append(paths, p.path)
+	}
+	if len(ids) == 0 {
+		return provisionProfile{}, "", fmt.Errorf("no code signing identity is installed for the certificates of the provisioning profiles %v", paths)
+	}
+	var names []string
+	for _, id := range ids {
+		names = append(names, fmt.Sprintf("%s (%s)", id.name, id.hash))
+	}
+	return provisionProfile{}, "", fmt.Errorf("the certificates of the provisioning profiles %v match none of the installed code signing identities: %s", paths, strings.Join(names, ", "))
+}
+
+func codesignCmd(identity, entitlements, app string, timestamp bool) *exec.Cmd {
+	return exec.Command("codesign", "-s", identity, "-v", "--entitlements", entitlements, timestampFlag(timestamp), app)
+}
+
+// codesignFrameworkCmd returns the command that signs an embedded framework
+// or dynamic library, replacing any existing signature.
+func codesignFrameworkCmd(identity, framework string, timestamp bool) *exec.Cmd {
+	return exec.Command("codesign", "-f", "-s", identity, "-v", timestampFlag(timestamp), framework)
+}
+
+// timestampFlag returns the codesign flag that includes a secure timestamp
+// from Apple's timestamp server in the signature, or that leaves it out.
+func timestampFlag(timestamp bool) string {
+	if timestamp {
+		return "--timestamp"
+	}
+	return "--timestamp=none"
+}
+
+// codesign runs the codesign command returned by cmd, retrying it while
+// the timestamp server is unavailable.
+func codesign(bi *buildInfo, cmd func() *exec.Cmd) error {
+	err := retry(bi.retries, "signing", func() error {
+		_, err := runCmd(cmd())
+		return err
+	})
+	if err != nil && bi.timestamp && strings.Contains(err.Error(), "timestamp service") {
+		return fmt.Errorf("sign: %v\nthe timestamp server didn't respond; try again later, or sign without a timestamp with -no-timestamp", err)
+	}
+	return err
+}
+
+// validateFramework checks a path of the -embed-frameworks flag.
+func validateFramework(path string) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	switch filepath.Ext(path) {
+	case ".framework":
+		if !fi.IsDir() {
+			return fmt.Errorf("%s is not a directory", path)
+		}
+	case ".dylib":
+		if fi.IsDir() {
+			return fmt.Errorf("%s is a directory", path)
+		}
+	default:
+		return fmt.Errorf("%s is not a .framework or .dylib", path)
+	}
+	return nil
+}
+
+// embedFrameworks copies the embedded frameworks into the Frameworks
+// directory of the app contents, and changes their install names and the
+// references of exe to them to be relative to the run path of exe.
+func embedFrameworks(bi *buildInfo, contents, exe string) error {
+	if len(bi.frameworks) == 0 {
+		return nil
+	}
+	dir := filepath.Join(contents, "Frameworks")
+	embedded, err := copyFrameworks(dir, bi.frameworks)
+	if err != nil {
+		return err
+	}
+	rpath := "@executable_path/Frameworks"
+	if bi.target == "macos-catalyst" {
+		rpath = "@executable_path/../Frameworks"
+	}
+	if _, err := runCmd(exec.Command("xcrun", "install_name_tool", "-add_rpath", rpath, exe)); err != nil {
+		return err
+	}
+	for _, bin := range embedded {
+		rel, err := filepath.Rel(dir, bin)
 		if err != nil {
 			return err
 		}
-		entFile := filepath.Join(tmpDir, "entitlements.plist")
-		if err := os.WriteFile(entFile, []byte(entitlements), 0660); err != nil {
+		id := "@rpath/" + filepath.ToSlash(rel)
+		// The install name is printed after the file name.
+		out, err := runQuery(exec.Command("xcrun", "otool", "-D", bin))
+		if err != nil {
 			return err
 		}
-		identity := sha1.Sum(certDER)
-		idHex := hex.EncodeToString(identity[:])
-		_, err = runCmd(exec.Command("codesign", "-s", idHex, "-v", "--entitlements", entFile, app))
-		return err
+		lines := strings.Split(out, "\n")
+		if _, err := runCmd(exec.Command("xcrun", "install_name_tool", "-id", id, bin)); err != nil {
+			return err
+		}
+		if len(lines) < 2 {
+			continue
+		}
+		oldID := strings.TrimSpace(lines[len(lines)-1])
+		if _, err := runCmd(exec.Command("xcrun", "install_name_tool", "-change", oldID, id, exe)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyFrameworks copies the frameworks and dynamic libraries into dir, and
+// returns the paths of their copied binaries.
+func copyFrameworks(dir string, frameworks []string) ([]string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	var binaries []string
+	for _, fw := range frameworks {
+		base := filepath.Base(fw)
+		dst := filepath.Join(dir, base)
+		if filepath.Ext(fw) == ".dylib" {
+			if err := copyFile(dst, fw); err != nil {
+				return nil, err
+			}
+			binaries = append(binaries, dst)
+			continue
+		}
+		if err := copyDir(dst, fw); err != nil {
+			return nil, err
+		}
+		binaries = append(binaries, filepath.Join(dst, strings.TrimSuffix(base, ".framework")))
+	}
+	return binaries, nil
+}
+
+// signEntitlements returns the entitlements of the provisioning profile
+// with the associated domains and push environment of the app.
+func signEntitlements(bi *buildInfo, entitlements string) (string, error) {
+	if len(bi.domains) > 0 {
+		entitlements = setAssociatedDomains(entitlements, bi.domains)
+	}
+	if bi.push != "" {
+		if !apsEnvironmentKey.MatchString(entitlements) {
+			return "", errors.New("the Push Notifications capability is missing")
+		}
+		entitlements = setPushEnvironment(entitlements, bi.push)
+	}
+	return entitlements, nil
+}
+
+// apsEnvironmentKey matches the push notification entitlement of
+// provisioning profiles.
+var apsEnvironmentKey = regexp.MustCompile(`(?s)\s*<key>aps-environment</key>\s*<string>[^<]*</string>`)
+
+// setPushEnvironment replaces the push notification entitlement of the
+// entitlements plist with the APNs environment.
+func setPushEnvironment(entitlements, env string) string {
+	entitlements = apsEnvironmentKey.ReplaceAllString(entitlements, "")
+	end := strings.LastIndex(entitlements, "</dict>")
+	if end == -1 {
+		return entitlements
+	}
+	return entitlements[:end] + "\t<key>aps-environment</key>\n\t<string>" + env + "</string>\n" + entitlements[end:]
+}
+
+// associatedDomainsKey matches the associated domains entitlement of
+// provisioning profiles, which is typically the "*" wildcard.
+var associatedDomainsKey = regexp.MustCompile(`(?s)\s*<key>com\.apple\.developer\.associated-domains</key>\s*(<string>[^<]*</string>|<array/>|<array>.*?</array>)`)
+
+// setAssociatedDomains replaces the associated domains entitlement of the
+// entitlements plist with the domains.
+func setAssociatedDomains(entitlements string, domains []string) string {
+	entitlements = associatedDomainsKey.ReplaceAllString(entitlements, "")
+	end := strings.LastIndex(entitlements, "</dict>")
+	if end == -1 {
+		return entitlements
+	}
+	return entitlements[:end] + strings.TrimPrefix(plistStringArray("com.apple.developer.associated-domains", domains), "\n") + "\n" + entitlements[end:]
+}
+
+// backgroundModes are the known UIBackgroundModes values.
+var backgroundModes = map[string]bool{
+	"audio":                true,
+	"location":             true,
+	"voip":                 true,
+	"external-accessory":   true,
+	"bluetooth-central":    true,
+	"bluetooth-peripheral": true,
+	"fetch":                true,
+	"remote-notification":  true,
+	"processing":           true,
+	"nearby-interaction":   true,
+	"push-to-talk":         true,
+}
+
+// validateAssociatedDomain checks an associated domain in the
+// service:domain[?mode=developer|managed] format.
+func validateAssociatedDomain(d string) error {
+	service, host, ok := strings.Cut(d, ":")
+	switch service {
+	case "applinks", "webcredentials", "activitycontinuation", "appclips":
+	default:
+		return fmt.Errorf("associated domain %q must start with applinks:, webcredentials:, activitycontinuation: or appclips:", d)
+	}
+	host, mode, hasMode := strings.Cut(host, "?")
+	if hasMode && mode != "mode=developer" && mode != "mode=managed" && mode != "mode=developer+managed" {
+		return fmt.Errorf("associated domain %q has an invalid mode %q", d, mode)
+	}
+	labels := strings.Split(strings.TrimPrefix(host, "*."), ".")
+	if !ok || len(labels) < 2 {
+		return fmt.Errorf("associated domain %q has an invalid domain name", d)
+	}
+	for _, l := range labels {
+		if l == "" || l[0] == '-' || l[len(l)-1] == '-' {
+			return fmt.Errorf("associated domain %q has an invalid domain name", d)
+		}
+		for _, c := range l {
+			if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '-') {
+				return fmt.Errorf("associated domain %q has an invalid domain name", d)
+			}
+		}
 	}
-	return fmt.Errorf("sign: no valid provisioning profile found for bundle id %q among %v", bi.appID, avail)
+	return nil
 }
 
-func exeIOS(tmpDir, target, app string, bi *buildInfo) error {
+func exeIOS(tmpDir, target, app string, bi *buildInfo, device bool) error {
 	if bi.appID == "" {
 		return errors.New("app id is empty; use -appid to set it")
 	}
@@ -160,10 +759,21 @@ func exeIOS(tmpDir, target, app string, bi *buildInfo) error {
 	if err := os.Mkdir(app, 0755); err != nil {
 		return err
 	}
+	contents := bundleContents(app, target)
+	exeDir, resources := app, app
+	if target == "macos-catalyst" {
+		exeDir = filepath.Join(contents, "MacOS")
+		resources = filepath.Join(contents, "Resources")
+		for _, dir := range []string{exeDir, resources} {
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return err
+			}
+		}
+	}
 	appName := UppercaseName(bi.name)
-	exe := filepath.Join(app, appName)
+	exe := filepath.Join(exeDir, appName)
 	lipo := exec.Command("xcrun", "lipo", "-o", exe, "-create")
-	var builds errgroup.Group
+	builds := newBuildGroup(bi.jobs)
 	for _, a := range bi.archs {
 		clang, cflags, err := iosCompilerFor(target, a, bi.minsdk)
 		if err != nil {
@@ -172,13 +782,12 @@ func exeIOS(tmpDir, target, app string, bi *buildInfo) error {
 		cflags = append(cflags,
 			"-fobjc-arc",
 		)
-		cflagsLine := strings.Join(cflags, " ")
 		exeSlice := filepath.Join(tmpDir, "app-"+a)
 		lipo.Args = append(lipo.Args, exeSlice)
 		compile := exec.Command(
 			"go",
 			"build",
-			"-ldflags=-s -w "+bi.ldflags,
+			"-ldflags="+bi.ldflags,
 			"-o", exeSlice,
 			"-tags", bi.tags,
 			bi.pkgPath,
@@ -188,12 +797,12 @@ func exeIOS(tmpDir, target, app string, bi *buildInfo) error {
 			"GOOS=ios",
 			"GOARCH="+a,
 			"CGO_ENABLED=1",
-			"CC="+clang,
-			"CGO_CFLAGS="+cflagsLine,
-			"CGO_LDFLAGS=-lresolv "+cflagsLine,
 		)
+		compile.Env = append(compile.Env, cgoEnv(bi, clang, cflags, append([]string{"-lresolv"}, cflags...))...)
+		arch, slice := a, exeSlice
 		builds.Go(func() error {
-			_, err := runCmd(compile)
+			err := runGoBuild(bi, compile, slice)
+			emitBuild(arch, err)
 			return err
 		})
 	}
@@ -203,13 +812,22 @@ func exeIOS(tmpDir, target, app string, bi *buildInfo) error {
 	if _, err := runCmd(lipo); err != nil {
 		return err
 	}
-	infoPlist := buildInfoPlist(bi)
-	plistFile := filepath.Join(app, "Info.plist")
+	if err := embedFrameworks(bi, contents, exe); err != nil {
+		return err
+	}
+	if err := copyAssets(resources, bi); err != nil {
+		return err
+	}
+	if err := writeLocalizedNames(resources, bi.localNames); err != nil {
+		return err
+	}
+	infoPlist := buildInfoPlist(bi, device)
+	plistFile := filepath.Join(contents, "Info.plist")
 	if err := os.WriteFile(plistFile, []byte(infoPlist), 0660); err != nil {
 		return err
 	}
 	if _, err := os.Stat(bi.iconPath); err == nil {
-		assetPlist, err := iosIcons(bi, tmpDir, app, bi.iconPath)
+		assetPlist, err := iosIcons(bi, tmpDir, resources, bi.iconPath)
 		if err != nil {
 			return err
 		}
@@ -223,20 +841,217 @@ func exeIOS(tmpDir, target, app string, bi *buildInfo) error {
 			return err
 		}
 	}
-	if _, err := runCmd(exec.Command("plutil", "-convert", "binary1", plistFile)); err != nil {
-		return err
+	if _, err := runCmd(exec.Command("plutil", "-convert", "binary1", plistFile)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// iosIcons builds an asset catalog and compile it with the Xcode command actool.
+// iosIcons returns the asset plist file to be merged into Info.plist.
+func iosIcons(bi *buildInfo, tmpDir, appDir, icon string) (string, error) {
+	assets, appIconName, altIcons, err := iosAssetCatalog(bi, tmpDir, icon)
+	if err != nil {
+		return "", err
+	}
+	assetPlist := filepath.Join(tmpDir, "assets.plist")
+	_, err = runCmd(actoolCmd(bi, appDir, assets, assetPlist, appIconName, altIcons))
+	return assetPlist, err
+}
+
+// iosAssetCatalog creates the assets catalog of the app icons in tmpDir,
+// and returns its path along with the names of the app icon and alternate
+// icons. The app icon is generated from the icon image, or copied from the
+// icon if it is an asset catalog.
+func iosAssetCatalog(bi *buildInfo, tmpDir, icon string) (assets, appIconName string, altIcons []string, err error) {
+	assets = filepath.Join(tmpDir, "Assets.xcassets")
+	if err := os.Mkdir(assets, 0700); err != nil {
+		return "", "", nil, err
+	}
+	switch {
+	case isIconCatalog(icon):
+		appIconName, err = copyIconCatalog(assets, icon, bi.target)
+		if err != nil {
+			return "", "", nil, err
+		}
+	case bi.target == "tvos":
+		appIconName = "Brand Assets"
+		if err := tvosBrandAssets(filepath.Join(assets, appIconName+".brandassets"), icon); err != nil {
+			return "", "", nil, err
+		}
+	default:
+		appIconName = "AppIcon"
+		if err := iosAppIconSet(filepath.Join(assets, appIconName+".appiconset"), icon); err != nil {
+			return "", "", nil, err
+		}
+	}
+	if bi.target != "tvos" {
+		for _, alt := range bi.altIcons {
+			name := altIconName(alt)
+			if err := iosAppIconSet(filepath.Join(assets, name+".appiconset"), alt); err != nil {
+				return "", "", nil, err
+			}
+			altIcons = append(altIcons, name)
+		}
+	}
+	return assets, appIconName, altIcons, nil
+}
+
+// isIconCatalog reports whether icon is an asset catalog (.xcassets) or app
+// icon set (.appiconset) directory.
+func isIconCatalog(icon string) bool {
+	switch filepath.Ext(icon) {
+	case ".xcassets", ".appiconset":
+		fi, err := os.Stat(icon)
+		return err == nil && fi.IsDir()
+	}
+	return false
+}
+
+// copyIconCatalog copies the icon asset catalog or app icon set into the
+// assets directory, and returns the name of the app icon. The app icon set
+// is validated for target. For tvOS, the app icon is the brand assets of
+// the catalog.
+func copyIconCatalog(assets, icon, target string) (string, error) {
+	if filepath.Ext(icon) == ".appiconset" {
+		if target == "tvos" {
+			return "", fmt.Errorf("%s: tvOS requires an asset catalog with brand assets", icon)
+		}
+		if err := validateAppIconSet(icon, target); err != nil {
+			return "", err
+		}
+		return altIconName(icon), copyDir(filepath.Join(assets, filepath.Base(icon)), icon)
+	}
+	ext := ".appiconset"
+	if target == "tvos" {
+		ext = ".brandassets"
+	}
+	sets, err := filepath.Glob(filepath.Join(icon, "*"+ext))
+	if err != nil {
+		return "", err
+	}
+	var set string
+	switch len(sets) {
+	case 0:
+		return "", fmt.Errorf("%s: no %s app icon found", icon, ext)
+	case 1:
+		set = sets[0]
+	default:
+		// Prefer the app icon named by Xcode.
+		for _, s := range sets {
+			if altIconName(s) == "AppIcon" || altIconName(s) == "Brand Assets" {
+				set = s
+			}
+		}
+		if set == "" {
+			return "", fmt.Errorf("%s: more than one %s app icon found", icon, ext)
+		}
+	}
+	if ext == ".appiconset" {
+		if err := validateAppIconSet(set, target); err != nil {
+			return "", err
+		}
+	}
+	return altIconName(set), copyDir(assets, icon)
+}
+
+// validateAppIconSet checks that the Contents.json file of an app icon set
+// lists the icon sizes required by target, and that the listed files exist.
+func validateAppIconSet(dir, target string) error {
+	data, err := os.ReadFile(filepath.Join(dir, "Contents.json"))
+	if err != nil {
+		return err
+	}
+	var contents struct {
+		Images []struct {
+			Size     string `json:"size"`
+			Idiom    string `json:"idiom"`
+			Scale    string `json:"scale"`
+			Filename string `json:"filename"`
+		} `json:"images"`
+	}
+	if err := json.Unmarshal(data, &contents); err != nil {
+		return fmt.Errorf("%s: %v", dir, err)
+	}
+	sizes := make(map[string]bool)
+	universal := false
+	for _, img := range contents.Images {
+		if img.Filename == "" {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(dir, img.Filename)); err != nil {
+			return fmt.Errorf("%s: %v", dir, err)
+		}
+		size := img.Size
+		if img.Scale != "" && img.Scale != "1x" {
+			size += "@" + img.Scale
+		}
+		sizes[size] = true
+		if img.Idiom == "universal" {
+			universal = true
+		}
+	}
+	var required []string
+	switch {
+	case target == "macos":
+		required = []string{"512x512", "512x512@2x"}
+	case universal:
+		// A single size app icon is resized by actool.
+		required = []string{"1024x1024"}
+	default:
+		required = []string{"60x60@2x", "60x60@3x", "1024x1024"}
+	}
+	for _, size := range required {
+		if !sizes[size] {
+			return fmt.Errorf("%s: missing %s app icon", dir, size)
+		}
 	}
 	return nil
 }
 
-// iosIcons builds an asset catalog and compile it with the Xcode command actool.
-// iosIcons returns the asset plist file to be merged into Info.plist.
-func iosIcons(bi *buildInfo, tmpDir, appDir, icon string) (string, error) {
-	assets := filepath.Join(tmpDir, "Assets.xcassets")
-	if err := os.Mkdir(assets, 0700); err != nil {
-		return "", err
+// actoolCmd returns the command that compiles the assets catalog into
+// appDir. Alternate app icons are declared by actool in the CFBundleIcons
+// entry of the partial Info.plist.
+func actoolCmd(bi *buildInfo, appDir, assets, assetPlist, appIconName string, altIcons []string) *exec.Cmd {
+	minsdk := bi.minsdk
+	if minsdk == 0 {
+		switch bi.target {
+		case "tvos":
+			minsdk = minTVOSVersion
+		case "macos-catalyst":
+			minsdk = minCatalystVersion
+		default:
+			minsdk = minIOSVersion
+		}
+	}
+	compile := exec.Command(
+		"actool",
+		"--compile", appDir,
+		"--platform", iosPlatformFor(bi.target),
+		"--minimum-deployment-target", strconv.Itoa(minsdk),
+		"--app-icon", appIconName,
+		"--output-partial-info-plist", assetPlist,
+	)
+	for _, name := range altIcons {
+		compile.Args = append(compile.Args, "--alternate-app-icon", name)
+	}
+	if bi.target == "macos-catalyst" {
+		compile.Args = append(compile.Args, "--ui-framework-family", "uikit", "--target-device", "mac")
 	}
-	appIcon := filepath.Join(assets, "AppIcon.appiconset")
+	compile.Args = append(compile.Args, assets)
+	return compile
+}
+
+// altIconName returns the name of an alternate icon, which is the
+// name of its file without extension.
+func altIconName(path string) string {
+	base := filepath.Base(path)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// iosAppIconSet builds the iPhone and iPad app icon set in the appIcon
+// directory.
+func iosAppIconSet(appIcon, icon string) error {
 	err := buildIcons(appIcon, icon, []iconVariant{
 		{path: "ios_2x.png", size: 120},
 		{path: "ios_3x.png", size: 180},
@@ -245,7 +1060,7 @@ func iosIcons(bi *buildInfo, tmpDir, appDir, icon string) (string, error) {
 		{path: "ios_store.png", size: 1024, fill: true},
 	})
 	if err != nil {
-		return "", err
+		return err
 	}
 	contentJson := `{
 	"images" : [
@@ -270,36 +1085,157 @@ func iosIcons(bi *buildInfo, tmpDir, appDir, icon string) (string, error) {
 	]
 }`
 	contentFile := filepath.Join(appIcon, "Contents.json")
-	if err := os.WriteFile(contentFile, []byte(contentJson), 0600); err != nil {
-		return "", err
+	return os.WriteFile(contentFile, []byte(contentJson), 0600)
+}
+
+// tvosLayer is a layer image of a tvOS icon.
+type tvosLayer struct {
+	name string
+	path string
+}
+
+// tvosIconLayers returns the front, middle and back layers of the tvOS icon,
+// which are expected next to icon as <name>_front.png, <name>_middle.png
+// and <name>_back.png. The middle layer is optional.
+func tvosIconLayers(icon string) ([]tvosLayer, error) {
+	base := strings.TrimSuffix(icon, filepath.Ext(icon))
+	var layers []tvosLayer
+	for _, name := range []string{"Front", "Middle", "Back"} {
+		path := base + "_" + strings.ToLower(name) + ".png"
+		if _, err := os.Stat(path); err != nil {
+			if name == "Middle" && errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, fmt.Errorf("tvOS requires a layered icon; add %s_front.png and %[1]s_back.png (and optionally %[1]s_middle.png) next to %s: %v", base, icon, err)
+		}
+		layers = append(layers, tvosLayer{name: name, path: path})
 	}
-	assetPlist := filepath.Join(tmpDir, "assets.plist")
+	return layers, nil
+}
 
-	minsdk := bi.minsdk
-	if minsdk == 0 {
-		minsdk = minIOSVersion
+// tvosIconVariants returns the images of the Brand Assets catalog to
+// generate from each layer, keyed by layer name. The back layer also
+// provides the top shelf images.
+func tvosIconVariants(layers []tvosLayer) map[string][]iconVariant {
+	variants := make(map[string][]iconVariant)
+	for _, l := range layers {
+		file := strings.ToLower(l.name)
+		layer := l.name + ".imagestacklayer/Content.imageset"
+		// The back layer must be opaque.
+		back := l.name == "Back"
+		variants[l.name] = []iconVariant{
+			{path: filepath.Join("App Icon.imagestack", layer, file+".png"), size: 400, height: 240, fill: back},
+			{path: filepath.Join("App Icon.imagestack", layer, file+"@2x.png"), size: 800, height: 480, fill: back},
+			{path: filepath.Join("App Icon - App Store.imagestack", layer, file+".png"), size: 1280, height: 768, fill: back},
+		}
 	}
-	compile := exec.Command(
-		"actool",
-		"--compile", appDir,
-		"--platform", iosPlatformFor(bi.target),
-		"--minimum-deployment-target", strconv.Itoa(minsdk),
-		"--app-icon", "AppIcon",
-		"--output-partial-info-plist", assetPlist,
-		assets)
-	_, err = runCmd(compile)
-	return assetPlist, err
+	variants["Back"] = append(variants["Back"],
+		iconVariant{path: filepath.Join("Top Shelf Image.imageset", "topshelf.png"), size: 1920, height: 720, fill: true},
+		iconVariant{path: filepath.Join("Top Shelf Image.imageset", "topshelf@2x.png"), size: 3840, height: 1440, fill: true},
+		iconVariant{path: filepath.Join("Top Shelf Image Wide.imageset", "topshelf_wide.png"), size: 2320, height: 720, fill: true},
+		iconVariant{path: filepath.Join("Top Shelf Image Wide.imageset", "topshelf_wide@2x.png"), size: 4640, height: 1440, fill: true},
+	)
+	return variants
+}
+
+// tvosBrandAssets builds the layered app icons and top shelf images of a
+// tvOS app in the brand directory.
+func tvosBrandAssets(brand, icon string) error {
+	layers, err := tvosIconLayers(icon)
+	if err != nil {
+		return err
+	}
+	variants := tvosIconVariants(layers)
+	for _, l := range layers {
+		if err := buildIcons(brand, l.path, variants[l.name]); err != nil {
+			return err
+		}
+	}
+	type asset map[string]any
+	info := asset{"version": 1, "author": "xcode"}
+	contents := map[string]asset{
+		"": {"info": info, "assets": []asset{
+			{"size": "1280x768", "idiom": "tv", "filename": "App Icon - App Store.imagestack", "role": "primary-app-icon"},
+			{"size": "400x240", "idiom": "tv", "filename": "App Icon.imagestack", "role": "primary-app-icon"},
+			{"size": "2320x720", "idiom": "tv", "filename": "Top Shelf Image Wide.imageset", "role": "top-shelf-image-wide"},
+			{"size": "1920x720", "idiom": "tv", "filename": "Top Shelf Image.imageset", "role": "top-shelf-image"},
+		}},
+		"Top Shelf Image.imageset": {"info": info, "images": []asset{
+			{"idiom": "tv", "filename": "topshelf.png", "scale": "1x"},
+			{"idiom": "tv", "filename": "topshelf@2x.png", "scale": "2x"},
+		}},
+		"Top Shelf Image Wide.imageset": {"info": info, "images": []asset{
+			{"idiom": "tv", "filename": "topshelf_wide.png", "scale": "1x"},
+			{"idiom": "tv", "filename": "topshelf_wide@2x.png", "scale": "2x"},
+		}},
+	}
+	for _, stack := range []string{"App Icon.imagestack", "App Icon - App Store.imagestack"} {
+		var stackLayers []asset
+		for _, l := range layers {
+			layer := filepath.Join(stack, l.name+".imagestacklayer")
+			stackLayers = append(stackLayers, asset{"filename": l.name + ".imagestacklayer"})
+			contents[layer] = asset{"info": info}
+			file := strings.ToLower(l.name)
+			images := []asset{{"idiom": "tv", "filename": file + ".png", "scale": "1x"}}
+			if stack == "App Icon.imagestack" {
+				images = append(images, asset{"idiom": "tv", "filename": file + "@2x.png", "scale": "2x"})
+			}
+			contents[filepath.Join(layer, "Content.imageset")] = asset{"info": info, "images": images}
+		}
+		contents[stack] = asset{"info": info, "layers": stackLayers}
+	}
+	for dir, c := range contents {
+		data, err := json.MarshalIndent(c, "", "\t")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(brand, dir, "Contents.json"), data, 0600); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func buildInfoPlist(bi *buildInfo) string {
+// buildInfoPlist returns the Info.plist of an app for a device or for
+// the simulator or Mac Catalyst.
+func buildInfoPlist(bi *buildInfo, device bool) string {
 	appName := UppercaseName(bi.name)
 	platform := iosPlatformFor(bi.target)
-	var supportPlatform string
+	var capabilities string
+	if device {
+		caps := bi.deviceCaps
+		if len(caps) == 0 {
+			caps = []string{"arm64"}
+		}
+		capabilities = plistStringArray("UIRequiredDeviceCapabilities", caps)
+	}
+	var supportPlatform, extraKeys string
 	switch bi.target {
 	case "ios":
 		supportPlatform = "iPhoneOS"
 	case "tvos":
 		supportPlatform = "AppleTVOS"
+	case "macos-catalyst":
+		supportPlatform = "MacOSX"
+		extraKeys = `
+	<key>LSRequiresIPhoneOS</key>
+	<false/>`
+	}
+	if len(bi.bgModes) > 0 {
+		extraKeys += plistStringArray("UIBackgroundModes", bi.bgModes)
+	}
+	if bi.target != "tvos" {
+		extraKeys += statusBarKeys(bi.statusBar)
+	}
+	if bi.ats != "" {
+		extraKeys += "\n\t<key>NSAppTransportSecurity</key>\n\t" + bi.ats
+	}
+	extraKeys += urlTypesKeys(bi)
+	extraKeys += localizedNameKeys(bi, appName)
+	for _, u := range bi.usage {
+		var text strings.Builder
+		xml.EscapeText(&text, []byte(u.text))
+		extraKeys += fmt.Sprintf("\n\t<key>%s</key>\n\t<string>%s</string>", u.key, text.String())
 	}
 	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
 <!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
@@ -322,9 +1258,7 @@ func buildInfoPlist(bi *buildInfo) string {
 	<key>CFBundleVersion</key>
 	<string>%d</string>
 	<key>UILaunchStoryboardName</key>
-	<string>LaunchScreen</string>
-	<key>UIRequiredDeviceCapabilities</key>
-	<array><string>arm64</string></array>
+	<string>LaunchScreen</string>%s
 	<key>DTPlatformName</key>
 	<string>%s</string>
 	<key>DTPlatformVersion</key>
@@ -357,9 +1291,147 @@ func buildInfoPlist(bi *buildInfo) string {
 	<key>DTXcode</key>
 	<string>1030</string>
 	<key>DTXcodeBuild</key>
-	<string>10G8</string>
+	<string>10G8</string>%s
 </dict>
-</plist>`, appName, bi.appID, appName, bi.version, bi.version.VersionCode, platform, minIOSVersion, supportPlatform, platform)
+</plist>`, appName, bi.appID, appName, bi.version, bi.version.VersionCode, capabilities, platform, minIOSVersion, supportPlatform, platform, extraKeys)
+}
+
+// appTransportSecurity returns the NSAppTransportSecurity dictionary of the
+// -ats flag: allow-local for local networking, allow-all for arbitrary loads,
+// or the path of a file containing the dictionary.
+func appTransportSecurity(ats string) (string, error) {
+	switch ats {
+	case "":
+		return "", nil
+	case "allow-local":
+		return `<dict>
+		<key>NSAllowsLocalNetworking</key>
+		<true/>
+	</dict>`, nil
+	case "allow-all":
+		return `<dict>
+		<key>NSAllowsArbitraryLoads</key>
+		<true/>
+	</dict>`, nil
+	}
+	data, err := os.ReadFile(ats)
+	if err != nil {
+		return "", err
+	}
+	var root struct {
+		XMLName xml.Name
+	}
+	if err := xml.Unmarshal(data, &root); err != nil {
+		return "", fmt.Errorf("%s: %v", ats, err)
+	}
+	if root.XMLName.Local != "dict" {
+		return "", fmt.Errorf("%s: the root element is <%s>, not <dict>", ats, root.XMLName.Local)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// urlTypesKeys returns the CFBundleURLTypes entry of the Info.plist for the
+// URL schemes of the app. Each scheme is identified by a URL name derived
+// from the app id.
+func urlTypesKeys(bi *buildInfo) string {
+	if len(bi.schemes) == 0 {
+		return ""
+	}
+	role := bi.urlRole
+	if role == "" {
+		role = "Editor"
+	}
+	b := new(strings.Builder)
+	b.WriteString("\n\t<key>CFBundleURLTypes</key>\n\t<array>")
+	for _, s := range bi.schemes {
+		fmt.Fprintf(b, `
+		<dict>
+			<key>CFBundleURLName</key>
+			<string>%s.%s</string>
+			<key>CFBundleTypeRole</key>
+			<string>%s</string>
+			<key>CFBundleURLSchemes</key>
+			<array>
+				<string>%s</string>
+			</array>
+		</dict>`, bi.appID, s, role, s)
+	}
+	b.WriteString("\n\t</array>")
+	return b.String()
+}
+
+// statusBarKeys returns the Info.plist entries for the status bar style.
+// The style is global, so view controller based appearance is disabled for
+// all but the default style.
+func statusBarKeys(style string) string {
+	var keys string
+	switch style {
+	case "light":
+		keys = `
+	<key>UIStatusBarStyle</key>
+	<string>UIStatusBarStyleLightContent</string>`
+	case "dark":
+		keys = `
+	<key>UIStatusBarStyle</key>
+	<string>UIStatusBarStyleDarkContent</string>`
+	case "hidden":
+		keys = `
+	<key>UIStatusBarHidden</key>
+	<true/>`
+	default:
+		return ""
+	}
+	return keys + `
+	<key>UIViewControllerBasedStatusBarAppearance</key>
+	<false/>`
+}
+
+// localizedNameKeys returns the Info.plist entries that allow the
+// -localized-names to replace the base display name of the app.
+func localizedNameKeys(bi *buildInfo, base string) string {
+	if len(bi.localNames) == 0 {
+		return ""
+	}
+	var name strings.Builder
+	xml.EscapeText(&name, []byte(base))
+	locales := make([]string, len(bi.localNames))
+	for i, n := range bi.localNames {
+		locales[i] = n.locale
+	}
+	return "\n\t<key>CFBundleDisplayName</key>\n\t<string>" + name.String() + "</string>" +
+		plistStringArray("CFBundleLocalizations", locales)
+}
+
+// writeLocalizedNames writes the <locale>.lproj/InfoPlist.strings files that
+// localize the display name of the app bundle in the resources directory.
+func writeLocalizedNames(resources string, names []localizedName) error {
+	quote := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	for _, n := range names {
+		dir := filepath.Join(resources, n.locale+".lproj")
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		name := quote.Replace(n.name)
+		strs := fmt.Sprintf("\"CFBundleDisplayName\" = \"%s\";\n\"CFBundleName\" = \"%s\";\n", name, name)
+		if err := os.WriteFile(filepath.Join(dir, "InfoPlist.strings"), []byte(strs), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// plistStringArray returns a plist dictionary entry for the key and its
+// array of string values.
+func plistStringArray(key string, values []string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "\n\t<key>%s</key>\n\t<array>", key)
+	for _, v := range values {
+		b.WriteString("\n\t\t<string>")
+		xml.EscapeText(&b, []byte(v))
+		b.WriteString("</string>")
+	}
+	b.WriteString("\n\t</array>")
+	return b.String()
 }
 
 func iosPlatformFor(target string) string {
@@ -368,6 +1440,8 @@ func iosPlatformFor(target string) string {
 		return "iphoneos"
 	case "tvos":
 		return "appletvos"
+	case "macos-catalyst":
+		return "macosx"
 	default:
 		panic("invalid platform " + target)
 	}
@@ -402,65 +1476,187 @@ func archiveIOS(tmpDir, target, frameworkRoot string, bi *buildInfo) error {
 		}
 	}
 	exe := filepath.Join(frameworkDir, framework)
-	lipo := exec.Command("xcrun", "lipo", "-o", exe, "-create")
-	var builds errgroup.Group
+	libs, err := buildIOSArchives(tmpDir, target, bi)
+	if err != nil {
+		return err
+	}
+	if _, err := runCmd(lipoCmd(exe, libs)); err != nil {
+		return err
+	}
+	headerSrc, err := iosFrameworkHeader(bi)
+	if err != nil {
+		return err
+	}
+	headerDst := filepath.Join(frameworkDir, "Headers", framework+".h")
+	if err := copyFile(headerDst, headerSrc); err != nil {
+		return err
+	}
+	module := fmt.Sprintf(`framework module "%s" {
+    header "%[1]s.h"
+
+    export *
+}`, framework)
+	moduleFile := filepath.Join(frameworkDir, "Modules", "module.modulemap")
+	return os.WriteFile(moduleFile, []byte(module), 0644)
+}
+
+// archiveIOSLib builds the static library libFile, for embedding in Xcode
+// projects without the framework bundle. The header is written next to it,
+// with the .h extension.
+func archiveIOSLib(tmpDir, target, libFile string, bi *buildInfo) error {
+	libs, err := buildIOSArchives(tmpDir, target, bi)
+	if err != nil {
+		return err
+	}
+	header, err := iosFrameworkHeader(bi)
+	if err != nil {
+		return err
+	}
+	return writeIOSLib(libFile, header, libs)
+}
+
+// writeIOSLib combines the static libraries of every architecture into
+// libFile, and copies the header next to it.
+func writeIOSLib(libFile, header string, libs []string) error {
+	if _, err := runCmd(lipoCmd(libFile, libs)); err != nil {
+		return err
+	}
+	return copyFile(strings.TrimSuffix(libFile, ".a")+".h", header)
+}
+
+// lipoCmd returns the command that combines the libs of every architecture
+// into out.
+func lipoCmd(out string, libs []string) *exec.Cmd {
+	return exec.Command("xcrun", append([]string{"lipo", "-o", out, "-create"}, libs...)...)
+}
+
+// iosFrameworkHeader returns the path of the header of the Gio framework.
+func iosFrameworkHeader(bi *buildInfo) (string, error) {
+	appDir, err := runQuery(exec.Command("go", "list", "-tags", bi.tags, "-f", "{{.Dir}}", "gioui.org/app/"))
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(appDir, "framework_ios.h"), nil
+}
+
+// buildIOSArchives builds the program as a static library for every
+// architecture, and returns their paths.
+func buildIOSArchives(tmpDir, target string, bi *buildInfo) ([]string, error) {
+	var libs []string
+	builds := newBuildGroup(bi.jobs)
 	tags := bi.tags
 	for _, a := range bi.archs {
 		clang, cflags, err := iosCompilerFor(target, a, bi.minsdk)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		lib := filepath.Join(tmpDir, "gio-"+a)
 		cmd := exec.Command(
 			"go",
 			"build",
-			"-ldflags=-s -w "+bi.ldflags,
+			"-ldflags="+bi.ldflags,
 			"-buildmode=c-archive",
 			"-o", lib,
 			"-tags", tags,
 			bi.pkgPath,
 		)
-		lipo.Args = append(lipo.Args, lib)
-		cflagsLine := strings.Join(cflags, " ")
+		libs = append(libs, lib)
 		cmd.Env = append(
 			os.Environ(),
 			"GOOS=ios",
 			"GOARCH="+a,
 			"CGO_ENABLED=1",
-			"CC="+clang,
-			"CGO_CFLAGS="+cflagsLine,
-			"CGO_LDFLAGS="+cflagsLine,
 		)
+		cmd.Env = append(cmd.Env, cgoEnv(bi, clang, cflags, cflags)...)
+		arch := a
 		builds.Go(func() error {
 			_, err := runCmd(cmd)
+			emitBuild(arch, err)
 			return err
 		})
 	}
 	if err := builds.Wait(); err != nil {
-		return err
+		return nil, err
 	}
-	if _, err := runCmd(lipo); err != nil {
-		return err
+	return libs, nil
+}
+
+func iosCompilerFor(target, arch string, minsdk int) (string, []string, error) {
+	platformSDK, targetFlags, err := iosTargetFlags(target, arch, minsdk)
+	if err != nil {
+		return "", nil, err
 	}
-	appDir, err := runCmd(exec.Command("go", "list", "-tags", tags, "-f", "{{.Dir}}", "gioui.org/app/"))
+	sdkPath, err := runQuery(exec.Command("xcrun", "--sdk", platformSDK, "--show-sdk-path"))
 	if err != nil {
-		return err
+		return "", nil, err
 	}
-	headerDst := filepath.Join(frameworkDir, "Headers", framework+".h")
-	headerSrc := filepath.Join(appDir, "framework_ios.h")
-	if err := copyFile(headerDst, headerSrc); err != nil {
-		return err
+	if err := checkAppleSDK(target, platformSDK, sdkPath, minsdk); err != nil {
+		return "", nil, err
 	}
-	module := fmt.Sprintf(`framework module "%s" {
-    header "%[1]s.h"
+	clang, err := runQuery(exec.Command("xcrun", "--sdk", platformSDK, "--find", "clang"))
+	if err != nil {
+		return "", nil, err
+	}
+	cflags := append(targetFlags, "-isysroot", sdkPath)
+	if target == "macos-catalyst" {
+		// UIKit for Mac Catalyst lives outside the default framework path.
+		cflags = append(cflags, "-iframework", filepath.Join(sdkPath, "System", "iOSSupport", "System", "Library", "Frameworks"))
+	}
+	return clang, cflags, nil
+}
 
-    export *
-}`, framework)
-	moduleFile := filepath.Join(frameworkDir, "Modules", "module.modulemap")
-	return os.WriteFile(moduleFile, []byte(module), 0644)
+// checkAppleSDK returns an error if minsdk is outside the deployment targets
+// supported by the SDK at sdkPath, as listed in its SDKSettings.json.
+func checkAppleSDK(target, platformSDK, sdkPath string, minsdk int) error {
+	data, err := os.ReadFile(filepath.Join(sdkPath, "SDKSettings.json"))
+	if err != nil {
+		// Older SDKs lack the settings; let the compiler check the version.
+		return nil
+	}
+	var settings struct {
+		SupportedTargets map[string]struct {
+			MinimumDeploymentTarget string
+			MaximumDeploymentTarget string
+		}
+	}
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return fmt.Errorf("%s: %v", sdkPath, err)
+	}
+	key := platformSDK
+	if target == "macos-catalyst" {
+		key = "iosmac"
+	}
+	supported, ok := settings.SupportedTargets[key]
+	if !ok {
+		return nil
+	}
+	major := func(v string) int {
+		v, _, _ = strings.Cut(v, ".")
+		n, _ := strconv.Atoi(v)
+		return n
+	}
+	versions := sdkVersions{
+		min: major(supported.MinimumDeploymentTarget),
+		max: major(supported.MaximumDeploymentTarget),
+	}
+	return checkSDKVersion("minsdk", minsdk, "the "+platformSDK+" SDK "+sdkPath, versions)
 }
 
-func iosCompilerFor(target, arch string, minsdk int) (string, []string, error) {
+// iosTargetFlags returns the SDK and the compiler flags that select the
+// platform and minimum OS version for target and arch.
+func iosTargetFlags(target, arch string, minsdk int) (string, []string, error) {
+	if target == "macos-catalyst" {
+		switch arch {
+		case "arm64", "amd64":
+		default:
+			return "", nil, fmt.Errorf("unsupported -arch: %s", arch)
+		}
+		if minsdk == 0 {
+			minsdk = minCatalystVersion
+		}
+		triple := fmt.Sprintf("%s-apple-ios%d.0-macabi", allArchs[arch].iosArch, minsdk)
+		return "macosx", []string{"-target", triple}, nil
+	}
 	var (
 		platformSDK string
 		platformOS  string
@@ -491,21 +1687,177 @@ func iosCompilerFor(target, arch string, minsdk int) (string, []string, error) {
 	default:
 		return "", nil, fmt.Errorf("unsupported -arch: %s", arch)
 	}
-	sdkPath, err := runCmd(exec.Command("xcrun", "--sdk", platformSDK, "--show-sdk-path"))
-	if err != nil {
-		return "", nil, err
-	}
-	clang, err := runCmd(exec.Command("xcrun", "--sdk", platformSDK, "--find", "clang"))
-	if err != nil {
-		return "", nil, err
-	}
 	cflags := []string{
 		"-fembed-bitcode",
 		"-arch", allArchs[arch].iosArch,
-		"-isysroot", sdkPath,
 		"-m" + platformOS + "-version-min=" + strconv.Itoa(minsdk),
 	}
-	return clang, cflags, nil
+	return platformSDK, cflags, nil
+}
+
+// validateOTA checks the -ota-url URL of the ipa and the -ota-icons URLs
+// of the display and full size images.
+func validateOTA(ipaURL string, icons []string) error {
+	for _, u := range append([]string{ipaURL}, icons...) {
+		parsed, err := url.Parse(u)
+		if err != nil || parsed.Scheme != "https" || parsed.Host == "" {
+			return fmt.Errorf("invalid -ota-url or -ota-icons URL %q: over-the-air installs require HTTPS", u)
+		}
+	}
+	if !strings.HasSuffix(ipaURL, ".ipa") {
+		return fmt.Errorf("invalid -ota-url %s: the URL doesn't end in .ipa", ipaURL)
+	}
+	if len(icons) != 2 {
+		return errors.New("-ota-url requires -ota-icons with the URLs of the 57x57 display image and the 512x512 full size image")
+	}
+	return nil
+}
+
+// writeOTAManifest writes the manifest.plist for installing the ipa over
+// the air through an itms-services link, and prints how to host it.
+func writeOTAManifest(bi *buildInfo, dst string) error {
+	if err := os.WriteFile(dst, []byte(otaManifest(bi)), 0644); err != nil {
+		return err
+	}
+	addArtifact(dst, "")
+	manifestURL := bi.otaURL[:strings.LastIndex(bi.otaURL, "/")+1] + "manifest.plist"
+	fmt.Fprintf(os.Stderr, `gogio: upload the ipa to %s and %s to %s, and install the app
+from a web page on the device with the link
+	itms-services://?action=download-manifest&url=%s
+`, bi.otaURL, dst, manifestURL, url.QueryEscape(manifestURL))
+	return nil
+}
+
+// otaManifest returns the manifest.plist of the ipa at bi.otaURL for
+// itms-services installs of enterprise and ad-hoc builds.
+func otaManifest(bi *buildInfo) string {
+	esc := func(s string) string {
+		var b strings.Builder
+		xml.EscapeText(&b, []byte(s))
+		return b.String()
+	}
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>items</key>
+	<array>
+		<dict>
+			<key>assets</key>
+			<array>
+				<dict>
+					<key>kind</key>
+					<string>software-package</string>
+					<key>url</key>
+					<string>%s</string>
+				</dict>
+				<dict>
+					<key>kind</key>
+					<string>display-image</string>
+					<key>url</key>
+					<string>%s</string>
+				</dict>
+				<dict>
+					<key>kind</key>
+					<string>full-size-image</string>
+					<key>url</key>
+					<string>%s</string>
+				</dict>
+			</array>
+			<key>metadata</key>
+			<dict>
+				<key>bundle-identifier</key>
+				<string>%s</string>
+				<key>bundle-version</key>
+				<string>%s</string>
+				<key>kind</key>
+				<string>software</string>
+				<key>title</key>
+				<string>%s</string>
+			</dict>
+		</dict>
+	</array>
+</dict>
+</plist>
+`, esc(bi.otaURL), esc(bi.otaIcons[0]), esc(bi.otaIcons[1]), bi.appID, bi.version, esc(UppercaseName(bi.name)))
+}
+
+// keepIPAApp copies the signed .app of the ipa file to the dst directory,
+// for inspecting it with tools such as codesign -dv.
+func keepIPAApp(tmpDir, ipa, dst string, bi *buildInfo) error {
+	if err := os.RemoveAll(dst); err != nil {
+		return err
+	}
+	if bi.exportOptions != "" {
+		// xcodebuild signs the app while exporting it, so the signed app
+		// only exists in the exported ipa.
+		return extractIPAApp(ipa, dst)
+	}
+	return copyDir(dst, filepath.Join(tmpDir, "Payload", bi.name+".app"))
+}
+
+// extractIPAApp extracts the .app of the ipa file to the dst directory.
+func extractIPAApp(ipa, dst string) error {
+	r, err := zip.OpenReader(ipa)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	found := false
+	for _, f := range r.File {
+		// The app is the only directory of the Payload.
+		_, rel, ok := strings.Cut(f.Name, ".app/")
+		if !ok || !strings.HasPrefix(f.Name, "Payload/") || strings.HasSuffix(f.Name, "/") {
+			continue
+		}
+		found = true
+		path := filepath.Join(dst, filepath.FromSlash(rel))
+		// Only archivers on Unix systems record permissions and symbolic
+		// links, such as those of versioned frameworks.
+		creator := f.CreatorVersion >> 8
+		unix := creator == creatorUnix || creator == creatorMacOS
+		if unix && f.Mode()&os.ModeSymlink != 0 {
+			if err := extractSymlink(path, f); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := extractFile(path, f); err != nil {
+			return err
+		}
+		if mode := f.Mode().Perm(); unix && mode != 0 {
+			if err := os.Chmod(path, mode); err != nil {
+				return err
+			}
+		}
+	}
+	if !found {
+		return fmt.Errorf("%s: no app in the Payload directory", ipa)
+	}
+	return nil
+}
+
+// The creator versions of zip entries written on Unix systems and macOS.
+const (
+	creatorUnix  = 3
+	creatorMacOS = 19
+)
+
+// extractSymlink creates the symbolic link of the zip entry f at dst.
+func extractSymlink(dst string, f *zip.File) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	r, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	target, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return os.Symlink(string(target), dst)
 }
 
 func zipDir(dst, base, dir string) (err error) {
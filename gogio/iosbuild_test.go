@@ -0,0 +1,768 @@
+// SPDX-License-Identifier: Unlicense OR MIT
+
+package main
+
+import (
+	"archive/zip"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestDsymutilCmd(t *testing.T) {
+	t.Parallel()
+
+	out := filepath.Join("dist", "app.ipa")
+	exe := filepath.Join("Payload", "app.app", "App")
+	dsym := dsymPath(out)
+	if exp := filepath.Join("dist", "app.app.dSYM"); dsym != exp {
+		t.Errorf("dSYM path is %q, expected %q", dsym, exp)
+	}
+	cmd := dsymutilCmd(exe, dsym)
+	if exp := []string{"xcrun", "dsymutil", exe, "-o", dsym}; !reflect.DeepEqual(cmd.Args, exp) {
+		t.Errorf("dsymutil command is %v, expected %v", cmd.Args, exp)
+	}
+}
+
+func TestCatalyst(t *testing.T) {
+	t.Parallel()
+
+	sdk, cflags, err := iosTargetFlags("macos-catalyst", "arm64", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sdk != "macosx" {
+		t.Errorf("catalyst SDK is %q, expected macosx", sdk)
+	}
+	if exp := []string{"-target", "arm64-apple-ios14.0-macabi"}; !reflect.DeepEqual(cflags, exp) {
+		t.Errorf("catalyst flags are %v, expected %v", cflags, exp)
+	}
+	plist := buildInfoPlist(&buildInfo{
+		appID:  "com.example.app",
+		name:   "app",
+		target: "macos-catalyst",
+	}, false)
+	for _, s := range []string{
+		"<key>LSRequiresIPhoneOS</key>\n\t<false/>",
+		"<key>CFBundleSupportedPlatforms</key>\n\t<array>\n\t\t<string>MacOSX</string>",
+	} {
+		if !strings.Contains(plist, s) {
+			t.Errorf("Info.plist is missing %q:\n%s", s, plist)
+		}
+	}
+}
+
+func TestTVOSIcons(t *testing.T) {
+	t.Parallel()
+
+	icon := writeTestIcon(t, 1024)
+	if _, err := tvosIconLayers(icon); err == nil {
+		t.Error("flat tvOS icon didn't fail")
+	}
+	base := strings.TrimSuffix(icon, ".png")
+	for _, layer := range []string{"_front.png", "_back.png"} {
+		if err := copyFile(base+layer, icon); err != nil {
+			t.Fatal(err)
+		}
+	}
+	layers, err := tvosIconLayers(icon)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(layers) != 2 || layers[0].name != "Front" || layers[1].name != "Back" {
+		t.Fatalf("got layers %v, expected Front and Back", layers)
+	}
+	sizes := make(map[string]bool)
+	for _, variants := range tvosIconVariants(layers) {
+		for _, v := range variants {
+			sizes[fmt.Sprintf("%dx%d", v.size, v.height)] = true
+		}
+	}
+	for _, size := range []string{"400x240", "800x480", "1280x768", "1920x720", "3840x1440", "2320x720", "4640x1440"} {
+		if !sizes[size] {
+			t.Errorf("tvOS assets are missing the %s size", size)
+		}
+	}
+	brand := filepath.Join(t.TempDir(), "Brand Assets.brandassets")
+	if err := tvosBrandAssets(brand, icon); err != nil {
+		t.Fatal(err)
+	}
+	img := filepath.Join(brand, "Top Shelf Image.imageset", "topshelf.png")
+	f, err := os.Open(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	cfg, err := png.DecodeConfig(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Width != 1920 || cfg.Height != 720 {
+		t.Errorf("top shelf image is %dx%d, expected 1920x720", cfg.Width, cfg.Height)
+	}
+}
+
+func TestDeviceCapabilities(t *testing.T) {
+	t.Parallel()
+
+	bi := &buildInfo{
+		appID:  "com.example.app",
+		name:   "app",
+		target: "ios",
+	}
+	const arm64 = "<key>UIRequiredDeviceCapabilities</key>\n\t<array>\n\t\t<string>arm64</string>\n\t</array>"
+	if plist := buildInfoPlist(bi, true); !strings.Contains(plist, arm64) {
+		t.Errorf("device Info.plist doesn't require arm64:\n%s", plist)
+	}
+	if plist := buildInfoPlist(bi, false); strings.Contains(plist, "UIRequiredDeviceCapabilities") {
+		t.Errorf("simulator Info.plist requires device capabilities:\n%s", plist)
+	}
+	bi.deviceCaps = []string{"arm64", "metal"}
+	if plist := buildInfoPlist(bi, true); !strings.Contains(plist, "<string>arm64</string>\n\t\t<string>metal</string>") {
+		t.Errorf("Info.plist doesn't contain the -device-capabilities:\n%s", plist)
+	}
+}
+
+func TestAssociatedDomains(t *testing.T) {
+	t.Parallel()
+
+	const profile = `<?xml version="1.0" encoding="UTF-8"?>
+<plist version="1.0">
+<dict>
+	<key>application-identifier</key>
+	<string>TEAM.com.example.app</string>
+	<key>com.apple.developer.associated-domains</key>
+	<string>*</string>
+</dict>
+</plist>`
+	domains := []string{"applinks:example.com", "webcredentials:*.example.com?mode=developer"}
+	for _, d := range domains {
+		if err := validateAssociatedDomain(d); err != nil {
+			t.Error(err)
+		}
+	}
+	for _, d := range []string{"example.com", "applinks:", "applinks:localhost", "links:example.com", "applinks:bad_host.com"} {
+		if err := validateAssociatedDomain(d); err == nil {
+			t.Errorf("validateAssociatedDomain(%q) didn't fail", d)
+		}
+	}
+	entitlements := setAssociatedDomains(profile, domains)
+	entFile := filepath.Join(t.TempDir(), "entitlements.plist")
+	if err := os.WriteFile(entFile, []byte(entitlements), 0660); err != nil {
+		t.Fatal(err)
+	}
+	cmd := codesignCmd("identity", entFile, "app.app", true)
+	if exp := []string{"codesign", "-s", "identity", "-v", "--entitlements", entFile, "--timestamp", "app.app"}; !reflect.DeepEqual(cmd.Args, exp) {
+		t.Errorf("codesign command is %v, expected %v", cmd.Args, exp)
+	}
+	signed, err := os.ReadFile(entFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const exp = `	<key>com.apple.developer.associated-domains</key>
+	<array>
+		<string>applinks:example.com</string>
+		<string>webcredentials:*.example.com?mode=developer</string>
+	</array>
+</dict>`
+	if !strings.Contains(string(signed), exp) {
+		t.Errorf("entitlements are missing the associated domains:\n%s", signed)
+	}
+	if strings.Contains(string(signed), "<string>*</string>") {
+		t.Errorf("entitlements contain the profile wildcard:\n%s", signed)
+	}
+}
+
+func TestPushEntitlement(t *testing.T) {
+	t.Parallel()
+
+	const profile = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>application-identifier</key>
+	<string>TEAM.com.example.app</string>
+	<key>aps-environment</key>
+	<string>production</string>
+</dict>
+</plist>`
+	bi := &buildInfo{push: "development"}
+	entitlements, err := signEntitlements(bi, profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entFile := filepath.Join(t.TempDir(), "entitlements.plist")
+	if err := os.WriteFile(entFile, []byte(entitlements), 0660); err != nil {
+		t.Fatal(err)
+	}
+	cmd := codesignCmd("identity", entFile, "app.app", true)
+	if !reflect.DeepEqual(cmd.Args[4:6], []string{"--entitlements", entFile}) {
+		t.Errorf("codesign command %v doesn't use the entitlements", cmd.Args)
+	}
+	signed, err := os.ReadFile(entFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const exp = "\t<key>aps-environment</key>\n\t<string>development</string>\n</dict>"
+	if !strings.Contains(string(signed), exp) {
+		t.Errorf("entitlements are missing the push environment:\n%s", signed)
+	}
+	if strings.Contains(string(signed), "production") {
+		t.Errorf("entitlements contain the profile push environment:\n%s", signed)
+	}
+	if _, err := signEntitlements(bi, strings.Replace(profile, "aps-environment", "other", 1)); err == nil {
+		t.Error("a profile without the push capability was accepted")
+	}
+}
+
+func TestEmbedFrameworks(t *testing.T) {
+	t.Parallel()
+
+	src := t.TempDir()
+	framework := filepath.Join(src, "Foo.framework")
+	if err := os.Mkdir(framework, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range []string{filepath.Join(framework, "Foo"), filepath.Join(framework, "Info.plist"), filepath.Join(src, "libbar.dylib")} {
+		if err := os.WriteFile(file, []byte(file), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fws := []string{framework, filepath.Join(src, "libbar.dylib")}
+	for _, fw := range fws {
+		if err := validateFramework(fw); err != nil {
+			t.Error(err)
+		}
+	}
+	if err := validateFramework(filepath.Join(framework, "Info.plist")); err == nil {
+		t.Error("a file that is not a framework was accepted")
+	}
+	app := filepath.Join(t.TempDir(), "app.app")
+	if exp := filepath.Join(app, "Contents"); bundleContents(app, "macos-catalyst") != exp {
+		t.Errorf("Mac Catalyst bundle contents are in %s, expected %s", bundleContents(app, "macos-catalyst"), exp)
+	}
+	dir := filepath.Join(bundleContents(app, "ios"), "Frameworks")
+	binaries, err := copyFrameworks(dir, fws)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := []string{filepath.Join(dir, "Foo.framework", "Foo"), filepath.Join(dir, "libbar.dylib")}
+	if !reflect.DeepEqual(binaries, exp) {
+		t.Errorf("embedded binaries are %v, expected %v", binaries, exp)
+	}
+	for _, file := range append(exp, filepath.Join(dir, "Foo.framework", "Info.plist")) {
+		if _, err := os.Stat(file); err != nil {
+			t.Errorf("framework was not copied: %v", err)
+		}
+	}
+	cmd := codesignFrameworkCmd("identity", filepath.Join(dir, "Foo.framework"), true)
+	if exp := []string{"codesign", "-f", "-s", "identity", "-v", "--timestamp", filepath.Join(dir, "Foo.framework")}; !reflect.DeepEqual(cmd.Args, exp) {
+		t.Errorf("codesign command is %v, expected %v", cmd.Args, exp)
+	}
+}
+
+func TestExportOptions(t *testing.T) {
+	t.Parallel()
+
+	bi := &buildInfo{
+		appID:         "com.example.app",
+		name:          "app",
+		target:        "ios",
+		version:       Semver{Major: 1, VersionCode: 7},
+		exportOptions: "ExportOptions.plist",
+	}
+	plist := xcarchivePlist(bi)
+	for _, exp := range []string{
+		"<string>Applications/app.app</string>",
+		"<string>com.example.app</string>",
+		"<key>CFBundleVersion</key>\n\t\t<string>7</string>",
+	} {
+		if !strings.Contains(plist, exp) {
+			t.Errorf("archive Info.plist is missing %q:\n%s", exp, plist)
+		}
+	}
+	cmd := exportArchiveCmd("app.xcarchive", bi.exportOptions, "export")
+	exp := []string{"xcodebuild", "-exportArchive", "-archivePath", "app.xcarchive", "-exportOptionsPlist", "ExportOptions.plist", "-exportPath", "export"}
+	if !reflect.DeepEqual(cmd.Args, exp) {
+		t.Errorf("export command is %v, expected %v", cmd.Args, exp)
+	}
+}
+
+func TestUpload(t *testing.T) {
+	t.Parallel()
+
+	bi := &buildInfo{
+		target:    "tvos",
+		apiKey:    "KEYID",
+		apiIssuer: "ISSUER",
+	}
+	cmd := uploadCmd(bi, "app.ipa")
+	exp := []string{"xcrun", "altool", "--upload-app", "-f", "app.ipa", "-t", "appletvos", "--apiKey", "KEYID", "--apiIssuer", "ISSUER"}
+	if !reflect.DeepEqual(cmd.Args, exp) {
+		t.Errorf("upload command is %v, expected %v", cmd.Args, exp)
+	}
+}
+
+func TestBackgroundModes(t *testing.T) {
+	t.Parallel()
+
+	bi := &buildInfo{
+		appID:  "com.example.app",
+		name:   "app",
+		target: "ios",
+	}
+	if plist := buildInfoPlist(bi, true); strings.Contains(plist, "UIBackgroundModes") {
+		t.Errorf("Info.plist contains UIBackgroundModes without -background-modes:\n%s", plist)
+	}
+	bi.bgModes = []string{"audio", "fetch"}
+	const exp = "<key>UIBackgroundModes</key>\n\t<array>\n\t\t<string>audio</string>\n\t\t<string>fetch</string>\n\t</array>"
+	if plist := buildInfoPlist(bi, true); !strings.Contains(plist, exp) {
+		t.Errorf("Info.plist is missing the background modes:\n%s", plist)
+	}
+}
+
+func TestStatusBarStyle(t *testing.T) {
+	t.Parallel()
+
+	bi := &buildInfo{
+		appID:     "com.example.app",
+		name:      "app",
+		target:    "ios",
+		statusBar: "default",
+	}
+	if plist := buildInfoPlist(bi, true); strings.Contains(plist, "UIViewControllerBasedStatusBarAppearance") {
+		t.Errorf("Info.plist contains status bar keys for the default style:\n%s", plist)
+	}
+	bi.statusBar = "hidden"
+	plist := buildInfoPlist(bi, true)
+	for _, exp := range []string{
+		"<key>UIStatusBarHidden</key>\n\t<true/>",
+		"<key>UIViewControllerBasedStatusBarAppearance</key>\n\t<false/>",
+	} {
+		if !strings.Contains(plist, exp) {
+			t.Errorf("Info.plist is missing %q:\n%s", exp, plist)
+		}
+	}
+}
+
+func TestAppTransportSecurity(t *testing.T) {
+	t.Parallel()
+
+	config := filepath.Join(t.TempDir(), "ats.plist")
+	const exceptions = `<dict>
+	<key>NSExceptionDomains</key>
+	<dict>
+		<key>example.com</key>
+		<dict>
+			<key>NSExceptionAllowsInsecureHTTPLoads</key>
+			<true/>
+		</dict>
+	</dict>
+</dict>
+`
+	if err := os.WriteFile(config, []byte(exceptions), 0600); err != nil {
+		t.Fatal(err)
+	}
+	ats, err := appTransportSecurity(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bi := &buildInfo{
+		appID:  "com.example.app",
+		name:   "app",
+		target: "ios",
+		ats:    ats,
+	}
+	plist := buildInfoPlist(bi, true)
+	for _, exp := range []string{
+		"<key>NSAppTransportSecurity</key>\n\t<dict>",
+		"<key>example.com</key>",
+		"<key>NSExceptionAllowsInsecureHTTPLoads</key>",
+	} {
+		if !strings.Contains(plist, exp) {
+			t.Errorf("Info.plist is missing %q:\n%s", exp, plist)
+		}
+	}
+	if ats, err := appTransportSecurity("allow-local"); err != nil || !strings.Contains(ats, "NSAllowsLocalNetworking") {
+		t.Errorf("allow-local configuration is %q, %v", ats, err)
+	}
+	if err := os.WriteFile(config, []byte("<array/>"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := appTransportSecurity(config); err == nil {
+		t.Error("a configuration without a dictionary was accepted")
+	}
+}
+
+func TestAltIcons(t *testing.T) {
+	t.Parallel()
+
+	dark := filepath.Join(t.TempDir(), "Dark.png")
+	if err := copyFile(dark, writeTestIcon(t, 1024)); err != nil {
+		t.Fatal(err)
+	}
+	assets := t.TempDir()
+	bi := &buildInfo{
+		target:   "ios",
+		altIcons: []string{dark},
+	}
+	name := altIconName(dark)
+	if err := iosAppIconSet(filepath.Join(assets, name+".appiconset"), dark); err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range []string{"Contents.json", "ios_2x.png", "ios_store.png"} {
+		if _, err := os.Stat(filepath.Join(assets, "Dark.appiconset", file)); err != nil {
+			t.Errorf("alternate icon set is missing %s: %v", file, err)
+		}
+	}
+	cmd := actoolCmd(bi, "app.app", assets, "assets.plist", "AppIcon", []string{name})
+	args := strings.Join(cmd.Args, " ")
+	for _, arg := range []string{"--app-icon AppIcon", "--alternate-app-icon Dark"} {
+		if !strings.Contains(args, arg) {
+			t.Errorf("actool command %q is missing %q", args, arg)
+		}
+	}
+}
+
+func TestAppIconCatalog(t *testing.T) {
+	t.Parallel()
+
+	icon := writeTestIcon(t, 1024)
+	set := filepath.Join(t.TempDir(), "Custom.appiconset")
+	if err := iosAppIconSet(set, icon); err != nil {
+		t.Fatal(err)
+	}
+	bi := &buildInfo{target: "ios"}
+	tmpDir := t.TempDir()
+	assets, appIconName, _, err := iosAssetCatalog(bi, tmpDir, set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if appIconName != "Custom" {
+		t.Errorf("app icon name is %q, want Custom", appIconName)
+	}
+	if _, err := os.Stat(filepath.Join(assets, "Custom.appiconset", "Contents.json")); err != nil {
+		t.Errorf("app icon set was not copied: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(assets, "AppIcon.appiconset")); err == nil {
+		t.Error("app icon set was generated for an asset catalog icon")
+	}
+	cmd := actoolCmd(bi, "app.app", assets, "assets.plist", appIconName, nil)
+	if args := strings.Join(cmd.Args, " "); !strings.Contains(args, "--app-icon Custom") {
+		t.Errorf("actool command %q doesn't compile the provided icon", args)
+	}
+
+	if err := os.Remove(filepath.Join(set, "ios_3x.png")); err != nil {
+		t.Fatal(err)
+	}
+	if err := validateAppIconSet(set, "ios"); err == nil {
+		t.Error("app icon set with a missing icon was accepted")
+	}
+	if err := validateAppIconSet(set, "macos"); err == nil {
+		t.Error("iOS app icon set was accepted for MacOS")
+	}
+}
+
+func TestAppleSDKRange(t *testing.T) {
+	t.Parallel()
+
+	sdk := t.TempDir()
+	const settings = `{
+	"SupportedTargets": {
+		"iphoneos": {"MinimumDeploymentTarget": "12.0", "MaximumDeploymentTarget": "17.2.99"},
+		"iosmac": {"MinimumDeploymentTarget": "13.1", "MaximumDeploymentTarget": "17.2.99"}
+	}
+}`
+	if err := os.WriteFile(filepath.Join(sdk, "SDKSettings.json"), []byte(settings), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkAppleSDK("ios", "iphoneos", sdk, 15); err != nil {
+		t.Errorf("-minsdk 15: %v", err)
+	}
+	if err := checkAppleSDK("ios", "iphoneos", sdk, 18); err == nil || !strings.Contains(err.Error(), "-minsdk 18 is newer than 17") {
+		t.Errorf("-minsdk 18: got error %v, expected an out of range error", err)
+	}
+	if err := checkAppleSDK("macos-catalyst", "macosx", sdk, 11); err == nil || !strings.Contains(err.Error(), "-minsdk 11 is older than 13") {
+		t.Errorf("-minsdk 11: got error %v, expected an out of range error", err)
+	}
+}
+
+func TestUsageDescriptions(t *testing.T) {
+	t.Parallel()
+
+	usage, err := getUsageDescriptions("NSCameraUsageDescription=Needed for scanning, NSMicrophoneUsageDescription=Records voice memos, and nothing else")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bi := &buildInfo{
+		appID:  "com.example.app",
+		name:   "app",
+		target: "ios",
+		usage:  usage,
+	}
+	plist := buildInfoPlist(bi, true)
+	for _, exp := range []string{
+		"<key>NSCameraUsageDescription</key>\n\t<string>Needed for scanning</string>",
+		"<key>NSMicrophoneUsageDescription</key>\n\t<string>Records voice memos, and nothing else</string>",
+	} {
+		if !strings.Contains(plist, exp) {
+			t.Errorf("Info.plist is missing %q:\n%s", exp, plist)
+		}
+	}
+	for _, invalid := range []string{"NSCamera=Scanning", "Needed for scanning", "NSCameraUsageDescription="} {
+		if _, err := getUsageDescriptions(invalid); err == nil {
+			t.Errorf("-usage %q was accepted", invalid)
+		}
+	}
+}
+
+func TestKeepApp(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	payload := filepath.Join(dir, "Payload", "app.app")
+	if err := os.MkdirAll(payload, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{"App": "exe", "Info.plist": "plist"} {
+		if err := os.WriteFile(filepath.Join(payload, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Chmod(filepath.Join(payload, "App"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	out := t.TempDir()
+	ipa := filepath.Join(out, "app.ipa")
+	if err := zipDir(ipa, dir, "Payload"); err != nil {
+		t.Fatal(err)
+	}
+	check := func(app string) {
+		t.Helper()
+		for name, exp := range map[string]string{"App": "exe", "Info.plist": "plist"} {
+			if content, err := os.ReadFile(filepath.Join(app, name)); err != nil || string(content) != exp {
+				t.Errorf("%s alongside the ipa has content %q, %v, expected %q", name, content, err, exp)
+			}
+		}
+		if runtime.GOOS == "windows" {
+			return
+		}
+		if fi, err := os.Stat(filepath.Join(app, "App")); err != nil || fi.Mode()&0100 == 0 {
+			t.Errorf("the executable of the kept app isn't executable: %v, %v", fi, err)
+		}
+	}
+	app := filepath.Join(out, "app.app")
+	if err := keepIPAApp(dir, ipa, app, &buildInfo{name: "app"}); err != nil {
+		t.Fatal(err)
+	}
+	check(app)
+	if runtime.GOOS == "windows" {
+		return
+	}
+
+	// Exported apps are extracted from the ipa, which keeps the
+	// permissions and links recorded by Unix archivers.
+	exported := filepath.Join(t.TempDir(), "app.ipa")
+	f, err := os.Create(exported)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	for _, e := range []struct {
+		name, content string
+		mode          os.FileMode
+	}{
+		{"Payload/app.app/App", "exe", 0755},
+		{"Payload/app.app/Info.plist", "plist", 0644},
+		{"Payload/app.app/Frameworks/Foo.framework/Versions/A/Foo", "foo", 0755},
+		{"Payload/app.app/Frameworks/Foo.framework/Foo", "Versions/A/Foo", os.ModeSymlink | 0755},
+	} {
+		hdr := &zip.FileHeader{Name: e.name}
+		hdr.SetMode(e.mode)
+		w, err := zw.CreateHeader(hdr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(w, e.content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := keepIPAApp(t.TempDir(), exported, app, &buildInfo{name: "app", exportOptions: "ExportOptions.plist"}); err != nil {
+		t.Fatal(err)
+	}
+	check(app)
+	if link, err := os.Readlink(filepath.Join(app, "Frameworks", "Foo.framework", "Foo")); err != nil || link != "Versions/A/Foo" {
+		t.Errorf("framework link is %q, %v, expected Versions/A/Foo", link, err)
+	}
+}
+
+func TestOTAManifest(t *testing.T) {
+	t.Parallel()
+
+	icons := []string{"https://example.com/app/icon57.png", "https://example.com/app/icon512.png"}
+	bi := &buildInfo{
+		appID:    "com.example.app",
+		name:     "app",
+		version:  Semver{Major: 1, Minor: 2, Patch: 3, VersionCode: 4},
+		otaURL:   "https://example.com/app/app.ipa",
+		otaIcons: icons,
+	}
+	if err := validateOTA(bi.otaURL, bi.otaIcons); err != nil {
+		t.Fatal(err)
+	}
+	manifest := otaManifest(bi)
+	for _, exp := range []string{
+		"<key>bundle-identifier</key>\n\t\t\t\t<string>com.example.app</string>",
+		"<key>bundle-version</key>\n\t\t\t\t<string>1.2.3.4</string>",
+		"<key>url</key>\n\t\t\t\t\t<string>https://example.com/app/app.ipa</string>",
+	} {
+		if !strings.Contains(manifest, exp) {
+			t.Errorf("manifest.plist is missing %q:\n%s", exp, manifest)
+		}
+	}
+	if err := validateOTA(bi.otaURL, nil); err == nil {
+		t.Error("-ota-url without -ota-icons was accepted")
+	}
+	if err := validateOTA("http://example.com/app.ipa", icons); err == nil {
+		t.Error("-ota-url without HTTPS was accepted")
+	}
+}
+
+func TestLocalizedNames(t *testing.T) {
+	t.Parallel()
+
+	names, err := getLocalizedNames("fr=Mon App,de=Meine App, Deutsch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := filepath.Join(t.TempDir(), "app.app")
+	if err := writeLocalizedNames(app, names); err != nil {
+		t.Fatal(err)
+	}
+	for locale, exp := range map[string]string{"fr": "Mon App", "de": "Meine App, Deutsch"} {
+		strs, err := os.ReadFile(filepath.Join(app, locale+".lproj", "InfoPlist.strings"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entry := fmt.Sprintf("\"CFBundleDisplayName\" = \"%s\";", exp); !strings.Contains(string(strs), entry) {
+			t.Errorf("%s InfoPlist.strings %q doesn't contain %s", locale, strs, entry)
+		}
+	}
+	plist := buildInfoPlist(&buildInfo{name: "app", appID: "org.gioui.app", target: "ios", localNames: names}, true)
+	if !strings.Contains(plist, "<key>CFBundleDisplayName</key>\n\t<string>App</string>") {
+		t.Errorf("Info.plist doesn't keep the app name as base display name:\n%s", plist)
+	}
+	if !strings.Contains(plist, plistStringArray("CFBundleLocalizations", []string{"fr", "de"})) {
+		t.Errorf("Info.plist doesn't list the localizations:\n%s", plist)
+	}
+	if _, err := getLocalizedNames("Mon App"); err == nil {
+		t.Error("a name without locale was accepted")
+	}
+}
+
+func TestIOSStaticLibrary(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake xcrun requires a shell")
+	}
+	// The fake xcrun lipo concatenates the libraries into the output.
+	bin := t.TempDir()
+	const script = "#!/bin/sh\n[ \"$1\" = lipo ] && [ \"$2\" = -o ] && [ \"$4\" = -create ] || exit 1\nout=$3\nshift 4\ncat \"$@\" > \"$out\"\n"
+	if err := os.WriteFile(filepath.Join(bin, "xcrun"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	dir := t.TempDir()
+	var libs []string
+	for _, a := range []string{"arm64", "amd64"} {
+		lib := filepath.Join(dir, "gio-"+a)
+		if err := os.WriteFile(lib, []byte(a), 0644); err != nil {
+			t.Fatal(err)
+		}
+		libs = append(libs, lib)
+	}
+	header := filepath.Join(dir, "framework_ios.h")
+	if err := os.WriteFile(header, []byte("// Gio header\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(dir, "out", "libgio.a")
+	if err := os.MkdirAll(filepath.Dir(out), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeIOSLib(out, header, libs); err != nil {
+		t.Fatal(err)
+	}
+	if lib, err := os.ReadFile(out); err != nil || string(lib) != "arm64amd64" {
+		t.Errorf("static library is %q, %v, expected the libraries of both architectures", lib, err)
+	}
+	if h, err := os.ReadFile(filepath.Join(dir, "out", "libgio.h")); err != nil || string(h) != "// Gio header\n" {
+		t.Errorf("header is %q, %v, expected a copy of the framework header", h, err)
+	}
+}
+
+func TestIOSSimulator(t *testing.T) {
+	t.Parallel()
+
+	archs := []string{"arm64", "amd64"}
+	device := false
+	bi := &buildInfo{simulator: &device}
+	if !iosForDevice(bi, "app.app") {
+		t.Error("-simulator=false .app is built for the simulator")
+	}
+	if got := iosArchs(archs, iosForDevice(bi, "app.app")); !reflect.DeepEqual(got, []string{"arm64"}) {
+		t.Errorf("-simulator=false .app archs are %v, expected [arm64]", got)
+	}
+	// Without -simulator, the output decides.
+	bi = &buildInfo{}
+	if got := iosArchs(archs, iosForDevice(bi, "app.app")); !reflect.DeepEqual(got, []string{"amd64"}) {
+		t.Errorf(".app archs are %v, expected [amd64]", got)
+	}
+	if !iosForDevice(bi, "app.ipa") {
+		t.Error(".ipa is built for the simulator")
+	}
+}
+
+func TestSelectProvision(t *testing.T) {
+	t.Parallel()
+
+	installed, other := []byte("installed certificate"), []byte("uninstalled certificate")
+	sum := sha1.Sum(installed)
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	out := fmt.Sprintf(`  1) %s "Apple Development: Gopher (ABCDE12345)"
+  2) 0123456789abcdef0123456789abcdef01234567 "Apple Distribution: Gopher (ABCDE12345)"
+     2 valid identities found
+`, hash)
+	ids := parseIdentities(out)
+	if len(ids) != 2 || ids[0].hash != hash || ids[0].name != "Apple Development: Gopher (ABCDE12345)" || ids[1].hash != "0123456789ABCDEF0123456789ABCDEF01234567" {
+		t.Fatalf("parsed identities %+v", ids)
+	}
+
+	stale := provisionProfile{path: "stale.mobileprovision", certs: [][]byte{other}}
+	valid := provisionProfile{path: "valid.mobileprovision", certs: [][]byte{other, installed}}
+	profile, idHex, err := selectProvision([]provisionProfile{stale, valid}, ids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profile.path != valid.path || idHex != hash {
+		t.Errorf("selected %s signed by %s, expected %s signed by %s", profile.path, idHex, valid.path, hash)
+	}
+
+	_, _, err = selectProvision([]provisionProfile{stale}, ids)
+	if err == nil || !strings.Contains(err.Error(), "stale.mobileprovision") || !strings.Contains(err.Error(), "Apple Distribution: Gopher") {
+		t.Errorf("profile without an installed certificate selected or badly reported: %v", err)
+	}
+}
@@ -4,31 +4,36 @@ package main
 
 import (
 	"bytes"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
-	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"text/template"
 
 	"golang.org/x/tools/go/packages"
 )
 
-func buildJS(bi *buildInfo) error {
-	out := *destPath
-	if out == "" {
-		out = bi.name
+func buildJS(tmpDir string, bi *buildInfo) error {
+	out := outputPath(bi)
+	dir := out
+	if bi.singleFile {
+		// Build into the working directory and inline the result.
+		dir = filepath.Join(tmpDir, "js")
 	}
-	if err := os.MkdirAll(out, 0700); err != nil {
+	if err := os.MkdirAll(dir, 0700); err != nil {
 		return err
 	}
+	wasm := filepath.Join(dir, "main.wasm")
 	cmd := exec.Command(
 		"go",
 		"build",
 		"-ldflags="+bi.ldflags,
 		"-tags="+bi.tags,
-		"-o", filepath.Join(out, "main.wasm"),
+		"-o", wasm,
 		bi.pkgPath,
 	)
 	cmd.Env = append(
@@ -36,65 +41,241 @@ func buildJS(bi *buildInfo) error {
 		"GOOS=js",
 		"GOARCH=wasm",
 	)
-	_, err := runCmd(cmd)
+	err := runGoBuild(bi, cmd, wasm)
+	emitBuild("wasm", err)
 	if err != nil {
 		return err
 	}
 
-	var faviconPath string
-	if _, err := os.Stat(bi.iconPath); err == nil {
-		// Copy icon to the output folder
-		icon, err := os.ReadFile(bi.iconPath)
-		if err != nil {
-			return err
-		}
-		if err := os.WriteFile(filepath.Join(out, filepath.Base(bi.iconPath)), icon, 0600); err != nil {
+	if !bi.singleFile {
+		if err := writeJSResources(out, bi); err != nil {
 			return err
 		}
-		faviconPath = filepath.Base(bi.iconPath)
 	}
 
-	indexTemplate, err := template.New("").Parse(jsIndex)
+	wasmJS, err := wasmExecJS(bi.wasmExec)
 	if err != nil {
 		return err
 	}
-
-	var b bytes.Buffer
-	if err := indexTemplate.Execute(&b, struct {
-		Name string
-		Icon string
-	}{
-		Name: bi.name,
-		Icon: faviconPath,
-	}); err != nil {
+	pkgs, err := packages.Load(&packages.Config{
+		Mode: packages.NeedName | packages.NeedFiles | packages.NeedImports | packages.NeedDeps,
+		Env:  append(os.Environ(), "GOOS=js", "GOARCH=wasm"),
+	}, bi.pkgPath)
+	if err != nil {
 		return err
 	}
-
-	if err := os.WriteFile(filepath.Join(out, "index.html"), b.Bytes(), 0600); err != nil {
+	extraJS, err := findPackagesJS(pkgs[0], make(map[string]bool))
+	if err != nil {
 		return err
 	}
 
-	goroot, err := runCmd(exec.Command("go", "env", "GOROOT"))
+	jsFiles := append([]string{wasmJS}, extraJS...)
+	if !bi.singleFile {
+		return mergeJSFiles(filepath.Join(out, "wasm.js"), "main.wasm", bi.minify, jsFiles...)
+	}
+	if dryRunSkip("inlining " + wasm) {
+		return nil
+	}
+	if fi, err := os.Stat(wasm); err == nil {
+		fmt.Fprintf(os.Stderr, "gogio: warning: -single-file inlines the %.1f MB WebAssembly module in base64, which adds a third to its size and may exceed the data URL limits of some browsers\n", float64(fi.Size())/1e6)
+	}
+	return writeSingleFile(out, dir, wasm, jsFiles, bi)
+}
+
+// writeSingleFile writes the dst HTML page with the wasm module, the
+// JavaScript files and the icon inlined, using dir for intermediate files.
+func writeSingleFile(dst, dir, wasm string, jsFiles []string, bi *buildInfo) error {
+	module, err := os.ReadFile(wasm)
 	if err != nil {
 		return err
 	}
-	wasmJS := filepath.Join(goroot, "misc", "wasm", "wasm_exec.js")
-	if _, err := os.Stat(wasmJS); err != nil {
-		return fmt.Errorf("failed to find $GOROOT/misc/wasm/wasm_exec.js driver: %v", err)
+	script := filepath.Join(dir, "wasm.js")
+	if err := mergeJSFiles(script, dataURL("application/wasm", module), bi.minify, jsFiles...); err != nil {
+		return err
 	}
-	pkgs, err := packages.Load(&packages.Config{
-		Mode: packages.NeedName | packages.NeedFiles | packages.NeedImports | packages.NeedDeps,
-		Env:  append(os.Environ(), "GOOS=js", "GOARCH=wasm"),
-	}, bi.pkgPath)
+	js, err := os.ReadFile(script)
 	if err != nil {
 		return err
 	}
-	extraJS, err := findPackagesJS(pkgs[0], make(map[string]bool))
+	page := newJSPage(bi)
+	page.Script = escapeScript(string(js))
+	icon, err := writeJSIcon(dir, bi)
+	if err != nil {
+		return err
+	}
+	if icon != "" {
+		data, err := os.ReadFile(filepath.Join(dir, icon))
+		if err != nil {
+			return err
+		}
+		page.Icon = dataURL("image/png", data)
+	}
+	return writeJSIndex(dst, page)
+}
+
+// scriptBreaks matches the sequences that end or confuse the parsing of an
+// inline <script> element.
+var scriptBreaks = regexp.MustCompile(`(?i)<(/script|!--)`)
+
+// escapeScript escapes the sequences of the JavaScript source js that
+// would end an inline <script> element early. A backslash before the slash
+// or exclamation mark keeps their meaning in strings, regular expressions
+// and comments.
+func escapeScript(js string) string {
+	return scriptBreaks.ReplaceAllString(js, `<\${1}`)
+}
+
+// getWebConfig returns the -web-config JSON object, which is either the
+// value itself or the contents of the file it names, compacted and escaped
+// for inclusion in a <script> element.
+func getWebConfig(v string) (string, error) {
+	if v == "" {
+		return "", nil
+	}
+	data := []byte(v)
+	if !strings.HasPrefix(strings.TrimSpace(v), "{") {
+		var err error
+		data, err = os.ReadFile(v)
+		if err != nil {
+			return "", err
+		}
+	}
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return "", fmt.Errorf("expected a JSON object: %v", err)
+	}
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, data); err != nil {
+		return "", err
+	}
+	// Escape <, > and & to not end the <script> element.
+	var escaped bytes.Buffer
+	json.HTMLEscape(&escaped, compact.Bytes())
+	return escaped.String(), nil
+}
+
+// dataURL returns a base64 encoded data URL of the data.
+func dataURL(mimeType string, data []byte) string {
+	return "data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(data)
+}
+
+// wasmExecJS returns the path of the wasm_exec.js driver: the path specified
+// by -wasm-exec, or the driver of the go command in $PATH, which may be
+// different from the toolchain gogio was built with.
+func wasmExecJS(path string) (string, error) {
+	if path != "" {
+		if _, err := os.Stat(path); err != nil {
+			return "", fmt.Errorf("invalid -wasm-exec: %v", err)
+		}
+		return path, nil
+	}
+	goroot, err := runQuery(exec.Command("go", "env", "GOROOT"))
+	if err != nil {
+		return "", err
+	}
+	// Go 1.24 moved the driver from misc/wasm to lib/wasm.
+	for _, dir := range []string{"lib", "misc"} {
+		wasmJS := filepath.Join(goroot, dir, "wasm", "wasm_exec.js")
+		if _, err := os.Stat(wasmJS); err == nil {
+			return wasmJS, nil
+		}
+	}
+	return "", fmt.Errorf("failed to find the wasm_exec.js driver in %s; use -wasm-exec to specify it", goroot)
+}
+
+// writeJSResources copies the icon and assets to the out directory and
+// writes the index.html page.
+func writeJSResources(out string, bi *buildInfo) error {
+	if err := copyAssets(out, bi); err != nil {
+		return err
+	}
+	faviconPath, err := writeJSIcon(out, bi)
 	if err != nil {
 		return err
 	}
+	page := newJSPage(bi)
+	page.Icon = faviconPath
+	return writeJSIndex(filepath.Join(out, "index.html"), page)
+}
+
+// writeJSIcon writes the icon, if any, to the out directory and returns its
+// file name.
+func writeJSIcon(out string, bi *buildInfo) (string, error) {
+	if _, err := os.Stat(bi.iconPath); err != nil {
+		return "", nil
+	}
+	faviconPath := filepath.Base(bi.iconPath)
+	if bi.iconShape == "rounded" || bi.iconShape == "circle" {
+		err := buildIcons(out, bi.iconPath, []iconVariant{
+			{path: faviconPath, size: 512, shape: bi.iconShape},
+		})
+		return faviconPath, err
+	}
+	// Copy icon to the output folder
+	icon, err := os.ReadFile(bi.iconPath)
+	if err != nil {
+		return "", err
+	}
+	return faviconPath, os.WriteFile(filepath.Join(out, faviconPath), icon, 0600)
+}
 
-	return mergeJSFiles(filepath.Join(out, "wasm.js"), append([]string{wasmJS}, extraJS...)...)
+// jsPage is the data of the index.html template.
+type jsPage struct {
+	Title string
+	// ThemeColor is the CSS color of the browser interface, if any.
+	ThemeColor string
+	// Icon is the icon URL.
+	Icon string
+	// Script is the inlined JavaScript, if any. Otherwise, the page loads
+	// wasm.js.
+	Script string
+	// Config is the JSON object of window.gioConfig, if any.
+	Config string
+	// Loader is the script of the loading overlay, if any.
+	Loader string
+	// minify reports whether to minify the page markup.
+	minify bool
+}
+
+// newJSPage returns the page data for the title and theme color of the
+// build.
+func newJSPage(bi *buildInfo) jsPage {
+	page := jsPage{Title: bi.title, Config: bi.webConfig, minify: bi.minify}
+	if page.Title == "" {
+		page.Title = bi.name
+	}
+	if c := bi.themeColor; len(c) == 9 {
+		// Convert #AARRGGBB to the CSS #RRGGBBAA.
+		page.ThemeColor = "#" + c[3:] + c[1:3]
+	} else {
+		page.ThemeColor = c
+	}
+	if bi.loader {
+		page.Loader = jsLoader
+		if bi.minify {
+			page.Loader = minifyJS(page.Loader)
+		}
+	}
+	return page
+}
+
+// writeJSIndex writes the HTML page to dst.
+func writeJSIndex(dst string, page jsPage) error {
+	index := jsIndex
+	if page.minify {
+		index = minifyHTML(index)
+	}
+	indexTemplate, err := template.New("").Parse(index)
+	if err != nil {
+		return err
+	}
+
+	var b bytes.Buffer
+	if err := indexTemplate.Execute(&b, page); err != nil {
+		return err
+	}
+
+	return os.WriteFile(dst, b.Bytes(), 0600)
 }
 
 func findPackagesJS(p *packages.Package, visited map[string]bool) (extraJS []string, err error) {
@@ -120,34 +301,199 @@ func findPackagesJS(p *packages.Package, visited map[string]bool) (extraJS []str
 }
 
 // mergeJSFiles will merge all files into a single `wasm.js`. It will prepend the jsSetGo
-// and append the jsStartGo.
-func mergeJSFiles(dst string, files ...string) (err error) {
-	w, err := os.Create(dst)
-	if err != nil {
-		return err
-	}
-	defer func() {
-		if cerr := w.Close(); err != nil {
-			err = cerr
-		}
-	}()
-	_, err = io.Copy(w, strings.NewReader(jsSetGo))
-	if err != nil {
-		return err
-	}
+// and append the jsStartGo, which loads the wasm module from wasmURL. The
+// result is minified if minify is set.
+func mergeJSFiles(dst, wasmURL string, minify bool, files ...string) error {
+	var b strings.Builder
+	b.WriteString(jsSetGo)
 	for i := range files {
-		r, err := os.Open(files[i])
+		data, err := os.ReadFile(files[i])
 		if err != nil {
 			return err
 		}
-		_, err = io.Copy(w, r)
-		r.Close()
-		if err != nil {
-			return err
+		b.Write(data)
+	}
+	fmt.Fprintf(&b, jsStartGo, wasmURL)
+	js := b.String()
+	if minify {
+		js = minifyJS(js)
+	}
+	return os.WriteFile(dst, []byte(js), 0666)
+}
+
+// minifyHTML removes the comments and the indentation and line breaks of
+// the HTML markup. The markup must not contain elements such as <pre> and
+// <script> whose whitespace is significant.
+func minifyHTML(src string) string {
+	var b strings.Builder
+	for {
+		start := strings.Index(src, "<!--")
+		if start == -1 {
+			break
 		}
+		end := strings.Index(src[start:], "-->")
+		if end == -1 {
+			break
+		}
+		b.WriteString(src[:start])
+		src = src[start+end+len("-->"):]
+	}
+	b.WriteString(src)
+	var min strings.Builder
+	for _, line := range strings.Split(b.String(), "\n") {
+		min.WriteString(strings.TrimSpace(line))
 	}
-	_, err = io.Copy(w, strings.NewReader(jsStartGo))
-	return err
+	return min.String()
+}
+
+// minifyJS removes the comments, indentation, blank lines and repeated
+// spaces of the JavaScript source. Line breaks are kept, because they may
+// terminate statements. Strings, template literals and regular expressions
+// are copied verbatim.
+func minifyJS(src string) string {
+	var b strings.Builder
+	// space is set when whitespace or a comment separates the previous
+	// and the next token.
+	lineStart, space := true, false
+	for i := 0; i < len(src); {
+		c := src[i]
+		next := byte(0)
+		if i+1 < len(src) {
+			next = src[i+1]
+		}
+		switch {
+		case c == '\n' || c == '\r':
+			if !lineStart {
+				b.WriteByte('\n')
+			}
+			lineStart, space = true, false
+			i++
+			continue
+		case c == ' ' || c == '\t':
+			space = true
+			i++
+			continue
+		case c == '/' && next == '/':
+			if end := strings.IndexByte(src[i:], '\n'); end != -1 {
+				i += end
+			} else {
+				i = len(src)
+			}
+			continue
+		case c == '/' && next == '*':
+			if end := strings.Index(src[i+2:], "*/"); end != -1 {
+				i += 2 + end + len("*/")
+			} else {
+				i = len(src)
+			}
+			space = true
+			continue
+		}
+		if space && !lineStart {
+			b.WriteByte(' ')
+		}
+		lineStart, space = false, false
+		end := i + 1
+		switch {
+		case c == '"' || c == '\'' || c == '`':
+			end = jsStringEnd(src, i)
+		case c == '/' && jsRegexpAllowed(b.String()):
+			end = jsRegexpEnd(src, i)
+		}
+		b.WriteString(src[i:end])
+		i = end
+	}
+	return b.String()
+}
+
+// jsStringEnd returns the index after the string or template literal that
+// starts at src[start].
+func jsStringEnd(src string, start int) int {
+	quote := src[start]
+	for i := start + 1; i < len(src); i++ {
+		switch c := src[i]; {
+		case c == '\\':
+			i++
+		case c == quote:
+			return i + 1
+		case quote == '`' && c == '$' && i+1 < len(src) && src[i+1] == '{':
+			i = jsSubstitutionEnd(src, i+2) - 1
+		case quote != '`' && c == '\n':
+			// Unterminated string.
+			return i
+		}
+	}
+	return len(src)
+}
+
+// jsSubstitutionEnd returns the index after the closing brace of the
+// template literal substitution whose expression starts at src[start].
+func jsSubstitutionEnd(src string, start int) int {
+	depth := 1
+	for i := start; i < len(src); i++ {
+		switch c := src[i]; c {
+		case '"', '\'', '`':
+			i = jsStringEnd(src, i) - 1
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return len(src)
+}
+
+// jsRegexpEnd returns the index after the regular expression literal that
+// starts at src[start].
+func jsRegexpEnd(src string, start int) int {
+	class := false
+	for i := start + 1; i < len(src); i++ {
+		switch c := src[i]; {
+		case c == '\\':
+			i++
+		case c == '[':
+			class = true
+		case c == ']':
+			class = false
+		case c == '/' && !class:
+			// Skip the flags.
+			i++
+			for i < len(src) && ('a' <= src[i] && src[i] <= 'z') {
+				i++
+			}
+			return i
+		case c == '\n':
+			return i
+		}
+	}
+	return len(src)
+}
+
+// jsRegexpAllowed reports whether a slash after the minified JavaScript
+// code starts a regular expression rather than a division.
+func jsRegexpAllowed(code string) bool {
+	code = strings.TrimRight(code, " ")
+	if code == "" {
+		return true
+	}
+	if strings.ContainsRune("(,=:[!&|?{};+-*%<>~^\n", rune(code[len(code)-1])) {
+		return true
+	}
+	for _, kw := range []string{"return", "typeof", "case", "do", "else", "in", "of", "void", "yield", "await", "delete", "instanceof", "new", "throw"} {
+		if rest, ok := strings.CutSuffix(code, kw); ok && (rest == "" || !isJSIdent(rest[len(rest)-1])) {
+			return true
+		}
+	}
+	return false
+}
+
+// isJSIdent reports whether c is an ASCII character of JavaScript
+// identifiers.
+func isJSIdent(c byte) bool {
+	return c == '_' || c == '$' || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
 }
 
 const (
@@ -155,18 +501,74 @@ const (
 <html>
 	<head>
 		<meta charset="utf-8">
-		<meta name="viewport" content="width=device-width, user-scalable=no">
+		<meta name="viewport" content="width=device-width, initial-scale=1, user-scalable=no, viewport-fit=cover">
 		<meta name="mobile-web-app-capable" content="yes">
+		{{ if .ThemeColor }}<meta name="theme-color" content="{{.ThemeColor}}">{{ end }}
 		{{ if .Icon }}<link rel="icon" href="{{.Icon}}" type="image/x-icon" />{{ end }}
-		{{ if .Name }}<title>{{.Name}}</title>{{ end }}
-		<script src="wasm.js"></script>
+		{{ if .Title }}<title>{{html .Title}}</title>{{ end }}
+		{{ if .Config }}<script>window.gioConfig = {{.Config}};</script>{{ end }}
+		{{ if .Loader }}<script>{{.Loader}}</script>{{ end }}
+		{{ if .Script }}<script>{{.Script}}</script>{{ else }}<script src="wasm.js"></script>{{ end }}
 		<style>
 			body,pre { margin:0;padding:0; }
 		</style>
+		{{ if .Loader }}<style>
+			#gio-loader { position:fixed;inset:0;display:flex;align-items:center;justify-content:center;background:#fff; }
+			#gio-loader-track { width:50%;height:4px;background:#0002; }
+			#gio-loader-bar { width:0;height:100%;background:{{ if .ThemeColor }}{{.ThemeColor}}{{ else }}#3f51b5{{ end }}; }
+		</style>{{ end }}
 	</head>
 	<body>
+		{{ if .Loader }}<div id="gio-loader"><div id="gio-loader-track"><div id="gio-loader-bar"></div></div></div>{{ end }}
 	</body>
 </html>`
+	// jsLoader removes the loading overlay when Gio draws its first frame,
+	// and defines the gioFetchWasm function that fetches the wasm module
+	// while updating the progress bar. The progress is based on the
+	// Content-Length of the response.
+	jsLoader = `(() => {
+	const hide = () => {
+		const loader = document.getElementById("gio-loader");
+		if (loader) {
+			loader.remove();
+		}
+	};
+	// Gio adds its canvas when it starts, and draws the first frame in
+	// the following animation frame.
+	const observer = new MutationObserver(() => {
+		if (document.querySelector("canvas")) {
+			observer.disconnect();
+			requestAnimationFrame(() => requestAnimationFrame(hide));
+		}
+	});
+	observer.observe(document.documentElement, {childList: true, subtree: true});
+	window.gioFetchWasm = async (url) => {
+		const resp = await fetch(url);
+		const total = Number(resp.headers.get("Content-Length"));
+		if (!resp.ok || !resp.body || !total) {
+			return resp;
+		}
+		const reader = resp.body.getReader();
+		let loaded = 0;
+		const body = new ReadableStream({
+			async pull(controller) {
+				const {done, value} = await reader.read();
+				if (done) {
+					controller.close();
+					return;
+				}
+				loaded += value.byteLength;
+				const bar = document.getElementById("gio-loader-bar");
+				if (bar) {
+					// Compressed responses report their compressed length.
+					bar.style.width = Math.min(100, 100 * loaded / total) + "%";
+				}
+				controller.enqueue(value);
+			},
+		});
+		return new Response(body, {headers: {"Content-Type": "application/wasm"}});
+	};
+})();`
 	// jsSetGo sets the `window.go` variable.
 	jsSetGo = `(() => {
     window.go = {argv: [], env: {}, importObject: {go: {}}};
@@ -175,7 +577,8 @@ const (
 		window.go["argv"] = argv.split(" ");
 	}
 })();`
-	// jsStartGo initializes the main.wasm.
+	// jsStartGo initializes the wasm module, whose URL is formatted
+	// into it.
 	jsStartGo = `(() => {
 	defaultGo = new Go();
 	Object.assign(defaultGo["argv"], defaultGo["argv"].concat(go["argv"]));
@@ -193,7 +596,8 @@ const (
             return await WebAssembly.instantiate(source, importObject);
         };
     }
-    WebAssembly.instantiateStreaming(fetch("main.wasm"), go.importObject).then((result) => {
+    const fetchWasm = window.gioFetchWasm || fetch;
+    WebAssembly.instantiateStreaming(fetchWasm(%q), go.importObject).then((result) => {
         go.run(result.instance);
     });
 })();`
@@ -0,0 +1,292 @@
+// SPDX-License-Identifier: Unlicense OR MIT
+
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeTestAssets creates an assets directory with a file in a
+// subdirectory and returns the directory path.
+func writeTestAssets(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "fonts"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "fonts", "font.ttf"), []byte("font"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestJSAssets(t *testing.T) {
+	t.Parallel()
+
+	out := t.TempDir()
+	bi := &buildInfo{
+		name:      "app",
+		assetsDir: writeTestAssets(t),
+	}
+	if err := writeJSResources(out, bi); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(filepath.Join(out, "fonts", "font.ttf")); err != nil || string(data) != "font" {
+		t.Errorf("asset not copied to the web output: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(out, "index.html")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestWasmExec(t *testing.T) {
+	t.Parallel()
+
+	driver := filepath.Join(t.TempDir(), "wasm_exec.js")
+	if err := os.WriteFile(driver, []byte("// driver"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	path, err := wasmExecJS(driver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != driver {
+		t.Errorf("driver path is %q, expected %q", path, driver)
+	}
+	if _, err := wasmExecJS(filepath.Join(t.TempDir(), "missing.js")); err == nil {
+		t.Error("a missing driver was accepted")
+	}
+}
+
+func TestSingleFile(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	wasm := filepath.Join(dir, "main.wasm")
+	if err := os.WriteFile(wasm, []byte("\x00asm module"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	driver := filepath.Join(dir, "wasm_exec.js")
+	if err := os.WriteFile(driver, []byte("// wasm_exec driver\nconst end = \"</SCRIPT>\", comment = '<!--';"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	bi := &buildInfo{
+		name:     "app",
+		iconPath: writeTestIcon(t, 64),
+	}
+	out := filepath.Join(t.TempDir(), "app.html")
+	if err := writeSingleFile(out, dir, wasm, []string{driver}, bi); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := string(data)
+	for _, exp := range []string{
+		dataURL("application/wasm", []byte("\x00asm module")),
+		"// wasm_exec driver",
+		`"<\/SCRIPT>"`,
+		`'<\!--'`,
+		`<link rel="icon" href="data:image/png;base64,`,
+	} {
+		if !strings.Contains(page, exp) {
+			t.Errorf("page is missing %q:\n%s", exp, page)
+		}
+	}
+	for _, ref := range []string{"main.wasm", `src="wasm.js"`, filepath.Base(bi.iconPath)} {
+		if strings.Contains(page, ref) {
+			t.Errorf("page refers to %q:\n%s", ref, page)
+		}
+	}
+	if n := strings.Count(strings.ToLower(page), "</script"); n != 1 {
+		t.Errorf("page has %d </script> tags, expected 1:\n%s", n, page)
+	}
+}
+
+func TestJSPageTitle(t *testing.T) {
+	t.Parallel()
+
+	out := t.TempDir()
+	bi := &buildInfo{
+		name:       "app",
+		title:      "My <App>",
+		themeColor: "#80112233",
+	}
+	if err := writeJSResources(out, bi); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(out, "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := string(data)
+	for _, exp := range []string{
+		"<title>My &lt;App&gt;</title>",
+		`<meta name="theme-color" content="#11223380">`,
+		`initial-scale=1`,
+	} {
+		if !strings.Contains(page, exp) {
+			t.Errorf("page is missing %q:\n%s", exp, page)
+		}
+	}
+	if p := newJSPage(&buildInfo{name: "app"}); p.Title != "app" {
+		t.Errorf("default title is %q, expected the app name", p.Title)
+	}
+}
+
+func TestMinify(t *testing.T) {
+	t.Parallel()
+
+	js := "// Comment.\n" +
+		"const s = \"a  // not a comment\";   /* block */ let x = 1;\n" +
+		"\n" +
+		"\tconst r = /[/*]+\\//g;\n" +
+		"    const t = `line\n    ${s + '}'} /* kept */`;\n" +
+		"return a / b / c;\n"
+	exp := "const s = \"a  // not a comment\"; let x = 1;\n" +
+		"const r = /[/*]+\\//g;\n" +
+		"const t = `line\n    ${s + '}'} /* kept */`;\n" +
+		"return a / b / c;\n"
+	if got := minifyJS(js); got != exp {
+		t.Errorf("minified JavaScript is\n%s\nexpected\n%s", got, exp)
+	}
+
+	pages := make(map[bool][]byte)
+	for _, minify := range []bool{false, true} {
+		out := t.TempDir()
+		bi := &buildInfo{name: "app", themeColor: "#112233", minify: minify}
+		if err := writeJSResources(out, bi); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(filepath.Join(out, "index.html"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages[minify] = data
+	}
+	if len(pages[true]) >= len(pages[false]) {
+		t.Errorf("minified page is %d bytes, expected less than %d", len(pages[true]), len(pages[false]))
+	}
+	plain, err := htmlElements(pages[false])
+	if err != nil {
+		t.Fatal(err)
+	}
+	min, err := htmlElements(pages[true])
+	if err != nil {
+		t.Fatalf("minified page doesn't parse: %v\n%s", err, pages[true])
+	}
+	if !reflect.DeepEqual(min, plain) {
+		t.Errorf("minified page has the elements %v, expected %v", min, plain)
+	}
+}
+
+// htmlElements parses the HTML page and returns its elements and their
+// attributes.
+func htmlElements(page []byte) ([]string, error) {
+	d := xml.NewDecoder(bytes.NewReader(page))
+	d.Strict = false
+	d.AutoClose = xml.HTMLAutoClose
+	d.Entity = xml.HTMLEntity
+	var elems []string
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return elems, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if e, ok := tok.(xml.StartElement); ok {
+			elem := e.Name.Local
+			for _, a := range e.Attr {
+				elem += fmt.Sprintf(" %s=%q", a.Name.Local, a.Value)
+			}
+			elems = append(elems, elem)
+		}
+	}
+}
+
+func TestJSLoader(t *testing.T) {
+	t.Parallel()
+
+	for _, loader := range []bool{false, true} {
+		out := t.TempDir()
+		bi := &buildInfo{name: "app", themeColor: "#112233", loader: loader}
+		if err := writeJSResources(out, bi); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(filepath.Join(out, "index.html"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		page := string(data)
+		for _, exp := range []string{
+			`<div id="gio-loader">`,
+			"background:#112233;",
+			"window.gioFetchWasm = async (url)",
+			`resp.headers.get("Content-Length")`,
+		} {
+			if got := strings.Contains(page, exp); got != loader {
+				t.Errorf("with loader %v, page contains %q: %v\n%s", loader, exp, got, page)
+			}
+		}
+		if loader && strings.Index(page, "gioFetchWasm") > strings.Index(page, `src="wasm.js"`) {
+			t.Errorf("loader script is not defined before wasm.js is loaded:\n%s", page)
+		}
+	}
+	if !strings.Contains(jsStartGo, "window.gioFetchWasm || fetch") {
+		t.Error("wasm.js doesn't fetch the module through the loader")
+	}
+}
+
+func TestWebConfig(t *testing.T) {
+	t.Parallel()
+
+	file := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(file, []byte("{\n\t\"apiBase\": \"https://api.example.com\",\n\t\"beta\": true\n}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config, err := getWebConfig(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := `{"apiBase":"https://api.example.com","beta":true}`; config != exp {
+		t.Errorf("config is %s, expected %s", config, exp)
+	}
+	if _, err := getWebConfig(`["not", "an", "object"]`); err == nil {
+		t.Error("JSON array was accepted")
+	}
+	if _, err := getWebConfig(`{"unterminated": `); err == nil {
+		t.Error("invalid JSON was accepted")
+	}
+
+	config, err = getWebConfig(`{"banner": "</script><script>alert(1)"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := t.TempDir()
+	bi := &buildInfo{name: "app", webConfig: config}
+	if err := writeJSResources(out, bi); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(out, "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := string(data)
+	if exp := `window.gioConfig = {"banner":"\u003c/script\u003e\u003cscript\u003ealert(1)"};`; !strings.Contains(page, exp) {
+		t.Errorf("page is missing %q:\n%s", exp, page)
+	}
+	if strings.Index(page, "gioConfig") > strings.Index(page, `src="wasm.js"`) {
+		t.Errorf("config is not set before wasm.js is loaded:\n%s", page)
+	}
+}
@@ -0,0 +1,407 @@
+// SPDX-License-Identifier: Unlicense OR MIT
+
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// linuxIconSizes are the hicolor theme sizes generated for desktop icons.
+var linuxIconSizes = []int{16, 24, 32, 48, 64, 128, 256, 512}
+
+// Flatpak runtime used by generated manifests.
+const (
+	flatpakRuntime        = "org.freedesktop.Platform"
+	flatpakRuntimeVersion = "23.08"
+	flatpakSDK            = "org.freedesktop.Sdk"
+)
+
+// flatpakFinishArgs are the sandbox permissions required by Gio programs.
+var flatpakFinishArgs = []string{
+	"--share=ipc",
+	"--socket=wayland",
+	"--socket=fallback-x11",
+	"--device=dri",
+}
+
+type flatpakManifest struct {
+	AppID          string          `json:"app-id"`
+	Runtime        string          `json:"runtime"`
+	RuntimeVersion string          `json:"runtime-version"`
+	SDK            string          `json:"sdk"`
+	Command        string          `json:"command"`
+	FinishArgs     []string        `json:"finish-args"`
+	Modules        []flatpakModule `json:"modules"`
+}
+
+type flatpakModule struct {
+	Name          string          `json:"name"`
+	BuildSystem   string          `json:"buildsystem"`
+	BuildCommands []string        `json:"build-commands"`
+	Sources       []flatpakSource `json:"sources"`
+}
+
+type flatpakSource struct {
+	Type string `json:"type"`
+	Path string `json:"path"`
+}
+
+func buildLinux(tmpDir string, bi *buildInfo) error {
+	out := *destPath
+	format := *pkgFormat
+	if format == "" {
+		format = "tar"
+		if strings.HasSuffix(out, ".AppImage") {
+			format = "appimage"
+		}
+	}
+	if format != "tar" && bi.target != "linux" {
+		return fmt.Errorf("-format %s is only supported for target linux", format)
+	}
+	var ext string
+	var pkg func(tmpDir, dest, arch string, bi *buildInfo) error
+	switch format {
+	case "tar":
+		ext, pkg = ".tar.gz", packageLinuxTar
+		if strings.HasSuffix(out, ".tgz") {
+			ext = ".tgz"
+		}
+	case "appimage":
+		ext, pkg = ".AppImage", packageAppImage
+	case "flatpak":
+		// The output is a directory.
+		ext, pkg = "", packageFlatpak
+	default:
+		return fmt.Errorf("invalid -format %s for target %s", format, bi.target)
+	}
+	if out == "" {
+		out = bi.name + ext
+		if format == "flatpak" {
+			out = bi.name + "-flatpak"
+		}
+	}
+	if !strings.HasSuffix(out, ext) {
+		return fmt.Errorf("invalid output name %q, it must end with `%s`", out, ext)
+	}
+	for _, arch := range bi.archs {
+		dest := out
+		if len(bi.archs) > 1 {
+			dest = archOutput(bi, out, ext, arch)
+		}
+		if err := pkg(tmpDir, dest, arch, bi); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// packageLinuxTar writes a tarball with the program and its desktop
+// integration files laid out like an installation prefix.
+func packageLinuxTar(tmpDir, dest, arch string, bi *buildInfo) error {
+	dir := strings.TrimSuffix(strings.TrimSuffix(filepath.Base(dest), ".tar.gz"), ".tgz")
+	prefix := filepath.Join(tmpDir, arch, dir)
+	if err := buildLinuxProgram(bi, arch, filepath.Join(prefix, "bin", bi.name)); err != nil {
+		return err
+	}
+	if err := writeLinuxShare(prefix, bi); err != nil {
+		return err
+	}
+	return tarDir(dest, filepath.Join(tmpDir, arch), dir)
+}
+
+func packageAppImage(tmpDir, dest, arch string, bi *buildInfo) error {
+	appimagetool, err := exec.LookPath("appimagetool")
+	if err != nil {
+		appimagetool = ""
+	}
+	// Without appimagetool, the AppDir itself is the output.
+	appDir := strings.TrimSuffix(dest, ".AppImage") + ".AppDir"
+	if appimagetool != "" {
+		appDir = filepath.Join(tmpDir, bi.name+"_"+arch+".AppDir")
+	}
+	if err := os.RemoveAll(appDir); err != nil {
+		return err
+	}
+	exe := filepath.Join(appDir, "usr", "bin", bi.name)
+	if err := buildLinuxProgram(bi, arch, exe); err != nil {
+		return err
+	}
+	if err := writeLinuxAppDir(appDir, bi); err != nil {
+		return err
+	}
+	if appimagetool == "" {
+		fmt.Fprintf(os.Stderr, "gogio: appimagetool not found in $PATH; wrote %s instead of %s.\n"+
+			"Install appimagetool from https://appimage.github.io/appimagetool and run\n\n"+
+			"\tARCH=%s appimagetool %s %s\n\n", appDir, dest, appImageArch(arch), appDir, dest)
+		return nil
+	}
+	cmd := exec.Command(appimagetool, appDir, dest)
+	cmd.Env = append(os.Environ(), "ARCH="+appImageArch(arch))
+	_, err = runCmd(cmd)
+	return err
+}
+
+// packageFlatpak writes a Flatpak manifest and the files it references to
+// the dest directory, and runs flatpak-builder if available.
+func packageFlatpak(tmpDir, dest, arch string, bi *buildInfo) error {
+	if err := buildLinuxProgram(bi, arch, filepath.Join(dest, bi.name)); err != nil {
+		return err
+	}
+	share := filepath.Join(tmpDir, arch, "flatpak")
+	if err := writeLinuxShare(share, bi); err != nil {
+		return err
+	}
+	desktop := bi.appID + ".desktop"
+	if err := copyFile(filepath.Join(dest, desktop), filepath.Join(share, "share", "applications", desktop)); err != nil {
+		return err
+	}
+	icon := filepath.Join(share, "share", "icons", "hicolor", "256x256", "apps", bi.appID+".png")
+	hasIcon := false
+	if _, err := os.Stat(icon); err == nil {
+		if err := copyFile(filepath.Join(dest, bi.appID+".png"), icon); err != nil {
+			return err
+		}
+		hasIcon = true
+	}
+	manifest := filepath.Join(dest, bi.appID+".json")
+	if err := writeFlatpakManifest(manifest, bi, hasIcon); err != nil {
+		return err
+	}
+	builder, err := exec.LookPath("flatpak-builder")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "gogio: flatpak-builder not found in $PATH; wrote the manifest %s.\n"+
+			"Install flatpak-builder and run\n\n"+
+			"\tflatpak-builder --repo=repo build %s\n\n"+
+			"in %s to build the Flatpak.\n", manifest, filepath.Base(manifest), dest)
+		return nil
+	}
+	cmd := exec.Command(builder, "--force-clean", "--repo=repo", "build", filepath.Base(manifest))
+	cmd.Dir = dest
+	_, err = runCmd(cmd)
+	return err
+}
+
+func writeFlatpakManifest(path string, bi *buildInfo, hasIcon bool) error {
+	desktop := bi.appID + ".desktop"
+	mod := flatpakModule{
+		Name:        bi.name,
+		BuildSystem: "simple",
+		BuildCommands: []string{
+			"install -Dm755 " + bi.name + " /app/bin/" + bi.name,
+			"install -Dm644 " + desktop + " /app/share/applications/" + desktop,
+		},
+		Sources: []flatpakSource{
+			{Type: "file", Path: bi.name},
+			{Type: "file", Path: desktop},
+		},
+	}
+	if hasIcon {
+		icon := bi.appID + ".png"
+		mod.BuildCommands = append(mod.BuildCommands, "install -Dm644 "+icon+" /app/share/icons/hicolor/256x256/apps/"+icon)
+		mod.Sources = append(mod.Sources, flatpakSource{Type: "file", Path: icon})
+	}
+	manifest, err := json.MarshalIndent(flatpakManifest{
+		AppID:          bi.appID,
+		Runtime:        flatpakRuntime,
+		RuntimeVersion: flatpakRuntimeVersion,
+		SDK:            flatpakSDK,
+		Command:        bi.name,
+		FinishArgs:     flatpakFinishArgs,
+		Modules:        []flatpakModule{mod},
+	}, "", "\t")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, manifest, 0644)
+}
+
+func buildLinuxProgram(bi *buildInfo, arch, dest string) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	cmd := exec.Command(
+		"go",
+		"build",
+		"-ldflags="+bi.ldflags,
+		"-tags="+bi.tags,
+		"-o", dest,
+		bi.pkgPath,
+	)
+	cmd.Env = append(
+		os.Environ(),
+		"GOOS="+bi.target,
+		"GOARCH="+arch,
+		"CGO_ENABLED=1", // Required by the Wayland and X11 backends.
+	)
+	cmd.Env = append(cmd.Env, cgoEnv(bi, "", nil, nil)...)
+	return runGoBuild(bi, cmd, dest)
+}
+
+// writeLinuxAppDir lays out the AppImage directory structure around the
+// program already built into appDir/usr/bin.
+func writeLinuxAppDir(appDir string, bi *buildInfo) error {
+	if err := writeLinuxShare(filepath.Join(appDir, "usr"), bi); err != nil {
+		return err
+	}
+	// appimagetool expects the desktop file and its icon at the root.
+	desktop := bi.appID + ".desktop"
+	if err := copyFile(filepath.Join(appDir, desktop), filepath.Join(appDir, "usr", "share", "applications", desktop)); err != nil {
+		return err
+	}
+	if _, err := os.Stat(bi.iconPath); err == nil {
+		icon := filepath.Join("usr", "share", "icons", "hicolor", "256x256", "apps", bi.appID+".png")
+		if err := copyFile(filepath.Join(appDir, bi.appID+".png"), filepath.Join(appDir, icon)); err != nil {
+			return err
+		}
+		if err := os.Symlink(icon, filepath.Join(appDir, ".DirIcon")); err != nil {
+			return err
+		}
+	}
+	return os.Symlink(filepath.Join("usr", "bin", bi.name), filepath.Join(appDir, "AppRun"))
+}
+
+// writeLinuxShare writes the desktop entry and hicolor icons under
+// prefix/share, following the freedesktop.org directory layout.
+func writeLinuxShare(prefix string, bi *buildInfo) error {
+	share := filepath.Join(prefix, "share")
+	apps := filepath.Join(share, "applications")
+	if err := os.MkdirAll(apps, 0755); err != nil {
+		return err
+	}
+	entry, err := linuxDesktopEntry(bi)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(apps, bi.appID+".desktop"), entry, 0644); err != nil {
+		return err
+	}
+	if _, err := os.Stat(bi.iconPath); err != nil {
+		return nil
+	}
+	var variants []iconVariant
+	for _, size := range linuxIconSizes {
+		variants = append(variants, iconVariant{
+			path:  filepath.Join(fmt.Sprintf("%[1]dx%[1]d", size), "apps", bi.appID+".png"),
+			size:  size,
+			shape: bi.iconShape,
+		})
+	}
+	return buildIcons(filepath.Join(share, "icons", "hicolor"), bi.iconPath, variants)
+}
+
+func linuxDesktopEntry(bi *buildInfo) ([]byte, error) {
+	tmpl, err := template.New("desktop").Parse(`[Desktop Entry]
+Type=Application
+Name={{.Name}}
+Exec={{.Exec}}{{if .Schemes}} %u{{end}}
+Icon={{.Icon}}
+Terminal=false
+Categories=Utility;
+{{if .Schemes}}MimeType={{range .Schemes}}x-scheme-handler/{{.}};{{end}}
+{{end}}`)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, struct {
+		Name, Exec, Icon string
+		Schemes          []string
+	}{
+		Name:    desktopString(UppercaseName(bi.name)),
+		Exec:    desktopString(desktopExecArg(bi.name)),
+		Icon:    bi.appID,
+		Schemes: bi.schemes,
+	})
+	return buf.Bytes(), err
+}
+
+// desktopString escapes s for a string value of a desktop entry.
+func desktopString(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, "\t", `\t`, "\r", `\r`).Replace(s)
+}
+
+// desktopExecArg quotes arg for the Exec key of a desktop entry, where
+// arguments with reserved characters are quoted and % starts a field code.
+// The result is escaped by desktopString like any other string value.
+func desktopExecArg(arg string) string {
+	arg = strings.ReplaceAll(arg, "%", "%%")
+	if !strings.ContainsAny(arg, " \t\n\"'\\><~|&;$*?#()`") {
+		return arg
+	}
+	return `"` + strings.NewReplacer(`"`, `\"`, "`", "\\`", "$", `\$`, `\`, `\\`).Replace(arg) + `"`
+}
+
+// tarDir writes a gzip compressed tarball of the dir directory in base, with
+// entry names relative to base.
+func tarDir(dst, base, dir string) (err error) {
+	f, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	err = filepath.Walk(filepath.Join(base, dir), func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		hdr, err := tar.FileInfoHeader(fi, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(path[len(base)+1:])
+		if fi.IsDir() {
+			hdr.Name += "/"
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+		src, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		_, err = io.Copy(tw, src)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// appImageArch maps a GOARCH to the architecture name used by appimagetool.
+func appImageArch(goarch string) string {
+	switch goarch {
+	case "amd64":
+		return "x86_64"
+	case "386":
+		return "i686"
+	case "arm64":
+		return "aarch64"
+	case "arm":
+		return "armhf"
+	default:
+		return goarch
+	}
+}
@@ -0,0 +1,145 @@
+// SPDX-License-Identifier: Unlicense OR MIT
+
+package main
+
+import (
+	"encoding/json"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// writeTestIcon writes a square PNG of the given size and returns its path.
+func writeTestIcon(t *testing.T, size int) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "appicon.png")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, image.NewNRGBA(image.Rect(0, 0, size, size))); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLinuxAppDir(t *testing.T) {
+	t.Parallel()
+
+	appDir := t.TempDir()
+	bi := &buildInfo{
+		appID:    "com.example.app",
+		name:     "app",
+		iconPath: writeTestIcon(t, 512),
+	}
+	if err := writeLinuxAppDir(appDir, bi); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{
+		"com.example.app.desktop",
+		"com.example.app.png",
+		"usr/share/applications/com.example.app.desktop",
+		"usr/share/icons/hicolor/256x256/apps/com.example.app.png",
+		"usr/share/icons/hicolor/16x16/apps/com.example.app.png",
+	} {
+		if _, err := os.Stat(filepath.Join(appDir, path)); err != nil {
+			t.Errorf("missing %s in AppDir: %v", path, err)
+		}
+	}
+	if dst, err := os.Readlink(filepath.Join(appDir, "AppRun")); err != nil || dst != filepath.Join("usr", "bin", "app") {
+		t.Errorf("AppRun links to %q (%v), expected usr/bin/app", dst, err)
+	}
+}
+
+func TestLinuxDesktopEntry(t *testing.T) {
+	t.Parallel()
+
+	bi := &buildInfo{
+		appID:   "com.example.app",
+		name:    "app",
+		schemes: []string{"foo", "bar"},
+	}
+	entry, err := linuxDesktopEntry(bi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"Name=App\n",
+		"Exec=app %u\n",
+		"Icon=com.example.app\n",
+		"MimeType=x-scheme-handler/foo;x-scheme-handler/bar;\n",
+	} {
+		if !strings.Contains(string(entry), line) {
+			t.Errorf("desktop entry is missing %q:\n%s", line, entry)
+		}
+	}
+
+	bi.name = `my app 100% "fun"`
+	entry, err = linuxDesktopEntry(bi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		`Name=My app 100% "fun"` + "\n",
+		`Exec="my app 100%% \\"fun\\"" %u` + "\n",
+	} {
+		if !strings.Contains(string(entry), line) {
+			t.Errorf("desktop entry is missing %q:\n%s", line, entry)
+		}
+	}
+}
+
+func TestFlatpakManifest(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "manifest.json")
+	bi := &buildInfo{
+		appID: "com.example.app",
+		name:  "app",
+	}
+	if err := writeFlatpakManifest(path, bi, true); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m struct {
+		AppID      string   `json:"app-id"`
+		Command    string   `json:"command"`
+		FinishArgs []string `json:"finish-args"`
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatal(err)
+	}
+	if m.AppID != bi.appID {
+		t.Errorf("app-id is %q, expected %q", m.AppID, bi.appID)
+	}
+	if m.Command != bi.name {
+		t.Errorf("command is %q, expected %q", m.Command, bi.name)
+	}
+	if !reflect.DeepEqual(m.FinishArgs, flatpakFinishArgs) {
+		t.Errorf("finish-args are %v, expected %v", m.FinishArgs, flatpakFinishArgs)
+	}
+}
+
+func TestFreeBSDTarget(t *testing.T) {
+	if err := validateTarget("freebsd"); err != nil {
+		t.Fatal(err)
+	}
+	defer func(old string) { *target = old }(*target)
+	*target = "freebsd"
+	exp := os.Getenv("GOARCH")
+	if exp == "" {
+		exp = runtime.GOARCH
+	}
+	if archs := getArchs(); !reflect.DeepEqual(archs, []string{exp}) {
+		t.Errorf("got archs %v for freebsd, expected [%s]", archs, exp)
+	}
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"debug/macho"
+	"encoding/xml"
 	"errors"
 	"fmt"
 	"os"
@@ -14,7 +16,7 @@ func buildMac(tmpDir string, bi *buildInfo) error {
 	builder := &macBuilder{TempDir: tmpDir}
 	builder.DestDir = *destPath
 	if builder.DestDir == "" {
-		builder.DestDir = bi.pkgPath
+		builder.DestDir = pkgOutputDir(bi)
 	}
 
 	name := bi.name
@@ -22,7 +24,9 @@ func buildMac(tmpDir string, bi *buildInfo) error {
 		if filepath.Ext(*destPath) != ".app" {
 			return fmt.Errorf("invalid output name %q, it must end with `.app`", *destPath)
 		}
-		name = filepath.Base(*destPath)
+		if !templatedOutput(bi, *destPath) {
+			name = filepath.Base(*destPath)
+		}
 	}
 	name = strings.TrimSuffix(name, ".app")
 
@@ -30,7 +34,7 @@ func buildMac(tmpDir string, bi *buildInfo) error {
 		return errors.New("app id is empty; use -appid to set it")
 	}
 
-	if err := builder.setIcon(bi.iconPath); err != nil {
+	if err := builder.setIcon(bi.iconPath, bi.iconShape); err != nil {
 		return err
 	}
 
@@ -50,6 +54,10 @@ func buildMac(tmpDir string, bi *buildInfo) error {
 			return err
 		}
 
+		if err := extractSymbols(bi, filepath.Join(tmpDest, "Contents", "MacOS", name), dsymPath(finalDest)); err != nil {
+			return err
+		}
+
 		if bi.key != "" {
 			if err := builder.signProgram(bi, tmpDest, name, arch); err != nil {
 				return err
@@ -60,7 +68,7 @@ func buildMac(tmpDir string, bi *buildInfo) error {
 			return err
 		}
 
-		if bi.notaryAppleID != "" {
+		if bi.notaryAppleID != "" || bi.notaryProfile != "" {
 			if err := builder.notarize(bi, tmpDest+".zip"); err != nil {
 				return err
 			}
@@ -69,6 +77,8 @@ func buildMac(tmpDir string, bi *buildInfo) error {
 		if err := dittounzip(tmpDest+".zip", finalDest); err != nil {
 			return err
 		}
+		addArtifact(finalDest, arch)
+		addArtifact(dsymPath(finalDest), arch)
 	}
 
 	return nil
@@ -83,10 +93,13 @@ type macBuilder struct {
 	Entitlements []byte
 }
 
-func (b *macBuilder) setIcon(path string) (err error) {
+func (b *macBuilder) setIcon(path, shape string) (err error) {
 	if _, err := os.Stat(path); err != nil {
 		return nil
 	}
+	if isIconCatalog(path) {
+		return b.compileIconCatalog(path)
+	}
 
 	out := filepath.Join(b.TempDir, "iconset.iconset")
 	if err := os.MkdirAll(out, 0777); err != nil {
@@ -94,18 +107,18 @@ func (b *macBuilder) setIcon(path string) (err error) {
 	}
 
 	err = buildIcons(out, path, []iconVariant{
-		{path: "icon_512x512@2x.png", size: 1024},
-		{path: "icon_512x512.png", size: 512},
-		{path: "icon_256x256@2x.png", size: 512},
-		{path: "icon_256x256.png", size: 256},
-		{path: "icon_128x128@2x.png", size: 256},
-		{path: "icon_128x128.png", size: 128},
-		{path: "icon_64x64@2x.png", size: 128},
-		{path: "icon_64x64.png", size: 64},
-		{path: "icon_32x32@2x.png", size: 64},
-		{path: "icon_32x32.png", size: 32},
-		{path: "icon_16x16@2x.png", size: 32},
-		{path: "icon_16x16.png", size: 16},
+		{path: "icon_512x512@2x.png", size: 1024, shape: shape},
+		{path: "icon_512x512.png", size: 512, shape: shape},
+		{path: "icon_256x256@2x.png", size: 512, shape: shape},
+		{path: "icon_256x256.png", size: 256, shape: shape},
+		{path: "icon_128x128@2x.png", size: 256, shape: shape},
+		{path: "icon_128x128.png", size: 128, shape: shape},
+		{path: "icon_64x64@2x.png", size: 128, shape: shape},
+		{path: "icon_64x64.png", size: 64, shape: shape},
+		{path: "icon_32x32@2x.png", size: 64, shape: shape},
+		{path: "icon_32x32.png", size: 32, shape: shape},
+		{path: "icon_16x16@2x.png", size: 32, shape: shape},
+		{path: "icon_16x16.png", size: 16, shape: shape},
 	})
 
 	if err != nil {
@@ -118,11 +131,82 @@ func (b *macBuilder) setIcon(path string) (err error) {
 	if _, err := runCmd(cmd); err != nil {
 		return err
 	}
+	if dryRunSkip("embedding icon.icns") {
+		return nil
+	}
 
 	b.Icons, err = os.ReadFile(filepath.Join(b.TempDir, "icon.icns"))
 	return err
 }
 
+// compileIconCatalog compiles the app icon of an asset catalog or app icon
+// set with actool.
+func (b *macBuilder) compileIconCatalog(icon string) error {
+	assets := filepath.Join(b.TempDir, "Assets.xcassets")
+	if err := os.Mkdir(assets, 0700); err != nil {
+		return err
+	}
+	appIconName, err := copyIconCatalog(assets, icon, "macos")
+	if err != nil {
+		return err
+	}
+	out := filepath.Join(b.TempDir, "icons")
+	if err := os.Mkdir(out, 0700); err != nil {
+		return err
+	}
+	if _, err := runCmd(macActoolCmd(out, assets, appIconName)); err != nil {
+		return err
+	}
+	if dryRunSkip("embedding " + appIconName + ".icns") {
+		return nil
+	}
+	b.Icons, err = os.ReadFile(filepath.Join(out, appIconName+".icns"))
+	return err
+}
+
+// macActoolCmd returns the command that compiles the app icon of the assets
+// catalog into an .icns file in the out directory.
+func macActoolCmd(out, assets, appIconName string) *exec.Cmd {
+	return exec.Command(
+		"actool",
+		"--compile", out,
+		"--platform", "macosx",
+		"--minimum-deployment-target", "10.13",
+		"--app-icon", appIconName,
+		"--output-partial-info-plist", filepath.Join(out, "assets.plist"),
+		assets,
+	)
+}
+
+// macCategories are the known LSApplicationCategoryType values.
+var macCategories = map[string]bool{}
+
+func init() {
+	for _, c := range []string{
+		"business", "developer-tools", "education", "entertainment",
+		"finance", "games", "graphics-design", "healthcare-fitness",
+		"lifestyle", "medical", "music", "news", "photography",
+		"productivity", "reference", "social-networking", "sports",
+		"travel", "utilities", "video", "weather",
+		"action-games", "adventure-games", "arcade-games", "board-games",
+		"card-games", "casino-games", "dice-games", "educational-games",
+		"family-games", "kids-games", "music-games", "puzzle-games",
+		"racing-games", "role-playing-games", "simulation-games",
+		"sports-games", "strategy-games", "trivia-games", "word-games",
+	} {
+		macCategories["public.app-category."+c] = true
+	}
+}
+
+// macCategory expands a short category name such as "productivity" to its
+// LSApplicationCategoryType value.
+func macCategory(c string) string {
+	if c == "" || strings.HasPrefix(c, "public.app-category.") {
+		return c
+	}
+	return "public.app-category." + c
+}
+
 func (b *macBuilder) setInfo(buildInfo *buildInfo, name string) error {
 	t, err := template.New("manifest").Parse(`<?xml version="1.0" encoding="UTF-8"?>
 <!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
@@ -138,18 +222,45 @@ func (b *macBuilder) setInfo(buildInfo *buildInfo, name string) error {
 	<true/>
 	<key>CFBundlePackageType</key>
 	<string>APPL</string>
+{{- if .Category}}
+	<key>LSApplicationCategoryType</key>
+	<string>{{.Category}}</string>
+{{- end}}
+{{- if .Copyright}}
+	<key>NSHumanReadableCopyright</key>
+	<string>{{.Copyright}}</string>
+{{- end}}
+{{- .URLTypes}}
+{{- .LocalizedNames}}
 </dict>
 </plist>`)
 	if err != nil {
 		return err
 	}
 
+	category := macCategory(buildInfo.category)
+	if category != "" && !macCategories[category] {
+		fmt.Fprintf(os.Stderr, "gogio: warning: unknown -category %q\n", buildInfo.category)
+	}
+	esc := func(s string) string {
+		var b strings.Builder
+		xml.EscapeText(&b, []byte(s))
+		return b.String()
+	}
 	var manifest bufferCoff
 	if err := t.Execute(&manifest, struct {
-		Name, Bundle string
+		Name, Bundle        string
+		Category, Copyright string
+		URLTypes            string
+		LocalizedNames      string
 	}{
-		Name:   name,
-		Bundle: buildInfo.appID,
+		Name:      esc(name),
+		Bundle:    buildInfo.appID,
+		Category:  esc(category),
+		Copyright: esc(buildInfo.copyright),
+		URLTypes:  urlTypesKeys(buildInfo),
+		// The bundle name is the base display name.
+		LocalizedNames: localizedNameKeys(buildInfo, name),
 	}); err != nil {
 		return err
 	}
@@ -169,7 +280,9 @@ func (b *macBuilder) setInfo(buildInfo *buildInfo, name string) error {
 	return nil
 }
 
-func (b *macBuilder) buildProgram(buildInfo *buildInfo, binDest string, name string, arch string) error {
+// writeResources writes the Info.plist, icon and assets of the app bundle
+// in binDest.
+func (b *macBuilder) writeResources(buildInfo *buildInfo, binDest string) error {
 	for _, path := range []string{"/Contents/MacOS", "/Contents/Resources"} {
 		if err := os.MkdirAll(filepath.Join(binDest, path), 0755); err != nil {
 			return err
@@ -182,7 +295,19 @@ func (b *macBuilder) buildProgram(buildInfo *buildInfo, binDest string, name str
 		}
 	}
 
-	if err := os.WriteFile(filepath.Join(binDest, "/Contents/Info.plist"), b.Manifest, 0755); err != nil {
+	if err := copyAssets(filepath.Join(binDest, "Contents", "Resources"), buildInfo); err != nil {
+		return err
+	}
+
+	if err := writeLocalizedNames(filepath.Join(binDest, "Contents", "Resources"), buildInfo.localNames); err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(binDest, "/Contents/Info.plist"), b.Manifest, 0755)
+}
+
+func (b *macBuilder) buildProgram(buildInfo *buildInfo, binDest string, name string, arch string) error {
+	if err := b.writeResources(buildInfo, binDest); err != nil {
 		return err
 	}
 
@@ -200,8 +325,8 @@ func (b *macBuilder) buildProgram(buildInfo *buildInfo, binDest string, name str
 		"GOARCH="+arch,
 		"CGO_ENABLED=1", // Required to cross-compile between AMD/ARM
 	)
-	_, err := runCmd(cmd)
-	return err
+	cmd.Env = append(cmd.Env, cgoEnv(buildInfo, "", nil, nil)...)
+	return runGoBuild(buildInfo, cmd, filepath.Join(binDest, "/Contents/MacOS/"+name))
 }
 
 func (b *macBuilder) signProgram(buildInfo *buildInfo, binDest string, name string, arch string) error {
@@ -215,36 +340,134 @@ func (b *macBuilder) signProgram(buildInfo *buildInfo, binDest string, name stri
 		return err
 	}
 
+	exe := filepath.Join(binDest, "Contents", "MacOS", name)
+	order, err := macSignOrder(binDest, exe)
+	if err != nil {
+		return err
+	}
+	for _, path := range order {
+		// Only the app has the app's entitlements. Nested code keeps the
+		// entitlements of its own signature, if any.
+		ent := ""
+		if path == exe || path == binDest {
+			ent = options
+		}
+		if err := codesign(buildInfo, func() *exec.Cmd { return macCodesignCmd(buildInfo, ent, path) }); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// macCodesignCmd returns the command that signs the code at path with the
+// hardened runtime that notarization requires. Without entitlements, the
+// entitlements of an existing signature are preserved.
+func macCodesignCmd(bi *buildInfo, entitlements, path string) *exec.Cmd {
 	cmd := exec.Command(
 		"codesign",
-		"--deep",
 		"--force",
 		"--options", "runtime",
-		"--entitlements", options,
-		"--sign", buildInfo.key,
-		binDest,
+		timestampFlag(bi.timestamp),
 	)
-	_, err := runCmd(cmd)
-	return err
+	if entitlements != "" {
+		cmd.Args = append(cmd.Args, "--entitlements", entitlements)
+	} else {
+		cmd.Args = append(cmd.Args, "--preserve-metadata=entitlements")
+	}
+	cmd.Args = append(cmd.Args, "--sign", bi.key, path)
+	return cmd
+}
+
+// macBundleExts are the extensions of the bundles that contain code.
+var macBundleExts = map[string]bool{
+	".app": true, ".appex": true, ".bundle": true, ".framework": true,
+	".plugin": true, ".xpc": true,
+}
+
+// macSignOrder returns the code of the app bundle in the order it must be
+// signed, from the inside out: the nested code, such as frameworks and
+// helpers, deepest first, then the exe main executable, then the app
+// itself. Signing the app with codesign --deep would instead apply the app's
+// entitlements to all nested code.
+func macSignOrder(app, exe string) ([]string, error) {
+	nested, err := macNestedCode(filepath.Join(app, "Contents"), exe)
+	if err != nil {
+		return nil, err
+	}
+	return append(nested, exe, app), nil
+}
+
+// macNestedCode returns the code bundles and Mach-O binaries in dir, each
+// after the code it contains, leaving out the exe file.
+func macNestedCode(dir, exe string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var code []string
+	for _, e := range entries {
+		path := filepath.Join(dir, e.Name())
+		switch {
+		case e.IsDir():
+			nested, err := macNestedCode(path, exe)
+			if err != nil {
+				return nil, err
+			}
+			code = append(code, nested...)
+			if macBundleExts[filepath.Ext(path)] {
+				code = append(code, path)
+			}
+		case e.Type().IsRegular() && path != exe && isMachO(path):
+			code = append(code, path)
+		}
+	}
+	return code, nil
+}
+
+// isMachO reports whether the file at path is a Mach-O binary, possibly
+// with several architectures.
+func isMachO(path string) bool {
+	if f, err := macho.Open(path); err == nil {
+		f.Close()
+		return true
+	}
+	if f, err := macho.OpenFat(path); err == nil {
+		f.Close()
+		return true
+	}
+	return false
 }
 
 func (b *macBuilder) notarize(buildInfo *buildInfo, binDest string) error {
+	return retry(buildInfo.retries, "notarization", func() error {
+		_, err := runCmd(notarizeCmd(buildInfo, binDest))
+		return err
+	})
+}
+
+func notarizeCmd(buildInfo *buildInfo, binDest string) *exec.Cmd {
 	cmd := exec.Command(
 		"xcrun",
 		"notarytool",
 		"submit",
 		binDest,
-		"--apple-id", buildInfo.notaryAppleID,
-		"--team-id", buildInfo.notaryTeamID,
 		"--wait",
 	)
 
+	// Credentials stored in the keychain don't show up in process listings.
+	if buildInfo.notaryProfile != "" {
+		cmd.Args = append(cmd.Args, "--keychain-profile", buildInfo.notaryProfile)
+		return cmd
+	}
+
+	cmd.Args = append(cmd.Args,
+		"--apple-id", buildInfo.notaryAppleID,
+		"--team-id", buildInfo.notaryTeamID,
+	)
 	if buildInfo.notaryPassword != "" {
 		cmd.Args = append(cmd.Args, "--password", buildInfo.notaryPassword)
 	}
-
-	_, err := runCmd(cmd)
-	return err
+	return cmd
 }
 
 func dittozip(input, output string) error {
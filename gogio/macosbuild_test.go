@@ -0,0 +1,200 @@
+// SPDX-License-Identifier: Unlicense OR MIT
+
+package main
+
+import (
+	"encoding/xml"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestMacAssets(t *testing.T) {
+	t.Parallel()
+
+	app := filepath.Join(t.TempDir(), "App.app")
+	bi := &buildInfo{
+		appID:     "com.example.app",
+		name:      "app",
+		assetsDir: writeTestAssets(t),
+	}
+	b := &macBuilder{TempDir: t.TempDir()}
+	if err := b.setInfo(bi, "App"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.writeResources(bi, app); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(filepath.Join(app, "Contents", "Resources", "fonts", "font.ttf")); err != nil || string(data) != "font" {
+		t.Errorf("asset not copied to the app resources: %v", err)
+	}
+}
+
+func TestMacCategoryCopyright(t *testing.T) {
+	t.Parallel()
+
+	bi := &buildInfo{
+		appID:     "com.example.app",
+		category:  "productivity",
+		copyright: "© 2024 Example & Co",
+	}
+	b := &macBuilder{}
+	if err := b.setInfo(bi, "App"); err != nil {
+		t.Fatal(err)
+	}
+	for _, exp := range []string{
+		"<key>LSApplicationCategoryType</key>\n\t<string>public.app-category.productivity</string>",
+		"<key>NSHumanReadableCopyright</key>\n\t<string>© 2024 Example &amp; Co</string>",
+	} {
+		if !strings.Contains(string(b.Manifest), exp) {
+			t.Errorf("Info.plist doesn't contain %q:\n%s", exp, b.Manifest)
+		}
+	}
+	var plist struct{}
+	if err := xml.Unmarshal(b.Manifest, &plist); err != nil {
+		t.Errorf("invalid Info.plist: %v\n%s", err, b.Manifest)
+	}
+}
+
+func TestNotarizeKeychainProfile(t *testing.T) {
+	t.Parallel()
+
+	bi := &buildInfo{notaryProfile: "gogio-profile"}
+	args := strings.Join(notarizeCmd(bi, "App.zip").Args, " ")
+	if !strings.Contains(args, "--keychain-profile gogio-profile") {
+		t.Errorf("notarytool arguments %q don't use the keychain profile", args)
+	}
+	if strings.Contains(args, "--apple-id") || strings.Contains(args, "--password") {
+		t.Errorf("notarytool arguments %q contain inline credentials", args)
+	}
+
+	bi = &buildInfo{notaryAppleID: "dev@example.com", notaryTeamID: "TEAM", notaryPassword: "secret"}
+	args = strings.Join(notarizeCmd(bi, "App.zip").Args, " ")
+	if !strings.Contains(args, "--apple-id dev@example.com") || !strings.Contains(args, "--password secret") {
+		t.Errorf("notarytool arguments %q don't contain the inline credentials", args)
+	}
+}
+
+func TestCodesignTimestamp(t *testing.T) {
+	t.Parallel()
+
+	bi := &buildInfo{key: "Developer ID", timestamp: true}
+	args := strings.Join(macCodesignCmd(bi, "ent.ent", "App.app").Args, " ")
+	if !strings.Contains(args, " --timestamp ") {
+		t.Errorf("codesign arguments %q don't request a timestamp", args)
+	}
+	bi.timestamp = false
+	args = strings.Join(macCodesignCmd(bi, "ent.ent", "App.app").Args, " ")
+	if !strings.Contains(args, " --timestamp=none ") {
+		t.Errorf("codesign arguments %q don't disable the timestamp", args)
+	}
+
+	if runtime.GOOS == "windows" {
+		return
+	}
+	bi = &buildInfo{timestamp: true}
+	err := codesign(bi, func() *exec.Cmd {
+		return exec.Command("sh", "-c", "echo 'App.app: The timestamp service is not available.' >&2; exit 1")
+	})
+	if err == nil || !strings.Contains(err.Error(), "-no-timestamp") {
+		t.Errorf("timestamp failure returned %v, expected a hint of -no-timestamp", err)
+	}
+}
+
+func TestMacSignOrder(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("framework bundles use symbolic links")
+	}
+	t.Parallel()
+
+	app := filepath.Join(t.TempDir(), "App.app")
+	contents := filepath.Join(app, "Contents")
+	exe := filepath.Join(contents, "MacOS", "App")
+	fw := filepath.Join(contents, "Frameworks", "Foo.framework")
+	fwBin := filepath.Join(fw, "Versions", "A", "Foo")
+	helper := filepath.Join(contents, "Helpers", "Helper.app")
+	helperExe := filepath.Join(helper, "Contents", "MacOS", "Helper")
+	tool := filepath.Join(contents, "MacOS", "tool")
+	// A minimal 64-bit Mach-O header without load commands.
+	header := []byte{
+		0xcf, 0xfa, 0xed, 0xfe, 0x07, 0x00, 0x00, 0x01, 0x03, 0x00, 0x00, 0x00,
+		0x06, 0x00, 0x00, 0x00, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	}
+	files := map[string][]byte{
+		exe:                                   header,
+		fwBin:                                 header,
+		helperExe:                             header,
+		tool:                                  header,
+		filepath.Join(contents, "Info.plist"): []byte("<plist/>"),
+		filepath.Join(contents, "Resources", "data.bin"):         []byte("not code"),
+		filepath.Join(fw, "Versions", "A", "Resources", "x.txt"): []byte("not code"),
+	}
+	for path, data := range files {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, data, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("A", filepath.Join(fw, "Versions", "Current")); err != nil {
+		t.Fatal(err)
+	}
+
+	order, err := macSignOrder(app, exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := []string{fwBin, fw, helperExe, helper, tool, exe, app}
+	if !reflect.DeepEqual(order, exp) {
+		t.Errorf("signing order is\n%v\nexpected\n%v", order, exp)
+	}
+
+	bi := &buildInfo{key: "Developer ID", timestamp: true}
+	args := macCodesignCmd(bi, "", fw).Args
+	if exp := []string{"codesign", "--force", "--options", "runtime", "--timestamp", "--preserve-metadata=entitlements", "--sign", "Developer ID", fw}; !reflect.DeepEqual(args, exp) {
+		t.Errorf("nested codesign command is %v, expected %v", args, exp)
+	}
+	args = macCodesignCmd(bi, "ent.ent", app).Args
+	if exp := []string{"codesign", "--force", "--options", "runtime", "--timestamp", "--entitlements", "ent.ent", "--sign", "Developer ID", app}; !reflect.DeepEqual(args, exp) {
+		t.Errorf("app codesign command is %v, expected %v", args, exp)
+	}
+}
+
+func TestURLTypes(t *testing.T) {
+	t.Parallel()
+
+	bi := &buildInfo{
+		appID:   "com.example.app",
+		name:    "app",
+		target:  "ios",
+		schemes: []string{"example"},
+		urlRole: "Viewer",
+	}
+	b := &macBuilder{}
+	if err := b.setInfo(bi, "App"); err != nil {
+		t.Fatal(err)
+	}
+	for name, plist := range map[string]string{
+		"iOS":   buildInfoPlist(bi, true),
+		"macOS": string(b.Manifest),
+	} {
+		for _, exp := range []string{
+			"<key>CFBundleURLName</key>\n\t\t\t<string>com.example.app.example</string>",
+			"<key>CFBundleTypeRole</key>\n\t\t\t<string>Viewer</string>",
+			"<key>CFBundleURLSchemes</key>\n\t\t\t<array>\n\t\t\t\t<string>example</string>",
+		} {
+			if !strings.Contains(plist, exp) {
+				t.Errorf("%s Info.plist doesn't contain %q:\n%s", name, exp, plist)
+			}
+		}
+	}
+	bi.urlRole = ""
+	if plist := buildInfoPlist(bi, true); !strings.Contains(plist, "<string>Editor</string>") {
+		t.Errorf("Info.plist doesn't default to the Editor role:\n%s", plist)
+	}
+}
@@ -11,43 +11,154 @@ import (
 	"image/color"
 	"image/png"
 	"io"
+	"math"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	"gioui.org/cmd/gogio/iconscale"
 	"golang.org/x/image/draw"
 	"golang.org/x/sync/errgroup"
 )
 
 var (
-	target        = flag.String("target", "", "specify target (ios, tvos, android, js).\n")
+	target        = flag.String("target", "", "specify target (ios, tvos, macos-catalyst, android, js, macos, windows, linux, freebsd).\n")
 	archNames     = flag.String("arch", "", "specify architecture(s) to include (arm, arm64, amd64).")
+	ndkDir        = flag.String("ndk", "", "specify the Android NDK directory, overriding $ANDROID_NDK_HOME.")
 	minsdk        = flag.Int("minsdk", 0, "specify the minimum supported operating system level")
 	targetsdk     = flag.Int("targetsdk", 0, "specify the target supported operating system level for Android")
 	buildMode     = flag.String("buildmode", "exe", "specify buildmode (archive, exe)")
 	destPath      = flag.String("o", "", "output file or directory.\nFor -target ios or tvos, use the .app suffix to target simulators.")
+	simulator     = flag.Bool("simulator", false, "build iOS and tvOS .app outputs for the simulator, or for devices if false. Defaults to true for .app outputs.")
+	outputTmpl    = flag.String("output-name", "", "specify the output file name template, with the {name}, {version}, {versioncode}, {arch}, {target} and {ext} placeholders.")
 	appID         = flag.String("appid", "", "app identifier (for -buildmode=exe)")
 	name          = flag.String("name", "", "app name (for -buildmode=exe)")
 	version       = flag.String("version", "1.0.0.1", "semver app version (for -buildmode=exe) on the form major.minor.patch.versioncode")
+	autoVersion   = flag.Bool("autoversioncode", false, "derive the version code from the number of git commits.")
 	printCommands = flag.Bool("x", false, "print the commands")
-	keepWorkdir   = flag.Bool("work", false, "print the name of the temporary work directory and do not delete it when exiting.")
+	dryRun        = flag.Bool("dry-run", false, "print the commands of the build without running them.")
+	keepWorkdir   = workFlag("work", "print the name of the temporary work directory and do not delete it when exiting. With -work=dir, use the stable dir/gogio-<target> directory, cleaned before every build.")
+	preBuild      = flag.String("prebuild", "", "specify a shell command to run in the package directory before building.")
+	postBuild     = flag.String("postbuild", "", "specify a shell command to run in the package directory after a successful build.")
+	tmpDirRoot    = flag.String("tmpdir", "", "specify the directory in which to create the temporary work directory.")
 	linkMode      = flag.String("linkmode", "", "set the -linkmode flag of the go tool")
+	stripSymbols  = flag.Bool("strip", true, "strip symbol and debug information from binaries.")
+	debugBuild    = flag.Bool("debug", false, "build with debug information, and generate dSYM bundles for Apple targets.")
+	debuggable    = flag.Bool("debuggable", false, "mark Android apps debuggable. Implied by -debug for apps not signed with -signkey.")
+	userRes       = flag.String("res", "", "specify a directory of Android resources to merge into the generated resources.")
+	testOnly      = flag.Bool("test-only", false, "mark Android apps test only, which restricts their installation to adb install -t.")
 	extraLdflags  = flag.String("ldflags", "", "extra flags to the Go linker")
+	ldflagsFile   = flag.String("ldflags-file", "", "specify a file of extra flags to the Go linker")
+	buildTimeVar  = flag.String("buildtimevar", "main.buildTime", "specify the string variable set to the build time, or empty to disable.")
+	commitVar     = flag.String("commitvar", "main.buildCommit", "specify the string variable set to the git commit of the package, or empty to disable.")
 	extraTags     = flag.String("tags", "", "extra tags to the Go tool")
+	targetTags    = targetFlag("target-tags", "specify extra tags for some targets only, in the targets=tags form with comma separated lists of targets and tags. May be repeated.")
+	targetLdflags = targetFlag("target-ldflags", "specify extra linker flags for some targets only, in the targets=flags form with a comma separated list of targets. May be repeated.")
+	cgoCC         = flag.String("cc", "", "specify the C compiler for cgo, overriding the compiler gogio selects for the target.")
+	cgoCFlags     = flag.String("cflags", "", "specify the CGO_CFLAGS, replacing the flags gogio computes for the target.")
+	cgoLdflags    = flag.String("ldflags-cgo", "", "specify the CGO_LDFLAGS, replacing the flags gogio computes for the target.")
+	sysroot       = flag.String("sysroot", "", "specify the sysroot of the C compiler, replacing the computed one.")
+	targetTriple  = flag.String("target-triple", "", "specify the target triple of the C compiler, replacing the computed one.")
 	iconPath      = flag.String("icon", "", "specify an icon for iOS and Android")
+	assetsDir     = flag.String("assets", "", "specify a directory of files to include in the app bundle.")
 	signKey       = flag.String("signkey", "", "specify the path of the keystore to be used to sign Android apk files.")
 	signPass      = flag.String("signpass", "", "specify the password to decrypt the signkey.")
+	signAlias     = flag.String("signalias", "", "specify the alias of the key in the Android keystore.")
+	v4Signing     = flag.Bool("v4-signing", false, "sign Android apks with the v4 scheme, writing the .apk.idsig file.")
+	universalAPK  = flag.Bool("universal-apk", false, "also write a universal apk, signed with the same key, next to .aab outputs.")
+	signKeyPass   = flag.String("signkeypass", "", "specify the password of the Android signing key, defaulting to -signpass.")
 	notaryID      = flag.String("notaryid", "", "specify the apple id to use for notarization.")
 	notaryPass    = flag.String("notarypass", "", "specify app-specific password of the Apple ID to be used for notarization.")
 	notaryTeamID  = flag.String("notaryteamid", "", "specify the team id to use for notarization.")
+	notaryProfile = flag.String("notary-profile", "", "specify the notarytool keychain profile to use for notarization.")
+	noTimestamp   = flag.Bool("no-timestamp", false, "sign Apple apps without a secure timestamp from Apple's timestamp server.")
+	pkgFormat     = flag.String("format", "", "specify the package format (tar, appimage or flatpak for linux, exe or msix for windows).")
+	category      = flag.String("category", "", "specify the macOS app category (LSApplicationCategoryType).")
+	copyright     = flag.String("copyright", "", "specify the copyright notice of the app.")
+	company       = flag.String("company", "", "specify the company name of Windows programs. Defaults to the domain of the app id.")
+	product       = flag.String("product", "", "specify the product name of Windows programs. Defaults to the app name.")
+	description   = flag.String("description", "", "specify the file description of Windows programs. Defaults to the product name.")
+	cfgChanges    = flag.String("config-changes", defaultConfigChanges, "specify the '|' separated configuration changes handled by the Android activity.")
+	queries       = flag.String("queries", "", "specify a comma separated list of the package names of the Android apps the app queries, or @file entries.")
+	schemes       = flag.String("schemes", "", "specify a list of comma separated URI schemes that the program accepts, or @file entries.")
+	themeColor    = flag.String("theme-color", "", "specify the Android status bar and web page theme color, in #RRGGBB or #AARRGGBB format.")
+	pageTitle     = flag.String("title", "", "specify the title of the web page, defaulting to the app name.")
+	webConfig     = flag.String("web-config", "", "specify a JSON object, or a file with one, to set as window.gioConfig in the web page.")
+	webLoader     = flag.Bool("loader", false, "show a loading progress bar in the web page until the app draws its first frame.")
+	minifyWeb     = flag.Bool("minify", false, "strip comments and whitespace from the HTML and JavaScript of WebAssembly builds.")
+	splashIcon    = flag.String("splash-icon", "", "specify a PNG image to use as Android splash screen icon.")
+	splashColor   = flag.String("splash-color", "", "specify the Android splash screen background color, in #RRGGBB or #AARRGGBB format.")
+	appClass      = flag.String("application-class", "", "specify the Android Application subclass, from a jar in a package directory.")
+	activityClass = flag.String("activity-class", "", "specify the Android Activity class, from a jar in a package directory.")
+	wearOS        = flag.Bool("wear", false, "package the Android app for Wear OS watches.")
+	usesFeatures  = flag.String("features", "", "specify a comma separated list of Android uses-feature entries in the name[:required] form.")
+	networkConfig = flag.String("network-config", "", "specify an Android network security configuration XML file.")
+	cleartext     = flag.Bool("allow-cleartext", false, "allow cleartext network traffic in Android apps.")
+	appLinks      = flag.Bool("assetlinks", false, "write the assetlinks.json file for the Android App Links of the signed app.")
+	multidex      = flag.Bool("multidex", false, "enable multidex for Android apps with more than 64K methods.")
+	shrink        = flag.Bool("shrink", false, "shrink the Android Java classes with R8.")
+	deviceCaps    = flag.String("device-capabilities", "", "specify a comma separated list of the UIRequiredDeviceCapabilities of iOS apps, replacing arm64.")
+	assocDomains  = flag.String("associated-domains", "", "specify a comma separated list of iOS associated domains, such as applinks:example.com.")
+	otaURL        = flag.String("ota-url", "", "specify the HTTPS URL of the hosted iOS .ipa, to write a manifest.plist for over-the-air installs.")
+	otaIcons      = flag.String("ota-icons", "", "specify the comma separated HTTPS URLs of the 57x57 and 512x512 icons of -ota-url installs.")
+	consoleApp    = flag.Bool("console", false, "build Windows programs for the console subsystem instead of the GUI subsystem.")
+	winResources  = flag.String("resources", "", "embed the resources of an .rc file or a directory in Windows programs.")
+	publisher     = flag.String("publisher", "", "specify the Publisher of the identity of Windows MSIX packages. Defaults to CN=<app id>.")
+	strictIcons   = flag.Bool("strict", false, "fail the build for icons that are too small or not square, instead of warning.")
+	iconScaler    = scalerFlag("icon-scaler", "specify the algorithm for resizing icons: catmullrom, bilinear or nearest.")
+	noCache       = flag.Bool("no-cache", false, "don't reuse or cache the outputs of go build.")
+	keepApp       = flag.Bool("keep-app", false, "also write the .app of iOS and tvOS .ipa builds next to the .ipa.")
+	localNames    = flag.String("localized-names", "", "specify a comma separated list of iOS and macOS app names per locale in the locale=name form.")
+	usageStrings  = flag.String("usage", "", "specify a comma separated list of iOS usage descriptions in the key=description form.")
+	bgModes       = flag.String("background-modes", "", "specify a comma separated list of iOS UIBackgroundModes, such as audio,fetch.")
+	altIcons      = flag.String("alt-icons", "", "specify a comma separated list of PNG images to use as alternate iOS app icons.")
+	iconShape     = flag.String("icon-shape", "square", "specify the shape of desktop and web app icons (square, rounded or circle).")
+	atsConfig     = flag.String("ats", "", "specify the iOS App Transport Security configuration: allow-local, allow-all or a plist file.")
+	singleFile    = flag.Bool("single-file", false, "output a single HTML file with the WebAssembly module inlined.")
+	wasmExec      = flag.String("wasm-exec", "", "specify the wasm_exec.js driver of WebAssembly builds.")
+	jsonEvents    = flag.Bool("json", false, "write build events as newline delimited JSON to stdout.")
+	jobs          = flag.Int("jobs", runtime.GOMAXPROCS(0), "specify the maximum number of concurrent builds.")
+	uploadApp     = flag.Bool("upload", false, "upload the iOS or tvOS .ipa to App Store Connect.")
+	apiKey        = flag.String("api-key", "", "specify the App Store Connect API key id for -upload.")
+	apiIssuer     = flag.String("api-issuer", "", "specify the App Store Connect API issuer id for -upload.")
+	exportOpts    = flag.String("export-options", "", "specify an ExportOptions.plist to export iOS apps with xcodebuild.")
+	frameworks    = flag.String("embed-frameworks", "", "specify a comma separated list of .framework or .dylib paths to embed in iOS apps.")
+	pushEnv       = flag.String("push", "", "specify the APNs environment of iOS push notifications (development or production).")
+	statusBar     = flag.String("statusbar-style", "default", "specify the iOS status bar style (default, light, dark or hidden).")
+	urlRole       = flag.String("url-role", "Editor", "specify the CFBundleTypeRole of the -schemes of Apple apps (Editor, Viewer or None).")
+	manifestOut   = flag.String("manifest-out", "", "specify a file to write a JSON list of the build artifacts to.")
+	retries       = flag.Int("retries", 3, "specify the number of retries of notarizations and uploads that fail transiently.")
 )
 
 func main() {
 	flag.Usage = func() {
 		fmt.Fprint(os.Stderr, mainUsage)
 	}
+	// The -version flag specifies the app version, so only a lone
+	// --version is treated as a request for the gogio version.
+	if len(os.Args) == 2 && (os.Args[1] == "version" || os.Args[1] == "--version") {
+		fmt.Println(versionString())
+		os.Exit(0)
+	}
+	if len(os.Args) >= 2 && os.Args[1] == "clean" {
+		if err := runClean(os.Stdout, os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "gogio: %v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
 	flag.Parse()
+	if *jsonEvents {
+		events = newEventWriter(os.Stdout)
+		cmdLog = os.Stderr
+	}
 	if err := flagValidate(); err != nil {
 		fmt.Fprintf(os.Stderr, "gogio: %v\n", err)
 		os.Exit(1)
@@ -57,48 +168,299 @@ func main() {
 		fmt.Fprintf(os.Stderr, "gogio: %v\n", err)
 		os.Exit(1)
 	}
-	if err := build(buildInfo); err != nil {
+	if *destPath != "" || buildInfo.outputTmpl != "" {
+		*destPath = resolveOutput(buildInfo, *destPath)
+	}
+	if err := runBuild(buildInfo); err != nil {
 		fmt.Fprintf(os.Stderr, "gogio: %v\n", err)
 		os.Exit(1)
 	}
 	os.Exit(0)
 }
 
+// runBuild runs the build and its hooks, and emits the build events.
+func runBuild(bi *buildInfo) error {
+	err := runBuildPhases(bi)
+	if err != nil {
+		emit(buildEvent{Action: "fail", Error: err.Error()})
+	}
+	return err
+}
+
+func runBuildPhases(bi *buildInfo) error {
+	artifacts = nil
+	if *preBuild != "" {
+		if err := runPhase("prebuild", func() error { return runHook("prebuild", *preBuild, bi) }); err != nil {
+			return err
+		}
+	}
+	if err := runPhase("build", func() error { return build(bi) }); err != nil {
+		return err
+	}
+	// A dry run produces no artifacts.
+	if !*dryRun {
+		arts := buildArtifacts(bi)
+		for _, a := range arts {
+			emit(buildEvent{Action: "artifact", Arch: a.Arch, Path: a.Path})
+		}
+		if *manifestOut != "" {
+			if err := writeArtifactManifest(*manifestOut, arts); err != nil {
+				return fmt.Errorf("-manifest-out: %v", err)
+			}
+		}
+	}
+	if *postBuild != "" {
+		return runPhase("postbuild", func() error { return runHook("postbuild", *postBuild, bi) })
+	}
+	return nil
+}
+
 func flagValidate() error {
 	pkgPathArg := flag.Arg(0)
 	if pkgPathArg == "" {
 		return errors.New("specify a package")
 	}
-	if *target == "" {
-		return errors.New("please specify -target")
+	if err := validateTarget(*target); err != nil {
+		return err
 	}
-	switch *target {
-	case "ios", "tvos", "android", "js", "windows", "macos":
-	default:
-		return fmt.Errorf("invalid -target %s", *target)
+	if *notaryProfile != "" && (*notaryID != "" || *notaryPass != "" || *notaryTeamID != "") {
+		return errors.New("-notary-profile can't be combined with -notaryid, -notarypass or -notaryteamid")
+	}
+	if *singleFile && *assetsDir != "" {
+		return errors.New("-single-file can't be combined with -assets")
+	}
+	if *jobs < 1 {
+		return fmt.Errorf("invalid -jobs %d", *jobs)
+	}
+	if *otaURL != "" {
+		if err := validateOTA(*otaURL, getCommaList(*otaIcons)); err != nil {
+			return err
+		}
+	}
+	if err := validateOutputName(*outputTmpl); err != nil {
+		return fmt.Errorf("invalid -output-name %s: %v", *outputTmpl, err)
+	}
+	if *retries < 0 {
+		return fmt.Errorf("invalid -retries %d", *retries)
+	}
+	if *uploadApp && (*apiKey == "" || *apiIssuer == "") {
+		return errors.New("-upload requires -api-key and -api-issuer")
+	}
+	if *networkConfig != "" && *cleartext {
+		return errors.New("-network-config can't be combined with -allow-cleartext")
+	}
+	if *tmpDirRoot != "" {
+		if err := validateTmpDir(*tmpDirRoot); err != nil {
+			return err
+		}
 	}
 	switch *buildMode {
 	case "archive", "exe":
 	default:
 		return fmt.Errorf("invalid -buildmode %s", *buildMode)
 	}
+	switch *iconShape {
+	case "square", "rounded", "circle":
+	default:
+		return fmt.Errorf("invalid -icon-shape %s", *iconShape)
+	}
+	switch *statusBar {
+	case "default", "light", "dark", "hidden":
+	default:
+		return fmt.Errorf("invalid -statusbar-style %s", *statusBar)
+	}
+	switch *urlRole {
+	case "Editor", "Viewer", "None":
+	default:
+		return fmt.Errorf("invalid -url-role %s", *urlRole)
+	}
+	switch *pushEnv {
+	case "", "development", "production":
+	default:
+		return fmt.Errorf("invalid -push %s", *pushEnv)
+	}
+	return nil
+}
+
+func validateTarget(target string) error {
+	if target == "" {
+		return errors.New("please specify -target")
+	}
+	switch target {
+	case "ios", "tvos", "macos-catalyst", "android", "js", "windows", "macos", "linux", "freebsd":
+	default:
+		return fmt.Errorf("invalid -target %s", target)
+	}
 	return nil
 }
 
+// validateTmpDir checks that dir is an existing, writable directory.
+func validateTmpDir(dir string) error {
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("invalid -tmpdir: %v", err)
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("invalid -tmpdir: %s is not a directory", dir)
+	}
+	f, err := os.CreateTemp(dir, "gogio-")
+	if err != nil {
+		return fmt.Errorf("invalid -tmpdir: %v", err)
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// workDir is the value of the -work flag. A bare -work keeps the temporary
+// working directory, and -work=dir keeps a stable working directory in dir.
+type workDir struct {
+	keep bool
+	dir  string
+}
+
+// scalerFlag defines the -icon-scaler flag.
+func scalerFlag(name, usage string) *iconscale.Scaler {
+	s := new(iconscale.Scaler)
+	flag.TextVar(s, name, iconscale.CatmullRom, usage)
+	return s
+}
+
+// targetValues holds the values of a per-target flag, by target. The flag
+// is given as targets=value, with a comma separated list of targets, and
+// may be repeated.
+type targetValues map[string][]string
+
+// targetFlag defines a per-target flag.
+func targetFlag(name, usage string) targetValues {
+	v := make(targetValues)
+	flag.Var(v, name, usage)
+	return v
+}
+
+func (v targetValues) String() string {
+	var vals []string
+	for t, tv := range v {
+		for _, val := range tv {
+			vals = append(vals, t+"="+val)
+		}
+	}
+	sort.Strings(vals)
+	return strings.Join(vals, " ")
+}
+
+func (v targetValues) Set(s string) error {
+	targets, val, ok := strings.Cut(s, "=")
+	if !ok || targets == "" {
+		return fmt.Errorf("expected targets=value, got %q", s)
+	}
+	for _, t := range strings.Split(targets, ",") {
+		if t == "" || validateTarget(t) != nil {
+			return fmt.Errorf("unknown target %q", t)
+		}
+		v[t] = append(v[t], val)
+	}
+	return nil
+}
+
+// workFlag defines the -work flag.
+func workFlag(name, usage string) *workDir {
+	w := new(workDir)
+	flag.Var(w, name, usage)
+	return w
+}
+
+func (w *workDir) String() string {
+	if w.dir != "" {
+		return w.dir
+	}
+	return strconv.FormatBool(w.keep)
+}
+
+func (w *workDir) Set(v string) error {
+	if keep, err := strconv.ParseBool(v); err == nil {
+		w.keep, w.dir = keep, ""
+		return nil
+	}
+	w.keep, w.dir = true, v
+	return nil
+}
+
+// IsBoolFlag allows the flag to be given without a value.
+func (w *workDir) IsBoolFlag() bool { return true }
+
+// newWorkDir creates the temporary working directory in root, or in the
+// default directory for temporary files if root is empty.
+func newWorkDir(root string) (string, error) {
+	dir, err := os.MkdirTemp(root, "gogio-")
+	if err != nil {
+		return "", err
+	}
+	return dir, markWorkDir(dir)
+}
+
+// stableWorkDir creates the working directory of target builds in root,
+// whose path is the same for every build. Files of an earlier build are
+// removed.
+func stableWorkDir(root, target string) (string, error) {
+	dir, err := filepath.Abs(filepath.Join(root, "gogio-"+target))
+	if err != nil {
+		return "", err
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	return dir, markWorkDir(dir)
+}
+
+// workDirMarker is the file that marks a directory as a gogio work
+// directory, so that clean doesn't remove other directories whose names
+// happen to match.
+const workDirMarker = ".gogio-work"
+
+func markWorkDir(dir string) error {
+	return os.WriteFile(filepath.Join(dir, workDirMarker), nil, 0644)
+}
+
 func build(bi *buildInfo) error {
-	tmpDir, err := os.MkdirTemp("", "gogio-")
+	var tmpDir string
+	var err error
+	if keepWorkdir.dir != "" {
+		tmpDir, err = stableWorkDir(keepWorkdir.dir, bi.target)
+	} else {
+		tmpDir, err = newWorkDir(*tmpDirRoot)
+	}
 	if err != nil {
 		return err
 	}
-	if *keepWorkdir {
+	if keepWorkdir.keep {
 		fmt.Fprintf(os.Stderr, "WORKDIR=%s\n", tmpDir)
 	} else {
 		defer os.RemoveAll(tmpDir)
 	}
+	if *dryRun {
+		// The outputs gogio writes itself, such as archives and bundle
+		// files, go to the work directory.
+		dest := *destPath
+		defer func() { *destPath = dest }()
+		name := filepath.Base(dest)
+		if dest == "" {
+			name = outputName(bi)
+		}
+		dir := filepath.Join(tmpDir, "dry-run")
+		if err := os.Mkdir(dir, 0755); err != nil {
+			return err
+		}
+		out := outputPath(bi)
+		*destPath = filepath.Join(dir, name)
+		fmt.Fprintf(cmdLog, "# dry run: writing outputs to %s instead of %s\n", *destPath, out)
+	}
 	switch *target {
 	case "js":
-		return buildJS(bi)
-	case "ios", "tvos":
+		return buildJS(tmpDir, bi)
+	case "ios", "tvos", "macos-catalyst":
 		return buildIOS(tmpDir, *target, bi)
 	case "android":
 		return buildAndroid(tmpDir, bi)
@@ -106,25 +468,367 @@ func build(bi *buildInfo) error {
 		return buildWindows(tmpDir, bi)
 	case "macos":
 		return buildMac(tmpDir, bi)
+	case "linux", "freebsd":
+		return buildLinux(tmpDir, bi)
 	default:
 		panic("unreachable")
 	}
 }
 
+// runHook runs the shell command hook in the package directory. The build
+// metadata is available to the command through GOGIO_* environment
+// variables.
+func runHook(kind, hook string, bi *buildInfo) error {
+	if hook == "" {
+		return nil
+	}
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", hook)
+	} else {
+		cmd = exec.Command("sh", "-c", hook)
+	}
+	// The output path is relative to the working directory of gogio, not
+	// the package directory of the command.
+	out, err := filepath.Abs(outputPath(bi))
+	if err != nil {
+		return err
+	}
+	cmd.Dir = bi.pkgDir
+	cmd.Env = append(os.Environ(),
+		"GOGIO_TARGET="+bi.target,
+		"GOGIO_OUTPUT="+out,
+		"GOGIO_VERSION="+bi.version.String(),
+		"GOGIO_APPID="+bi.appID,
+		"GOGIO_NAME="+bi.name,
+	)
+	// Keep the output of hooks out of the -json event stream.
+	cmd.Stdout = cmdLog
+	cmd.Stderr = os.Stderr
+	if *printCommands || *dryRun {
+		fmt.Fprintf(cmdLog, "%s\n", strings.Join(cmd.Args, " "))
+	}
+	if *dryRun {
+		return nil
+	}
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("-%s command %q failed: %v", kind, hook, err)
+	}
+	return nil
+}
+
+// resolveOutput returns the path of the default named output in the dest
+// directory, if dest is an existing directory that isn't itself an output
+// such as an app bundle or an earlier WebAssembly build. Otherwise, it
+// returns dest. An empty dest resolves to the -output-name output in the
+// default output directory.
+func resolveOutput(bi *buildInfo, dest string) string {
+	if dest == "" {
+		switch bi.target {
+		case "windows", "macos":
+			return filepath.Join(pkgOutputDir(bi), outputName(bi))
+		}
+		return outputName(bi)
+	}
+	if fi, err := os.Stat(dest); err != nil || !fi.IsDir() {
+		return dest
+	}
+	switch filepath.Ext(dest) {
+	case ".app", ".framework", ".dSYM":
+		return dest
+	}
+	if strings.HasSuffix(dest, "-flatpak") || strings.HasSuffix(dest, "-msix") {
+		return dest
+	}
+	if bi.target == "js" {
+		if _, err := os.Stat(filepath.Join(dest, "main.wasm")); err == nil {
+			return dest
+		}
+	}
+	return filepath.Join(dest, outputName(bi))
+}
+
+// outputPath returns the path of the build output, either specified by -o
+// or the default for the target.
+func outputPath(bi *buildInfo) string {
+	if *destPath != "" {
+		return *destPath
+	}
+	switch bi.target {
+	case "windows", "macos":
+		if *pkgFormat == "msix" {
+			return filepath.Join(pkgOutputDir(bi), outputName(bi))
+		}
+		return pkgOutputDir(bi)
+	}
+	return outputName(bi)
+}
+
+// outputName returns the default file name of the build output, rendered
+// from the -output-name template if set.
+func outputName(bi *buildInfo) string {
+	name, ext := defaultOutputName(bi)
+	if bi.outputTmpl != "" {
+		arch := "universal"
+		if len(bi.archs) == 1 {
+			arch = bi.archs[0]
+		}
+		return renderOutputName(bi, arch, ext)
+	}
+	return name + ext
+}
+
+// defaultOutputName returns the default file name of the build output,
+// split into the name and the extension required by the target.
+func defaultOutputName(bi *buildInfo) (string, string) {
+	switch bi.target {
+	case "android":
+		if *buildMode == "archive" {
+			return androidName(bi.name), ".aar"
+		}
+		return androidName(bi.name), ".apk"
+	case "ios", "tvos":
+		if *buildMode == "archive" {
+			return UppercaseName(bi.name), ".framework"
+		}
+		return bi.name, ".ipa"
+	case "macos-catalyst":
+		return bi.name, ".app"
+	case "linux", "freebsd":
+		switch *pkgFormat {
+		case "appimage":
+			return bi.name, ".AppImage"
+		case "flatpak":
+			return bi.name + "-flatpak", ""
+		}
+		return bi.name, ".tar.gz"
+	case "windows":
+		if *pkgFormat == "msix" {
+			return bi.name, ".msix"
+		}
+		return bi.name, ".exe"
+	case "macos":
+		return bi.name, ".app"
+	case "js":
+		if bi.singleFile {
+			return bi.name, ".html"
+		}
+		return bi.name, ""
+	default:
+		return bi.name, ""
+	}
+}
+
+// renderOutputName returns the -output-name template rendered for arch. The
+// ext extension is appended if the rendered name doesn't end with it.
+func renderOutputName(bi *buildInfo, arch, ext string) string {
+	r := strings.NewReplacer(
+		"{name}", bi.name,
+		"{version}", fmt.Sprintf("%d.%d.%d", bi.version.Major, bi.version.Minor, bi.version.Patch),
+		"{versioncode}", strconv.FormatUint(uint64(bi.version.VersionCode), 10),
+		"{arch}", arch,
+		"{target}", bi.target,
+		"{ext}", strings.TrimPrefix(ext, "."),
+	)
+	name := r.Replace(bi.outputTmpl)
+	if !strings.HasSuffix(name, ext) {
+		name += ext
+	}
+	return name
+}
+
+// outputPlaceholder matches the placeholders of -output-name templates.
+var outputPlaceholder = regexp.MustCompile(`\{[^{}]*\}`)
+
+// validateOutputName checks that the -output-name template names a file
+// and uses only known placeholders.
+func validateOutputName(tmpl string) error {
+	if strings.ContainsAny(tmpl, `/\`) {
+		return errors.New("the template must not contain path separators")
+	}
+	for _, p := range outputPlaceholder.FindAllString(tmpl, -1) {
+		switch p {
+		case "{name}", "{version}", "{versioncode}", "{arch}", "{target}", "{ext}":
+		default:
+			return fmt.Errorf("unknown placeholder %s", p)
+		}
+	}
+	return nil
+}
+
+// templatedOutput reports whether the out path was named by the
+// -output-name template.
+func templatedOutput(bi *buildInfo, out string) bool {
+	return bi.outputTmpl != "" && filepath.Base(out) == outputName(bi)
+}
+
+// archOutput returns the output for arch of targets that build an output per
+// architecture: the -output-name template rendered for arch, or out with an
+// _arch suffix.
+func archOutput(bi *buildInfo, out, ext, arch string) string {
+	if templatedOutput(bi, out) {
+		return filepath.Join(filepath.Dir(out), renderOutputName(bi, arch, ext))
+	}
+	return strings.TrimSuffix(out, ext) + "_" + arch + ext
+}
+
+// runCmdRaw runs cmd and returns its output. Under -dry-run, the command is
+// printed instead, and the output is empty.
 func runCmdRaw(cmd *exec.Cmd) ([]byte, error) {
+	if *dryRun {
+		fmt.Fprintf(cmdLog, "%s\n", strings.Join(cmd.Args, " "))
+		return nil, nil
+	}
+	return execCmd(cmd)
+}
+
+// runQuery runs cmd and returns its trimmed output, even under -dry-run.
+// It is for commands that only read information the build depends on, such
+// as go list.
+func runQuery(cmd *exec.Cmd) (string, error) {
+	out, err := execCmd(cmd)
+	return string(bytes.TrimSpace(out)), err
+}
+
+// dryRunSkip reports whether -dry-run is set, and if so, prints that the
+// step is skipped. Steps that process the outputs of commands are skipped,
+// because the commands didn't run.
+func dryRunSkip(step string) bool {
+	if *dryRun {
+		fmt.Fprintf(cmdLog, "# skipped %s\n", step)
+	}
+	return *dryRun
+}
+
+func execCmd(cmd *exec.Cmd) ([]byte, error) {
 	if *printCommands {
-		fmt.Printf("%s\n", strings.Join(cmd.Args, " "))
+		fmt.Fprintf(cmdLog, "%s\n", strings.Join(cmd.Args, " "))
+	}
+	stderr := new(bytes.Buffer)
+	if cmd.Stderr == nil {
+		cmd.Stderr = stderr
 	}
 	out, err := cmd.Output()
 	if err == nil {
 		return out, nil
 	}
-	if err, ok := err.(*exec.ExitError); ok {
-		return nil, fmt.Errorf("%s failed: %s%s", strings.Join(cmd.Args, " "), out, err.Stderr)
+	if _, ok := err.(*exec.ExitError); ok {
+		// Some tools, such as apksigner, report their errors on stdout.
+		msg := stderr.Bytes()
+		if len(bytes.TrimSpace(msg)) == 0 {
+			msg = out
+		}
+		return nil, fmt.Errorf("%s failed: %w%s", strings.Join(cmd.Args, " "), err, lastLines(msg, cmdErrLines))
 	}
 	return nil, err
 }
 
+// cmdErrLines is the number of lines of a failed command's output
+// included in its error.
+const cmdErrLines = 20
+
+// lastLines returns the last n lines of out, each preceded by a newline.
+func lastLines(out []byte, n int) string {
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	var b strings.Builder
+	for _, l := range lines {
+		if l = strings.TrimRight(l, "\r"); l != "" {
+			b.WriteString("\n" + l)
+		}
+	}
+	return b.String()
+}
+
+// newBuildGroup returns a group for running builds concurrently, at most
+// jobs at a time.
+func newBuildGroup(jobs int) *errgroup.Group {
+	g := new(errgroup.Group)
+	if jobs > 0 {
+		g.SetLimit(jobs)
+	}
+	return g
+}
+
+// sdkVersions is the range of OS versions or API levels supported by an SDK.
+// Zero bounds are unknown.
+type sdkVersions struct {
+	min, max int
+}
+
+// checkSDKVersion returns an error if the version specified by the flag
+// is outside the versions of the sdk.
+func checkSDKVersion(flag string, version int, sdk string, r sdkVersions) error {
+	if version == 0 {
+		return nil
+	}
+	if r.min > 0 && version < r.min {
+		return fmt.Errorf("-%s %d is older than %d, the oldest version supported by %s", flag, version, r.min, sdk)
+	}
+	if r.max > 0 && version > r.max {
+		return fmt.Errorf("-%s %d is newer than %d, the newest version supported by %s", flag, version, r.max, sdk)
+	}
+	return nil
+}
+
+// retryDelay is the delay before the first retry of a transient failure.
+// The delay doubles for every following retry.
+var retryDelay = 5 * time.Second
+
+// retry runs f, retrying it at most retries times while it fails with a
+// transient error, such as a network or server error.
+func retry(retries int, what string, f func() error) error {
+	delay := retryDelay
+	for attempt := 1; ; attempt++ {
+		err := f()
+		if err == nil || attempt > retries || !isTransient(err) {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "gogio: %s failed (attempt %d of %d), retrying in %v: %v\n", what, attempt, retries+1, delay, err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// httpStatus matches an HTTP status code in an error message, such as
+// "HTTP status code: 503", "HTTP/1.1 502" or "statusCode=429".
+var httpStatus = regexp.MustCompile(`(?i)\b(?:HTTP(?:/[0-9.]+)?|status)(?: status)?(?: ?code)?[ :=]*([1-5][0-9][0-9])\b`)
+
+// isTransient reports whether err is a network or server failure of a
+// notarization or upload, which may succeed if retried. Authentication
+// failures are never transient.
+func isTransient(err error) bool {
+	msg := strings.ToLower(err.Error())
+	if m := httpStatus.FindStringSubmatch(msg); m != nil {
+		switch m[1] {
+		case "408", "429", "500", "502", "503", "504":
+			return true
+		}
+		return false
+	}
+	for _, s := range []string{"unauthorized", "unable to authenticate", "authentication failed", "invalid credentials"} {
+		if strings.Contains(msg, s) {
+			return false
+		}
+	}
+	for _, s := range []string{
+		"timed out", "i/o timeout", "gateway timeout",
+		"network connection was lost", "network is unreachable",
+		"internet connection appears to be offline",
+		"connection reset", "connection refused", "could not connect",
+		"no such host", "temporary failure in name resolution",
+		"temporarily unavailable", "service unavailable", "internal server error",
+		"bad gateway", "try again later", "timestamp service is not available",
+	} {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
+
 func runCmd(cmd *exec.Cmd) (string, error) {
 	out, err := runCmdRaw(cmd)
 	return string(bytes.TrimSpace(out)), err
@@ -149,6 +853,39 @@ func copyFile(dst, src string) (err error) {
 	return err
 }
 
+// copyDir copies the files in the src directory to dst, preserving the
+// directory structure and keeping executable files executable.
+func copyDir(dst, src string) error {
+	return filepath.Walk(src, func(path string, f os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if f.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		if err := copyFile(target, path); err != nil {
+			return err
+		}
+		if f.Mode()&0111 != 0 {
+			return os.Chmod(target, 0755)
+		}
+		return nil
+	})
+}
+
+// copyAssets copies the contents of the -assets directory, if any, to dst.
+func copyAssets(dst string, bi *buildInfo) error {
+	if bi.assetsDir == "" {
+		return nil
+	}
+	return copyDir(dst, bi.assetsDir)
+}
+
 type arch struct {
 	iosArch   string
 	jniArch   string
@@ -181,7 +918,13 @@ var allArchs = map[string]arch{
 type iconVariant struct {
 	path string
 	size int
-	fill bool
+	// height of non-square variants. The source image is cropped to
+	// the aspect ratio of the variant.
+	height int
+	fill   bool
+	// shape of the icon: square, rounded or circle. The default is
+	// square.
+	shape string
 }
 
 func buildIcons(baseDir, icon string, variants []iconVariant) error {
@@ -194,6 +937,12 @@ func buildIcons(baseDir, icon string, variants []iconVariant) error {
 	if err != nil {
 		return err
 	}
+	if problem := iconProblem(img, variants); problem != "" {
+		if *strictIcons {
+			return fmt.Errorf("%s: %s", icon, problem)
+		}
+		warnOnce(fmt.Sprintf("%s: %s", icon, problem))
+	}
 	var resizes errgroup.Group
 	for _, v := range variants {
 		v := v
@@ -217,14 +966,98 @@ func buildIcons(baseDir, icon string, variants []iconVariant) error {
 	return resizes.Wait()
 }
 
+// iconProblem describes why the source image is unsuitable for the icon
+// variants: it is smaller than the largest variant and would be upscaled,
+// or it isn't square while the variants are. It returns the empty string
+// for suitable images.
+func iconProblem(img image.Image, variants []iconVariant) string {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	largest, square := 0, true
+	for _, v := range variants {
+		largest = max(largest, v.size, v.height)
+		if v.height != 0 && v.height != v.size {
+			square = false
+		}
+	}
+	switch {
+	case square && w != h:
+		return fmt.Sprintf("the %dx%d icon is not square", w, h)
+	case w < largest || h < largest:
+		return fmt.Sprintf("the %dx%d icon is upscaled to %dx%d; use an icon of at least that size", w, h, largest, largest)
+	}
+	return ""
+}
+
+var (
+	warnedMu sync.Mutex
+	warned   = make(map[string]bool)
+)
+
+// warnOnce prints the warning, unless it was printed before.
+func warnOnce(warning string) {
+	warnedMu.Lock()
+	defer warnedMu.Unlock()
+	if !warned[warning] {
+		warned[warning] = true
+		fmt.Fprintf(os.Stderr, "gogio: warning: %s\n", warning)
+	}
+}
+
 func resizeIcon(v iconVariant, img image.Image) *image.NRGBA {
-	scaled := image.NewNRGBA(image.Rectangle{Max: image.Point{X: v.size, Y: v.size}})
-	op := draw.Src
+	w, h := v.size, v.size
+	src := img.Bounds()
+	if v.height != 0 {
+		h = v.height
+		if sw, sh := src.Dx(), src.Dy(); sw*h > sh*w {
+			cw := sh * w / h
+			src.Min.X += (sw - cw) / 2
+			src.Max.X = src.Min.X + cw
+		} else {
+			ch := sw * h / w
+			src.Min.Y += (sh - ch) / 2
+			src.Max.Y = src.Min.Y + ch
+		}
+	}
+	scaled := iconscale.Resize(img, src, w, h, *iconScaler)
 	if v.fill {
-		op = draw.Over
-		draw.Draw(scaled, scaled.Bounds(), &image.Uniform{color.White}, image.Point{}, draw.Src)
+		filled := image.NewNRGBA(scaled.Bounds())
+		draw.Draw(filled, filled.Bounds(), &image.Uniform{color.White}, image.Point{}, draw.Src)
+		draw.Draw(filled, filled.Bounds(), scaled, image.Point{}, draw.Over)
+		scaled = filled
+	}
+	switch v.shape {
+	case "rounded":
+		maskIcon(scaled, roundedIconRadius*float64(min(w, h)))
+	case "circle":
+		maskIcon(scaled, float64(min(w, h))/2)
 	}
-	draw.CatmullRom.Scale(scaled, scaled.Bounds(), img, img.Bounds(), op, nil)
 
 	return scaled
 }
+
+// roundedIconRadius is the corner radius of rounded icons, relative to
+// their size.
+const roundedIconRadius = 0.225
+
+// maskIcon makes the corners of img transparent outside of circle arcs
+// with the radius. The edges are anti-aliased.
+func maskIcon(img *image.NRGBA, radius float64) {
+	b := img.Bounds()
+	// The corner arcs are centered in the rectangle inset by the
+	// radius.
+	minX, minY := float64(b.Min.X)+radius, float64(b.Min.Y)+radius
+	maxX, maxY := float64(b.Max.X)-radius, float64(b.Max.Y)-radius
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			px, py := float64(x)+.5, float64(y)+.5
+			dx := max(minX-px, 0, px-maxX)
+			dy := max(minY-py, 0, py-maxY)
+			if dx == 0 || dy == 0 {
+				continue
+			}
+			coverage := max(0, min(1, radius-math.Hypot(dx, dy)+.5))
+			i := img.PixOffset(x, y) + 3
+			img.Pix[i] = uint8(float64(img.Pix[i])*coverage + .5)
+		}
+	}
+}
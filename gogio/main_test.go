@@ -1,8 +1,22 @@
 package main
 
 import (
+	"bytes"
+	"errors"
+	"flag"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestMain(m *testing.M) {
@@ -15,3 +29,466 @@ func TestMain(m *testing.M) {
 	}
 	os.Exit(m.Run())
 }
+
+func TestWorkDirRoot(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	if err := validateTmpDir(root); err != nil {
+		t.Fatal(err)
+	}
+	dir, err := newWorkDir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := filepath.Dir(dir); got != root {
+		t.Errorf("work directory %s is not in -tmpdir %s", dir, root)
+	}
+	file := filepath.Join(root, "file")
+	if err := os.WriteFile(file, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	for _, invalid := range []string{file, filepath.Join(root, "missing")} {
+		if err := validateTmpDir(invalid); err == nil {
+			t.Errorf("-tmpdir %s was accepted", invalid)
+		}
+	}
+}
+
+func TestStableWorkDir(t *testing.T) {
+	t.Parallel()
+
+	var w workDir
+	fs := flag.NewFlagSet("gogio", flag.ContinueOnError)
+	fs.Var(&w, "work", "")
+	if err := fs.Parse([]string{"-work"}); err != nil || !w.keep || w.dir != "" {
+		t.Errorf("-work set %+v, %v, expected a kept random directory", w, err)
+	}
+	if err := fs.Parse([]string{"-work=build"}); err != nil || !w.keep || w.dir != "build" {
+		t.Errorf("-work=build set %+v, %v, expected the build directory", w, err)
+	}
+
+	root := t.TempDir()
+	dir, err := stableWorkDir(root, "android")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := filepath.Join(root, "gogio-android"); dir != exp {
+		t.Errorf("work directory is %s, expected %s", dir, exp)
+	}
+	stale := filepath.Join(dir, "stale", "file")
+	if err := os.MkdirAll(filepath.Dir(stale), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(stale, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	again, err := stableWorkDir(root, "android")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != dir {
+		t.Errorf("second build used %s, expected %s", again, dir)
+	}
+	if entries, err := os.ReadDir(dir); err != nil || len(entries) != 1 || entries[0].Name() != workDirMarker {
+		t.Errorf("work directory was not cleaned: %v, %v", entries, err)
+	}
+}
+
+func TestWorkDirMarker(t *testing.T) {
+	t.Parallel()
+	root := t.TempDir()
+	tmp, err := newWorkDir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stable, err := stableWorkDir(root, "android")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range []string{tmp, stable} {
+		if _, err := os.Stat(filepath.Join(d, workDirMarker)); err != nil {
+			t.Errorf("work directory %s isn't marked: %v", d, err)
+		}
+	}
+}
+
+func TestPostBuildHook(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hook test uses a POSIX shell")
+	}
+	defer func(old string) { *destPath = old }(*destPath)
+	*destPath = filepath.Join("out", "app.apk")
+	// The output is relative to the working directory, which isn't the
+	// package directory.
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll("out", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(*destPath, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	exp, err := filepath.Abs(*destPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bi := &buildInfo{
+		target: "android",
+		name:   "app",
+		pkgDir: t.TempDir(),
+	}
+	if err := runHook("postbuild", `test -e "$GOGIO_OUTPUT" && echo "$GOGIO_OUTPUT" > output.txt`, bi); err != nil {
+		t.Fatal(err)
+	}
+	out, err := os.ReadFile(filepath.Join(bi.pkgDir, "output.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(string(out)); got != exp {
+		t.Errorf("hook saw GOGIO_OUTPUT=%q, expected %q", got, exp)
+	}
+	if err := runHook("postbuild", "exit 3", bi); err == nil {
+		t.Error("failing hook did not return an error")
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	out := t.TempDir()
+	exe := filepath.Join(out, "app.exe")
+	manifest := filepath.Join(out, "artifacts.json")
+	defer func(tgt, dest, mout string, dry bool) {
+		*target, *destPath, *manifestOut, *dryRun = tgt, dest, mout, dry
+	}(*target, *destPath, *manifestOut, *dryRun)
+	*target, *destPath, *manifestOut, *dryRun = "windows", exe, manifest, true
+	defer func(w io.Writer) { cmdLog = w }(cmdLog)
+	log := new(bytes.Buffer)
+	cmdLog = log
+
+	bi := &buildInfo{
+		name:    "app",
+		pkgPath: ".",
+		pkgDir:  t.TempDir(),
+		target:  "windows",
+		archs:   []string{"amd64"},
+	}
+	if err := runBuild(bi); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(log.String(), "go build") {
+		t.Errorf("dry run didn't print the go build command:\n%s", log)
+	}
+	if *destPath != exe {
+		t.Errorf("dry run left -o at %s, expected %s", *destPath, exe)
+	}
+	for _, f := range []string{exe, manifest} {
+		if _, err := os.Stat(f); !os.IsNotExist(err) {
+			t.Errorf("dry run wrote %s", f)
+		}
+	}
+	if sysos, _ := filepath.Glob(filepath.Join(bi.pkgDir, "*.syso")); len(sysos) > 0 {
+		t.Errorf("dry run wrote %v", sysos)
+	}
+
+	if runtime.GOOS == "windows" {
+		return
+	}
+	// Sign an Android App Bundle without ~/.android/debug.keystore. The
+	// keystore isn't generated, so nothing may read it.
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("JAVA_HOME", "")
+	bin := t.TempDir()
+	if err := os.WriteFile(filepath.Join(bin, "keytool"), []byte("#!/bin/sh\nexit 1\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	tools := &androidTools{buildtools: t.TempDir()}
+	if err := os.WriteFile(filepath.Join(tools.buildtools, "bundletool.jar"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	tmpDir := t.TempDir()
+	aab := filepath.Join(out, "app.aab")
+	links := filepath.Join(out, "assetlinks.json")
+	bi = &buildInfo{name: "app", appID: "com.example.app", target: "android"}
+	if err := signAAB(tmpDir, aab, tools, bi); err != nil {
+		t.Fatalf("dry run of an .aab build: %v", err)
+	}
+	if _, err := buildUniversalAPK(tmpDir, aab, tools, bi); err != nil {
+		t.Errorf("dry run of -universal-apk: %v", err)
+	}
+	if err := writeAssetLinks(bi, links); err != nil {
+		t.Errorf("dry run of -assetlinks: %v", err)
+	}
+	for _, f := range []string{aab, links, bi.key} {
+		if _, err := os.Stat(f); !os.IsNotExist(err) {
+			t.Errorf("dry run wrote %s", f)
+		}
+	}
+}
+
+func TestIconShape(t *testing.T) {
+	t.Parallel()
+
+	img := image.NewNRGBA(image.Rect(0, 0, 100, 100))
+	for i := range img.Pix {
+		img.Pix[i] = 0xff
+	}
+	tests := []struct {
+		shape       string
+		transparent []image.Point
+		opaque      []image.Point
+	}{
+		{
+			shape:  "square",
+			opaque: []image.Point{{0, 0}, {99, 99}},
+		},
+		{
+			// The corner radius is 22.5 pixels.
+			shape:       "rounded",
+			transparent: []image.Point{{0, 0}, {99, 0}, {0, 99}, {99, 99}, {5, 5}},
+			opaque:      []image.Point{{8, 8}, {91, 91}, {50, 0}, {0, 50}, {22, 0}},
+		},
+		{
+			shape:       "circle",
+			transparent: []image.Point{{0, 0}, {99, 99}, {13, 13}},
+			opaque:      []image.Point{{15, 15}, {84, 84}, {50, 2}, {2, 50}, {50, 50}},
+		},
+	}
+	for _, test := range tests {
+		icon := resizeIcon(iconVariant{size: 100, shape: test.shape}, img)
+		for _, p := range test.transparent {
+			if a := icon.NRGBAAt(p.X, p.Y).A; a != 0 {
+				t.Errorf("%s: pixel %v has alpha %d, expected transparent", test.shape, p, a)
+			}
+		}
+		for _, p := range test.opaque {
+			if c := icon.NRGBAAt(p.X, p.Y); c != (color.NRGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}) {
+				t.Errorf("%s: pixel %v is %v, expected opaque white", test.shape, p, c)
+			}
+		}
+	}
+}
+
+func TestBuildGroupLimit(t *testing.T) {
+	t.Parallel()
+
+	const limit = 2
+	builds := newBuildGroup(limit)
+	var mu sync.Mutex
+	running, peak := 0, 0
+	for i := 0; i < 8; i++ {
+		builds.Go(func() error {
+			mu.Lock()
+			running++
+			peak = max(peak, running)
+			mu.Unlock()
+			time.Sleep(10 * time.Millisecond)
+			mu.Lock()
+			running--
+			mu.Unlock()
+			return nil
+		})
+	}
+	if err := builds.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if peak > limit {
+		t.Errorf("%d builds ran concurrently, expected at most %d", peak, limit)
+	}
+}
+
+func TestRunCmdError(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake command requires a shell")
+	}
+	t.Parallel()
+
+	out, err := runCmd(exec.Command("sh", "-c", "echo ' ok '"))
+	if err != nil || out != "ok" {
+		t.Errorf("got %q, %v, expected %q", out, err, "ok")
+	}
+	_, err = runCmd(exec.Command("sh", "-c", "echo output; for i in $(seq 30); do echo line $i >&2; done; echo 'error: signing identity not found' >&2; exit 1"))
+	if err == nil {
+		t.Fatal("failing command succeeded")
+	}
+	msg := err.Error()
+	for _, want := range []string{"sh -c", "exit status 1", "error: signing identity not found", "line 30"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("error %q doesn't contain %q", msg, want)
+		}
+	}
+	if strings.Contains(msg, "\nline 1\n") || strings.Contains(msg, "\noutput") {
+		t.Errorf("error %q contains more than the last lines of stderr", msg)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake command requires a shell")
+	}
+	defer func(d time.Duration) { retryDelay = d }(retryDelay)
+	retryDelay = time.Millisecond
+
+	// The fake command fails with a transient error until it has run
+	// three times.
+	const script = `n=$(cat "$1" 2>/dev/null || echo 0); n=$((n+1)); echo $n > "$1"
+if [ $n -lt 3 ]; then echo "$2" >&2; exit 1; fi; echo uploaded`
+	run := func(retries int, failure string) (int, error) {
+		counter := filepath.Join(t.TempDir(), "attempts")
+		err := retry(retries, "upload", func() error {
+			_, err := runCmd(exec.Command("sh", "-c", script, "sh", counter, failure))
+			return err
+		})
+		n, rerr := os.ReadFile(counter)
+		if rerr != nil {
+			t.Fatal(rerr)
+		}
+		attempts, _ := strconv.Atoi(strings.TrimSpace(string(n)))
+		return attempts, err
+	}
+
+	if attempts, err := run(3, "Error: The network connection was lost."); err != nil || attempts != 3 {
+		t.Errorf("transient failure: %d attempts, %v, expected success after 3 attempts", attempts, err)
+	}
+	if attempts, err := run(1, "Error: HTTP status code: 503"); err == nil || attempts != 2 {
+		t.Errorf("transient failure: %d attempts, %v, expected failure after 2 attempts", attempts, err)
+	}
+	if attempts, err := run(3, "Error: HTTP status code: 401. Unable to authenticate."); err == nil || attempts != 1 {
+		t.Errorf("authentication failure: %d attempts, %v, expected failure after 1 attempt", attempts, err)
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	t.Parallel()
+
+	for msg, exp := range map[string]bool{
+		"Error: HTTP status code: 503":                              true,
+		"Error: HTTP status code: 401. Unable to authenticate.":     false,
+		"unexpected response: HTTP/1.1 502 Bad Gateway":             true,
+		"request failed with statusCode=429":                        true,
+		"HTTP status code: 403. Forbidden. network request refused": false,
+		"Error: The network connection was lost.":                   true,
+		"dial tcp: lookup api.example.com: no such host":            true,
+		"The timestamp service is not available.":                   true,
+		"open /tmp/build-500401/app.ipa: no such file or directory": false,
+		"package example.com/network: cannot find module":           false,
+		"app.ipa: 5003 bytes is too small":                          false,
+	} {
+		if got := isTransient(errors.New(msg)); got != exp {
+			t.Errorf("isTransient(%q) = %v, expected %v", msg, got, exp)
+		}
+	}
+}
+
+func TestOutputDirectory(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	for _, bi := range []*buildInfo{
+		{name: "app", target: "js"},
+		{name: "app", target: "android"},
+	} {
+		exp := filepath.Join(dir, outputName(bi))
+		if out := resolveOutput(bi, dir); out != exp {
+			t.Errorf("%s output in a directory is %q, expected %q", bi.target, out, exp)
+		}
+		file := filepath.Join(dir, "custom.apk")
+		if out := resolveOutput(bi, file); out != file {
+			t.Errorf("%s output file is %q, expected %q", bi.target, out, file)
+		}
+	}
+	// An earlier WebAssembly build is overwritten.
+	web := filepath.Join(dir, "web")
+	if err := os.MkdirAll(web, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(web, "main.wasm"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if out := resolveOutput(&buildInfo{name: "app", target: "js"}, web); out != web {
+		t.Errorf("js output in an earlier build is %q, expected %q", out, web)
+	}
+}
+
+func TestOutputNameTemplate(t *testing.T) {
+	t.Parallel()
+
+	bi := &buildInfo{
+		name:       "myapp",
+		target:     "android",
+		archs:      []string{"arm64", "amd64"},
+		version:    Semver{Major: 1, Minor: 2, Patch: 3, VersionCode: 42},
+		outputTmpl: "{name}-{version}-{arch}.{ext}",
+	}
+	if name := outputName(bi); name != "myapp-1.2.3-universal.apk" {
+		t.Errorf("two-arch android output is %q, expected myapp-1.2.3-universal.apk", name)
+	}
+	bi.archs = []string{"arm64"}
+	if name := outputName(bi); name != "myapp-1.2.3-arm64.apk" {
+		t.Errorf("arm64 android output is %q, expected myapp-1.2.3-arm64.apk", name)
+	}
+	bi.outputTmpl = "{target}-{versioncode}"
+	if name := outputName(bi); name != "android-42.apk" {
+		t.Errorf("output without {ext} is %q, expected android-42.apk", name)
+	}
+
+	// Windows writes an executable per architecture.
+	dir := t.TempDir()
+	bi = &buildInfo{
+		name:       "myapp",
+		target:     "windows",
+		archs:      []string{"amd64", "arm64"},
+		version:    Semver{Major: 1, Minor: 2, Patch: 3},
+		outputTmpl: "{name}-{version}-{arch}.{ext}",
+	}
+	out := resolveOutput(bi, dir)
+	if exp := filepath.Join(dir, "myapp-1.2.3-arm64.exe"); archOutput(bi, out, ".exe", "arm64") != exp {
+		t.Errorf("arm64 windows output is %q, expected %q", archOutput(bi, out, ".exe", "arm64"), exp)
+	}
+	if err := validateOutputName("{name}-{commit}"); err == nil {
+		t.Error("an unknown placeholder was accepted")
+	}
+}
+
+func TestIconSize(t *testing.T) {
+	defer func(strict bool) { *strictIcons = strict }(*strictIcons)
+
+	variants := []iconVariant{{path: "small.png", size: 48}, {path: "large.png", size: 1024}}
+	small := image.NewNRGBA(image.Rect(0, 0, 48, 48))
+	if problem := iconProblem(small, variants); !strings.Contains(problem, "48x48 icon is upscaled to 1024x1024") {
+		t.Errorf("a 48x48 icon has problem %q, expected a warning about upscaling", problem)
+	}
+	if problem := iconProblem(image.NewNRGBA(image.Rect(0, 0, 1024, 1024)), variants); problem != "" {
+		t.Errorf("a 1024x1024 icon has problem %q", problem)
+	}
+	// Sources of non-square variants need not be square.
+	banner := []iconVariant{{path: "banner.png", size: 400, height: 240}}
+	if problem := iconProblem(image.NewNRGBA(image.Rect(0, 0, 1920, 720)), banner); problem != "" {
+		t.Errorf("a banner icon has problem %q", problem)
+	}
+
+	dir := t.TempDir()
+	wide := filepath.Join(dir, "wide.png")
+	f, err := os.Create(wide)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(f, image.NewNRGBA(image.Rect(0, 0, 2048, 1024))); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	*strictIcons = false
+	if err := buildIcons(dir, wide, variants); err != nil {
+		t.Errorf("a non-square icon failed without -strict: %v", err)
+	}
+	*strictIcons = true
+	if err := buildIcons(dir, wide, variants); err == nil || !strings.Contains(err.Error(), "2048x1024 icon is not square") {
+		t.Errorf("a non-square icon under -strict returned %v, expected an error", err)
+	}
+}
@@ -0,0 +1,49 @@
+// SPDX-License-Identifier: Unlicense OR MIT
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// toolVersion is the gogio version. If empty, the version is derived from
+// the module build information. Release builds may set it at link time:
+//
+//	go build -ldflags="-X main.toolVersion=v1.2.3" gioui.org/cmd/gogio
+var toolVersion string
+
+// versionString returns the gogio version, the commit it was built from if
+// known, and the Go toolchain version.
+func versionString() string {
+	ver := toolVersion
+	var commit string
+	if info, ok := debug.ReadBuildInfo(); ok {
+		if ver == "" {
+			ver = info.Main.Version
+		}
+		var modified bool
+		for _, s := range info.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				commit = s.Value
+			case "vcs.modified":
+				modified = s.Value == "true"
+			}
+		}
+		if len(commit) > 12 {
+			commit = commit[:12]
+		}
+		if commit != "" && modified {
+			commit += "+dirty"
+		}
+	}
+	if ver == "" {
+		ver = "(devel)"
+	}
+	if commit != "" {
+		ver += " " + commit
+	}
+	return fmt.Sprintf("gogio version %s %s %s/%s", ver, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
@@ -0,0 +1,21 @@
+// SPDX-License-Identifier: Unlicense OR MIT
+
+package main
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestVersionString(t *testing.T) {
+	t.Parallel()
+
+	v := versionString()
+	if !strings.HasPrefix(v, "gogio version ") {
+		t.Errorf("unexpected version output %q", v)
+	}
+	if !strings.Contains(v, runtime.Version()) {
+		t.Errorf("version output %q doesn't contain the Go version %s", v, runtime.Version())
+	}
+}
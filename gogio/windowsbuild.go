@@ -3,6 +3,7 @@ package main
 import (
 	"bytes"
 	"encoding/binary"
+	"encoding/xml"
 	"errors"
 	"fmt"
 	"image/png"
@@ -11,8 +12,12 @@ import (
 	"os/exec"
 	"path/filepath"
 	"reflect"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 	"text/template"
+	"unicode/utf16"
 
 	"github.com/akavel/rsrc/binutil"
 	"github.com/akavel/rsrc/coff"
@@ -23,27 +28,51 @@ func buildWindows(tmpDir string, bi *buildInfo) error {
 	builder := &windowsBuilder{TempDir: tmpDir}
 	builder.DestDir = *destPath
 	if builder.DestDir == "" {
-		builder.DestDir = bi.pkgPath
+		builder.DestDir = pkgOutputDir(bi)
 	}
 
+	ext := ".exe"
+	switch *pkgFormat {
+	case "", "exe":
+	case "msix":
+		ext = ".msix"
+	default:
+		return fmt.Errorf("invalid -format %s for target %s", *pkgFormat, bi.target)
+	}
 	name := bi.name
 	if *destPath != "" {
-		if filepath.Ext(*destPath) != ".exe" {
-			return fmt.Errorf("invalid output name %q, it must end with `.exe`", *destPath)
+		if filepath.Ext(*destPath) != ext {
+			return fmt.Errorf("invalid output name %q, it must end with `%s`", *destPath, ext)
+		}
+		if !templatedOutput(bi, *destPath) {
+			name = filepath.Base(*destPath)
+		}
+	}
+	name = strings.TrimSuffix(name, ext)
+	msix := ext == ".msix"
+	if msix {
+		if _, err := os.Stat(bi.iconPath); err != nil {
+			return fmt.Errorf("-format msix requires an icon: %v", err)
 		}
-		name = filepath.Base(*destPath)
 	}
-	name = strings.TrimSuffix(name, ".exe")
 	sdk := bi.minsdk
 	if sdk > 10 {
 		return fmt.Errorf("invalid minsdk (%d) it's higher than Windows 10", sdk)
 	}
+	var res []windowsResource
+	if bi.resources != "" {
+		var err error
+		res, err = loadWindowsResources(bi.resources)
+		if err != nil {
+			return fmt.Errorf("invalid -resources: %v", err)
+		}
+	}
 
 	for _, arch := range bi.archs {
 		builder.Coff = coff.NewRSRC()
 		builder.Coff.Arch(arch)
 
-		if err := builder.embedIcon(bi.iconPath); err != nil {
+		if err := builder.embedIcon(bi.iconPath, bi.iconShape); err != nil {
 			return err
 		}
 
@@ -58,17 +87,48 @@ func buildWindows(tmpDir string, bi *buildInfo) error {
 		if err := builder.embedInfo(windowsResources{
 			Version:      [2]uint32{uint32(bi.version.Major), uint32(bi.version.Minor)<<16 | uint32(bi.version.Patch)},
 			VersionHuman: bi.version.String(),
-			Name:         name,
 			Language:     0x0400, // Process Default Language: https://docs.microsoft.com/en-us/previous-versions/ms957130(v=msdn.10)
+			Company:      windowsCompany(bi),
+			Product:      windowsProduct(bi, name),
+			Description:  windowsDescription(bi, name),
+			Copyright:    bi.copyright,
 		}); err != nil {
 			return fmt.Errorf("can't create info: %v", err)
 		}
 
+		if err := builder.embedResources(res); err != nil {
+			return err
+		}
+
 		if err := builder.buildResource(bi, name, arch); err != nil {
 			return fmt.Errorf("can't build the resources: %v", err)
 		}
 
-		if err := builder.buildProgram(bi, name, arch); err != nil {
+		dest := builder.DestDir
+		if len(bi.archs) > 1 {
+			dest = filepath.Join(filepath.Dir(builder.DestDir), name+"_"+arch+ext)
+			if templatedOutput(bi, builder.DestDir) {
+				dest = archOutput(bi, builder.DestDir, ext, arch)
+			}
+		}
+		if !msix {
+			if err := builder.buildProgram(bi, dest, arch); err != nil {
+				return err
+			}
+			addArtifact(dest, arch)
+			continue
+		}
+		if *destPath == "" {
+			dest = filepath.Join(builder.DestDir, name+ext)
+			if len(bi.archs) > 1 {
+				dest = filepath.Join(builder.DestDir, name+"_"+arch+ext)
+			}
+		}
+		stage := filepath.Join(tmpDir, "msix_"+arch)
+		if err := builder.buildProgram(bi, filepath.Join(stage, name+".exe"), arch); err != nil {
+			return err
+		}
+		if err := packageMSIX(stage, dest, name, arch, bi); err != nil {
 			return err
 		}
 	}
@@ -81,7 +141,10 @@ type (
 		Version      [2]uint32
 		VersionHuman string
 		Language     uint16
-		Name         string
+		Company      string
+		Product      string
+		Description  string
+		Copyright    string
 	}
 	windowsManifest struct {
 		Version        string
@@ -92,17 +155,49 @@ type (
 		TempDir string
 		DestDir string
 		Coff    *coff.Coff
+		// used tracks the type and id of the resources added to Coff.
+		used map[[2]uint32]bool
+	}
+	// windowsResource is a resource of the -resources flag.
+	windowsResource struct {
+		kind uint32
+		id   uint16
+		data []byte
+		// icons are the images of an icon group resource.
+		icons []icoImage
+	}
+	// icoImage is an image of an .ico file.
+	icoImage struct {
+		// entry is the first 12 bytes of the ICONDIRENTRY, which are
+		// shared with the GRPICONDIRENTRY of the group resource.
+		entry [12]byte
+		data  []byte
 	}
 )
 
 const (
 	// https://docs.microsoft.com/en-us/windows/win32/menurc/resource-types
+	windowsResourceBitmap    = 2
 	windowsResourceIcon      = 3
+	windowsResourceString    = 6
+	windowsResourceData      = 10
 	windowsResourceIconGroup = windowsResourceIcon + 11
 	windowsResourceManifest  = 24
 	windowsResourceVersion   = 16
+	windowsResourceHTML      = 23
 )
 
+// windowsResourceTypes maps the resource type names of .rc files and
+// -resources directories to their ids.
+var windowsResourceTypes = map[string]uint32{
+	"BITMAP":   windowsResourceBitmap,
+	"ICON":     windowsResourceIconGroup,
+	"RCDATA":   windowsResourceData,
+	"HTML":     windowsResourceHTML,
+	"MANIFEST": windowsResourceManifest,
+	"STRING":   windowsResourceString,
+}
+
 type bufferCoff struct {
 	bytes.Buffer
 }
@@ -111,7 +206,7 @@ func (b *bufferCoff) Size() int64 {
 	return int64(b.Len())
 }
 
-func (b *windowsBuilder) embedIcon(path string) (err error) {
+func (b *windowsBuilder) embedIcon(path, shape string) (err error) {
 	iconFile, err := os.Open(path)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
@@ -137,11 +232,11 @@ func (b *windowsBuilder) embedIcon(path string) (err error) {
 	for _, size := range sizes {
 		var iconBuffer bufferCoff
 
-		if err := png.Encode(&iconBuffer, resizeIcon(iconVariant{size: size, fill: false}, iconImage)); err != nil {
+		if err := png.Encode(&iconBuffer, resizeIcon(iconVariant{size: size, fill: false, shape: shape}, iconImage)); err != nil {
 			return fmt.Errorf("can't encode image: %v", err)
 		}
 
-		b.Coff.AddResource(windowsResourceIcon, uint16(size), &iconBuffer)
+		b.addResource(windowsResourceIcon, uint16(size), &iconBuffer)
 
 		if err := binary.Write(&iconHeader, binary.LittleEndian, struct {
 			Size     [2]uint8
@@ -161,13 +256,406 @@ func (b *windowsBuilder) embedIcon(path string) (err error) {
 		}
 	}
 
-	b.Coff.AddResource(windowsResourceIconGroup, 1, &iconHeader)
+	b.addResource(windowsResourceIconGroup, 1, &iconHeader)
 
 	return nil
 }
 
+// addResource adds a resource to the resource section. The ids of a type
+// must be added in increasing order.
+func (b *windowsBuilder) addResource(kind uint32, id uint16, data coff.Sizer) {
+	if b.used == nil {
+		b.used = make(map[[2]uint32]bool)
+	}
+	b.used[[2]uint32{kind, uint32(id)}] = true
+	b.Coff.AddResource(kind, id, data)
+}
+
+// embedResources adds the -resources resources after the generated icon,
+// manifest and version resources. The images of icons are numbered after the
+// generated icon images.
+func (b *windowsBuilder) embedResources(res []windowsResource) error {
+	var maxIcon uint16
+	maxID := make(map[uint32]uint16)
+	for k := range b.used {
+		if k[0] == windowsResourceIcon {
+			maxIcon = max(maxIcon, uint16(k[1]))
+		}
+		maxID[k[0]] = max(maxID[k[0]], uint16(k[1]))
+	}
+	for _, r := range res {
+		if b.used[[2]uint32{r.kind, uint32(r.id)}] {
+			return fmt.Errorf("invalid -resources: resource %d of type %d collides with a resource generated by gogio", r.id, r.kind)
+		}
+		if r.id < maxID[r.kind] {
+			return fmt.Errorf("invalid -resources: resource %d of type %d must be numbered after %d, the last resource generated by gogio", r.id, r.kind, maxID[r.kind])
+		}
+	}
+	groups := make(map[uint16]*bufferCoff)
+	for _, r := range res {
+		if r.kind != windowsResourceIconGroup {
+			continue
+		}
+		group := new(bufferCoff)
+		binary.Write(group, binary.LittleEndian, [3]uint16{0, 1, uint16(len(r.icons))})
+		for _, img := range r.icons {
+			maxIcon++
+			b.addResource(windowsResourceIcon, maxIcon, &bufferCoff{*bytes.NewBuffer(img.data)})
+			group.Write(img.entry[:])
+			binary.Write(group, binary.LittleEndian, maxIcon)
+		}
+		groups[r.id] = group
+	}
+	for _, r := range res {
+		if group, ok := groups[r.id]; ok && r.kind == windowsResourceIconGroup {
+			b.addResource(r.kind, r.id, group)
+			continue
+		}
+		b.addResource(r.kind, r.id, &bufferCoff{*bytes.NewBuffer(r.data)})
+	}
+	return nil
+}
+
+// loadWindowsResources loads the resources of an .rc file or a directory.
+// The resources are sorted by type and id.
+func loadWindowsResources(path string) ([]windowsResource, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	var res []windowsResource
+	strs := make(map[uint16]string)
+	if fi.IsDir() {
+		res, err = loadResourceDir(path, strs)
+	} else {
+		res, err = loadResourceScript(path, strs)
+	}
+	if err != nil {
+		return nil, err
+	}
+	res = append(res, stringTables(strs)...)
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].kind != res[j].kind {
+			return res[i].kind < res[j].kind
+		}
+		return res[i].id < res[j].id
+	})
+	for i := 1; i < len(res); i++ {
+		if res[i].kind == res[i-1].kind && res[i].id == res[i-1].id {
+			return nil, fmt.Errorf("%s: duplicate resource %d of type %d", path, res[i].id, res[i].kind)
+		}
+	}
+	return res, nil
+}
+
+// loadResourceDir loads the resources of a directory, where every
+// subdirectory is named after a resource type such as RCDATA, BITMAP, ICON
+// or STRING, or a type number, and contains files named after the resource
+// ids, such as 101.bmp. The files of the STRING directory contain the
+// strings of the string table.
+func loadResourceDir(dir string, strs map[uint16]string) ([]windowsResource, error) {
+	types, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var res []windowsResource
+	for _, t := range types {
+		if !t.IsDir() {
+			continue
+		}
+		kind, err := resourceType(t.Name())
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", dir, err)
+		}
+		files, err := os.ReadDir(filepath.Join(dir, t.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range files {
+			name := f.Name()
+			id, err := resourceID(strings.TrimSuffix(name, filepath.Ext(name)))
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", filepath.Join(dir, t.Name(), name), err)
+			}
+			path := filepath.Join(dir, t.Name(), name)
+			if kind == windowsResourceString {
+				s, err := os.ReadFile(path)
+				if err != nil {
+					return nil, err
+				}
+				strs[id] = strings.TrimRight(string(s), "\r\n")
+				continue
+			}
+			r, err := fileResource(kind, id, path)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, r)
+		}
+	}
+	return res, nil
+}
+
+// loadResourceScript loads the resources of an .rc resource script. The
+// script may contain STRINGTABLE blocks and single line resources that name a
+// file, such as
+//
+//	101 BITMAP "logo.bmp"
+//
+// Preprocessor directives are ignored, and ids must be numbers.
+func loadResourceScript(path string, strs map[uint16]string) ([]windowsResource, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	toks, err := rcTokens(string(src))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	var res []windowsResource
+	for len(toks) > 0 {
+		tok := toks[0]
+		if strings.EqualFold(tok.text, "STRINGTABLE") {
+			toks = toks[1:]
+			// Skip memory options up to the block.
+			for len(toks) > 0 && toks[0].text != "{" && !strings.EqualFold(toks[0].text, "BEGIN") {
+				toks = toks[1:]
+			}
+			if len(toks) == 0 {
+				return nil, fmt.Errorf("%s:%d: STRINGTABLE without BEGIN", path, tok.line)
+			}
+			toks = toks[1:]
+			for len(toks) > 0 && toks[0].text != "}" && !strings.EqualFold(toks[0].text, "END") {
+				id, err := resourceID(toks[0].text)
+				if err != nil {
+					return nil, fmt.Errorf("%s:%d: %v", path, toks[0].line, err)
+				}
+				toks = toks[1:]
+				if len(toks) > 0 && toks[0].text == "," {
+					toks = toks[1:]
+				}
+				if len(toks) == 0 || !toks[0].quoted {
+					return nil, fmt.Errorf("%s:%d: missing string of string %d", path, tok.line, id)
+				}
+				strs[id] = toks[0].text
+				toks = toks[1:]
+			}
+			if len(toks) == 0 {
+				return nil, fmt.Errorf("%s:%d: STRINGTABLE without END", path, tok.line)
+			}
+			toks = toks[1:]
+			continue
+		}
+		id, err := resourceID(tok.text)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, tok.line, err)
+		}
+		if len(toks) < 2 {
+			return nil, fmt.Errorf("%s:%d: missing type of resource %d", path, tok.line, id)
+		}
+		kind, err := resourceType(toks[1].text)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, tok.line, err)
+		}
+		toks = toks[2:]
+		// Skip memory options up to the file name.
+		for len(toks) > 0 && !toks[0].quoted && toks[0].line == tok.line && toks[0].text != "{" && !strings.EqualFold(toks[0].text, "BEGIN") {
+			toks = toks[1:]
+		}
+		if len(toks) == 0 || !toks[0].quoted {
+			return nil, fmt.Errorf("%s:%d: resource %d must name a file; inline data is not supported", path, tok.line, id)
+		}
+		file := toks[0].text
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(filepath.Dir(path), file)
+		}
+		r, err := fileResource(kind, id, file)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, r)
+		toks = toks[1:]
+	}
+	return res, nil
+}
+
+// rcToken is a token of a resource script.
+type rcToken struct {
+	text   string
+	quoted bool
+	line   int
+}
+
+// rcTokens splits a resource script into words, quoted strings, commas and
+// braces, skipping comments and preprocessor directives.
+func rcTokens(src string) ([]rcToken, error) {
+	var toks []rcToken
+	line := 1
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case strings.HasPrefix(src[i:], "//"), c == '#' && (i == 0 || src[i-1] == '\n'):
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(src[i:], "/*"):
+			end := strings.Index(src[i+2:], "*/")
+			if end == -1 {
+				return nil, fmt.Errorf("line %d: unterminated comment", line)
+			}
+			line += strings.Count(src[i:i+2+end], "\n")
+			i += end + 4
+		case c == ',' || c == '{' || c == '}':
+			toks = append(toks, rcToken{text: string(c), line: line})
+			i++
+		case c == '"':
+			var s strings.Builder
+			i++
+			for {
+				if i >= len(src) || src[i] == '\n' {
+					return nil, fmt.Errorf("line %d: unterminated string", line)
+				}
+				if src[i] == '"' {
+					// A doubled quote is a literal quote.
+					if i+1 < len(src) && src[i+1] == '"' {
+						s.WriteByte('"')
+						i += 2
+						continue
+					}
+					i++
+					break
+				}
+				if src[i] == '\\' && i+1 < len(src) {
+					switch src[i+1] {
+					case 'n':
+						s.WriteByte('\n')
+					case 't':
+						s.WriteByte('\t')
+					default:
+						s.WriteByte(src[i+1])
+					}
+					i += 2
+					continue
+				}
+				s.WriteByte(src[i])
+				i++
+			}
+			toks = append(toks, rcToken{text: s.String(), quoted: true, line: line})
+		default:
+			start := i
+			for i < len(src) && !strings.ContainsRune(" \t\r\n,{}\"", rune(src[i])) {
+				i++
+			}
+			toks = append(toks, rcToken{text: src[start:i], line: line})
+		}
+	}
+	return toks, nil
+}
+
+// resourceType parses a resource type name or number.
+func resourceType(name string) (uint32, error) {
+	if kind, ok := windowsResourceTypes[strings.ToUpper(name)]; ok {
+		return kind, nil
+	}
+	kind, err := strconv.ParseUint(name, 0, 16)
+	if err != nil || kind == 0 {
+		return 0, fmt.Errorf("unsupported resource type %q", name)
+	}
+	return uint32(kind), nil
+}
+
+// resourceID parses a numeric resource id.
+func resourceID(s string) (uint16, error) {
+	id, err := strconv.ParseUint(s, 0, 16)
+	if err != nil || id == 0 {
+		return 0, fmt.Errorf("invalid resource id %q; only numeric ids are supported", s)
+	}
+	return uint16(id), nil
+}
+
+// fileResource returns the resource of the kind with the contents of file.
+func fileResource(kind uint32, id uint16, file string) (windowsResource, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return windowsResource{}, err
+	}
+	r := windowsResource{kind: kind, id: id, data: data}
+	switch kind {
+	case windowsResourceBitmap:
+		// Bitmap resources omit the BITMAPFILEHEADER.
+		if len(data) < 14 || string(data[:2]) != "BM" {
+			return r, fmt.Errorf("%s: not a BMP file", file)
+		}
+		r.data = data[14:]
+	case windowsResourceIconGroup:
+		r.icons, err = parseICO(data)
+		if err != nil {
+			return r, fmt.Errorf("%s: %v", file, err)
+		}
+		r.data = nil
+	}
+	return r, nil
+}
+
+// parseICO returns the images of an .ico file.
+func parseICO(data []byte) ([]icoImage, error) {
+	if len(data) < 6 || binary.LittleEndian.Uint16(data[2:]) != 1 {
+		return nil, errors.New("not an ICO file")
+	}
+	n := int(binary.LittleEndian.Uint16(data[4:]))
+	if len(data) < 6+16*n {
+		return nil, errors.New("truncated ICO file")
+	}
+	imgs := make([]icoImage, n)
+	for i := range imgs {
+		e := data[6+16*i : 6+16*(i+1)]
+		size := binary.LittleEndian.Uint32(e[8:])
+		off := binary.LittleEndian.Uint32(e[12:])
+		if uint64(off)+uint64(size) > uint64(len(data)) {
+			return nil, errors.New("truncated ICO file")
+		}
+		copy(imgs[i].entry[:], e[:12])
+		imgs[i].data = data[off : off+size]
+	}
+	return imgs, nil
+}
+
+// stringTables returns the string table resources of the strings. Every
+// resource holds a block of 16 strings, each prefixed by its length.
+func stringTables(strs map[uint16]string) []windowsResource {
+	blocks := make(map[uint16]*[16]string)
+	for id, s := range strs {
+		b := blocks[id/16+1]
+		if b == nil {
+			b = new([16]string)
+			blocks[id/16+1] = b
+		}
+		b[id%16] = s
+	}
+	var res []windowsResource
+	for id, b := range blocks {
+		var buf bytes.Buffer
+		for _, s := range b {
+			u := utf16.Encode([]rune(s))
+			binary.Write(&buf, binary.LittleEndian, uint16(len(u)))
+			binary.Write(&buf, binary.LittleEndian, u)
+		}
+		res = append(res, windowsResource{kind: windowsResourceString, id: id, data: buf.Bytes()})
+	}
+	return res
+}
+
 func (b *windowsBuilder) buildResource(buildInfo *buildInfo, name string, arch string) error {
-	out, err := os.Create(filepath.Join(buildInfo.pkgPath, name+"_windows_"+arch+".syso"))
+	syso := filepath.Join(buildInfo.pkgDir, name+"_windows_"+arch+".syso")
+	if dryRunSkip("writing " + syso) {
+		return nil
+	}
+	out, err := os.Create(syso)
 	if err != nil {
 		return err
 	}
@@ -196,27 +684,161 @@ func (b *windowsBuilder) buildResource(buildInfo *buildInfo, name string, arch s
 	return nil
 }
 
-func (b *windowsBuilder) buildProgram(buildInfo *buildInfo, name string, arch string) error {
-	dest := b.DestDir
-	if len(buildInfo.archs) > 1 {
-		dest = filepath.Join(filepath.Dir(b.DestDir), name+"_"+arch+".exe")
+func (b *windowsBuilder) buildProgram(buildInfo *buildInfo, dest string, arch string) error {
+	cmd := windowsBuildCmd(buildInfo, dest, arch)
+	if err := runGoBuild(buildInfo, cmd, dest); err != nil {
+		return err
+	}
+	return nil
+}
+
+// msixArchs maps GOARCH values to the ProcessorArchitecture of MSIX
+// packages.
+var msixArchs = map[string]string{
+	"386":   "x86",
+	"amd64": "x64",
+	"arm":   "arm",
+	"arm64": "arm64",
+}
+
+// packageMSIX writes the AppxManifest.xml and logos of the program in the
+// stage directory, and packs the directory into the dest .msix with
+// makeappx, signed by signtool if -signkey is set. Without makeappx, the
+// stage directory is copied next to dest instead.
+func packageMSIX(stage, dest, name, arch string, bi *buildInfo) error {
+	if err := buildIcons(stage, bi.iconPath, []iconVariant{
+		{path: filepath.Join("Assets", "Square44x44Logo.png"), size: 44},
+		{path: filepath.Join("Assets", "Square150x150Logo.png"), size: 150},
+		{path: filepath.Join("Assets", "StoreLogo.png"), size: 50},
+	}); err != nil {
+		return err
+	}
+	manifest := msixManifest(bi, name, arch)
+	if err := os.WriteFile(filepath.Join(stage, "AppxManifest.xml"), []byte(manifest), 0644); err != nil {
+		return err
+	}
+	makeappx, err := exec.LookPath("makeappx")
+	if err != nil {
+		dir := strings.TrimSuffix(dest, ".msix") + "-msix"
+		if err := os.RemoveAll(dir); err != nil {
+			return err
+		}
+		if err := copyDir(dir, stage); err != nil {
+			return err
+		}
+		addArtifact(dir, arch)
+		fmt.Fprintf(os.Stderr, "gogio: makeappx not found in $PATH; wrote %s instead of %s.\n"+
+			"Install the Windows SDK and run\n\n"+
+			"\tmakeappx pack /o /d %s /p %s\n"+
+			"\tsigntool sign /fd SHA256 /f <certificate.pfx> /p <password> %s\n\n"+
+			"to package and sign the MSIX.\n", dir, dest, dir, dest, dest)
+		return nil
+	}
+	if _, err := runCmd(exec.Command(makeappx, "pack", "/o", "/d", stage, "/p", dest)); err != nil {
+		return err
+	}
+	if bi.key != "" {
+		signtool, err := exec.LookPath("signtool")
+		if err != nil {
+			return fmt.Errorf("sign: %v", err)
+		}
+		cmd := exec.Command(signtool, "sign", "/fd", "SHA256", "/f", bi.key)
+		if bi.password != "" {
+			cmd.Args = append(cmd.Args, "/p", bi.password)
+		}
+		cmd.Args = append(cmd.Args, dest)
+		if _, err := runCmd(cmd); err != nil {
+			return fmt.Errorf("sign: %v", err)
+		}
+	}
+	addArtifact(dest, arch)
+	return nil
+}
+
+// msixManifest returns the AppxManifest.xml of the MSIX package of the
+// program. Every -schemes scheme is declared as a protocol extension.
+func msixManifest(bi *buildInfo, name, arch string) string {
+	esc := func(s string) string {
+		var b strings.Builder
+		xml.EscapeText(&b, []byte(s))
+		return b.String()
 	}
+	publisher := bi.publisher
+	if publisher == "" {
+		publisher = "CN=" + bi.appID
+	}
+	publisherName := bi.company
+	if publisherName == "" {
+		publisherName = strings.TrimPrefix(strings.SplitN(publisher, ",", 2)[0], "CN=")
+	}
+	product := windowsProduct(bi, name)
+	// The Store reserves the revision of package versions.
+	version := fmt.Sprintf("%d.%d.%d.0", bi.version.Major, bi.version.Minor, bi.version.Patch)
+	var protocols strings.Builder
+	for _, s := range bi.schemes {
+		fmt.Fprintf(&protocols, `
+				<uap:Extension Category="windows.protocol">
+					<uap:Protocol Name="%s">
+						<uap:DisplayName>%s</uap:DisplayName>
+					</uap:Protocol>
+				</uap:Extension>`, esc(strings.ToLower(s)), esc(product))
+	}
+	extensions := ""
+	if protocols.Len() > 0 {
+		extensions = "\n\t\t\t<Extensions>" + protocols.String() + "\n\t\t\t</Extensions>"
+	}
+	return fmt.Sprintf(`<?xml version="1.0" encoding="utf-8"?>
+<Package xmlns="http://schemas.microsoft.com/appx/manifest/foundation/windows10"
+	xmlns:uap="http://schemas.microsoft.com/appx/manifest/uap/windows10"
+	xmlns:rescap="http://schemas.microsoft.com/appx/manifest/foundation/windows10/restrictedcapabilities"
+	IgnorableNamespaces="uap rescap">
+	<Identity Name="%[1]s" Publisher="%[2]s" Version="%[3]s" ProcessorArchitecture="%[4]s" />
+	<Properties>
+		<DisplayName>%[5]s</DisplayName>
+		<PublisherDisplayName>%[6]s</PublisherDisplayName>
+		<Logo>Assets\StoreLogo.png</Logo>
+	</Properties>
+	<Dependencies>
+		<TargetDeviceFamily Name="Windows.Desktop" MinVersion="10.0.17763.0" MaxVersionTested="10.0.22621.0" />
+	</Dependencies>
+	<Resources>
+		<Resource Language="en-us" />
+	</Resources>
+	<Applications>
+		<Application Id="App" Executable="%[7]s" EntryPoint="Windows.FullTrustApplication">
+			<uap:VisualElements DisplayName="%[5]s" Description="%[9]s" BackgroundColor="transparent"
+				Square150x150Logo="Assets\Square150x150Logo.png" Square44x44Logo="Assets\Square44x44Logo.png" />%[8]s
+		</Application>
+	</Applications>
+	<Capabilities>
+		<rescap:Capability Name="runFullTrust" />
+	</Capabilities>
+</Package>
+`, esc(strings.ReplaceAll(bi.appID, "_", "-")), esc(publisher), version, msixArchs[arch], esc(product), esc(publisherName), esc(name+".exe"), extensions, esc(windowsDescription(bi, name)))
+}
 
+// windowsBuildCmd returns the command that builds the program into the
+// dest executable for arch. Programs use the GUI subsystem, unless -console
+// is set.
+func windowsBuildCmd(bi *buildInfo, dest, arch string) *exec.Cmd {
+	ldflags := bi.ldflags
+	if !bi.console {
+		ldflags = "-H=windowsgui " + ldflags
+	}
 	cmd := exec.Command(
 		"go",
 		"build",
-		"-ldflags=-H=windowsgui "+buildInfo.ldflags,
-		"-tags="+buildInfo.tags,
+		"-ldflags="+ldflags,
+		"-tags="+bi.tags,
 		"-o", dest,
-		buildInfo.pkgPath,
+		bi.pkgPath,
 	)
 	cmd.Env = append(
 		os.Environ(),
 		"GOOS=windows",
 		"GOARCH="+arch,
 	)
-	_, err := runCmd(cmd)
-	return err
+	return cmd
 }
 
 func (b *windowsBuilder) embedManifest(v windowsManifest) error {
@@ -260,7 +882,7 @@ func (b *windowsBuilder) embedManifest(v windowsManifest) error {
 		return err
 	}
 
-	b.Coff.AddResource(windowsResourceManifest, 1, &manifest)
+	b.addResource(windowsResourceManifest, 1, &manifest)
 
 	return nil
 }
@@ -268,6 +890,20 @@ func (b *windowsBuilder) embedManifest(v windowsManifest) error {
 func (b *windowsBuilder) embedInfo(v windowsResources) error {
 	page := uint16(1)
 
+	// https://docs.microsoft.com/pt-br/windows/win32/menurc/string-str
+	strs := []io.WriterTo{
+		newValue(valueText, "ProductVersion", v.VersionHuman),
+		newValue(valueText, "FileVersion", v.VersionHuman),
+		newValue(valueText, "FileDescription", v.Description),
+		newValue(valueText, "ProductName", v.Product),
+	}
+	if v.Company != "" {
+		strs = append(strs, newValue(valueText, "CompanyName", v.Company))
+	}
+	if v.Copyright != "" {
+		strs = append(strs, newValue(valueText, "LegalCopyright", v.Copyright))
+	}
+
 	// https://docs.microsoft.com/pt-br/windows/win32/menurc/vs-versioninfo
 	t := newValue(valueBinary, "VS_VERSION_INFO", []io.WriterTo{
 		// https://docs.microsoft.com/pt-br/windows/win32/api/VerRsrc/ns-verrsrc-vs_fixedfileinfo
@@ -285,14 +921,7 @@ func (b *windowsBuilder) embedInfo(v windowsResources) error {
 		// https://docs.microsoft.com/pt-br/windows/win32/menurc/stringfileinfo
 		newValue(valueText, "StringFileInfo", []io.WriterTo{
 			// https://docs.microsoft.com/pt-br/windows/win32/menurc/stringtable
-			newValue(valueText, fmt.Sprintf("%04X%04X", v.Language, page), []io.WriterTo{
-				// https://docs.microsoft.com/pt-br/windows/win32/menurc/string-str
-				newValue(valueText, "ProductVersion", v.VersionHuman),
-				newValue(valueText, "FileVersion", v.VersionHuman),
-				newValue(valueText, "FileDescription", v.Name),
-				newValue(valueText, "ProductName", v.Name),
-				// TODO include more data: gogio must have some way to provide such information (like Company Name, Copyright...)
-			}),
+			newValue(valueText, fmt.Sprintf("%04X%04X", v.Language, page), strs),
 		}),
 		// https://docs.microsoft.com/pt-br/windows/win32/menurc/varfileinfo
 		newValue(valueBinary, "VarFileInfo", []io.WriterTo{
@@ -309,11 +938,43 @@ func (b *windowsBuilder) embedInfo(v windowsResources) error {
 		return err
 	}
 
-	b.Coff.AddResource(windowsResourceVersion, 1, &verrsrc)
+	b.addResource(windowsResourceVersion, 1, &verrsrc)
 
 	return nil
 }
 
+// windowsCompany returns the -company name, which defaults to the domain
+// of the app id: gioui.org for org.gioui.example.
+func windowsCompany(bi *buildInfo) string {
+	if bi.company != "" {
+		return bi.company
+	}
+	elems := strings.Split(bi.appID, ".")
+	if len(elems) > 1 {
+		elems = elems[:len(elems)-1]
+	}
+	slices.Reverse(elems)
+	return strings.Join(elems, ".")
+}
+
+// windowsProduct returns the -product name, which defaults to the program
+// name.
+func windowsProduct(bi *buildInfo, name string) string {
+	if bi.product != "" {
+		return bi.product
+	}
+	return name
+}
+
+// windowsDescription returns the -description, which defaults to the
+// product name.
+func windowsDescription(bi *buildInfo, name string) string {
+	if bi.description != "" {
+		return bi.description
+	}
+	return windowsProduct(bi, name)
+}
+
 type windowsInfoValueFixed struct {
 	Signature      uint32
 	StructVersion  uint32
@@ -0,0 +1,182 @@
+// SPDX-License-Identifier: Unlicense OR MIT
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/akavel/rsrc/coff"
+)
+
+func TestWindowsConsole(t *testing.T) {
+	t.Parallel()
+
+	bi := &buildInfo{ldflags: "-s -w", pkgPath: "."}
+	if args := strings.Join(windowsBuildCmd(bi, "app.exe", "amd64").Args, " "); !strings.Contains(args, "-ldflags=-H=windowsgui -s -w") {
+		t.Errorf("GUI build command %q doesn't use the windowsgui subsystem", args)
+	}
+	bi.console = true
+	if args := strings.Join(windowsBuildCmd(bi, "app.exe", "amd64").Args, " "); strings.Contains(args, "windowsgui") {
+		t.Errorf("-console build command %q uses the windowsgui subsystem", args)
+	}
+}
+
+func TestWindowsResources(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	rc := filepath.Join(dir, "app.rc")
+	if err := os.WriteFile(filepath.Join(dir, "data.bin"), []byte("gogio rcdata"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	script := `#include "resource.h"
+// Strings.
+STRINGTABLE
+BEGIN
+	101, "Hello gogio"
+END
+102 RCDATA "data.bin"
+`
+	if err := os.WriteFile(rc, []byte(script), 0644); err != nil {
+		t.Fatal(err)
+	}
+	res, err := loadWindowsResources(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &windowsBuilder{Coff: coff.NewRSRC()}
+	b.Coff.Arch("amd64")
+	if err := b.embedManifest(windowsManifest{Version: "1.0.0.1", WindowsVersion: 10, Name: "app"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.embedResources(res); err != nil {
+		t.Fatal(err)
+	}
+	bi := &buildInfo{pkgDir: dir}
+	if err := b.buildResource(bi, "app", "amd64"); err != nil {
+		t.Fatal(err)
+	}
+	syso, err := os.ReadFile(filepath.Join(dir, "app_windows_amd64.syso"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(syso, utf16LE("Hello gogio")) {
+		t.Error("resources don't contain the string table")
+	}
+	if !bytes.Contains(syso, []byte("gogio rcdata")) {
+		t.Error("resources don't contain the RCDATA resource")
+	}
+
+	// A custom manifest collides with the generated one.
+	if err := os.MkdirAll(filepath.Join(dir, "res", "MANIFEST"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "res", "MANIFEST", "1.xml"), []byte("<assembly/>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	res, err = loadWindowsResources(filepath.Join(dir, "res"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b = &windowsBuilder{Coff: coff.NewRSRC()}
+	if err := b.embedManifest(windowsManifest{Version: "1.0.0.1", WindowsVersion: 10, Name: "app"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.embedResources(res); err == nil {
+		t.Error("colliding manifest resource was accepted")
+	}
+}
+
+func TestMSIXManifest(t *testing.T) {
+	t.Parallel()
+
+	bi := &buildInfo{
+		appID:   "org.gioui.example",
+		version: Semver{Major: 1, Minor: 2, Patch: 3, VersionCode: 4},
+		schemes: []string{"gio", "gio-example"},
+	}
+	manifest := msixManifest(bi, "example", "arm64")
+	for _, exp := range []string{
+		`<Identity Name="org.gioui.example" Publisher="CN=org.gioui.example" Version="1.2.3.0" ProcessorArchitecture="arm64" />`,
+		`<DisplayName>example</DisplayName>`,
+		`Executable="example.exe"`,
+		`<uap:Protocol Name="gio">`,
+		`<uap:Protocol Name="gio-example">`,
+	} {
+		if !strings.Contains(manifest, exp) {
+			t.Errorf("AppxManifest.xml doesn't contain %s:\n%s", exp, manifest)
+		}
+	}
+	bi.publisher = "CN=Example Corp, O=Example Corp, C=US"
+	bi.schemes = nil
+	manifest = msixManifest(bi, "example", "amd64")
+	if exp := `Publisher="CN=Example Corp, O=Example Corp, C=US"`; !strings.Contains(manifest, exp) {
+		t.Errorf("AppxManifest.xml doesn't contain %s:\n%s", exp, manifest)
+	}
+	if exp := `<PublisherDisplayName>Example Corp</PublisherDisplayName>`; !strings.Contains(manifest, exp) {
+		t.Errorf("AppxManifest.xml doesn't contain %s:\n%s", exp, manifest)
+	}
+	if strings.Contains(manifest, "<Extensions>") {
+		t.Errorf("AppxManifest.xml without -schemes declares extensions:\n%s", manifest)
+	}
+}
+
+func TestWindowsVersionInfo(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	bi := &buildInfo{
+		appID:       "org.gioui.example",
+		pkgDir:      dir,
+		product:     "Gio Example",
+		description: "An example of Gio",
+		copyright:   "Copyright 2026 The Gio authors",
+	}
+	b := &windowsBuilder{Coff: coff.NewRSRC()}
+	b.Coff.Arch("amd64")
+	if err := b.embedInfo(windowsResources{
+		VersionHuman: "1.2.3.4",
+		Language:     0x0400,
+		Company:      windowsCompany(bi),
+		Product:      windowsProduct(bi, "example"),
+		Description:  windowsDescription(bi, "example"),
+		Copyright:    bi.copyright,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.buildResource(bi, "example", "amd64"); err != nil {
+		t.Fatal(err)
+	}
+	syso, err := os.ReadFile(filepath.Join(dir, "example_windows_amd64.syso"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		"CompanyName", "gioui.org",
+		"ProductName", "Gio Example",
+		"FileDescription", "An example of Gio",
+		"LegalCopyright", "Copyright 2026 The Gio authors",
+	} {
+		if !bytes.Contains(syso, utf16LE(s)) {
+			t.Errorf("version resource doesn't contain %q", s)
+		}
+	}
+	bi.product, bi.description = "", ""
+	if p, d := windowsProduct(bi, "example"), windowsDescription(bi, "example"); p != "example" || d != "example" {
+		t.Errorf("default product and description are %q and %q, expected the app name", p, d)
+	}
+}
+
+// utf16LE returns the UTF-16LE encoding of s, as stored in resources.
+func utf16LE(s string) []byte {
+	var b bytes.Buffer
+	for _, c := range utf16.Encode([]rune(s)) {
+		b.Write([]byte{byte(c), byte(c >> 8)})
+	}
+	return b.Bytes()
+}
@@ -0,0 +1,53 @@
+// SPDX-License-Identifier: Unlicense OR MIT
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSplitCache(t *testing.T) {
+	const icon = `<svg xmlns="http://www.w3.org/2000/svg"><rect width="%d" height="10"/></svg>`
+	dir := t.TempDir()
+	var files []string
+	for i := 0; i < 2; i++ {
+		file := filepath.Join(dir, fmt.Sprintf("icon%d.svg", i))
+		if err := os.WriteFile(file, []byte(fmt.Sprintf(icon, i+1)), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, file)
+	}
+	defer func(p, o string, s bool) { *pkg, *output, *split = p, o, s }(*pkg, *output, *split)
+	*pkg, *output, *split = "icons", filepath.Join(dir, "svg.go"), true
+	if err := convertAll(files); err != nil {
+		t.Fatal(err)
+	}
+	gen := filepath.Join(dir, "svg_icon0.go")
+	// Mark the generated file to detect whether it is regenerated.
+	src, err := os.ReadFile(gen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(gen, append(src, "// cached\n"...), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := convertAll(files); err != nil {
+		t.Fatal(err)
+	}
+	if src, _ := os.ReadFile(gen); !strings.HasSuffix(string(src), "// cached\n") {
+		t.Error("unchanged SVG file was converted again")
+	}
+	if err := os.WriteFile(files[0], []byte(fmt.Sprintf(icon, 10)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := convertAll(files); err != nil {
+		t.Fatal(err)
+	}
+	if src, _ := os.ReadFile(gen); strings.HasSuffix(string(src), "// cached\n") {
+		t.Error("changed SVG file wasn't converted again")
+	}
+}
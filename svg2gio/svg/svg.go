@@ -0,0 +1,1482 @@
+// SPDX-License-Identifier: Unlicense OR MIT
+
+// Package svg converts SVG images to Go source code that draws them with
+// Gio. Only a limited subset of SVG files are supported.
+package svg
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"gioui.org/f32"
+	"golang.org/x/sync/errgroup"
+)
+
+// A Converter converts SVG images with options. The Convert, ConvertReader
+// and WriteImage functions use the zero Converter.
+type Converter struct {
+	// Scale multiplies the coordinates, sizes and stroke widths of the
+	// images. Zero means 1.
+	Scale float32
+}
+
+// Convert writes a Go source file in package pkg that declares an
+// Image_<name> variable for each SVG file, where name is the file name
+// without extension. The declarations are sorted by name, making the output
+// independent of the order of files.
+func Convert(w io.Writer, pkg string, files []string) error {
+	return new(Converter).Convert(w, pkg, files)
+}
+
+// ConvertReader is like Convert for a single SVG image read from r, declared
+// as the Image_<name> variable. Errors are prefixed with their line and
+// column in r.
+func ConvertReader(w io.Writer, pkg, name string, r io.Reader) error {
+	return new(Converter).ConvertReader(w, pkg, name, r)
+}
+
+// WriteImage writes a Go source file in package pkg that declares the
+// Image_<name> variable for the SVG image read from r. The file depends on
+// the declarations written by WriteHelpers to the same package.
+func WriteImage(w io.Writer, pkg, name string, r io.Reader) error {
+	return new(Converter).WriteImage(w, pkg, name, r)
+}
+
+// Convert is like the Convert function, with the options of c.
+func (c *Converter) Convert(w io.Writer, pkg string, files []string) error {
+	files = append([]string(nil), files...)
+	sort.SliceStable(files, func(i, j int) bool {
+		return imageName(files[i]) < imageName(files[j])
+	})
+	frags, err := convertFiles(files, c.scale())
+	if err != nil {
+		return err
+	}
+	buf := new(bytes.Buffer)
+	writeHeader(buf, pkg, "image/color", "math", "gioui.org/f32", "gioui.org/op", "gioui.org/op/clip", "gioui.org/op/paint")
+	fmt.Fprintf(buf, "var ops op.Ops\n\n")
+	fmt.Fprintf(buf, funcs)
+	for _, frag := range frags {
+		buf.Write(frag)
+	}
+	return writeSource(w, buf.Bytes())
+}
+
+// ConvertReader is like the ConvertReader function, with the options of c.
+func (c *Converter) ConvertReader(w io.Writer, pkg, name string, r io.Reader) error {
+	buf := new(bytes.Buffer)
+	writeHeader(buf, pkg, "image/color", "math", "gioui.org/f32", "gioui.org/op", "gioui.org/op/clip", "gioui.org/op/paint")
+	fmt.Fprintf(buf, "var ops op.Ops\n\n")
+	fmt.Fprintf(buf, funcs)
+	if err := convert(buf, "Image_"+name, r, c.scale()); err != nil {
+		return err
+	}
+	return writeSource(w, buf.Bytes())
+}
+
+// WriteHelpers writes a Go source file in package pkg with the declarations
+// shared by the files written by WriteImage.
+func WriteHelpers(w io.Writer, pkg string) error {
+	buf := new(bytes.Buffer)
+	writeHeader(buf, pkg, "image/color", "math", "gioui.org/f32", "gioui.org/op", "gioui.org/op/clip", "gioui.org/op/paint")
+	fmt.Fprintf(buf, "var ops op.Ops\n\n")
+	fmt.Fprintf(buf, funcs)
+	return writeSource(w, buf.Bytes())
+}
+
+// WriteImage is like the WriteImage function, with the options of c.
+func (c *Converter) WriteImage(w io.Writer, pkg, name string, r io.Reader) error {
+	frag := new(bytes.Buffer)
+	if err := convert(frag, "Image_"+name, r, c.scale()); err != nil {
+		return err
+	}
+	used, err := usedPackages(frag.Bytes())
+	if err != nil {
+		return err
+	}
+	var imports []string
+	for _, path := range []string{"gioui.org/f32", "gioui.org/op", "gioui.org/op/clip", "gioui.org/op/paint"} {
+		if used[path[strings.LastIndex(path, "/")+1:]] {
+			imports = append(imports, path)
+		}
+	}
+	buf := new(bytes.Buffer)
+	writeHeader(buf, pkg, imports...)
+	buf.Write(frag.Bytes())
+	return writeSource(w, buf.Bytes())
+}
+
+// usedPackages returns the names of the packages referenced by the
+// declarations in src, that is the qualifiers of selectors that don't
+// resolve to a declaration in src.
+func usedPackages(src []byte) (map[string]bool, error) {
+	f, err := parser.ParseFile(token.NewFileSet(), "", append([]byte("package p\n"), src...), 0)
+	if err != nil {
+		return nil, err
+	}
+	used := make(map[string]bool)
+	ast.Inspect(f, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if id, ok := sel.X.(*ast.Ident); ok && id.Obj == nil {
+				used[id.Name] = true
+			}
+		}
+		return true
+	})
+	return used, nil
+}
+
+func (c *Converter) scale() float32 {
+	if c.Scale == 0 {
+		return 1
+	}
+	return c.Scale
+}
+
+// WriteRegistry writes the declaration of the Images map from the names of
+// the SVG files without extension to their Image_<name> variables. The
+// declaration is meant to be appended to the output of Convert or
+// WriteHelpers.
+func WriteRegistry(w io.Writer, files []string) error {
+	var names []string
+	for _, filename := range files {
+		names = append(names, strings.TrimPrefix(imageName(filename), "Image_"))
+	}
+	sort.Strings(names)
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "\n// Images maps the names of the images to their variables.\n")
+	fmt.Fprintf(buf, "var Images = map[string]*struct {\n")
+	fmt.Fprintf(buf, "ViewBox struct { Min, Max f32.Point }\n")
+	fmt.Fprintf(buf, "Call op.CallOp\n")
+	fmt.Fprintf(buf, "}{\n")
+	for _, name := range names {
+		fmt.Fprintf(buf, "%q: &Image_%s,\n", name, name)
+	}
+	fmt.Fprintf(buf, "}\n")
+	return writeSource(w, buf.Bytes())
+}
+
+// convertFiles converts the files concurrently and returns their code
+// fragments in the order of files.
+func convertFiles(files []string, scale float32) ([][]byte, error) {
+	frags := make([][]byte, len(files))
+	g, ctx := errgroup.WithContext(context.Background())
+	g.SetLimit(runtime.GOMAXPROCS(0))
+	for i, filename := range files {
+		i, filename := i, filename
+		g.Go(func() error {
+			// Skip the remaining files after the first error.
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			f, err := os.Open(filename)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			w := new(bytes.Buffer)
+			if err := convert(w, imageName(filename), f, scale); err != nil {
+				return fmt.Errorf("%s:%w", filename, err)
+			}
+			frags[i] = w.Bytes()
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	return frags, nil
+}
+
+func writeHeader(w io.Writer, pkg string, imports ...string) {
+	fmt.Fprintf(w, "// Code generated by gioui.org/cmd/svg2gio; DO NOT EDIT.\n\n")
+	fmt.Fprintf(w, "package %s\n\n", pkg)
+	writeImports(w, imports...)
+}
+
+func writeSource(w io.Writer, src []byte) error {
+	src, err := format.Source(src)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(src)
+	return err
+}
+
+type Points []float32
+
+func (p *Points) UnmarshalText(text []byte) error {
+	for {
+		text = bytes.TrimLeft(text, "\t\n")
+		if len(text) == 0 {
+			break
+		}
+		var num []byte
+		end := bytes.IndexAny(text, " ,")
+		if end != -1 {
+			num = text[:end]
+			text = text[end+1:]
+		} else {
+			num = text
+			text = nil
+		}
+		f, err := strconv.ParseFloat(string(num), 32)
+		if err != nil {
+			return err
+		}
+		*p = append(*p, float32(f))
+	}
+	return nil
+}
+
+func (p Points) scale(s float32) {
+	for i := range p {
+		p[i] *= s
+	}
+}
+
+type Transform f32.Affine2D
+
+// scale the translation of t, for scaling the coordinates it transforms
+// and the coordinates of the result.
+func (t *Transform) scale(s float32) {
+	sx, hx, ox, hy, sy, oy := f32.Affine2D(*t).Elems()
+	*t = Transform(f32.NewAffine2D(sx, hx, ox*s, hy, sy, oy*s))
+}
+
+func (t *Transform) UnmarshalText(text []byte) error {
+	switch {
+	case bytes.HasPrefix(text, []byte("matrix(")) && bytes.HasSuffix(text, []byte(")")):
+		trans := text[7 : len(text)-1]
+		var p Points
+		if err := p.UnmarshalText(trans); err != nil {
+			return err
+		}
+		if len(p) != 6 {
+			return fmt.Errorf("malformed transform matrix: %q", text)
+		}
+		*t = Transform(f32.NewAffine2D(p[0], p[2], p[4], p[1], p[3], p[5]))
+		return nil
+	default:
+		return fmt.Errorf("unsupported transform: %q", text)
+	}
+}
+
+type Fill struct {
+	Transform      Transform `xml:"transform,attr"`
+	Fill           Color     `xml:"fill,attr"`
+	Stroke         Color     `xml:"stroke,attr"`
+	StrokeLinejoin string    `xml:"stroke-linejoin,attr"`
+	StrokeLinecap  string    `xml:"stroke-linecap,attr"`
+	StrokeWidth    float32   `xml:"stroke-width,attr"`
+	ClipPath       string    `xml:"clip-path,attr"`
+	VectorEffect   string    `xml:"vector-effect,attr"`
+}
+
+func (f *Fill) scale(s float32) {
+	f.Transform.scale(s)
+	f.StrokeWidth *= s
+}
+
+type Color struct {
+	Set   bool
+	Value int
+	// Ref is the id of the referenced paint server, such as a gradient.
+	Ref string
+}
+
+func (c *Color) UnmarshalText(text []byte) error {
+	if string(text) == "none" {
+		*c = Color{}
+		return nil
+	}
+	if ref, ok := bytes.CutPrefix(text, []byte("url(#")); ok && bytes.HasSuffix(ref, []byte(")")) {
+		*c = Color{
+			Set: true,
+			Ref: string(ref[:len(ref)-1]),
+		}
+		return nil
+	}
+	if !bytes.HasPrefix(text, []byte("#")) {
+		return fmt.Errorf("invalid color: %q", text)
+	}
+	text = text[1:]
+	i, err := strconv.ParseInt(string(text), 16, 32)
+	// Implied alpha.
+	if len(text) == 6 {
+		i |= 0xff000000
+	}
+	*c = Color{
+		Set:   true,
+		Value: int(i),
+	}
+	return err
+}
+
+// writeImports writes an import declaration with the standard library
+// packages grouped before the other packages, each group sorted.
+func writeImports(w io.Writer, paths ...string) {
+	var std, other []string
+	for _, p := range paths {
+		if strings.Contains(strings.SplitN(p, "/", 2)[0], ".") {
+			other = append(other, p)
+		} else {
+			std = append(std, p)
+		}
+	}
+	sort.Strings(std)
+	sort.Strings(other)
+	fmt.Fprintf(w, "import (\n")
+	for _, p := range std {
+		fmt.Fprintf(w, "\t%q\n", p)
+	}
+	if len(std) > 0 && len(other) > 0 {
+		fmt.Fprintf(w, "\n")
+	}
+	for _, p := range other {
+		fmt.Fprintf(w, "\t%q\n", p)
+	}
+	fmt.Fprintf(w, ")\n\n")
+}
+
+// imageName returns the name of the variable generated for the SVG file.
+func imageName(filename string) string {
+	base := filepath.Base(filename)
+	ext := filepath.Ext(base)
+	return "Image_" + base[:len(base)-len(ext)]
+}
+
+// convert writes the declaration of the variable name for the SVG image
+// read from r, with its coordinates multiplied by scale. Errors are
+// prefixed with their line and column in r.
+func convert(w io.Writer, name string, r io.Reader, scale float32) error {
+	d := xml.NewDecoder(r)
+	body := new(bytes.Buffer)
+	var docs []string
+	if err := parse(body, d, name, scale, &docs); err != nil {
+		line, col := d.InputPos()
+		var perr *posError
+		if errors.As(err, &perr) {
+			line, col, err = perr.line, perr.col, perr.err
+		}
+		return fmt.Errorf("%d:%d: %w", line, col, err)
+	}
+	// Document the variable with the title and description of the SVG.
+	for i, doc := range docs {
+		if i > 0 {
+			fmt.Fprintf(w, "//\n")
+		}
+		fmt.Fprintf(w, "// %s\n", doc)
+	}
+	fmt.Fprintf(w, "var %s struct {\n", name)
+	fmt.Fprintf(w, "ViewBox struct { Min, Max f32.Point }\n")
+	fmt.Fprintf(w, "Call op.CallOp\n\n")
+	fmt.Fprintf(w, "}\n")
+	fmt.Fprintf(w, "func init() {\n")
+	w.Write(body.Bytes())
+	fmt.Fprintf(w, "}\n")
+	return nil
+}
+
+// posError is an error at a position in the input, for errors that are
+// detected after the decoder has moved past their position.
+type posError struct {
+	line, col int
+	err       error
+}
+
+func (e *posError) Error() string {
+	return fmt.Sprintf("%d:%d: %v", e.line, e.col, e.err)
+}
+
+func (e *posError) Unwrap() error {
+	return e.err
+}
+
+func parse(w io.Writer, d *xml.Decoder, name string, scale float32, docs *[]string) error {
+	for {
+		line, col := d.InputPos()
+		tok, err := d.Token()
+		if err != nil {
+			if err == io.EOF {
+				return errors.New("unexpected end of file")
+			}
+			return err
+		}
+		switch tok := tok.(type) {
+		case xml.Comment, xml.ProcInst, xml.Directive, xml.CharData:
+			// Skip the XML declaration, DOCTYPE, comments and
+			// whitespace before the root element.
+		case xml.StartElement:
+			if n := tok.Name.Local; n != "svg" {
+				return &posError{line, col, fmt.Errorf("invalid SVG root: <%s>", n)}
+			}
+			if n := tok.Name.Space; n != "http://www.w3.org/2000/svg" {
+				return &posError{line, col, fmt.Errorf("unsupported SVG namespace: %q", n)}
+			}
+			fmt.Fprintf(w, "m := op.Record(&ops)\n")
+			defer fmt.Fprintf(w, "%s.Call = m.Stop()\n", name)
+			for _, a := range tok.Attr {
+				if a.Name.Local == "viewBox" {
+					p, err := parseViewBox(a.Value)
+					if err != nil {
+						return err
+					}
+					p.scale(scale)
+					fmt.Fprintf(w, "%s.ViewBox.Min = %s\n", name, point(f32.Pt(p[0], p[1])))
+					fmt.Fprintf(w, "%s.ViewBox.Max = %s\n", name, point(f32.Pt(p[2], p[3])))
+				}
+			}
+			defs := &definitions{
+				symbols:   make(map[string]symbol),
+				clipPaths: make(map[string][]byte),
+				gradients: make(map[string]*RadialGradient),
+				scale:     scale,
+			}
+			// The scale is treated as a transformation, except that it
+			// is baked into the coordinates.
+			return parseSVG(w, d, defs, scale, docs)
+		}
+	}
+}
+
+func parseViewBox(v string) (Points, error) {
+	var p Points
+	if err := p.UnmarshalText([]byte(v)); err != nil || len(p) != 4 {
+		return nil, fmt.Errorf("invalid viewBox attribute: %s", v)
+	}
+	return p, nil
+}
+
+// definitions holds the elements referenced by other elements.
+type definitions struct {
+	symbols map[string]symbol
+	// clipPaths maps the ids of <clipPath> elements to the path commands
+	// of their content.
+	clipPaths map[string][]byte
+	gradients map[string]*RadialGradient
+	// scale multiplies the coordinates of the elements.
+	scale float32
+}
+
+// symbol is a recorded <symbol> element. Its content is converted for each
+// <use> element, because the conversion depends on the transformation of
+// the <use> element.
+type symbol struct {
+	// viewBox is nil if the symbol doesn't specify one.
+	viewBox Points
+	// tokens of the element, including its start and end elements.
+	tokens []xml.Token
+}
+
+// tokenReplay replays recorded XML tokens.
+type tokenReplay []xml.Token
+
+func (r *tokenReplay) Token() (xml.Token, error) {
+	if len(*r) == 0 {
+		return nil, io.EOF
+	}
+	tok := (*r)[0]
+	*r = (*r)[1:]
+	return tok, nil
+}
+
+// decoder returns a decoder positioned after the start element of the
+// symbol.
+func (s symbol) decoder() *xml.Decoder {
+	r := tokenReplay(s.tokens)
+	d := xml.NewTokenDecoder(&r)
+	d.Token()
+	return d
+}
+
+// parseSymbol records a <symbol> element for <use> elements. Nested symbols
+// are recorded separately.
+func parseSymbol(d *xml.Decoder, start xml.StartElement, defs *definitions) error {
+	var id string
+	var sym symbol
+	for _, a := range start.Attr {
+		switch a.Name.Local {
+		case "id":
+			id = a.Value
+		case "viewBox":
+			p, err := parseViewBox(a.Value)
+			if err != nil {
+				return err
+			}
+			p.scale(defs.scale)
+			sym.viewBox = p
+		}
+	}
+	sym.tokens = append(sym.tokens, start.Copy())
+	for depth := 0; depth >= 0; {
+		tok, err := d.Token()
+		if err != nil {
+			if err == io.EOF {
+				return errors.New("unexpected end of <symbol> element")
+			}
+			return err
+		}
+		switch tok.(type) {
+		case xml.StartElement:
+			depth++
+		case xml.EndElement:
+			depth--
+		}
+		sym.tokens = append(sym.tokens, xml.CopyToken(tok))
+	}
+	// Convert the content to report errors and record nested symbols.
+	if err := parseSVG(io.Discard, sym.decoder(), defs, defs.scale, nil); err != nil {
+		return err
+	}
+	if id != "" {
+		defs.symbols[id] = sym
+	}
+	return nil
+}
+
+type Use struct {
+	Href   string  `xml:"href,attr"`
+	X      float32 `xml:"x,attr"`
+	Y      float32 `xml:"y,attr"`
+	Width  float32 `xml:"width,attr"`
+	Height float32 `xml:"height,attr"`
+	Fill
+}
+
+func (u *Use) scale(s float32) {
+	u.X *= s
+	u.Y *= s
+	u.Width *= s
+	u.Height *= s
+	u.Fill.scale(s)
+}
+
+// Emit writes the content of the referenced symbol, mapped from the
+// symbol's viewBox to the area of the <use> element. The scale is the
+// scale of the transformations around the <use> element.
+func (u *Use) Emit(w io.Writer, defs *definitions, scale float32) error {
+	id, ok := strings.CutPrefix(u.Href, "#")
+	sym, found := defs.symbols[id]
+	if !ok || !found {
+		return fmt.Errorf("unsupported <use> reference: %q", u.Href)
+	}
+	var trans f32.Affine2D
+	if vb := sym.viewBox; vb != nil && vb[2] > 0 && vb[3] > 0 {
+		width, height := u.Width, u.Height
+		if width == 0 {
+			width = vb[2]
+		}
+		if height == 0 {
+			height = vb[3]
+		}
+		// Scale uniformly and center, as for the default
+		// preserveAspectRatio of xMidYMid meet.
+		s := min(width/vb[2], height/vb[3])
+		trans = trans.Offset(f32.Pt(-vb[0], -vb[1])).
+			Scale(f32.Point{}, f32.Pt(s, s)).
+			Offset(f32.Pt((width-vb[2]*s)/2, (height-vb[3]*s)/2))
+	}
+	trans = f32.Affine2D(u.Transform).Mul(trans.Offset(f32.Pt(u.X, u.Y)))
+	fmt.Fprintf(w, "{\n")
+	pushed := pushTransform(w, trans)
+	if err := parseSVG(w, sym.decoder(), defs, scale*scaleOf(trans), nil); err != nil {
+		return err
+	}
+	if pushed {
+		fmt.Fprintf(w, "t.Pop()\n")
+	}
+	fmt.Fprintf(w, "}\n")
+	return nil
+}
+
+// pushTransform writes the code that pushes trans as t, unless trans is
+// the identity. It reports whether the code was written.
+func pushTransform(w io.Writer, trans f32.Affine2D) bool {
+	if trans == (f32.Affine2D{}) {
+		return false
+	}
+	sx, hx, ox, hy, sy, oy := trans.Elems()
+	fmt.Fprintf(w, "t := op.Affine(f32.NewAffine2D(%g, %g, %g, %g, %g, %g)).Push(&ops)\n", sx, hx, ox, hy, sy, oy)
+	return true
+}
+
+// scaleOf returns the factor by which trans scales lengths.
+func scaleOf(trans f32.Affine2D) float32 {
+	sx, hx, _, hy, sy, _ := trans.Elems()
+	return float32(math.Sqrt(math.Abs(float64(sx*sy - hx*hy))))
+}
+
+func point(p f32.Point) string {
+	return fmt.Sprintf("f32.Pt(%g, %g)", p.X, p.Y)
+}
+
+type Poly struct {
+	XMLName xml.Name
+	Points  Points `xml:"points,attr"`
+	Fill
+
+	// close closes the path of a polyline, for filling it.
+	close bool
+}
+
+func (p *Poly) Path(w io.Writer) error {
+	if len(p.Points) <= 1 {
+		return nil
+	}
+	pen := f32.Pt(p.Points[0], p.Points[1])
+	fmt.Fprintf(w, "p.MoveTo(%s)\n", point(pen))
+	last := pen
+	for i := 2; i < len(p.Points); i += 2 {
+		last = f32.Pt(p.Points[i], p.Points[i+1])
+		fmt.Fprintf(w, "p.LineTo(%s)\n", point(last))
+	}
+	if (p.XMLName.Local == "polygon" || p.close) && last != pen {
+		fmt.Fprintf(w, "p.LineTo(%s)\n", point(pen))
+	}
+	return nil
+}
+
+func (p *Poly) scale(s float32) {
+	p.Points.scale(s)
+	p.Fill.scale(s)
+}
+
+func (p *Poly) Bounds() rectangle {
+	var b bounds
+	for i := 0; i+1 < len(p.Points); i += 2 {
+		b.add(f32.Pt(p.Points[i], p.Points[i+1]))
+	}
+	return b.r
+}
+
+type Path struct {
+	D string `xml:"d,attr"`
+	Fill
+
+	// factor multiplies the coordinates of D, if not zero.
+	factor float32
+}
+
+func (p *Path) Path(w io.Writer) error {
+	return printPathCommands(w, p.D, p.factor)
+}
+
+func (p *Path) scale(s float32) {
+	p.factor = s
+	p.Fill.scale(s)
+}
+
+// Bounds returns the bounds of the points of the path, including the
+// control points of curves.
+func (p *Path) Bounds() rectangle {
+	var b bounds
+	cubeTo := func(p0, p1, p2 f32.Point) {
+		b.add(p0)
+		b.add(p1)
+		b.add(p2)
+	}
+	// Errors are reported by Path.
+	walkPathCommands(p.D, p.factor, b.add, b.add, cubeTo)
+	return b.r
+}
+
+type Line struct {
+	X1 float32 `xml:"x1,attr"`
+	Y1 float32 `xml:"y1,attr"`
+	X2 float32 `xml:"x2,attr"`
+	Y2 float32 `xml:"y2,attr"`
+	Fill
+}
+
+func (l *Line) Path(w io.Writer) error {
+	fmt.Fprintf(w, "p.MoveTo(%s)\n", point(f32.Pt(l.X1, l.Y1)))
+	fmt.Fprintf(w, "p.LineTo(%s)\n", point(f32.Pt(l.X2, l.Y2)))
+	return nil
+}
+
+func (l *Line) scale(s float32) {
+	l.X1 *= s
+	l.Y1 *= s
+	l.X2 *= s
+	l.Y2 *= s
+	l.Fill.scale(s)
+}
+
+func (l *Line) Bounds() rectangle {
+	var b bounds
+	b.add(f32.Pt(l.X1, l.Y1))
+	b.add(f32.Pt(l.X2, l.Y2))
+	return b.r
+}
+
+type Ellipse struct {
+	Cx float32 `xml:"cx,attr"`
+	Cy float32 `xml:"cy,attr"`
+	Rx float32 `xml:"rx,attr"`
+	Ry float32 `xml:"ry,attr"`
+	Fill
+}
+
+func (e *Ellipse) Path(w io.Writer) error {
+	c := f32.Pt(e.Cx, e.Cy)
+	r := f32.Pt(e.Rx, e.Ry)
+	fmt.Fprintf(w, "ellipse(&p, %s, %s)\n", point(c), point(r))
+	return nil
+}
+
+func (e *Ellipse) scale(s float32) {
+	e.Cx *= s
+	e.Cy *= s
+	e.Rx *= s
+	e.Ry *= s
+	e.Fill.scale(s)
+}
+
+func (e *Ellipse) Bounds() rectangle {
+	c := f32.Pt(e.Cx, e.Cy)
+	r := f32.Pt(e.Rx, e.Ry)
+	return rectangle{Min: c.Sub(r), Max: c.Add(r)}
+}
+
+type Rect struct {
+	X      float32 `xml:"x,attr"`
+	Y      float32 `xml:"y,attr"`
+	Width  float32 `xml:"width,attr"`
+	Height float32 `xml:"height,attr"`
+	Fill
+}
+
+func (r *Rect) Path(w io.Writer) error {
+	o := f32.Pt(r.X, r.Y)
+	sz := f32.Pt(r.Width, r.Height)
+	fmt.Fprintf(w, "rect(&p, %s, %s)\n", point(o), point(sz))
+	return nil
+}
+
+func (r *Rect) scale(s float32) {
+	r.X *= s
+	r.Y *= s
+	r.Width *= s
+	r.Height *= s
+	r.Fill.scale(s)
+}
+
+func (r *Rect) Bounds() rectangle {
+	o := f32.Pt(r.X, r.Y)
+	return rectangle{Min: o, Max: o.Add(f32.Pt(r.Width, r.Height))}
+}
+
+type Circle struct {
+	Cx float32 `xml:"cx,attr"`
+	Cy float32 `xml:"cy,attr"`
+	R  float32 `xml:"r,attr"`
+	Fill
+}
+
+func (c *Circle) Path(w io.Writer) error {
+	center := f32.Pt(c.Cx, c.Cy)
+	r := f32.Pt(c.R, c.R)
+	fmt.Fprintf(w, "ellipse(&p, %s, %s)\n", point(center), point(r))
+	return nil
+}
+
+func (c *Circle) scale(s float32) {
+	c.Cx *= s
+	c.Cy *= s
+	c.R *= s
+	c.Fill.scale(s)
+}
+
+func (c *Circle) Bounds() rectangle {
+	center := f32.Pt(c.Cx, c.Cy)
+	r := f32.Pt(c.R, c.R)
+	return rectangle{Min: center.Sub(r), Max: center.Add(r)}
+}
+
+type rectangle struct {
+	Min, Max f32.Point
+}
+
+// bounds accumulates the bounding rectangle of points.
+type bounds struct {
+	r   rectangle
+	set bool
+}
+
+func (b *bounds) add(p f32.Point) {
+	if !b.set {
+		b.r = rectangle{Min: p, Max: p}
+		b.set = true
+		return
+	}
+	b.r.Min = f32.Pt(min(b.r.Min.X, p.X), min(b.r.Min.Y, p.Y))
+	b.r.Max = f32.Pt(max(b.r.Max.X, p.X), max(b.r.Max.Y, p.Y))
+}
+
+// parseSVG converts the content of an element. The scale is the scale of
+// the transformations around the element. If docs is not nil, the text of
+// <title> and <desc> elements is appended to it.
+func parseSVG(w io.Writer, d *xml.Decoder, defs *definitions, scale float32, docs *[]string) error {
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			if err == io.EOF {
+				return errors.New("unexpected end of <svg> element")
+			}
+			return err
+		}
+		var start xml.StartElement
+		switch tok := tok.(type) {
+		case xml.EndElement:
+			return nil
+		case xml.StartElement:
+			start = tok
+		default:
+			continue
+		}
+		switch n := start.Name.Local; n {
+		case "g":
+			// Flatten groups, except for their transformation and
+			// clip path.
+			var trans Transform
+			var clipRef string
+			for _, a := range start.Attr {
+				switch a.Name.Local {
+				case "transform":
+					if err := trans.UnmarshalText([]byte(a.Value)); err != nil {
+						return err
+					}
+					trans.scale(defs.scale)
+				case "clip-path":
+					clipRef = a.Value
+				}
+			}
+			block := trans != (Transform{}) || clipRef != ""
+			if block {
+				fmt.Fprintf(w, "{\n")
+			}
+			pushed := pushTransform(w, f32.Affine2D(trans))
+			if clipRef != "" {
+				fmt.Fprintf(w, "var p clip.Path\n")
+				if err := defs.writeClip(w, clipRef); err != nil {
+					return err
+				}
+			}
+			if err := parseSVG(w, d, defs, scale*scaleOf(f32.Affine2D(trans)), nil); err != nil {
+				return err
+			}
+			if clipRef != "" {
+				fmt.Fprintf(w, "c.Pop()\n")
+			}
+			if pushed {
+				fmt.Fprintf(w, "t.Pop()\n")
+			}
+			if block {
+				fmt.Fprintf(w, "}\n")
+			}
+			continue
+		case "defs":
+			// Definitions are only drawn through references.
+			if err := parseSVG(io.Discard, d, defs, scale, nil); err != nil {
+				return err
+			}
+			continue
+		case "symbol":
+			if err := parseSymbol(d, start, defs); err != nil {
+				return err
+			}
+			continue
+		case "clipPath":
+			if err := parseClipPath(d, start, defs); err != nil {
+				return err
+			}
+			continue
+		case "radialGradient":
+			g := new(RadialGradient)
+			if err := d.DecodeElement(g, &start); err != nil {
+				return err
+			}
+			if err := g.validate(); err != nil {
+				return err
+			}
+			g.scale(defs.scale)
+			if g.ID != "" {
+				defs.gradients[g.ID] = g
+			}
+			continue
+		case "use":
+			u := new(Use)
+			if err := d.DecodeElement(u, &start); err != nil {
+				return err
+			}
+			u.scale(defs.scale)
+			if err := u.Emit(w, defs, scale); err != nil {
+				return err
+			}
+			continue
+		case "title", "desc":
+			if docs == nil {
+				d.Skip()
+				continue
+			}
+			var text struct {
+				Text string `xml:",chardata"`
+			}
+			if err := d.DecodeElement(&text, &start); err != nil {
+				return err
+			}
+			if doc := strings.Join(strings.Fields(text.Text), " "); doc != "" {
+				*docs = append(*docs, doc)
+			}
+			continue
+		}
+		elem, fill := newShape(start.Name.Local)
+		if elem == nil {
+			return fmt.Errorf("unsupported tag: <%s>", start.Name.Local)
+		}
+		if err := d.DecodeElement(elem, &start); err != nil {
+			return err
+		}
+		elem.scale(defs.scale)
+		if !fill.Fill.Set && !fill.Stroke.Set {
+			continue
+		}
+		fmt.Fprintf(w, "{\n")
+		trans := f32.Affine2D(fill.Transform)
+		pushed := pushTransform(w, trans)
+		// A filled polyline is closed for filling, but its stroke stays
+		// open.
+		fillElem := elem
+		if p, ok := elem.(*Poly); ok && p.XMLName.Local == "polyline" && fill.Fill.Set {
+			closed := *p
+			closed.close = true
+			fillElem = &closed
+		}
+		fmt.Fprintf(w, "var p clip.Path\n")
+		if fill.ClipPath != "" {
+			if err := defs.writeClip(w, fill.ClipPath); err != nil {
+				return err
+			}
+		}
+		fmt.Fprintf(w, "p.Begin(&ops)\n")
+		if err := fillElem.Path(w); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "spec := p.End()\n")
+		if ref := fill.Fill.Ref; ref != "" {
+			g, ok := defs.gradients[ref]
+			if !ok {
+				return fmt.Errorf("unsupported fill reference: %q", ref)
+			}
+			fmt.Fprintf(w, "g := clip.Outline{Path: spec}.Op().Push(&ops)\n")
+			g.emit(w, elem.Bounds())
+			fmt.Fprintf(w, "g.Pop()\n")
+		} else if fill.Fill.Set {
+			fmt.Fprintf(w, "paint.FillShape(&ops, argb(%#.8x), clip.Outline{Path: spec}.Op())\n", fill.Fill.Value)
+		}
+		if fillElem != elem && fill.Stroke.Set {
+			fmt.Fprintf(w, "p.Begin(&ops)\n")
+			if err := elem.Path(w); err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "spec = p.End()\n")
+		}
+		if fill.Stroke.Ref != "" {
+			return fmt.Errorf("unsupported stroke reference: %q", fill.Stroke.Ref)
+		}
+		if fill.Stroke.Set {
+			width := fill.StrokeWidth
+			if s := scale * scaleOf(trans); fill.VectorEffect == "non-scaling-stroke" && s != 0 {
+				// Undo the scaling of the transformations.
+				width /= s
+			}
+			fmt.Fprintf(w, "paint.FillShape(&ops, argb(%#.8x), clip.Stroke{Width: %g, Path: spec}.Op())\n", fill.Stroke.Value, width)
+		}
+		if fill.ClipPath != "" {
+			fmt.Fprintf(w, "c.Pop()\n")
+		}
+		if pushed {
+			fmt.Fprintf(w, "t.Pop()\n")
+		}
+		fmt.Fprintf(w, "}\n")
+	}
+}
+
+// RadialGradient is a <radialGradient> element.
+type RadialGradient struct {
+	ID                string    `xml:"id,attr"`
+	Cx                Length    `xml:"cx,attr"`
+	Cy                Length    `xml:"cy,attr"`
+	R                 Length    `xml:"r,attr"`
+	Fx                Length    `xml:"fx,attr"`
+	Fy                Length    `xml:"fy,attr"`
+	GradientUnits     string    `xml:"gradientUnits,attr"`
+	GradientTransform Transform `xml:"gradientTransform,attr"`
+	Stops             []Stop    `xml:"stop"`
+}
+
+type Stop struct {
+	Offset      Length   `xml:"offset,attr"`
+	StopColor   Color    `xml:"stop-color,attr"`
+	StopOpacity *float32 `xml:"stop-opacity,attr"`
+}
+
+// Length is a number or a percentage.
+type Length struct {
+	Set   bool
+	Value float32
+	// Percent is set if Value is a fraction from a percentage.
+	Percent bool
+}
+
+func (l *Length) UnmarshalText(text []byte) error {
+	num, percent := bytes.CutSuffix(bytes.TrimSpace(text), []byte("%"))
+	f, err := strconv.ParseFloat(string(num), 32)
+	if err != nil {
+		return fmt.Errorf("invalid length: %q", text)
+	}
+	if percent {
+		f /= 100
+	}
+	*l = Length{Set: true, Value: float32(f), Percent: percent}
+	return nil
+}
+
+func (g *RadialGradient) validate() error {
+	switch g.GradientUnits {
+	case "", "objectBoundingBox":
+		half := Length{Set: true, Value: .5}
+		for _, l := range []*Length{&g.Cx, &g.Cy, &g.R} {
+			if !l.Set {
+				*l = half
+			}
+		}
+	case "userSpaceOnUse":
+		for _, l := range []Length{g.Cx, g.Cy, g.R, g.Fx, g.Fy} {
+			if l.Percent {
+				return errors.New("unsupported percentage in <radialGradient> with userSpaceOnUse units")
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported gradientUnits: %s", g.GradientUnits)
+	}
+	if g.GradientTransform != (Transform{}) {
+		return errors.New("unsupported gradientTransform")
+	}
+	if len(g.Stops) == 0 {
+		return errors.New("<radialGradient> without stops")
+	}
+	if !g.Fx.Set {
+		g.Fx = g.Cx
+	}
+	if !g.Fy.Set {
+		g.Fy = g.Cy
+	}
+	return nil
+}
+
+// scale the coordinates of a gradient in user space.
+func (g *RadialGradient) scale(s float32) {
+	if g.GradientUnits != "userSpaceOnUse" {
+		return
+	}
+	for _, l := range []*Length{&g.Cx, &g.Cy, &g.R, &g.Fx, &g.Fy} {
+		l.Value *= s
+	}
+}
+
+// emit writes the code that paints the gradient for a shape with the
+// bounds. The gradient is approximated by the radialGradient function,
+// and only the first and last stops are used.
+func (g *RadialGradient) emit(w io.Writer, bounds rectangle) {
+	center := f32.Pt(g.Cx.Value, g.Cy.Value)
+	focus := f32.Pt(g.Fx.Value, g.Fy.Value)
+	radius := f32.Pt(g.R.Value, g.R.Value)
+	if g.GradientUnits != "userSpaceOnUse" {
+		// Map the unit square to the bounds.
+		size := bounds.Max.Sub(bounds.Min)
+		toBounds := func(p f32.Point) f32.Point {
+			return bounds.Min.Add(f32.Pt(p.X*size.X, p.Y*size.Y))
+		}
+		center, focus = toBounds(center), toBounds(focus)
+		radius = f32.Pt(radius.X*size.X, radius.Y*size.Y)
+	}
+	first, last := g.Stops[0], g.Stops[len(g.Stops)-1]
+	fmt.Fprintf(w, "radialGradient(%s, %s, %s, %#.8x, %#.8x, %g, %g)\n",
+		point(center), point(focus), point(radius), first.argb(), last.argb(), first.Offset.Value, last.Offset.Value)
+}
+
+func (s Stop) argb() uint32 {
+	c := uint32(s.StopColor.Value)
+	if !s.StopColor.Set {
+		// Stops are black by default.
+		c = 0xff000000
+	}
+	if o := s.StopOpacity; o != nil {
+		a := float32(c>>24) * max(0, min(1, *o))
+		c = c&0xffffff | uint32(a+.5)<<24
+	}
+	return c
+}
+
+// shape is an SVG element that describes a path.
+type shape interface {
+	Path(w io.Writer) error
+	// Bounds returns a rectangle that contains the shape.
+	Bounds() rectangle
+	// scale multiplies the coordinates and sizes of the shape.
+	scale(s float32)
+}
+
+// newShape returns the shape for the element name and its fill, or nil if
+// the element isn't a supported shape.
+func newShape(name string) (shape, *Fill) {
+	switch name {
+	case "polygon", "polyline":
+		p := new(Poly)
+		return p, &p.Fill
+	case "path":
+		p := new(Path)
+		return p, &p.Fill
+	case "line":
+		l := new(Line)
+		return l, &l.Fill
+	case "ellipse":
+		e := new(Ellipse)
+		return e, &e.Fill
+	case "rect":
+		r := new(Rect)
+		return r, &r.Fill
+	case "circle":
+		c := new(Circle)
+		return c, &c.Fill
+	default:
+		return nil, nil
+	}
+}
+
+// parseClipPath records the path commands of the shapes of a <clipPath>
+// element for the elements that reference it.
+func parseClipPath(d *xml.Decoder, start xml.StartElement, defs *definitions) error {
+	var id string
+	for _, a := range start.Attr {
+		switch a.Name.Local {
+		case "id":
+			id = a.Value
+		case "clipPathUnits":
+			if a.Value != "userSpaceOnUse" {
+				return fmt.Errorf("unsupported clipPathUnits: %s", a.Value)
+			}
+		}
+	}
+	code := new(bytes.Buffer)
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			if err == io.EOF {
+				return errors.New("unexpected end of <clipPath> element")
+			}
+			return err
+		}
+		var start xml.StartElement
+		switch tok := tok.(type) {
+		case xml.EndElement:
+			if id != "" {
+				defs.clipPaths[id] = code.Bytes()
+			}
+			return nil
+		case xml.StartElement:
+			start = tok
+		default:
+			continue
+		}
+		elem, fill := newShape(start.Name.Local)
+		if elem == nil {
+			return fmt.Errorf("unsupported tag in <clipPath>: <%s>", start.Name.Local)
+		}
+		if err := d.DecodeElement(elem, &start); err != nil {
+			return err
+		}
+		elem.scale(defs.scale)
+		if fill.Transform != (Transform{}) {
+			return errors.New("unsupported transform in <clipPath>")
+		}
+		if err := elem.Path(code); err != nil {
+			return err
+		}
+	}
+}
+
+// writeClip writes the code that pushes the clip path referenced by the
+// clip-path attribute value ref as c, building it with the clip.Path p.
+func (defs *definitions) writeClip(w io.Writer, ref string) error {
+	id, ok := strings.CutPrefix(ref, "url(#")
+	id, ok2 := strings.CutSuffix(id, ")")
+	code, found := defs.clipPaths[id]
+	if !ok || !ok2 || !found {
+		return fmt.Errorf("unsupported clip-path reference: %q", ref)
+	}
+	fmt.Fprintf(w, "p.Begin(&ops)\n")
+	w.Write(code)
+	fmt.Fprintf(w, "c := clip.Outline{Path: p.End()}.Op().Push(&ops)\n")
+	return nil
+}
+
+func printPathCommands(w io.Writer, cmds string, scale float32) error {
+	moveTo := func(p f32.Point) {
+		fmt.Fprintf(w, "p.MoveTo(%s)\n", point(p))
+	}
+	lineTo := func(p f32.Point) {
+		fmt.Fprintf(w, "p.LineTo(%s)\n", point(p))
+	}
+	cubeTo := func(p0, p1, p2 f32.Point) {
+		fmt.Fprintf(w, "p.CubeTo(%s, %s, %s)\n", point(p0), point(p1), point(p2))
+	}
+	return walkPathCommands(cmds, scale, moveTo, lineTo, cubeTo)
+}
+
+// WalkPath calls moveTo, lineTo and cubeTo for the absolute segments of the
+// <path> data d. Closing a subpath is reported as a line to its start point.
+// Commands outside the supported subset, such as arcs, result in an error.
+func WalkPath(d string, moveTo, lineTo func(p f32.Point), cubeTo func(p0, p1, p2 f32.Point)) error {
+	return walkPathCommands(d, 1, moveTo, lineTo, cubeTo)
+}
+
+// walkPathCommands calls moveTo, lineTo and cubeTo for the absolute
+// segments of the <path> data cmds, with the coordinates multiplied by
+// scale if it is not zero.
+func walkPathCommands(cmds string, scale float32, moveTo, lineTo func(p f32.Point), cubeTo func(p0, p1, p2 f32.Point)) error {
+	if scale != 0 && scale != 1 {
+		move, line, cube := moveTo, lineTo, cubeTo
+		moveTo = func(p f32.Point) { move(p.Mul(scale)) }
+		lineTo = func(p f32.Point) { line(p.Mul(scale)) }
+		cubeTo = func(p0, p1, p2 f32.Point) { cube(p0.Mul(scale), p1.Mul(scale), p2.Mul(scale)) }
+	}
+	cmds = strings.TrimSpace(cmds)
+	var pen f32.Point
+	initPoint := pen
+	ctrl2 := pen
+	for {
+		cmds = strings.TrimLeft(cmds, " ,\t\n")
+		if len(cmds) == 0 {
+			break
+		}
+		orig := cmds
+		op := rune(cmds[0])
+		cmds = cmds[1:]
+		switch op {
+		case 'M', 'm', 'V', 'v', 'L', 'l', 'H', 'h', 'C', 'c', 'S', 's':
+		case 'Z', 'z':
+			if pen != initPoint {
+				lineTo(initPoint)
+				pen = initPoint
+			}
+			ctrl2 = initPoint
+			continue
+		default:
+			return fmt.Errorf("unknown <path> command %s in %q", string(op), orig)
+		}
+		var coords []float64
+		for {
+			cmds = strings.TrimLeft(cmds, " ,\t\n")
+			if len(cmds) == 0 {
+				break
+			}
+			n, x, ok := parseFloat(cmds)
+			if !ok {
+				break
+			}
+			cmds = cmds[n:]
+			coords = append(coords, x)
+		}
+		rel := unicode.IsLower(op)
+		newPen := pen
+		switch unicode.ToLower(op) {
+		case 'h':
+			for _, x := range coords {
+				p := f32.Pt(float32(x), pen.Y)
+				if rel {
+					p.X += pen.X
+				}
+				lineTo(p)
+				newPen = p
+			}
+			pen = newPen
+			ctrl2 = newPen
+			continue
+		case 'v':
+			for _, y := range coords {
+				p := f32.Pt(pen.X, float32(y))
+				if rel {
+					p.Y += pen.Y
+				}
+				lineTo(p)
+				newPen = p
+			}
+			pen = newPen
+			ctrl2 = newPen
+			continue
+		}
+		if len(coords)%2 != 0 {
+			return fmt.Errorf("odd number of coordinates in <path> data: %q", orig)
+		}
+		var off f32.Point
+		if rel {
+			// Relative command.
+			off = pen
+		} else {
+			off = f32.Pt(0, 0)
+		}
+		var points []f32.Point
+		for i := 0; i < len(coords); i += 2 {
+			p := f32.Pt(float32(coords[i]), float32(coords[i+1]))
+			p = p.Add(off)
+			points = append(points, p)
+		}
+		newCtrl2 := ctrl2
+		switch op := unicode.ToLower(op); op {
+		case 'm', 'l':
+			sop := moveTo
+			if op == 'l' {
+				sop = lineTo
+			}
+			for _, p := range points {
+				sop(p)
+				newPen = p
+			}
+			if op == 'm' {
+				initPoint = newPen
+			}
+		case 'c':
+			for i := 0; i < len(points); i += 3 {
+				p1, p2, p3 := points[i], points[i+1], points[i+2]
+				cubeTo(p1, p2, p3)
+				newPen = p3
+				newCtrl2 = p2
+			}
+		case 's':
+			for i := 0; i < len(points); i += 2 {
+				p2, p3 := points[i], points[i+1]
+				// Compute p1 by reflecting p2 on to the line that contains pen and p2.
+				p1 := pen.Mul(2).Sub(ctrl2)
+				cubeTo(p1, p2, p3)
+				newPen = p3
+				newCtrl2 = p2
+			}
+		}
+		pen = newPen
+		ctrl2 = newCtrl2
+	}
+	return nil
+}
+
+func parseFloat(s string) (int, float64, bool) {
+	n := 0
+	if len(s) > 0 && s[0] == '-' {
+		n++
+	}
+	for ; n < len(s); n++ {
+		if !(unicode.IsDigit(rune(s[n])) || s[n] == '.') {
+			break
+		}
+	}
+	f, err := strconv.ParseFloat(s[:n], 64)
+	return n, f, err == nil
+}
+
+const funcs = `
+func argb(c uint32) color.NRGBA {
+	return color.NRGBA{A: uint8(c >> 24), R: uint8(c >> 16), G: uint8(c >> 8), B: uint8(c)}
+}
+
+func rect(p *clip.Path, origin, size f32.Point) {
+	p.MoveTo(origin)
+	p.LineTo(origin.Add(f32.Pt(size.X, 0)))
+	p.LineTo(origin.Add(size))
+	p.LineTo(origin.Add(f32.Pt(0, size.Y)))
+	p.Close()
+}
+
+func ellipse(p *clip.Path, center, radius f32.Point) {
+	r := radius.X
+	// We'll model the ellipse as a circle scaled in the Y
+	// direction.
+	scale := radius.Y / r
+
+	// https://pomax.github.io/bezierinfo/#circles_cubic.
+	const q = 4 * (math.Sqrt2 - 1) / 3
+
+	curve := r * q
+	top := f32.Point{X: center.X, Y: center.Y - r*scale}
+
+	p.MoveTo(top)
+	p.CubeTo(
+		f32.Point{X: center.X + curve, Y: center.Y - r*scale},
+		f32.Point{X: center.X + r, Y: center.Y - curve*scale},
+		f32.Point{X: center.X + r, Y: center.Y},
+	)
+	p.CubeTo(
+		f32.Point{X: center.X + r, Y: center.Y + curve*scale},
+		f32.Point{X: center.X + curve, Y: center.Y + r*scale},
+		f32.Point{X: center.X, Y: center.Y + r*scale},
+	)
+	p.CubeTo(
+		f32.Point{X: center.X - curve, Y: center.Y + r*scale},
+		f32.Point{X: center.X - r, Y: center.Y + curve*scale},
+		f32.Point{X: center.X - r, Y: center.Y},
+	)
+	p.CubeTo(
+		f32.Point{X: center.X - r, Y: center.Y - curve*scale},
+		f32.Point{X: center.X - curve, Y: center.Y - r*scale},
+		top,
+	)
+}
+
+// radialGradient approximates a radial gradient in the current clip area
+// with bands of ellipses. The ellipse of offset t has the center
+// focus + (center - focus)*t and radius radius*t, and its color is
+// interpolated between from at offset start and to at offset end.
+func radialGradient(center, focus, radius f32.Point, from, to uint32, start, end float32) {
+	const bands = 32
+	c0, c1 := argb(from), argb(to)
+	lerp := func(a, b uint8, t float32) uint8 {
+		return uint8(float32(a) + (float32(b)-float32(a))*t + .5)
+	}
+	paint.Fill(&ops, c1)
+	for i := bands; i > 0; i-- {
+		t := float32(i) / bands
+		var p clip.Path
+		p.Begin(&ops)
+		ellipse(&p, focus.Add(center.Sub(focus).Mul(t)), radius.Mul(t))
+		u := float32(0)
+		if end > start {
+			u = (t - .5/bands - start) / (end - start)
+		}
+		u = float32(math.Max(0, math.Min(1, float64(u))))
+		c := color.NRGBA{
+			R: lerp(c0.R, c1.R, u),
+			G: lerp(c0.G, c1.G, u),
+			B: lerp(c0.B, c1.B, u),
+			A: lerp(c0.A, c1.A, u),
+		}
+		paint.FillShape(&ops, c, clip.Outline{Path: p.End()}.Op())
+	}
+}
+`
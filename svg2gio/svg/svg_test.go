@@ -0,0 +1,432 @@
+// SPDX-License-Identifier: Unlicense OR MIT
+
+package svg
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testSVG = `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 24 24">
+	<path fill="#ff0000" d="M 2 2 L 22 2 L 12 20 Z"/>
+	<circle stroke="#0000ff" stroke-width="2" cx="12" cy="12" r="%d"/>
+</svg>`
+
+// writeTestSVGs writes n SVG files to dir and returns their paths.
+func writeTestSVGs(tb testing.TB, dir string, n int) []string {
+	tb.Helper()
+	var files []string
+	for i := 0; i < n; i++ {
+		file := filepath.Join(dir, fmt.Sprintf("icon%d.svg", i))
+		if err := os.WriteFile(file, []byte(fmt.Sprintf(testSVG, i+1)), 0o644); err != nil {
+			tb.Fatal(err)
+		}
+		files = append(files, file)
+	}
+	return files
+}
+
+func TestConvertOrder(t *testing.T) {
+	files := writeTestSVGs(t, t.TempDir(), 20)
+	// Reverse the files to ensure the order doesn't follow the names.
+	for i, j := 0, len(files)-1; i < j; i, j = i+1, j-1 {
+		files[i], files[j] = files[j], files[i]
+	}
+	frags, err := convertFiles(files, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, frag := range frags {
+		name := "Image_" + strings.TrimSuffix(filepath.Base(files[i]), ".svg")
+		if !strings.HasPrefix(string(frag), "var "+name+" struct") {
+			t.Errorf("fragment %d doesn't declare %s:\n%s", i, name, frag)
+		}
+	}
+}
+
+func TestConvertError(t *testing.T) {
+	dir := t.TempDir()
+	files := writeTestSVGs(t, dir, 4)
+	bad := filepath.Join(dir, "bad.svg")
+	if err := os.WriteFile(bad, []byte(`<svg xmlns="http://www.w3.org/2000/svg"><text/></svg>`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := convertFiles(append(files, bad), 1); err == nil || !strings.Contains(err.Error(), "bad.svg") {
+		t.Errorf("got error %v, expected a bad.svg error", err)
+	}
+}
+
+func BenchmarkConvertAll(b *testing.B) {
+	files := writeTestSVGs(b, b.TempDir(), 200)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := convertFiles(files, 1); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestStableOutput(t *testing.T) {
+	files := writeTestSVGs(t, t.TempDir(), 5)
+	var outputs []string
+	for _, order := range [][]string{files, files, {files[3], files[0], files[4], files[2], files[1]}} {
+		w := new(bytes.Buffer)
+		if err := Convert(w, "icons", order); err != nil {
+			t.Fatal(err)
+		}
+		outputs = append(outputs, w.String())
+	}
+	for i := 1; i < len(outputs); i++ {
+		if outputs[i] != outputs[0] {
+			t.Errorf("output %d differs from the first output:\n%s", i, outputs[i])
+		}
+	}
+	const imports = `import (
+	"image/color"
+	"math"
+
+	"gioui.org/f32"
+	"gioui.org/op"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+)`
+	if !strings.Contains(outputs[0], imports) {
+		t.Errorf("output doesn't contain the grouped imports:\n%s", outputs[0])
+	}
+}
+
+func TestCompile(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping compilation in short mode")
+	}
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip(err)
+	}
+	dir := t.TempDir()
+	files := writeTestSVGs(t, dir, 3)
+	w := new(bytes.Buffer)
+	if err := Convert(w, "icons", files); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteRegistry(w, files); err != nil {
+		t.Fatal(err)
+	}
+	single := new(bytes.Buffer)
+	const features = `<svg xmlns="http://www.w3.org/2000/svg">
+	<defs>
+		<clipPath id="round"><circle cx="12" cy="12" r="10"/></clipPath>
+		<symbol id="line" viewBox="0 0 10 10"><polyline fill="#ff0000" stroke="#0000ff" points="0,0 10,0 10,10"/></symbol>
+	</defs>
+	<radialGradient id="glow" fx="0.25"><stop offset="0" stop-color="#ffffff"/><stop offset="1" stop-color="#0000ff" stop-opacity="0.5"/></radialGradient>
+	<ellipse fill="url(#glow)" cx="12" cy="12" rx="8" ry="4"/>
+	<g clip-path="url(#round)">
+		<use href="#line" x="2" y="2" width="20" height="20"/>
+	</g>
+</svg>`
+	if err := ConvertReader(single, "icon", "single", strings.NewReader(features)); err != nil {
+		t.Fatal(err)
+	}
+	for name, src := range map[string][]byte{"icons.go": w.Bytes(), "single.go": single.Bytes()} {
+		file := filepath.Join(dir, name)
+		if err := os.WriteFile(file, src, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if out, err := exec.Command(goBin, "build", "-o", os.DevNull, file).CombinedOutput(); err != nil {
+			t.Errorf("%s: %v\n%s\n%s", name, err, out, src)
+		}
+	}
+}
+
+func TestConvertReaderError(t *testing.T) {
+	t.Parallel()
+	r := strings.NewReader("<svg xmlns=\"http://www.w3.org/2000/svg\">\n<text/></svg>")
+	err := ConvertReader(new(bytes.Buffer), "icons", "bad", r)
+	if err == nil || !strings.HasPrefix(err.Error(), "2:") {
+		t.Errorf("got error %v, expected an error on line 2", err)
+	}
+}
+
+func TestPolylineClosing(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		elem string
+		want []string
+	}{
+		{
+			elem: `<polyline fill="#ff0000" stroke="#0000ff" points="0,0 10,0 10,10"/>`,
+			want: []string{
+				"p.Begin(&ops)",
+				"p.MoveTo(f32.Pt(0, 0))",
+				"p.LineTo(f32.Pt(10, 0))",
+				"p.LineTo(f32.Pt(10, 10))",
+				"p.LineTo(f32.Pt(0, 0))",
+				"spec := p.End()",
+				"paint.FillShape(&ops, argb(0xffff0000), clip.Outline{Path: spec}.Op())",
+				"p.Begin(&ops)",
+				"p.MoveTo(f32.Pt(0, 0))",
+				"p.LineTo(f32.Pt(10, 0))",
+				"p.LineTo(f32.Pt(10, 10))",
+				"spec = p.End()",
+				"paint.FillShape(&ops, argb(0xff0000ff), clip.Stroke{Width: 0, Path: spec}.Op())",
+			},
+		},
+		{
+			elem: `<polygon fill="#ff0000" stroke="#0000ff" points="0,0 10,0 10,10"/>`,
+			want: []string{
+				"p.Begin(&ops)",
+				"p.MoveTo(f32.Pt(0, 0))",
+				"p.LineTo(f32.Pt(10, 0))",
+				"p.LineTo(f32.Pt(10, 10))",
+				"p.LineTo(f32.Pt(0, 0))",
+				"spec := p.End()",
+				"paint.FillShape(&ops, argb(0xffff0000), clip.Outline{Path: spec}.Op())",
+				"paint.FillShape(&ops, argb(0xff0000ff), clip.Stroke{Width: 0, Path: spec}.Op())",
+			},
+		},
+	}
+	for _, test := range tests {
+		w := new(bytes.Buffer)
+		r := strings.NewReader(`<svg xmlns="http://www.w3.org/2000/svg">` + test.elem + `</svg>`)
+		if err := convert(w, "Image_poly", r, 1); err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, line := range strings.Split(w.String(), "\n") {
+			if strings.HasPrefix(line, "p.") || strings.HasPrefix(line, "spec") || strings.HasPrefix(line, "paint.") {
+				got = append(got, line)
+			}
+		}
+		if strings.Join(got, "\n") != strings.Join(test.want, "\n") {
+			t.Errorf("%s: got commands\n%s\nexpected\n%s", test.elem, strings.Join(got, "\n"), strings.Join(test.want, "\n"))
+		}
+	}
+}
+
+func TestSymbolUse(t *testing.T) {
+	t.Parallel()
+	const src = `<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink">
+	<defs>
+		<symbol id="outer" viewBox="0 0 10 10">
+			<symbol id="square" viewBox="5 5 10 10">
+				<rect fill="#ff0000" x="5" y="5" width="10" height="10"/>
+			</symbol>
+			<use href="#square" x="1" y="2"/>
+		</symbol>
+	</defs>
+	<use xlink:href="#outer" x="20" y="30" width="20" height="40"/>
+</svg>`
+	w := new(bytes.Buffer)
+	if err := convert(w, "Image_symbol", strings.NewReader(src), 1); err != nil {
+		t.Fatal(err)
+	}
+	// The outer symbol is scaled by 2 to fit the width and centered
+	// vertically in the height of the use element.
+	const want = `{
+t := op.Affine(f32.NewAffine2D(2, 0, 20, 0, 2, 40)).Push(&ops)
+{
+t := op.Affine(f32.NewAffine2D(1, 0, -4, 0, 1, -3)).Push(&ops)
+{
+var p clip.Path
+p.Begin(&ops)
+rect(&p, f32.Pt(5, 5), f32.Pt(10, 10))
+`
+	if !strings.Contains(w.String(), want) {
+		t.Errorf("symbol isn't drawn at the use offset:\n%s", w)
+	}
+	if n := strings.Count(w.String(), "rect(&p"); n != 1 {
+		t.Errorf("got %d rectangles, expected only the used one", n)
+	}
+}
+
+func TestClipPath(t *testing.T) {
+	t.Parallel()
+	const src = `<svg xmlns="http://www.w3.org/2000/svg">
+	<defs>
+		<clipPath id="round" clipPathUnits="userSpaceOnUse">
+			<circle cx="12" cy="12" r="10"/>
+		</clipPath>
+	</defs>
+	<rect fill="#ff0000" x="0" y="0" width="24" height="24" clip-path="url(#round)"/>
+</svg>`
+	w := new(bytes.Buffer)
+	if err := convert(w, "Image_clip", strings.NewReader(src), 1); err != nil {
+		t.Fatal(err)
+	}
+	const want = `{
+var p clip.Path
+p.Begin(&ops)
+ellipse(&p, f32.Pt(12, 12), f32.Pt(10, 10))
+c := clip.Outline{Path: p.End()}.Op().Push(&ops)
+p.Begin(&ops)
+rect(&p, f32.Pt(0, 0), f32.Pt(24, 24))
+spec := p.End()
+paint.FillShape(&ops, argb(0xffff0000), clip.Outline{Path: spec}.Op())
+c.Pop()
+}
+`
+	if !strings.Contains(w.String(), want) {
+		t.Errorf("fill isn't clipped by the clip path:\n%s", w)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	files := writeTestSVGs(t, t.TempDir(), 3)
+	w := new(bytes.Buffer)
+	if err := WriteRegistry(w, []string{files[2], files[0], files[1]}); err != nil {
+		t.Fatal(err)
+	}
+	const want = `{
+	"icon0": &Image_icon0,
+	"icon1": &Image_icon1,
+	"icon2": &Image_icon2,
+}`
+	if !strings.Contains(w.String(), want) {
+		t.Errorf("registry doesn't map the file names to the images:\n%s", w)
+	}
+}
+
+func TestNonScalingStroke(t *testing.T) {
+	t.Parallel()
+	const src = `<svg xmlns="http://www.w3.org/2000/svg">
+	<g transform="matrix(4 0 0 4 0 0)">
+		<line stroke="#000000" stroke-width="2" x1="0" y1="0" x2="10" y2="10" vector-effect="non-scaling-stroke"/>
+		<line stroke="#000000" stroke-width="2" x1="0" y1="0" x2="10" y2="10"/>
+	</g>
+</svg>`
+	w := new(bytes.Buffer)
+	if err := convert(w, "Image_stroke", strings.NewReader(src), 1); err != nil {
+		t.Fatal(err)
+	}
+	out := w.String()
+	if !strings.Contains(out, "t := op.Affine(f32.NewAffine2D(4, 0, 0, 0, 4, 0)).Push(&ops)") {
+		t.Errorf("group isn't scaled:\n%s", out)
+	}
+	// The non-scaling stroke is 2 wide after the scaling by 4.
+	if !strings.Contains(out, "clip.Stroke{Width: 0.5, Path: spec}") {
+		t.Errorf("non-scaling stroke width is scaled:\n%s", out)
+	}
+	if !strings.Contains(out, "clip.Stroke{Width: 2, Path: spec}") {
+		t.Errorf("regular stroke width isn't scaled:\n%s", out)
+	}
+}
+
+func TestRadialGradient(t *testing.T) {
+	t.Parallel()
+	const src = `<svg xmlns="http://www.w3.org/2000/svg">
+	<defs>
+		<radialGradient id="glow">
+			<stop offset="0" stop-color="#ffffff"/>
+			<stop offset="1" stop-color="#0000ff"/>
+		</radialGradient>
+	</defs>
+	<circle fill="url(#glow)" cx="12" cy="12" r="10"/>
+</svg>`
+	w := new(bytes.Buffer)
+	if err := convert(w, "Image_gradient", strings.NewReader(src), 1); err != nil {
+		t.Fatal(err)
+	}
+	// The gradient is centered in the bounding box of the circle.
+	const want = `spec := p.End()
+g := clip.Outline{Path: spec}.Op().Push(&ops)
+radialGradient(f32.Pt(12, 12), f32.Pt(12, 12), f32.Pt(10, 10), 0xffffffff, 0xff0000ff, 0, 1)
+g.Pop()
+`
+	if !strings.Contains(w.String(), want) {
+		t.Errorf("circle isn't filled with the gradient:\n%s", w)
+	}
+}
+
+func TestTitleComment(t *testing.T) {
+	t.Parallel()
+	const src = `<svg xmlns="http://www.w3.org/2000/svg">
+	<title>Home</title>
+	<desc>A house with
+		a chimney.</desc>
+	<rect fill="#ff0000" width="10" height="10"><title>Wall</title></rect>
+</svg>`
+	w := new(bytes.Buffer)
+	if err := ConvertReader(w, "icons", "home", strings.NewReader(src)); err != nil {
+		t.Fatal(err)
+	}
+	const want = `
+// Home
+//
+// A house with a chimney.
+var Image_home struct {
+`
+	if !strings.Contains(w.String(), want) {
+		t.Errorf("title and description aren't documented:\n%s", w)
+	}
+	if strings.Contains(w.String(), "Wall") {
+		t.Errorf("shape title is included:\n%s", w)
+	}
+}
+
+func TestWriteImageImports(t *testing.T) {
+	t.Parallel()
+	const src = `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 24 24">
+	<title>Drawn without paint.Fill or clip.Path</title>
+</svg>`
+	w := new(bytes.Buffer)
+	if err := WriteImage(w, "icons", "empty", strings.NewReader(src)); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"gioui.org/op/clip", "gioui.org/op/paint"} {
+		if strings.Contains(w.String(), `"`+path+`"`) {
+			t.Errorf("unused package %s is imported:\n%s", path, w)
+		}
+	}
+}
+
+func TestScale(t *testing.T) {
+	t.Parallel()
+	const src = `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 24 24">
+	<path fill="#ff0000" d="M 2 2 L 22 2 l -10 18 Z"/>
+	<rect stroke="#0000ff" stroke-width="1.5" x="1" y="2" width="3" height="4" transform="matrix(1 0 0 1 5 6)"/>
+	<circle stroke="#0000ff" stroke-width="1" cx="12" cy="12" r="5" vector-effect="non-scaling-stroke"/>
+</svg>`
+	c := &Converter{Scale: 2}
+	w := new(bytes.Buffer)
+	if err := c.ConvertReader(w, "icons", "scaled", strings.NewReader(src)); err != nil {
+		t.Fatal(err)
+	}
+	out := w.String()
+	for _, want := range []string{
+		"Image_scaled.ViewBox.Max = f32.Pt(48, 48)",
+		"p.MoveTo(f32.Pt(4, 4))",
+		"p.LineTo(f32.Pt(44, 4))",
+		"p.LineTo(f32.Pt(24, 40))",
+		"f32.NewAffine2D(1, 0, 10, 0, 1, 12)",
+		"rect(&p, f32.Pt(2, 4), f32.Pt(6, 8))",
+		"clip.Stroke{Width: 3, Path: spec}",
+		"ellipse(&p, f32.Pt(24, 24), f32.Pt(10, 10))",
+		// Non-scaling strokes aren't scaled.
+		"clip.Stroke{Width: 1, Path: spec}",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("scaled output doesn't contain %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestProlog(t *testing.T) {
+	t.Parallel()
+	const prolog = `<?xml version="1.0" encoding="UTF-8"?>
+<!-- Generator: an editor -->
+<!DOCTYPE svg PUBLIC "-//W3C//DTD SVG 1.1//EN" "http://www.w3.org/Graphics/SVG/1.1/DTD/svg11.dtd">
+`
+	src := prolog + fmt.Sprintf(testSVG, 1)
+	if err := convert(new(bytes.Buffer), "Image_prolog", strings.NewReader(src), 1); err != nil {
+		t.Fatal(err)
+	}
+	err := convert(new(bytes.Buffer), "Image_prolog", strings.NewReader(prolog+"  <html/>"), 1)
+	if err == nil || err.Error() != "4:3: invalid SVG root: <html>" {
+		t.Errorf("got error %v, expected an invalid root error at 4:3", err)
+	}
+}